@@ -16,6 +16,7 @@ import (
 	"github.com/acquia/fn-drupal-operator/pkg/apis"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/controller"
+	"github.com/acquia/fn-drupal-operator/pkg/protection"
 	"github.com/acquia/fn-drupal-operator/version"
 
 	rolloutsv1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
@@ -132,6 +133,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup the deletion protection webhook, which is shared by all kinds
+	if err := protection.AddToManager(mgr); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
 	// Log if Istio is enabled
 	if common.IsIstioEnabled() {
 		log.Info("Istio is Enabled")
@@ -0,0 +1,85 @@
+// The migrate command migrates all the custom resources stored in a cluster to the latest version of their spec, and
+// reports what changed. See the "Spec Migrations" section of the README.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/acquia/fn-drupal-operator/pkg/apis"
+	"github.com/acquia/fn-drupal-operator/pkg/migration"
+)
+
+func main() {
+	dryRun := pflag.Bool("dry-run", false, "Report the migrations without updating the objects")
+	verbose := pflag.Bool("verbose", false, "Log the client's output to stderr")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\nMigrates the custom resources of all namespaces of the current cluster to the latest version of their spec.\n\n", os.Args[0])
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	if *verbose {
+		logf.SetLogger(zap.Logger(true))
+	}
+
+	failed, err := run(*dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// run migrates the objects and prints what changed. It returns whether any of the objects failed to update.
+func run(dryRun bool) (failed bool, err error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return false, err
+	}
+	s := runtime.NewScheme()
+	if err := apis.AddToScheme(s); err != nil {
+		return false, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		return false, err
+	}
+	// The migrations are printed rather than recorded as Events, which would be sent asynchronously and could be lost
+	// as the command exits
+	results, err := migration.MigrateAll(context.TODO(), c, nil, dryRun)
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+			fmt.Printf("%v: failed: %v\n", result, result.Err)
+			continue
+		}
+		fmt.Printf("%v: migrated from version %q to %q\n", result, result.Report.From, result.Report.To)
+		for _, step := range result.Report.Steps {
+			fmt.Printf("  - %v\n", step)
+		}
+		for _, warning := range result.Report.Warnings {
+			fmt.Printf("  Warning: %v\n", warning)
+		}
+		fmt.Printf("  Patch: %s\n", result.Patch)
+	}
+	if err == nil && len(results) == 0 {
+		fmt.Println("All objects are up to date")
+	}
+	if err == nil && dryRun && len(results) > 0 {
+		fmt.Println("Dry run: no objects were updated")
+	}
+	return failed, err
+}
@@ -0,0 +1,102 @@
+// The render command prints the resources that the operator would create for a set of custom resources, without
+// deploying them. See the "Rendering Manifests Offline" section of the README.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/acquia/fn-drupal-operator/pkg/render"
+)
+
+func main() {
+	liveFile := pflag.String("diff", "", "Diff the rendered resources against a live cluster export in this file, such as the output of \"kubectl get -o yaml\", instead of printing them")
+	namespace := pflag.StringP("namespace", "n", "default", "Namespace of the custom resources that don't set one")
+	verbose := pflag.Bool("verbose", false, "Log the controllers' output to stderr")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] FILE...\n\nRenders the resources the operator creates for the custom resources in the given YAML files (\"-\" for stdin).\n\n", os.Args[0])
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	if pflag.NArg() == 0 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+	if *verbose {
+		logf.SetLogger(zap.Logger(true))
+	}
+
+	differs, err := run(pflag.Args(), *namespace, *liveFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if differs {
+		os.Exit(1)
+	}
+}
+
+// run renders the custom resources in the given files, and prints them or diffs them against a live export. It
+// returns whether the diff found differences.
+func run(files []string, namespace, liveFile string) (differs bool, err error) {
+	s, err := render.Scheme()
+	if err != nil {
+		return false, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, file := range files {
+		decoded, err := decodeFile(file)
+		if err != nil {
+			return false, err
+		}
+		objs = append(objs, decoded...)
+	}
+	render.Default(objs, namespace)
+	typed, err := render.Typed(s, objs)
+	if err != nil {
+		return false, err
+	}
+
+	rendered, warnings, err := render.Render(s, typed)
+	if err != nil {
+		return false, err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+
+	if liveFile == "" {
+		return false, render.ToYAML(os.Stdout, rendered)
+	}
+	live, err := decodeFile(liveFile)
+	if err != nil {
+		return false, err
+	}
+	return render.Diff(os.Stdout, rendered, live)
+}
+
+func decodeFile(file string) ([]*unstructured.Unstructured, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	objs, err := render.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	return objs, nil
+}
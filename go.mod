@@ -9,13 +9,16 @@ require (
 	github.com/acquia/fn-ssh-proxy v0.4.0
 	github.com/argoproj/argo-rollouts v0.5.0
 	github.com/aws/aws-sdk-go v1.31.3
+	github.com/evanphx/json-patch v4.5.0+incompatible
 	github.com/go-logr/logr v0.1.0
 	github.com/go-openapi/spec v0.19.8
 	github.com/go-sql-driver/mysql v1.5.0
-	github.com/go-test/deep v1.0.6
 	github.com/google/go-cmp v0.4.1
 	github.com/google/uuid v1.1.1
 	github.com/operator-framework/operator-sdk v0.15.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v1.2.1
+	github.com/robfig/cron v1.1.0
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.5.1
@@ -27,8 +30,9 @@ require (
 	k8s.io/apimachinery v0.17.4
 	k8s.io/client-go v12.0.0+incompatible
 	k8s.io/kube-openapi v0.0.0-20190918143330-0270cf2f1c1d
-	k8s.io/utils v0.0.0-20200414100711-2df71ebbae66 // indirect
+	k8s.io/utils v0.0.0-20200414100711-2df71ebbae66
 	sigs.k8s.io/controller-runtime v0.4.0
+	sigs.k8s.io/yaml v1.1.0
 )
 
 // Pinned to kubernetes-1.16.2
@@ -1,10 +1,21 @@
 package v1alpha1
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron"
 	v1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 // Important: Run "operator-sdk generate k8s && operator-sdk generate crds" to regenerate code after modifying this file
@@ -103,3 +114,202 @@ type CommandList struct {
 func init() {
 	SchemeBuilder.Register(&Command{}, &CommandList{})
 }
+
+const (
+	// DefaultCommandActiveDeadlineSeconds is how long a Command's Job has to complete before it's killed, by default
+	DefaultCommandActiveDeadlineSeconds int64 = 3600
+	// DefaultCommandRestartPolicy is the restart policy of a Command's Pods, by default
+	DefaultCommandRestartPolicy = corev1.RestartPolicyNever
+	// DefaultCommandConcurrencyPolicy is the concurrency policy of a scheduled Command's CronJob, by default
+	DefaultCommandConcurrencyPolicy = batchv1beta1.ForbidConcurrent
+)
+
+// commandTargetKinds are the kinds of resources that a Command's TargetRef may refer to
+var commandTargetKinds = []string{"Site", "DrupalEnvironment"}
+
+var _ webhook.Validator = &Command{}
+var _ webhook.Defaulter = &Command{}
+
+func (c *Command) ValidateCreate() error {
+	log := logf.Log.WithName("commandvalidator").WithValues("operation", "create")
+	return validateCommand(log, c, nil)
+}
+
+func (c *Command) ValidateUpdate(old runtime.Object) error {
+	log := logf.Log.WithName("commandvalidator").WithValues("operation", "update")
+	oldc, ok := old.(*Command)
+	if !ok {
+		return fmt.Errorf("invalid old object passed.")
+	}
+	return validateCommand(log, c, oldc)
+}
+
+func (c *Command) ValidateDelete() error {
+	log := logf.Log.WithName("commandvalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(c); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// validateCommand validates a created (if old is nil) or updated Command
+func validateCommand(log logr.Logger, c *Command, old protectable) error {
+	if err := c.Spec.Validate(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := ValidateDeletionProtection(c, old); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Default sets the settings that the Command Controller would otherwise default, so that the stored Command shows the
+// effective values
+func (c *Command) Default() {
+	if c.Spec.RestartPolicy == "" {
+		c.Spec.RestartPolicy = DefaultCommandRestartPolicy
+	}
+	if c.Spec.ActiveDeadlineSeconds == nil {
+		deadline := DefaultCommandActiveDeadlineSeconds
+		c.Spec.ActiveDeadlineSeconds = &deadline
+	}
+	if c.Spec.Schedule != "" && c.Spec.ConcurrencyPolicy == "" {
+		c.Spec.ConcurrencyPolicy = DefaultCommandConcurrencyPolicy
+	}
+}
+
+// Validate checks the settings of the spec
+func (s *CommandSpec) Validate() error {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+
+	errs = append(errs, s.TargetRef.validate(path.Child("targetRef"))...)
+
+	if len(s.Command) == 0 {
+		errs = append(errs, field.Required(path.Child("command"), ""))
+	}
+	if s.Retries < 0 {
+		errs = append(errs, field.Invalid(path.Child("retries"), s.Retries, "must not be negative"))
+	}
+	switch s.RestartPolicy {
+	case "", corev1.RestartPolicyNever, corev1.RestartPolicyOnFailure:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("restartPolicy"), string(s.RestartPolicy), []string{string(corev1.RestartPolicyNever), string(corev1.RestartPolicyOnFailure)}))
+	}
+
+	if s.Schedule != "" {
+		// CronJobs parse their schedule the same way
+		if _, err := cron.ParseStandard(s.Schedule); err != nil {
+			errs = append(errs, field.Invalid(path.Child("schedule"), s.Schedule, err.Error()))
+		}
+	}
+	switch s.ConcurrencyPolicy {
+	case "", batchv1beta1.AllowConcurrent, batchv1beta1.ForbidConcurrent, batchv1beta1.ReplaceConcurrent:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("concurrencyPolicy"), string(s.ConcurrencyPolicy), []string{string(batchv1beta1.AllowConcurrent), string(batchv1beta1.ForbidConcurrent), string(batchv1beta1.ReplaceConcurrent)}))
+	}
+
+	if s.Resources != nil {
+		errs = append(errs, validateResourceRequirements(s.Resources, path.Child("resources"))...)
+	}
+	if s.ActiveDeadlineSeconds != nil && *s.ActiveDeadlineSeconds <= 0 {
+		errs = append(errs, field.Invalid(path.Child("activeDeadlineSeconds"), *s.ActiveDeadlineSeconds, "must be positive"))
+	}
+	if s.TerminationGracePeriodSeconds != nil && *s.TerminationGracePeriodSeconds < 0 {
+		errs = append(errs, field.Invalid(path.Child("terminationGracePeriodSeconds"), *s.TerminationGracePeriodSeconds, "must not be negative"))
+	}
+
+	errs = append(errs, s.validateVolumes(path, nil)...)
+	return errs.ToAggregate()
+}
+
+// ValidateTargetVolumes checks the additional volumes against the volumes of the target's Pods, which the Command's
+// Pods get as well. The webhooks can't look the target up, so its controller checks this.
+func (s *CommandSpec) ValidateTargetVolumes(targetVolumes []corev1.Volume) error {
+	return s.validateVolumes(field.NewPath("spec"), targetVolumes).ToAggregate()
+}
+
+// validate checks that the TargetRef refers to a kind of resource that Commands can run against
+func (r TargetRef) validate(path *field.Path) (errs field.ErrorList) {
+	gv, err := schema.ParseGroupVersion(r.APIVersion)
+	switch {
+	case err != nil:
+		errs = append(errs, field.Invalid(path.Child("apiVersion"), r.APIVersion, err.Error()))
+	case gv != SchemeGroupVersion:
+		errs = append(errs, field.NotSupported(path.Child("apiVersion"), r.APIVersion, []string{SchemeGroupVersion.String()}))
+	}
+
+	supported := false
+	for _, kind := range commandTargetKinds {
+		supported = supported || r.Kind == kind
+	}
+	if !supported {
+		errs = append(errs, field.NotSupported(path.Child("kind"), r.Kind, commandTargetKinds))
+	}
+
+	if r.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	return
+}
+
+// validateResourceRequirements checks that no resource's request exceeds its limit
+func validateResourceRequirements(resources *corev1.ResourceRequirements, path *field.Path) (errs field.ErrorList) {
+	for name, quantity := range resources.Requests {
+		if quantity.Sign() < 0 {
+			errs = append(errs, field.Invalid(path.Child("requests").Key(string(name)), quantity.String(), "must not be negative"))
+		}
+		if limit, ok := resources.Limits[name]; ok && quantity.Cmp(limit) > 0 {
+			errs = append(errs, field.Invalid(path.Child("requests").Key(string(name)), quantity.String(), fmt.Sprintf("must not be greater than the limit (%s)", limit.String())))
+		}
+	}
+	for name, quantity := range resources.Limits {
+		if quantity.Sign() < 0 {
+			errs = append(errs, field.Invalid(path.Child("limits").Key(string(name)), quantity.String(), "must not be negative"))
+		}
+	}
+	return
+}
+
+// validateVolumes checks that the additional volumes have valid names, unique among themselves and the given volumes of
+// the target, and that the additional volume mounts don't share a path. Mounts may refer to the target's volumes as well
+// as the additional ones.
+func (s *CommandSpec) validateVolumes(path *field.Path, targetVolumes []corev1.Volume) (errs field.ErrorList) {
+	targets := make(map[string]bool, len(targetVolumes))
+	for _, v := range targetVolumes {
+		targets[v.Name] = true
+	}
+	volumes := make(map[string]bool, len(s.AdditionalVolumes))
+	for i, v := range s.AdditionalVolumes {
+		namePath := path.Child("additionalVolumes").Index(i).Child("name")
+		for _, problem := range validation.IsDNS1123Label(v.Name) {
+			errs = append(errs, field.Invalid(namePath, v.Name, problem))
+		}
+		if volumes[v.Name] {
+			errs = append(errs, field.Duplicate(namePath, v.Name))
+		}
+		if targets[v.Name] {
+			errs = append(errs, field.Invalid(namePath, v.Name, "the target's Pods already have a volume with this name"))
+		}
+		volumes[v.Name] = true
+	}
+
+	mountPaths := make(map[string]bool, len(s.AdditionalVolumeMounts))
+	for i, m := range s.AdditionalVolumeMounts {
+		mountPath := path.Child("additionalVolumeMounts").Index(i)
+		if m.Name == "" {
+			errs = append(errs, field.Required(mountPath.Child("name"), ""))
+		}
+		if !strings.HasPrefix(m.MountPath, "/") {
+			errs = append(errs, field.Invalid(mountPath.Child("mountPath"), m.MountPath, "must be an absolute path"))
+		}
+		if mountPaths[m.MountPath] {
+			errs = append(errs, field.Duplicate(mountPath.Child("mountPath"), m.MountPath))
+		}
+		mountPaths[m.MountPath] = true
+	}
+	return
+}
@@ -0,0 +1,226 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestCommandSpec_Validate(t *testing.T) {
+	negative := int64(-1)
+
+	tests := []struct {
+		name   string
+		modify func(*CommandSpec)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(*CommandSpec) {},
+		},
+		{
+			name:   "empty command",
+			modify: func(s *CommandSpec) { s.Command = nil },
+			err:    "spec.command: Required value",
+		},
+		{
+			name:   "unsupported targetRef kind",
+			modify: func(s *CommandSpec) { s.TargetRef.Kind = "Database" },
+			err:    `spec.targetRef.kind: Unsupported value: "Database": supported values: "Site", "DrupalEnvironment"`,
+		},
+		{
+			name:   "unsupported targetRef version",
+			modify: func(s *CommandSpec) { s.TargetRef.APIVersion = "fnresources.acquia.io/v2" },
+			err:    `spec.targetRef.apiVersion: Unsupported value: "fnresources.acquia.io/v2": supported values: "fnresources.acquia.io/v1alpha1"`,
+		},
+		{
+			name:   "missing targetRef name",
+			modify: func(s *CommandSpec) { s.TargetRef.Name = "" },
+			err:    "spec.targetRef.name: Required value",
+		},
+		{
+			name:   "restart policy unsupported by Jobs",
+			modify: func(s *CommandSpec) { s.RestartPolicy = corev1.RestartPolicyAlways },
+			err:    `spec.restartPolicy: Unsupported value: "Always": supported values: "Never", "OnFailure"`,
+		},
+		{
+			name:   "schedule",
+			modify: func(s *CommandSpec) { s.Schedule = "*/15 * * * *" },
+		},
+		{
+			name:   "schedule with too few fields",
+			modify: func(s *CommandSpec) { s.Schedule = "0 3 * *" },
+			err:    `spec.schedule: Invalid value: "0 3 * *": Expected exactly 5 fields, found 4`,
+		},
+		{
+			name:   "schedule with an out of range value",
+			modify: func(s *CommandSpec) { s.Schedule = "0 24 * * *" },
+			err:    `spec.schedule: Invalid value: "0 24 * * *": End of range (24) above maximum (23)`,
+		},
+		{
+			name:   "schedule with an invalid step",
+			modify: func(s *CommandSpec) { s.Schedule = "*/0 * * * *" },
+			err:    `spec.schedule: Invalid value: "*/0 * * * *": Step of range should be a positive number`,
+		},
+		{
+			name:   "unknown predefined schedule",
+			modify: func(s *CommandSpec) { s.Schedule = "@fortnightly" },
+			err:    `spec.schedule: Invalid value: "@fortnightly": Unrecognized descriptor`,
+		},
+		{
+			name:   "unknown concurrency policy",
+			modify: func(s *CommandSpec) { s.ConcurrencyPolicy = "Queue" },
+			err:    `spec.concurrencyPolicy: Unsupported value: "Queue": supported values: "Allow", "Forbid", "Replace"`,
+		},
+		{
+			name: "request exceeding its limit",
+			modify: func(s *CommandSpec) {
+				s.Resources = &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				}
+			},
+			err: `spec.resources.requests[memory]: Invalid value: "1Gi": must not be greater than the limit (512Mi)`,
+		},
+		{
+			name:   "negative active deadline",
+			modify: func(s *CommandSpec) { s.ActiveDeadlineSeconds = &negative },
+			err:    "spec.activeDeadlineSeconds: Invalid value: -1: must be positive",
+		},
+		{
+			name: "duplicate volume names",
+			modify: func(s *CommandSpec) {
+				s.AdditionalVolumes = append(s.AdditionalVolumes, corev1.Volume{Name: "temporary"})
+			},
+			err: `spec.additionalVolumes[1].name: Duplicate value: "temporary"`,
+		},
+		{
+			name: "invalid volume name",
+			modify: func(s *CommandSpec) {
+				s.AdditionalVolumes[0].Name = "Temporary"
+				s.AdditionalVolumeMounts[0].Name = "Temporary"
+			},
+			err: `spec.additionalVolumes[0].name: Invalid value: "Temporary": a DNS-1123 label must consist of lower case alphanumeric characters`,
+		},
+		{
+			name: "duplicate mount paths",
+			modify: func(s *CommandSpec) {
+				s.AdditionalVolumeMounts = append(s.AdditionalVolumeMounts, corev1.VolumeMount{Name: "shared-files", MountPath: "/temporary"})
+			},
+			err: `spec.additionalVolumeMounts[1].mountPath: Duplicate value: "/temporary"`,
+		},
+		{
+			name: "relative mount path",
+			modify: func(s *CommandSpec) {
+				s.AdditionalVolumeMounts[0].MountPath = "temporary"
+			},
+			err: `spec.additionalVolumeMounts[0].mountPath: Invalid value: "temporary": must be an absolute path`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := CommandSpec{
+				TargetRef: TargetRef{
+					APIVersion: SchemeGroupVersion.String(),
+					Kind:       "Site",
+					Name:       "wlgore-site",
+				},
+				Command:                []string{"drush", "cron"},
+				AdditionalVolumes:      []corev1.Volume{{Name: "temporary"}},
+				AdditionalVolumeMounts: []corev1.VolumeMount{{Name: "temporary", MountPath: "/temporary"}},
+			}
+			test.modify(&spec)
+
+			cmd := &Command{Spec: spec}
+			if test.err == "" {
+				require.NoError(t, cmd.ValidateCreate())
+			} else {
+				require.Error(t, cmd.ValidateCreate())
+				require.Contains(t, cmd.ValidateCreate().Error(), test.err)
+				require.Contains(t, cmd.ValidateUpdate(&Command{}).Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestCommandSpec_ValidateSchedule(t *testing.T) {
+	spec := CommandSpec{
+		TargetRef: TargetRef{APIVersion: SchemeGroupVersion.String(), Kind: "Site", Name: "wlgore-site"},
+		Command:   []string{"drush", "cron"},
+	}
+	for _, schedule := range []string{"*/15 * * * *", "0 3 * * mon-fri", "0 0 1,15 JAN-JUN ?", "5-55/10 * * * *", "@daily", "@every 1h30m"} {
+		spec.Schedule = schedule
+		require.NoError(t, spec.Validate(), schedule)
+	}
+	for _, schedule := range []string{"* * * * * *", "60 * * * *", "0 0 0 * *", "0 0 * 13 *", "0 0 * * 7", "30-10 * * * *", "* * * foo *", "@every day"} {
+		spec.Schedule = schedule
+		require.Error(t, spec.Validate(), schedule)
+	}
+}
+
+func TestCommandSpec_ValidateTargetVolumes(t *testing.T) {
+	spec := CommandSpec{
+		AdditionalVolumes:      []corev1.Volume{{Name: "temporary"}, {Name: "shared-files"}},
+		AdditionalVolumeMounts: []corev1.VolumeMount{{Name: "temporary", MountPath: "/temporary"}},
+	}
+	require.NoError(t, spec.ValidateTargetVolumes([]corev1.Volume{{Name: "drupal-code"}}))
+	require.EqualError(t, spec.ValidateTargetVolumes([]corev1.Volume{{Name: "drupal-code"}, {Name: "shared-files"}}),
+		`spec.additionalVolumes[1].name: Invalid value: "shared-files": the target's Pods already have a volume with this name`)
+}
+
+func TestCommand_Default(t *testing.T) {
+	deadline := int64(60)
+	defaultDeadline := DefaultCommandActiveDeadlineSeconds
+
+	tests := []struct {
+		name     string
+		spec     CommandSpec
+		expected CommandSpec
+	}{
+		{
+			name: "Job",
+			spec: CommandSpec{},
+			expected: CommandSpec{
+				RestartPolicy:         corev1.RestartPolicyNever,
+				ActiveDeadlineSeconds: &defaultDeadline,
+			},
+		},
+		{
+			name: "CronJob",
+			spec: CommandSpec{Schedule: "@daily"},
+			expected: CommandSpec{
+				Schedule:              "@daily",
+				RestartPolicy:         corev1.RestartPolicyNever,
+				ConcurrencyPolicy:     batchv1beta1.ForbidConcurrent,
+				ActiveDeadlineSeconds: &defaultDeadline,
+			},
+		},
+		{
+			name: "settings already set",
+			spec: CommandSpec{
+				Schedule:              "@daily",
+				RestartPolicy:         corev1.RestartPolicyOnFailure,
+				ConcurrencyPolicy:     batchv1beta1.AllowConcurrent,
+				ActiveDeadlineSeconds: &deadline,
+			},
+			expected: CommandSpec{
+				Schedule:              "@daily",
+				RestartPolicy:         corev1.RestartPolicyOnFailure,
+				ConcurrencyPolicy:     batchv1beta1.AllowConcurrent,
+				ActiveDeadlineSeconds: &deadline,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := &Command{Spec: test.spec}
+			cmd.Default()
+			require.Equal(t, test.expected, cmd.Spec)
+		})
+	}
+}
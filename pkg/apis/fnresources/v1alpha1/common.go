@@ -11,6 +11,17 @@ const (
 	GitRefLabel        = LabelPrefix + "git-ref"
 	StageLabel         = LabelPrefix + "stage"
 	VersionLabel       = LabelPrefix + "version"
+	// ProvisionedLabel marks the namespaces and DrupalEnvironments that the operator provisioned for the DrupalApplication
+	// of their ApplicationIdLabel
+	ProvisionedLabel = LabelPrefix + "provisioned"
+	// ProductionLabel marks the Databases of production DrupalEnvironments, which are protected from deletion by default
+	ProductionLabel = LabelPrefix + "production"
 
 	ConfigHashAnnotation = LabelPrefix + "php-apache-config-hash"
+	// DriftPolicyAnnotation on a child resource chooses what happens to changes made to it outside of the operator:
+	// "revert" them, "report" them in the owner's Drifted condition, or "adopt" them
+	DriftPolicyAnnotation = LabelPrefix + "drift-policy"
+	// MaintenanceAnnotation puts a Site into maintenance, so that it responds with 503 Service Unavailable. Its value
+	// says what put the Site into maintenance, e.g. "databaserestore/<name>".
+	MaintenanceAnnotation = LabelPrefix + "maintenance"
 )
@@ -0,0 +1,66 @@
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is the type of a status Condition
+type ConditionType string
+
+// Condition describes one aspect of the observed state of a resource
+// +k8s:openapi-gen=true
+type Condition struct {
+	Type               ConditionType      `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime,omitempty"` // +optional
+	Reason             string             `json:"reason,omitempty"`             // +optional
+	Message            string             `json:"message,omitempty"`            // +optional
+}
+
+// FindCondition returns the Condition of the given type, or nil if there is none
+func FindCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the Condition of the same type. LastTransitionTime is only updated when the Status
+// changes.
+func SetCondition(conditions *[]Condition, c Condition) {
+	existing := FindCondition(*conditions, c.Type)
+	if existing == nil {
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		*conditions = append(*conditions, c)
+		return
+	}
+
+	if existing.Status != c.Status {
+		existing.Status = c.Status
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Reason = c.Reason
+	existing.Message = c.Message
+}
+
+// RemoveCondition removes the Condition of the given type, if present
+func RemoveCondition(conditions *[]Condition, t ConditionType) {
+	var kept []Condition
+	for _, c := range *conditions {
+		if c.Type != t {
+			kept = append(kept, c)
+		}
+	}
+	*conditions = kept
+}
+
+// IsConditionTrue returns true if the Condition of the given type is present with status "True"
+func IsConditionTrue(conditions []Condition, t ConditionType) bool {
+	c := FindCondition(conditions, t)
+	return c != nil && c.Status == v1.ConditionTrue
+}
@@ -0,0 +1,435 @@
+package v1alpha1
+
+import (
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1beta1"
+)
+
+// v1beta1 is the hub (and storage) version of DrupalEnvironment, Site and Database. The API server converts objects
+// between versions through the conversion webhook, which converts to and from the hub with the functions below.
+// Settings that v1beta1 can't express are kept in annotations, so that objects survive a round trip unchanged.
+
+const (
+	// ProductionAnnotation keeps the Production setting of a v1alpha1 DrupalEnvironment in v1beta1, which tells
+	// production environments by their stage, when the two disagree
+	ProductionAnnotation = LabelPrefix + "production"
+	// CertIssuerAnnotation keeps the CertIssuer setting of a v1alpha1 Site without TLS in v1beta1, where the issuer is
+	// part of the TLS settings
+	CertIssuerAnnotation = LabelPrefix + "cert-issuer"
+)
+
+var _ conversion.Convertible = &DrupalEnvironment{}
+var _ conversion.Convertible = &Site{}
+var _ conversion.Convertible = &Database{}
+
+// ConvertTo converts the DrupalEnvironment to v1beta1. The deprecated New Relic settings are converted to APM
+// settings, like the migration to version "3" does.
+func (e *DrupalEnvironment) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1beta1.DrupalEnvironment)
+	e.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = convertEnvironmentSpecTo(e.Spec)
+
+	if e.Spec.Production != dst.Spec.IsProduction() {
+		setAnnotation(&dst.ObjectMeta.Annotations, ProductionAnnotation, strconv.FormatBool(e.Spec.Production))
+	} else {
+		popAnnotation(&dst.ObjectMeta.Annotations, ProductionAnnotation)
+	}
+
+	dst.Status = v1beta1.DrupalEnvironmentStatus{
+		NumDrupal:        e.Status.NumDrupal,
+		Status:           v1beta1.DrupalEnvironmentStatusType(e.Status.Status),
+		Conditions:       convertConditionsTo(e.Status.Conditions),
+		AppliedResources: convertAppliedResourcesTo(e.Status.AppliedResources),
+	}
+	if e.Status.EffectiveSpec != nil {
+		spec := convertEnvironmentSpecTo(*e.Status.EffectiveSpec)
+		dst.Status.EffectiveSpec = &spec
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1beta1 DrupalEnvironment to this version
+func (e *DrupalEnvironment) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1beta1.DrupalEnvironment)
+	src.ObjectMeta.DeepCopyInto(&e.ObjectMeta)
+	e.Spec = convertEnvironmentSpecFrom(src.Spec)
+
+	if production, ok := popAnnotation(&e.ObjectMeta.Annotations, ProductionAnnotation); ok {
+		e.Spec.Production = production == "true"
+	}
+
+	e.Status = DrupalEnvironmentStatus{
+		NumDrupal:        src.Status.NumDrupal,
+		Status:           DrupalEnvironmentStatusType(src.Status.Status),
+		Conditions:       convertConditionsFrom(src.Status.Conditions),
+		AppliedResources: convertAppliedResourcesFrom(src.Status.AppliedResources),
+	}
+	if src.Status.EffectiveSpec != nil {
+		spec := convertEnvironmentSpecFrom(*src.Status.EffectiveSpec)
+		e.Status.EffectiveSpec = &spec
+	}
+	return nil
+}
+
+func convertEnvironmentSpecTo(in DrupalEnvironmentSpec) v1beta1.DrupalEnvironmentSpec {
+	in = *in.DeepCopy()
+	out := v1beta1.DrupalEnvironmentSpec{
+		Application:                in.Application,
+		GitRef:                     in.GitRef,
+		Stage:                      in.Stage,
+		CustomEnvironmentVariables: in.CustomEnvironmentVariables,
+		Template:                   in.Template,
+		Drupal: v1beta1.SpecDrupal{
+			Tag:                            in.Drupal.Tag,
+			PullPolicy:                     in.Drupal.PullPolicy,
+			MinReplicas:                    in.Drupal.MinReplicas,
+			MaxReplicas:                    in.Drupal.MaxReplicas,
+			TargetCPUUtilizationPercentage: in.Drupal.TargetCPUUtilizationPercentage,
+			Liveness:                       v1beta1.HTTPProbe(in.Drupal.Liveness),
+			Readiness:                      v1beta1.HTTPProbe(in.Drupal.Readiness),
+		},
+		Apache: v1beta1.SpecApache{
+			CustomImage: in.Apache.CustomImage,
+			Tag:         in.Apache.Tag,
+			WebRoot:     in.Apache.WebRoot,
+			Cpu:         v1beta1.Resources(in.Apache.Cpu),
+			Memory:      v1beta1.Resources(in.Apache.Memory),
+		},
+		Phpfpm: v1beta1.SpecPhpFpm{
+			CustomImage:                     in.Phpfpm.CustomImage,
+			Tag:                             in.Phpfpm.Tag,
+			Procs:                           in.Phpfpm.Procs,
+			MaxInputVars:                    in.Phpfpm.MaxInputVars,
+			MaxExecutionTime:                in.Phpfpm.MaxExecutionTime,
+			ProcMemoryLimitMiB:              in.Phpfpm.ProcMemoryLimitMiB,
+			PostMaxSizeMiB:                  in.Phpfpm.PostMaxSizeMiB,
+			OpcacheMemoryLimitMiB:           in.Phpfpm.OpcacheMemoryLimitMiB,
+			OpcacheInternedStringsBufferMiB: in.Phpfpm.OpcacheInternedStringsBufferMiB,
+			ApcMemoryLimitMiB:               in.Phpfpm.ApcMemoryLimitMiB,
+			Cpu:                             v1beta1.Resources(in.Phpfpm.Cpu),
+			Apm: v1beta1.SpecAPM{
+				Provider: v1beta1.APMProvider(in.Phpfpm.Apm.Provider),
+				Secret:   in.Phpfpm.Apm.Secret,
+				AppName:  in.Phpfpm.Apm.AppName,
+				Settings: in.Phpfpm.Apm.Settings,
+			},
+		},
+	}
+	if in.EFSID != "" {
+		out.Storage.EFS = &v1beta1.EFSStorage{FileSystemID: in.EFSID}
+	}
+	if in.Phpfpm.NewRelicSecret != "" && in.Phpfpm.Apm.Provider == "" {
+		out.Phpfpm.Apm = v1beta1.SpecAPM{
+			Provider: v1beta1.APMProvider(APMProviderNewRelic),
+			Secret:   in.Phpfpm.NewRelicSecret,
+			AppName:  in.Phpfpm.NewRelicAppName,
+		}
+	}
+	return out
+}
+
+func convertEnvironmentSpecFrom(in v1beta1.DrupalEnvironmentSpec) DrupalEnvironmentSpec {
+	in = *in.DeepCopy()
+	out := DrupalEnvironmentSpec{
+		Application:                in.Application,
+		Production:                 in.IsProduction(),
+		GitRef:                     in.GitRef,
+		Stage:                      in.Stage,
+		CustomEnvironmentVariables: in.CustomEnvironmentVariables,
+		Template:                   in.Template,
+		Drupal: SpecDrupal{
+			Tag:                            in.Drupal.Tag,
+			PullPolicy:                     in.Drupal.PullPolicy,
+			MinReplicas:                    in.Drupal.MinReplicas,
+			MaxReplicas:                    in.Drupal.MaxReplicas,
+			TargetCPUUtilizationPercentage: in.Drupal.TargetCPUUtilizationPercentage,
+			Liveness:                       HTTPProbe(in.Drupal.Liveness),
+			Readiness:                      HTTPProbe(in.Drupal.Readiness),
+		},
+		Apache: SpecApache{
+			CustomImage: in.Apache.CustomImage,
+			Tag:         in.Apache.Tag,
+			WebRoot:     in.Apache.WebRoot,
+			Cpu:         Resources(in.Apache.Cpu),
+			Memory:      Resources(in.Apache.Memory),
+		},
+		Phpfpm: SpecPhpFpm{
+			CustomImage:                     in.Phpfpm.CustomImage,
+			Tag:                             in.Phpfpm.Tag,
+			Procs:                           in.Phpfpm.Procs,
+			MaxInputVars:                    in.Phpfpm.MaxInputVars,
+			MaxExecutionTime:                in.Phpfpm.MaxExecutionTime,
+			ProcMemoryLimitMiB:              in.Phpfpm.ProcMemoryLimitMiB,
+			PostMaxSizeMiB:                  in.Phpfpm.PostMaxSizeMiB,
+			OpcacheMemoryLimitMiB:           in.Phpfpm.OpcacheMemoryLimitMiB,
+			OpcacheInternedStringsBufferMiB: in.Phpfpm.OpcacheInternedStringsBufferMiB,
+			ApcMemoryLimitMiB:               in.Phpfpm.ApcMemoryLimitMiB,
+			Cpu:                             Resources(in.Phpfpm.Cpu),
+			Apm: SpecAPM{
+				Provider: APMProvider(in.Phpfpm.Apm.Provider),
+				Secret:   in.Phpfpm.Apm.Secret,
+				AppName:  in.Phpfpm.Apm.AppName,
+				Settings: in.Phpfpm.Apm.Settings,
+			},
+		},
+	}
+	if in.Storage.EFS != nil {
+		out.EFSID = in.Storage.EFS.FileSystemID
+	}
+	return out
+}
+
+// ConvertTo converts the Site to v1beta1
+func (s *Site) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1beta1.Site)
+	s.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	spec := s.Spec.DeepCopy()
+	dst.Spec = v1beta1.SiteSpec{
+		Domains:      spec.Domains,
+		Environment:  spec.Environment,
+		Database:     spec.Database,
+		Install:      v1beta1.InstallSpec(spec.Install),
+		IngressClass: spec.IngressClass,
+	}
+	if spec.Tls {
+		dst.Spec.TLS = &v1beta1.TLSSpec{CertIssuer: spec.CertIssuer}
+	} else if spec.CertIssuer != "" {
+		setAnnotation(&dst.ObjectMeta.Annotations, CertIssuerAnnotation, spec.CertIssuer)
+	} else {
+		popAnnotation(&dst.ObjectMeta.Annotations, CertIssuerAnnotation)
+	}
+
+	dst.Status = v1beta1.SiteStatus{
+		Status:           v1beta1.Status(s.Status.Status),
+		Domains:          v1beta1.DomainStatus(s.Status.Domains),
+		Conditions:       convertConditionsTo(s.Status.Conditions),
+		AppliedResources: convertAppliedResourcesTo(s.Status.AppliedResources),
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1beta1 Site to this version
+func (s *Site) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1beta1.Site)
+	src.ObjectMeta.DeepCopyInto(&s.ObjectMeta)
+
+	spec := src.Spec.DeepCopy()
+	s.Spec = SiteSpec{
+		Domains:      spec.Domains,
+		Environment:  spec.Environment,
+		Database:     spec.Database,
+		Install:      InstallSpec(spec.Install),
+		IngressClass: spec.IngressClass,
+	}
+	if spec.TLS != nil {
+		s.Spec.Tls = true
+		s.Spec.CertIssuer = spec.TLS.CertIssuer
+	}
+	if issuer, ok := popAnnotation(&s.ObjectMeta.Annotations, CertIssuerAnnotation); ok && spec.TLS == nil {
+		s.Spec.CertIssuer = issuer
+	}
+
+	s.Status = SiteStatus{
+		Status:           Status(src.Status.Status),
+		Domains:          DomainStatus(src.Status.Domains),
+		Conditions:       convertConditionsFrom(src.Status.Conditions),
+		AppliedResources: convertAppliedResourcesFrom(src.Status.AppliedResources),
+	}
+	return nil
+}
+
+// ConvertTo converts the Database to v1beta1
+func (d *Database) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1beta1.Database)
+	d.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = v1beta1.DatabaseSpec{
+		Host:          d.Spec.Host,
+		Port:          d.Spec.Port,
+		SchemaName:    d.Spec.SchemaName,
+		User:          d.Spec.User,
+		AdminSecret:   d.Spec.AdminSecret,
+		UserSecret:    d.Spec.UserSecret,
+		ReclaimPolicy: v1beta1.DatabaseReclaimPolicy(d.Spec.ReclaimPolicy),
+		Adopt:         d.Spec.Adopt,
+	}
+	if d.Spec.SnapshotTarget != nil {
+		target := convertDumpTargetTo(*d.Spec.SnapshotTarget)
+		dst.Spec.SnapshotTarget = &target
+	}
+	if d.Spec.RotationInterval != nil {
+		interval := *d.Spec.RotationInterval
+		dst.Spec.RotationInterval = &interval
+	}
+	if d.Spec.TLS != nil {
+		dst.Spec.TLS = &v1beta1.DatabaseTLS{
+			CASecret:         d.Spec.TLS.CASecret,
+			VerifyMode:       v1beta1.DatabaseTLSVerifyMode(d.Spec.TLS.VerifyMode),
+			ClientCertSecret: d.Spec.TLS.ClientCertSecret,
+		}
+	}
+	dst.Status = v1beta1.DatabaseStatus{
+		Conditions:      convertConditionsTo(d.Status.Conditions),
+		Provisioned:     d.Status.Provisioned,
+		ProvisionedUser: d.Status.ProvisionedUser,
+	}
+	if d.Status.LastBackup != nil {
+		lastBackup := v1beta1.DatabaseLastBackup(*d.Status.LastBackup)
+		dst.Status.LastBackup = &lastBackup
+	}
+	if d.Status.Credentials != nil {
+		credentials := v1beta1.DatabaseCredentials(*d.Status.Credentials)
+		dst.Status.Credentials = &credentials
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1beta1 Database to this version
+func (d *Database) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1beta1.Database)
+	src.ObjectMeta.DeepCopyInto(&d.ObjectMeta)
+	d.Spec = DatabaseSpec{
+		Host:          src.Spec.Host,
+		Port:          src.Spec.Port,
+		SchemaName:    src.Spec.SchemaName,
+		User:          src.Spec.User,
+		AdminSecret:   src.Spec.AdminSecret,
+		UserSecret:    src.Spec.UserSecret,
+		ReclaimPolicy: DatabaseReclaimPolicy(src.Spec.ReclaimPolicy),
+		Adopt:         src.Spec.Adopt,
+	}
+	if src.Spec.SnapshotTarget != nil {
+		target := convertDumpTargetFrom(*src.Spec.SnapshotTarget)
+		d.Spec.SnapshotTarget = &target
+	}
+	if src.Spec.RotationInterval != nil {
+		interval := *src.Spec.RotationInterval
+		d.Spec.RotationInterval = &interval
+	}
+	if src.Spec.TLS != nil {
+		d.Spec.TLS = &DatabaseTLS{
+			CASecret:         src.Spec.TLS.CASecret,
+			VerifyMode:       DatabaseTLSVerifyMode(src.Spec.TLS.VerifyMode),
+			ClientCertSecret: src.Spec.TLS.ClientCertSecret,
+		}
+	}
+	d.Status = DatabaseStatus{
+		Conditions:      convertConditionsFrom(src.Status.Conditions),
+		Provisioned:     src.Status.Provisioned,
+		ProvisionedUser: src.Status.ProvisionedUser,
+	}
+	if src.Status.LastBackup != nil {
+		lastBackup := DatabaseLastBackup(*src.Status.LastBackup)
+		d.Status.LastBackup = &lastBackup
+	}
+	if src.Status.Credentials != nil {
+		credentials := DatabaseCredentials(*src.Status.Credentials)
+		d.Status.Credentials = &credentials
+	}
+	return nil
+}
+
+func convertDumpTargetTo(in DatabaseDumpTarget) v1beta1.DatabaseDumpTarget {
+	out := v1beta1.DatabaseDumpTarget{
+		PersistentVolumeClaim: in.PersistentVolumeClaim,
+		Path:                  in.Path,
+	}
+	if in.S3 != nil {
+		s3 := v1beta1.S3Target(*in.S3)
+		out.S3 = &s3
+	}
+	return out
+}
+
+func convertDumpTargetFrom(in v1beta1.DatabaseDumpTarget) DatabaseDumpTarget {
+	out := DatabaseDumpTarget{
+		PersistentVolumeClaim: in.PersistentVolumeClaim,
+		Path:                  in.Path,
+	}
+	if in.S3 != nil {
+		s3 := S3Target(*in.S3)
+		out.S3 = &s3
+	}
+	return out
+}
+
+func convertConditionsTo(in []Condition) []v1beta1.Condition {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1beta1.Condition, len(in))
+	for i, c := range in {
+		out[i] = v1beta1.Condition{
+			Type:               v1beta1.ConditionType(c.Type),
+			Status:             c.Status,
+			LastTransitionTime: *c.LastTransitionTime.DeepCopy(),
+			Reason:             c.Reason,
+			Message:            c.Message,
+		}
+	}
+	return out
+}
+
+func convertConditionsFrom(in []v1beta1.Condition) []Condition {
+	if in == nil {
+		return nil
+	}
+	out := make([]Condition, len(in))
+	for i, c := range in {
+		out[i] = Condition{
+			Type:               ConditionType(c.Type),
+			Status:             c.Status,
+			LastTransitionTime: *c.LastTransitionTime.DeepCopy(),
+			Reason:             c.Reason,
+			Message:            c.Message,
+		}
+	}
+	return out
+}
+
+func convertAppliedResourcesTo(in []AppliedResource) []v1beta1.AppliedResource {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1beta1.AppliedResource, len(in))
+	for i := range in {
+		out[i] = v1beta1.AppliedResource(*in[i].DeepCopy())
+	}
+	return out
+}
+
+func convertAppliedResourcesFrom(in []v1beta1.AppliedResource) []AppliedResource {
+	if in == nil {
+		return nil
+	}
+	out := make([]AppliedResource, len(in))
+	for i := range in {
+		out[i] = AppliedResource(*in[i].DeepCopy())
+	}
+	return out
+}
+
+// setAnnotation sets the annotation, creating the map of annotations if needed
+func setAnnotation(annotations *map[string]string, key, value string) {
+	if *annotations == nil {
+		*annotations = map[string]string{}
+	}
+	(*annotations)[key] = value
+}
+
+// popAnnotation removes the annotation, returning its value and whether it was set. The map of annotations is
+// cleared if it ends up empty, as it was before the annotation was set by setAnnotation.
+func popAnnotation(annotations *map[string]string, key string) (string, bool) {
+	value, ok := (*annotations)[key]
+	if !ok {
+		return "", false
+	}
+	delete(*annotations, key)
+	if len(*annotations) == 0 {
+		*annotations = nil
+	}
+	return value, true
+}
@@ -0,0 +1,246 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1beta1"
+)
+
+var conversionTime = metav1.NewTime(time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC))
+
+func conversionEnvironment() *DrupalEnvironment {
+	target := int32(60)
+	spec := DrupalEnvironmentSpec{
+		Application:                "wlgore",
+		Production:                 true,
+		EFSID:                      "fs-0123abcd",
+		GitRef:                     "tags/v1.0.0",
+		Stage:                      "prod",
+		CustomEnvironmentVariables: []corev1.EnvVar{{Name: "FOO", Value: "bar"}},
+		Drupal: SpecDrupal{
+			Tag:                            "v1.0.0",
+			MinReplicas:                    pointer.Int32Ptr(2),
+			MaxReplicas:                    pointer.Int32Ptr(4),
+			TargetCPUUtilizationPercentage: &target,
+			Liveness:                       HTTPProbe{Enabled: pointer.BoolPtr(true), HTTPPath: "/user/login"},
+		},
+		Apache: SpecApache{
+			Tag: "latest",
+			Cpu: Resources{Request: resource.MustParse("100m"), Limit: resource.MustParse("500m")},
+		},
+		Phpfpm: SpecPhpFpm{
+			Tag:   "7.3",
+			Procs: pointer.Int32Ptr(4),
+			Apm:   SpecAPM{Provider: APMProviderDatadog, Settings: map[string]string{"env": "prod"}},
+		},
+	}
+
+	return &DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wlgore-prod",
+			Namespace: "wlgore",
+			Labels:    map[string]string{VersionLabel: "3"},
+		},
+		Spec: spec,
+		Status: DrupalEnvironmentStatus{
+			NumDrupal:        2,
+			Status:           DrupalEnvironmentStatusSynced,
+			Conditions:       []Condition{{Type: QuotaExceededCondition, Status: corev1.ConditionFalse, LastTransitionTime: conversionTime}},
+			AppliedResources: []AppliedResource{{Kind: "Deployment", Name: "wlgore-prod-drupal", AppliedHash: "abc"}},
+			EffectiveSpec:    spec.DeepCopy(),
+		},
+	}
+}
+
+func TestDrupalEnvironment_ConvertTo(t *testing.T) {
+	env := conversionEnvironment()
+
+	hub := &v1beta1.DrupalEnvironment{}
+	require.NoError(t, env.ConvertTo(hub))
+	require.Equal(t, &v1beta1.EFSStorage{FileSystemID: "fs-0123abcd"}, hub.Spec.Storage.EFS)
+	require.Equal(t, &v1beta1.EFSStorage{FileSystemID: "fs-0123abcd"}, hub.Status.EffectiveSpec.Storage.EFS)
+	require.True(t, hub.Spec.IsProduction())
+	require.NotContains(t, hub.Annotations, ProductionAnnotation)
+	require.Equal(t, env.Labels, hub.Labels)
+}
+
+func TestDrupalEnvironment_ConversionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*DrupalEnvironment)
+	}{
+		{
+			name:   "production",
+			modify: func(*DrupalEnvironment) {},
+		},
+		{
+			name: "non-production",
+			modify: func(e *DrupalEnvironment) {
+				e.Spec.Stage = "dev"
+				e.Spec.Production = false
+			},
+		},
+		{
+			name:   "production flag disagreeing with the stage",
+			modify: func(e *DrupalEnvironment) { e.Spec.Stage = "live" },
+		},
+		{
+			name:   "without EFS",
+			modify: func(e *DrupalEnvironment) { e.Spec.EFSID = "" },
+		},
+		{
+			name:   "without status",
+			modify: func(e *DrupalEnvironment) { e.Status = DrupalEnvironmentStatus{} },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := conversionEnvironment()
+			test.modify(env)
+			original := env.DeepCopy()
+
+			hub := &v1beta1.DrupalEnvironment{}
+			require.NoError(t, env.ConvertTo(hub))
+			converted := &DrupalEnvironment{}
+			require.NoError(t, converted.ConvertFrom(hub))
+
+			require.Equal(t, original, env, "the converted object must not be changed")
+			require.Equal(t, original, converted)
+		})
+	}
+}
+
+func TestDrupalEnvironment_ConvertDeprecatedNewRelic(t *testing.T) {
+	env := conversionEnvironment()
+	env.Spec.Phpfpm.Apm = SpecAPM{}
+	env.Spec.Phpfpm.NewRelicSecret = "newrelic"
+	env.Spec.Phpfpm.NewRelicAppName = "wlgore"
+
+	hub := &v1beta1.DrupalEnvironment{}
+	require.NoError(t, env.ConvertTo(hub))
+	require.Equal(t, v1beta1.SpecAPM{Provider: "newrelic", Secret: "newrelic", AppName: "wlgore"}, hub.Spec.Phpfpm.Apm)
+}
+
+func TestDrupalEnvironment_ConvertFrom(t *testing.T) {
+	hub := &v1beta1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-test", Namespace: "wlgore"},
+		Spec: v1beta1.DrupalEnvironmentSpec{
+			Application: "wlgore",
+			GitRef:      "master",
+			Stage:       "test",
+		},
+	}
+	original := hub.DeepCopy()
+
+	env := &DrupalEnvironment{}
+	require.NoError(t, env.ConvertFrom(hub))
+	require.False(t, env.Spec.Production)
+	require.Empty(t, env.Spec.EFSID)
+
+	converted := &v1beta1.DrupalEnvironment{}
+	require.NoError(t, env.ConvertTo(converted))
+	require.Equal(t, original, converted)
+}
+
+func TestSite_ConversionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		spec SiteSpec
+		tls  *v1beta1.TLSSpec
+	}{
+		{
+			name: "without TLS",
+		},
+		{
+			name: "with TLS",
+			spec: SiteSpec{Tls: true},
+			tls:  &v1beta1.TLSSpec{},
+		},
+		{
+			name: "with TLS and a certificate issuer",
+			spec: SiteSpec{Tls: true, CertIssuer: "letsencrypt-prod"},
+			tls:  &v1beta1.TLSSpec{CertIssuer: "letsencrypt-prod"},
+		},
+		{
+			name: "with a certificate issuer but without TLS",
+			spec: SiteSpec{CertIssuer: "letsencrypt-prod"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			site := &Site{
+				ObjectMeta: metav1.ObjectMeta{Name: "wlgore-site", Namespace: "wlgore"},
+				Spec:       test.spec,
+				Status: SiteStatus{
+					Status:     SiteSyncedStatus,
+					Domains:    DomainsSyncedStatus,
+					Conditions: []Condition{{Type: DriftedCondition, Status: corev1.ConditionFalse, LastTransitionTime: conversionTime}},
+				},
+			}
+			site.Spec.Domains = []string{"wlgore.com", "www.wlgore.com"}
+			site.Spec.Environment = "wlgore-prod"
+			site.Spec.Database = "wlgore-database"
+			site.Spec.Install = InstallSpec{InstallProfile: "standard", AdminUsername: "admin", AdminEmail: "admin@wlgore.com"}
+			original := site.DeepCopy()
+
+			hub := &v1beta1.Site{}
+			require.NoError(t, site.ConvertTo(hub))
+			require.Equal(t, test.tls, hub.Spec.TLS)
+
+			converted := &Site{}
+			require.NoError(t, converted.ConvertFrom(hub))
+			require.Equal(t, original, converted)
+		})
+	}
+}
+
+func TestDatabase_ConversionRoundTrip(t *testing.T) {
+	db := &Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-database", Namespace: "wlgore"},
+		Spec: DatabaseSpec{
+			Host:        "mysql",
+			Port:        3306,
+			SchemaName:  "wlgore",
+			User:        "wlgore",
+			AdminSecret: "admin-secret",
+			UserSecret:  "user-secret",
+
+			ReclaimPolicy: DatabaseReclaimSnapshot,
+			SnapshotTarget: &DatabaseDumpTarget{
+				S3:   &S3Target{Bucket: "wlgore-snapshots", Endpoint: "http://minio:9000", CredentialsSecret: "minio"},
+				Path: "databases",
+			},
+			RotationInterval: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+			TLS:              &DatabaseTLS{CASecret: "mysql-ca", VerifyMode: DatabaseTLSVerifyCA, ClientCertSecret: "mysql-client"},
+		},
+		Status: DatabaseStatus{
+			Conditions:      []Condition{{Type: DatabaseReadyCondition, Status: corev1.ConditionTrue, LastTransitionTime: conversionTime, Reason: "Provisioned"}},
+			Provisioned:     true,
+			ProvisionedUser: "wlgore_b",
+			LastBackup:      &DatabaseLastBackup{Name: "wlgoredatabase-20200301-1200", CompletionTime: conversionTime},
+			Credentials:     &DatabaseCredentials{User: "wlgore_b", PreviousUser: "wlgore", LastRotationTime: conversionTime},
+		},
+	}
+	original := db.DeepCopy()
+
+	hub := &v1beta1.Database{}
+	require.NoError(t, db.ConvertTo(hub))
+	require.Equal(t, v1beta1.ConditionType("Ready"), hub.Status.Conditions[0].Type)
+	require.Equal(t, "wlgore-snapshots", hub.Spec.SnapshotTarget.S3.Bucket)
+	require.Equal(t, "wlgoredatabase-20200301-1200", hub.Status.LastBackup.Name)
+	require.Equal(t, "wlgore_b", hub.Status.Credentials.User)
+	require.Equal(t, v1beta1.DatabaseTLSVerifyCA, hub.Spec.TLS.VerifyMode)
+
+	converted := &Database{}
+	require.NoError(t, converted.ConvertFrom(hub))
+	require.Equal(t, original, converted)
+}
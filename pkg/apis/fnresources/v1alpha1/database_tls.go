@@ -0,0 +1,108 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TLSCAKey is the key of the CA bundle in the CASecret of a Database's TLS settings
+const TLSCAKey = "ca.crt"
+
+// DatabaseTLSFiles are the PEM encoded files that TLS connections to the server of a Database use
+type DatabaseTLSFiles struct {
+	VerifyMode DatabaseTLSVerifyMode
+	CA         []byte
+	// Cert and Key are the client certificate and its key, if the Database has a ClientCertSecret
+	Cert []byte
+	Key  []byte
+}
+
+// GetTLSFiles returns the files of the TLS connections to the Database's server, read from their Secrets, or nil if the
+// connections don't use TLS
+func (d *Database) GetTLSFiles(c client.Client) (*DatabaseTLSFiles, error) {
+	spec := d.Spec.TLS
+	if spec == nil {
+		return nil, nil
+	}
+
+	files := &DatabaseTLSFiles{VerifyMode: spec.GetVerifyMode()}
+	caSecret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: spec.CASecret, Namespace: d.Namespace}, caSecret); err != nil {
+		return nil, err
+	}
+	if files.CA = caSecret.Data[TLSCAKey]; len(files.CA) == 0 {
+		return nil, fmt.Errorf("secret '%s' has no %q", spec.CASecret, TLSCAKey)
+	}
+
+	if spec.ClientCertSecret != "" {
+		certSecret := &corev1.Secret{}
+		if err := c.Get(context.TODO(), types.NamespacedName{Name: spec.ClientCertSecret, Namespace: d.Namespace}, certSecret); err != nil {
+			return nil, err
+		}
+		files.Cert = certSecret.Data[corev1.TLSCertKey]
+		files.Key = certSecret.Data[corev1.TLSPrivateKeyKey]
+		if len(files.Cert) == 0 || len(files.Key) == 0 {
+			return nil, fmt.Errorf("secret '%s' has no %q and %q", spec.ClientCertSecret, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+	}
+	return files, nil
+}
+
+// Config returns the configuration of TLS connections to the given server host
+func (f *DatabaseTLSFiles) Config(host string) (*tls.Config, error) {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(f.CA) {
+		return nil, fmt.Errorf("no certificates in the CA bundle")
+	}
+
+	config := &tls.Config{RootCAs: roots, ServerName: host}
+	if f.Cert != nil {
+		cert, err := tls.X509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch f.VerifyMode {
+	case DatabaseTLSRequired:
+		config.InsecureSkipVerify = true
+	case DatabaseTLSVerifyCA:
+		// The handshake can't verify the chain without verifying the host too, so the chain is verified on its own
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyChain(roots)
+	}
+	return config, nil
+}
+
+// verifyChain returns a function verifying that the certificate of a TLS peer is signed by one of the roots, whatever
+// host it's for
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
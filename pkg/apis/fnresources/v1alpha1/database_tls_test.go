@@ -0,0 +1,120 @@
+package v1alpha1
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCert returns a PEM encoded certificate for the host and its key, signed by the parent, or self-signed without
+// one
+func newTestCert(t *testing.T, host string, parent *tls.Certificate) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{host},
+	}
+	issuer, signer := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newTestCA(t *testing.T) (*tls.Certificate, []byte) {
+	certPEM, keyPEM := newTestCert(t, "ca", nil)
+	ca, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	ca.Leaf, err = x509.ParseCertificate(ca.Certificate[0])
+	require.NoError(t, err)
+	return &ca, certPEM
+}
+
+// handshake runs a TLS handshake between a client with the config and a server with the certificate
+func handshake(config *tls.Config, certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestDatabaseTLSFiles_Config(t *testing.T) {
+	ca, caPEM := newTestCA(t)
+	otherCA, _ := newTestCA(t)
+
+	tests := []struct {
+		name       string
+		verifyMode DatabaseTLSVerifyMode
+		signer     *tls.Certificate
+		host       string
+		valid      bool
+	}{
+		{name: "VerifyIdentity", verifyMode: DatabaseTLSVerifyIdentity, signer: ca, host: "mysql", valid: true},
+		{name: "VerifyIdentity with another host", verifyMode: DatabaseTLSVerifyIdentity, signer: ca, host: "other"},
+		{name: "VerifyIdentity with another CA", verifyMode: DatabaseTLSVerifyIdentity, signer: otherCA, host: "mysql"},
+		{name: "VerifyCA with another host", verifyMode: DatabaseTLSVerifyCA, signer: ca, host: "other", valid: true},
+		{name: "VerifyCA with another CA", verifyMode: DatabaseTLSVerifyCA, signer: otherCA, host: "mysql"},
+		{name: "Required with another CA", verifyMode: DatabaseTLSRequired, signer: otherCA, host: "other", valid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := &DatabaseTLSFiles{VerifyMode: test.verifyMode, CA: caPEM}
+			config, err := files.Config("mysql")
+			require.NoError(t, err)
+
+			certPEM, keyPEM := newTestCert(t, test.host, test.signer)
+			err = handshake(config, certPEM, keyPEM)
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+
+	files := &DatabaseTLSFiles{CA: []byte("not a certificate")}
+	_, err := files.Config("mysql")
+	require.EqualError(t, err, "no certificates in the CA bundle")
+}
@@ -2,10 +2,12 @@ package v1alpha1
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -13,6 +15,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -32,19 +35,137 @@ type DatabaseSpec struct {
 	User        string `json:"user"`
 	AdminSecret string `json:"adminSecret,omitempty"` // +optional
 	UserSecret  string `json:"userSecret"`
+
+	// ReclaimPolicy says what happens to the schema and its user when the Database is deleted. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Retain;Delete;Snapshot
+	ReclaimPolicy DatabaseReclaimPolicy `json:"reclaimPolicy,omitempty"` // +optional
+	// SnapshotTarget is where the schema is dumped to before it's dropped, with the Snapshot reclaim policy
+	SnapshotTarget *DatabaseDumpTarget `json:"snapshotTarget,omitempty"` // +optional
+	// Adopt lets the Database take over a schema that already exists, such as one retained by a deleted Database.
+	// Otherwise, provisioning fails if the schema exists, so that Databases can't share a schema by mistake.
+	Adopt bool `json:"adopt,omitempty"` // +optional
+	// RotationInterval is how often the credentials of the user are rotated. Without it, credentials are only rotated when
+	// requested with the RotateCredentialsAnnotation.
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"` // +optional
+	// TLS configures TLS connections to the MySQL server, of both the operator and Drupal. Without it, connections are
+	// unencrypted.
+	TLS *DatabaseTLS `json:"tls,omitempty"` // +optional
+}
+
+// DatabaseReclaimPolicy says what happens to the schema and user of a Database when it's deleted
+type DatabaseReclaimPolicy string
+
+const (
+	// DatabaseReclaimRetain keeps the schema and user, so that they can be adopted by another Database
+	DatabaseReclaimRetain DatabaseReclaimPolicy = "Retain"
+	// DatabaseReclaimDelete drops the schema and user
+	DatabaseReclaimDelete DatabaseReclaimPolicy = "Delete"
+	// DatabaseReclaimSnapshot dumps the schema to the SnapshotTarget, and then drops the schema and user
+	DatabaseReclaimSnapshot DatabaseReclaimPolicy = "Snapshot"
+)
+
+// DatabaseTLS configures TLS connections to the MySQL server of a Database
+// +k8s:openapi-gen=true
+type DatabaseTLS struct {
+	// CASecret is the name of a Secret in the Database's namespace with the PEM encoded CA bundle that the server's
+	// certificate is verified with, in its "ca.crt" key
+	CASecret string `json:"caSecret"`
+	// VerifyMode says how much of the server's certificate is verified. Defaults to VerifyIdentity. PHP can't verify
+	// a certificate without its host, so Drupal only encrypts connections with VerifyCA, like with Required.
+	// +kubebuilder:validation:Enum=Required;VerifyCA;VerifyIdentity
+	VerifyMode DatabaseTLSVerifyMode `json:"verifyMode,omitempty"` // +optional
+	// ClientCertSecret is the name of a kubernetes.io/tls Secret in the Database's namespace with the client certificate
+	// and key that connections authenticate with, for servers that require them
+	ClientCertSecret string `json:"clientCertSecret,omitempty"` // +optional
+}
+
+// DatabaseTLSVerifyMode says how much of the certificate of a Database's server is verified, like MySQL's --ssl-mode
+type DatabaseTLSVerifyMode string
+
+const (
+	// DatabaseTLSRequired encrypts connections without verifying the server's certificate
+	DatabaseTLSRequired DatabaseTLSVerifyMode = "Required"
+	// DatabaseTLSVerifyCA verifies that the server's certificate is signed by the CA bundle
+	DatabaseTLSVerifyCA DatabaseTLSVerifyMode = "VerifyCA"
+	// DatabaseTLSVerifyIdentity verifies that the server's certificate is signed by the CA bundle, and is for the host
+	DatabaseTLSVerifyIdentity DatabaseTLSVerifyMode = "VerifyIdentity"
+)
+
+// GetVerifyMode returns the verify mode of the TLS connections, which is VerifyIdentity if it isn't set
+func (t *DatabaseTLS) GetVerifyMode() DatabaseTLSVerifyMode {
+	if t.VerifyMode == "" {
+		return DatabaseTLSVerifyIdentity
+	}
+	return t.VerifyMode
 }
 
 // DatabaseStatus defines the observed state of Database
 // +k8s:openapi-gen=true
 type DatabaseStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"` // +optional
+	// Provisioned is set once the schema was created, or adopted, by the Database
+	Provisioned bool `json:"provisioned,omitempty"` // +optional
+	// ProvisionedUser is the user last given the password of the user Secret and privileges on the schema. The user is
+	// only provisioned again when it changes, as credentials are rotated.
+	ProvisionedUser string `json:"provisionedUser,omitempty"` // +optional
+	// LastBackup is the latest successful DatabaseBackup of the Database, recorded by its DatabaseBackupSchedule
+	LastBackup *DatabaseLastBackup `json:"lastBackup,omitempty"` // +optional
+	// Credentials describe the MySQL users of the Database, once its credentials were first rotated
+	Credentials *DatabaseCredentials `json:"credentials,omitempty"` // +optional
+}
+
+// DatabaseLastBackup describes the latest successful DatabaseBackup of a Database
+// +k8s:openapi-gen=true
+type DatabaseLastBackup struct {
+	// Name is the name of the DatabaseBackup
+	Name string `json:"name"`
+	// Location is the URL of the dump
+	Location       string      `json:"location,omitempty"` // +optional
+	CompletionTime metav1.Time `json:"completionTime"`
 }
 
+// DatabaseCredentials describe the MySQL users that the credentials of a Database are rotated between
+// +k8s:openapi-gen=true
+type DatabaseCredentials struct {
+	// User is the user in the user Secret
+	User string `json:"user"`
+	// PreviousUser is the user that the Secret held before the last rotation. It keeps working for the
+	// CredentialsGracePeriod, so that Pods can pick up the new credentials without downtime, and is then dropped.
+	PreviousUser     string      `json:"previousUser,omitempty"` // +optional
+	LastRotationTime metav1.Time `json:"lastRotationTime"`
+	// RotationRequest is the value of the RotateCredentialsAnnotation that was last acted on
+	RotationRequest string `json:"rotationRequest,omitempty"` // +optional
+}
+
+const (
+	// RotateCredentialsAnnotation requests a rotation of the credentials of a Database whenever its value changes, e.g.
+	// to the current time
+	RotateCredentialsAnnotation = LabelPrefix + "rotate-credentials"
+	// AlternateUserSuffix is appended to the user of a Database to name the other user that its credentials are rotated to
+	AlternateUserSuffix = "_b"
+	// CredentialsGracePeriod is how long the previous user of a Database keeps working after its credentials are rotated
+	CredentialsGracePeriod = time.Hour
+)
+
+const (
+	// DatabaseReadyCondition is True when the database schema and its user are provisioned
+	DatabaseReadyCondition ConditionType = "Ready"
+	// DatabaseBackupFailedCondition is True when the latest backup of a scheduled Database failed
+	DatabaseBackupFailedCondition ConditionType = "BackupFailed"
+	// DatabaseBackupOverdueCondition is True when a scheduled Database wasn't backed up successfully in the last period
+	// of its schedule
+	DatabaseBackupOverdueCondition ConditionType = "BackupOverdue"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Database is the Schema for the databases API
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Last Backup",type="date",JSONPath=".status.lastBackup.completionTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type Database struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -115,6 +236,19 @@ func (d Database) DatabaseName() string {
 	return d.Spec.SchemaName
 }
 
+// GetReclaimPolicy returns the Database's reclaim policy, which is Delete if it isn't set
+func (d *Database) GetReclaimPolicy() DatabaseReclaimPolicy {
+	if d.Spec.ReclaimPolicy == "" {
+		return DatabaseReclaimDelete
+	}
+	return d.Spec.ReclaimPolicy
+}
+
+// AlternateUser returns the user that the credentials of the Database are rotated to from its spec.user, and back
+func (d *Database) AlternateUser() string {
+	return d.Spec.User + AlternateUserSuffix
+}
+
 // ConnectionConfig intended to replace pkg/common/Database
 type ConnectionConfig struct {
 	Host     string `json:"host"`
@@ -122,6 +256,8 @@ type ConnectionConfig struct {
 	Name     string `json:"database"`
 	User     string `json:"user"`
 	Password string `json:"pass"`
+	// TLS configures TLS connections, which are unencrypted if it's nil
+	TLS *tls.Config `json:"-"`
 }
 
 // GetConnectionConfig returns a database connecton config
@@ -132,12 +268,17 @@ func (d *Database) GetConnectionConfig(c client.Client) (ConnectionConfig, error
 	}
 
 	passwd := string(pwdSecret.Data["password"])
+	// The user is only in the Secret once the credentials were rotated, or the Secret was created by the controller
+	user := string(pwdSecret.Data["username"])
+	if user == "" {
+		user = d.Spec.User
+	}
 
 	return ConnectionConfig{
 		Host:     d.Spec.Host,
 		Port:     d.Spec.Port,
 		Name:     d.DatabaseName(),
-		User:     d.Spec.User,
+		User:     user,
 		Password: passwd,
 	}, nil
 }
@@ -205,6 +346,16 @@ func (d *Database) GetAdminConnectionConfig(c client.Client) (ConnectionConfig,
 	db.Host = d.Spec.Host
 	db.Port = d.Spec.Port
 
+	tlsFiles, err := d.GetTLSFiles(c)
+	if err != nil {
+		return ConnectionConfig{}, err
+	}
+	if tlsFiles != nil {
+		if db.TLS, err = tlsFiles.Config(d.Spec.Host); err != nil {
+			return ConnectionConfig{}, err
+		}
+	}
+
 	return db, nil
 }
 
@@ -217,6 +368,10 @@ func (d *Database) GetAdminSecret(c client.Client) (*corev1.Secret, error) {
 	return pwdSecret, nil
 }
 
+// tlsConfigLock serializes the registration of the TLS configs of connections with the driver, which only looks them up
+// when the connection is opened
+var tlsConfigLock sync.Mutex
+
 // GetConnectionFromConfig returns a mysql connection
 func (db ConnectionConfig) GetConnectionFromConfig() (*sql.DB, error) {
 	config := mysql.NewConfig()
@@ -227,6 +382,16 @@ func (db ConnectionConfig) GetConnectionFromConfig() (*sql.DB, error) {
 	portInt := strconv.Itoa(db.Port)
 	config.Addr = net.JoinHostPort(db.Host, portInt)
 	config.Timeout = time.Second * 5
+
+	if db.TLS != nil {
+		tlsConfigLock.Lock()
+		defer tlsConfigLock.Unlock()
+
+		config.TLSConfig = fmt.Sprintf("fnresources-%s@%s", config.User, config.Addr)
+		if err := mysql.RegisterTLSConfig(config.TLSConfig, db.TLS); err != nil {
+			return nil, err
+		}
+	}
 	conn, err := sql.Open("mysql", config.FormatDSN())
 
 	if err != nil {
@@ -260,6 +425,22 @@ func (d *Database) ValidateCreate() error {
 		log.Info(err.Error())
 		return err
 	}
+	if err := d.validateReclaimPolicy(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := d.validateRotation(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := d.validateTLS(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := ValidateDeletionProtection(d, nil); err != nil {
+		log.Info(err.Error())
+		return err
+	}
 	return nil
 }
 
@@ -280,19 +461,95 @@ func (d *Database) ValidateUpdate(old runtime.Object) error {
 		log.Info(err.Error())
 		return err
 	}
+	if err := d.validateReclaimPolicy(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := d.validateRotation(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := d.validateTLS(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := ValidateDeletionProtection(d, oldd); err != nil {
+		log.Info(err.Error())
+		return err
+	}
 	return nil
 }
 
 func (d *Database) ValidateDelete() error {
+	log := logf.Log.WithName("databasevalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(d); err != nil {
+		log.Info(err.Error())
+		return err
+	}
 	return nil
 }
 
+// validateReclaimPolicy checks that the Snapshot reclaim policy has a valid target
+func (d *Database) validateReclaimPolicy() error {
+	switch d.GetReclaimPolicy() {
+	case DatabaseReclaimRetain, DatabaseReclaimDelete:
+		return nil
+	case DatabaseReclaimSnapshot:
+		if d.Spec.SnapshotTarget == nil {
+			return fmt.Errorf("snapshotTarget is required with the %s reclaimPolicy", DatabaseReclaimSnapshot)
+		}
+		return d.Spec.SnapshotTarget.Validate(field.NewPath("spec", "snapshotTarget")).ToAggregate()
+	default:
+		return fmt.Errorf("reclaimPolicy must be one of %q, %q or %q", DatabaseReclaimRetain, DatabaseReclaimDelete, DatabaseReclaimSnapshot)
+	}
+}
+
+// validateRotation checks that the alternate user of a Database whose credentials are rotated fits MySQL's limit of 16
+// characters
+func (d *Database) validateRotation() error {
+	if d.Spec.RotationInterval != nil && d.Spec.RotationInterval.Duration <= 0 {
+		return fmt.Errorf("rotationInterval must be positive")
+	}
+	if d.Spec.RotationInterval == nil && d.GetAnnotations()[RotateCredentialsAnnotation] == "" {
+		return nil
+	}
+	if userLength, limit := len(d.Spec.User), 16-len(AlternateUserSuffix); userLength > limit {
+		return fmt.Errorf("user '%s' too many characters to rotate credentials (%d > %d)", d.Spec.User, userLength, limit)
+	}
+	return nil
+}
+
+// validateTLS checks that TLS connections have a CA bundle and a valid verify mode
+func (d *Database) validateTLS() error {
+	if d.Spec.TLS == nil {
+		return nil
+	}
+	if d.Spec.TLS.CASecret == "" {
+		return fmt.Errorf("tls.caSecret is required")
+	}
+	switch d.Spec.TLS.GetVerifyMode() {
+	case DatabaseTLSRequired, DatabaseTLSVerifyCA, DatabaseTLSVerifyIdentity:
+		return nil
+	default:
+		return fmt.Errorf("tls.verifyMode must be one of %q, %q or %q", DatabaseTLSRequired, DatabaseTLSVerifyCA, DatabaseTLSVerifyIdentity)
+	}
+}
+
 func (d *Database) Default() {
 	log := logf.Log.WithName("databasedefaulter")
 	if d.Spec.Port == 0 {
 		log.Info("Defaulting port to 3306")
 		d.Spec.Port = 3306
 	}
+	if d.Spec.ReclaimPolicy == "" {
+		log.Info("Defaulting reclaimPolicy to Delete")
+		d.Spec.ReclaimPolicy = DatabaseReclaimDelete
+	}
+	// New Databases are of the latest spec version, so that they aren't migrated like the ones created before it. Objects
+	// that exist already are left to the controller to migrate.
+	if ObjectVersion(d) == "" && d.CreationTimestamp.IsZero() {
+		setObjectVersion(d, d.SpecVersion())
+	}
 }
 
 /////////////////////
@@ -301,12 +558,31 @@ func (d *Database) Default() {
 
 var _ versionedType = &Database{}
 
-func (d *Database) SpecVersion() string {
-	return "2"
+// databaseMigrations are the migration steps of Databases
+var databaseMigrations = []MigrationStep{
+	{
+		Version:     2,
+		Description: "Label with the spec version",
+		Migrate:     func(metav1.Object) []string { return nil },
+	},
+	{
+		Version:     3,
+		Description: "Adopt the existing schema",
+		Migrate:     func(o metav1.Object) []string { return migrateDatabaseAdopt(o.(*Database)) },
+	},
 }
 
-func (d *Database) migrationNeeded() bool {
-	return false
+// migrateDatabaseAdopt lets Databases created before spec.adopt existed keep managing the schema they created, which
+// status.provisioned doesn't record for them
+func migrateDatabaseAdopt(d *Database) []string {
+	d.Spec.Adopt = true
+	return nil
 }
 
-func (d *Database) doMigrate() {}
+func (d *Database) SpecVersion() string {
+	return latestVersion(databaseMigrations)
+}
+
+func (d *Database) migrationSteps() []MigrationStep {
+	return databaseMigrations
+}
@@ -2,8 +2,10 @@ package v1alpha1
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestValidateCreate(t *testing.T) {
@@ -22,6 +24,67 @@ func TestValidateCreate(t *testing.T) {
 	require.NoError(t, d.ValidateCreate())
 }
 
+func TestValidateReclaimPolicy(t *testing.T) {
+	d := &Database{
+		Spec: DatabaseSpec{
+			ReclaimPolicy: "Archive",
+		},
+	}
+	require.EqualError(t, d.ValidateCreate(), `reclaimPolicy must be one of "Retain", "Delete" or "Snapshot"`)
+
+	d.Spec.ReclaimPolicy = DatabaseReclaimSnapshot
+	require.EqualError(t, d.ValidateCreate(), "snapshotTarget is required with the Snapshot reclaimPolicy")
+	require.Error(t, d.ValidateUpdate(d.DeepCopy()))
+
+	d.Spec.SnapshotTarget = &DatabaseDumpTarget{}
+	require.EqualError(t, d.ValidateCreate(), "spec.snapshotTarget: Required value: one of persistentVolumeClaim or s3 is required")
+
+	d.Spec.SnapshotTarget = &DatabaseDumpTarget{PersistentVolumeClaim: "wlgore-snapshots"}
+	require.NoError(t, d.ValidateCreate())
+
+	d.Spec.ReclaimPolicy = DatabaseReclaimRetain
+	d.Spec.SnapshotTarget = nil
+	require.NoError(t, d.ValidateCreate())
+}
+
+func TestValidateRotation(t *testing.T) {
+	d := &Database{
+		Spec: DatabaseSpec{
+			User:             "sixteencharacter",
+			RotationInterval: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+		},
+	}
+	require.EqualError(t, d.ValidateCreate(), "user 'sixteencharacter' too many characters to rotate credentials (16 > 14)")
+
+	d.Spec.RotationInterval = nil
+	require.NoError(t, d.ValidateCreate())
+	d.Annotations = map[string]string{RotateCredentialsAnnotation: "2020-03-01T12:00:00Z"}
+	require.Error(t, d.ValidateUpdate(d.DeepCopy()))
+
+	d.Spec.User = "fourteenchars"
+	require.NoError(t, d.ValidateCreate())
+
+	d.Spec.RotationInterval = &metav1.Duration{}
+	require.EqualError(t, d.ValidateCreate(), "rotationInterval must be positive")
+}
+
+func TestValidateTLS(t *testing.T) {
+	d := &Database{
+		Spec: DatabaseSpec{
+			User: "wlgore",
+			TLS:  &DatabaseTLS{},
+		},
+	}
+	require.EqualError(t, d.ValidateCreate(), "tls.caSecret is required")
+
+	d.Spec.TLS.CASecret = "mysql-ca"
+	require.NoError(t, d.ValidateCreate())
+	require.Equal(t, DatabaseTLSVerifyIdentity, d.Spec.TLS.GetVerifyMode())
+
+	d.Spec.TLS.VerifyMode = "Preferred"
+	require.EqualError(t, d.ValidateUpdate(d.DeepCopy()), `tls.verifyMode must be one of "Required", "VerifyCA" or "VerifyIdentity"`)
+}
+
 func TestValidateUpdate(t *testing.T) {
 	d := &Database{
 		Spec: DatabaseSpec{
@@ -57,4 +120,7 @@ func TestDefault(t *testing.T) {
 	d := &Database{}
 	d.Default()
 	require.Equal(t, 3306, d.Spec.Port)
+	require.Equal(t, DatabaseReclaimDelete, d.Spec.ReclaimPolicy)
+	require.Equal(t, d.SpecVersion(), ObjectVersion(d))
+	require.Nil(t, Migrate(d), "new Databases shouldn't be migrated")
 }
@@ -0,0 +1,145 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Important: Run "operator-sdk generate k8s && operator-sdk generate crds" to regenerate code after modifying this file
+// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+
+// DatabaseBackupSpec defines the desired state of DatabaseBackup
+// +k8s:openapi-gen=true
+type DatabaseBackupSpec struct {
+	// Database is the name of the Database to back up, in the same namespace
+	Database string `json:"database"`
+	// Target is where the dump is written to
+	Target DatabaseDumpTarget `json:"target"`
+}
+
+// DatabaseJobPhase is the phase of the Job of a DatabaseBackup or DatabaseRestore
+type DatabaseJobPhase string
+
+const (
+	DatabaseJobPending   DatabaseJobPhase = "Pending"
+	DatabaseJobRunning   DatabaseJobPhase = "Running"
+	DatabaseJobSucceeded DatabaseJobPhase = "Succeeded"
+	DatabaseJobFailed    DatabaseJobPhase = "Failed"
+)
+
+// Finished returns true if the Job succeeded or failed
+func (p DatabaseJobPhase) Finished() bool {
+	return p == DatabaseJobSucceeded || p == DatabaseJobFailed
+}
+
+// DatabaseBackupStatus defines the observed state of DatabaseBackup
+// +k8s:openapi-gen=true
+type DatabaseBackupStatus struct {
+	Phase DatabaseJobPhase `json:"phase,omitempty"` // +optional
+	// Message explains the phase, e.g. why the backup failed
+	Message string `json:"message,omitempty"` // +optional
+	// File is the path of the dump within the target
+	File string `json:"file,omitempty"` // +optional
+	// Location is the URL of the dump, e.g. s3://bucket/path/file.sql.gz
+	Location string `json:"location,omitempty"` // +optional
+	// SizeBytes is the size of the compressed dump
+	SizeBytes int64 `json:"sizeBytes,omitempty"` // +optional
+	// Checksum is the SHA-256 checksum of the compressed dump, as "sha256:<hex digest>"
+	Checksum       string       `json:"checksum,omitempty"`       // +optional
+	StartTime      *metav1.Time `json:"startTime,omitempty"`      // +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"` // +optional
+	// Duration is how long the backup Job ran
+	Duration *metav1.Duration `json:"duration,omitempty"` // +optional
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseBackup is the Schema for the databasebackups API
+// +kubebuilder:resource:shortName=dbbackup,scope=Namespaced
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Database",type="string",JSONPath=".spec.database"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.sizeBytes"
+// +kubebuilder:printcolumn:name="Location",type="string",JSONPath=".status.location",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type DatabaseBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseBackupSpec   `json:"spec,omitempty"`
+	Status DatabaseBackupStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseBackupList contains a list of DatabaseBackup
+type DatabaseBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseBackup{}, &DatabaseBackupList{})
+}
+
+var _ webhook.Validator = &DatabaseBackup{}
+
+func (b *DatabaseBackup) ValidateCreate() error {
+	log := logf.Log.WithName("databasebackupvalidator").WithValues("operation", "create")
+	return validateDatabaseBackup(log, b, nil)
+}
+
+func (b *DatabaseBackup) ValidateUpdate(old runtime.Object) error {
+	log := logf.Log.WithName("databasebackupvalidator").WithValues("operation", "update")
+	oldb, ok := old.(*DatabaseBackup)
+	if !ok {
+		return fmt.Errorf("invalid old object passed.")
+	}
+	return validateDatabaseBackup(log, b, oldb)
+}
+
+func (b *DatabaseBackup) ValidateDelete() error {
+	log := logf.Log.WithName("databasebackupvalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(b); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// validateDatabaseBackup validates a created (if old is nil) or updated DatabaseBackup. The spec can't be updated,
+// since the backup runs once.
+func validateDatabaseBackup(log logr.Logger, b *DatabaseBackup, old *DatabaseBackup) error {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+	if b.Spec.Database == "" {
+		errs = append(errs, field.Required(path.Child("database"), ""))
+	}
+	errs = append(errs, b.Spec.Target.Validate(path.Child("target"))...)
+	if old != nil && !equality.Semantic.DeepEqual(b.Spec, old.Spec) {
+		errs = append(errs, field.Forbidden(path, "is immutable"))
+	}
+	if err := errs.ToAggregate(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+
+	var oldp protectable
+	if old != nil {
+		oldp = old
+	}
+	if err := ValidateDeletionProtection(b, oldp); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
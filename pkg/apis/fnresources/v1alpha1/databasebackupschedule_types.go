@@ -0,0 +1,179 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Important: Run "operator-sdk generate k8s && operator-sdk generate crds" to regenerate code after modifying this file
+// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+
+// BackupScheduleLabel is set on the DatabaseBackups created by a DatabaseBackupSchedule, to its name
+const BackupScheduleLabel = LabelPrefix + "backup-schedule"
+
+// DatabaseBackupScheduleSpec defines the desired state of DatabaseBackupSchedule
+// +k8s:openapi-gen=true
+type DatabaseBackupScheduleSpec struct {
+	// Database is the name of the Database to back up, in the same namespace. Either it or Environment is required.
+	Database string `json:"database,omitempty"` // +optional
+	// Environment is the name of a DrupalEnvironment, in the same namespace, whose Sites' Databases are backed up
+	Environment string `json:"environment,omitempty"` // +optional
+	// Schedule is when backups are taken, in Cron format (e.g. "0 * * * *" or "@hourly"), in UTC
+	Schedule string `json:"schedule"`
+	// Target is where the dumps are written to
+	Target DatabaseDumpTarget `json:"target"`
+	// Retention says which of the DatabaseBackups created by the schedule are kept. All of them are kept if it's empty.
+	Retention BackupRetention `json:"retention,omitempty"` // +optional
+	// Suspend stops new backups from being taken. Existing ones are still pruned.
+	Suspend bool `json:"suspend,omitempty"` // +optional
+}
+
+// BackupRetention says which successful backups of a Database are kept. A backup is kept if any of the rules keeps it.
+// Failed backups are kept until a later backup succeeds.
+// +k8s:openapi-gen=true
+type BackupRetention struct {
+	// KeepLast is the number of latest backups to keep
+	// +kubebuilder:validation:Minimum=0
+	KeepLast int32 `json:"keepLast,omitempty"` // +optional
+	// Daily is the number of days, with a backup, for which the latest backup of the day is kept
+	// +kubebuilder:validation:Minimum=0
+	Daily int32 `json:"daily,omitempty"` // +optional
+	// Weekly is the number of weeks, with a backup, for which the latest backup of the week is kept
+	// +kubebuilder:validation:Minimum=0
+	Weekly int32 `json:"weekly,omitempty"` // +optional
+	// Monthly is the number of months, with a backup, for which the latest backup of the month is kept
+	// +kubebuilder:validation:Minimum=0
+	Monthly int32 `json:"monthly,omitempty"` // +optional
+}
+
+// IsZero returns true if no rule is set, so that all backups are kept
+func (r BackupRetention) IsZero() bool {
+	return r == BackupRetention{}
+}
+
+// DatabaseBackupScheduleStatus defines the observed state of DatabaseBackupSchedule
+// +k8s:openapi-gen=true
+type DatabaseBackupScheduleStatus struct {
+	// Databases are the names of the Databases backed up by the schedule
+	Databases []string `json:"databases,omitempty"` // +optional
+	// LastScheduleTime is when backups were last taken
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"` // +optional
+	// NextScheduleTime is when backups are taken next
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"` // +optional
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseBackupSchedule is the Schema for the databasebackupschedules API
+// +kubebuilder:resource:shortName=dbbackupschedule,scope=Namespaced
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+// +kubebuilder:printcolumn:name="Database",type="string",JSONPath=".spec.database"
+// +kubebuilder:printcolumn:name="Environment",type="string",JSONPath=".spec.environment"
+// +kubebuilder:printcolumn:name="Suspend",type="boolean",JSONPath=".spec.suspend"
+// +kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=".status.lastScheduleTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type DatabaseBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseBackupScheduleSpec   `json:"spec,omitempty"`
+	Status DatabaseBackupScheduleStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseBackupScheduleList contains a list of DatabaseBackupSchedule
+type DatabaseBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseBackupSchedule{}, &DatabaseBackupScheduleList{})
+}
+
+// ParseSchedule parses the Cron schedule of the DatabaseBackupSchedule
+func (s *DatabaseBackupSchedule) ParseSchedule() (cron.Schedule, error) {
+	return cron.ParseStandard(s.Spec.Schedule)
+}
+
+var _ webhook.Validator = &DatabaseBackupSchedule{}
+
+func (s *DatabaseBackupSchedule) ValidateCreate() error {
+	log := logf.Log.WithName("databasebackupschedulevalidator").WithValues("operation", "create")
+	return validateDatabaseBackupSchedule(log, s, nil)
+}
+
+func (s *DatabaseBackupSchedule) ValidateUpdate(old runtime.Object) error {
+	log := logf.Log.WithName("databasebackupschedulevalidator").WithValues("operation", "update")
+	olds, ok := old.(*DatabaseBackupSchedule)
+	if !ok {
+		return fmt.Errorf("invalid old object passed.")
+	}
+	return validateDatabaseBackupSchedule(log, s, olds)
+}
+
+func (s *DatabaseBackupSchedule) ValidateDelete() error {
+	log := logf.Log.WithName("databasebackupschedulevalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(s); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// validateDatabaseBackupSchedule validates a created (if old is nil) or updated DatabaseBackupSchedule
+func validateDatabaseBackupSchedule(log logr.Logger, s *DatabaseBackupSchedule, old *DatabaseBackupSchedule) error {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+	if (s.Spec.Database == "") == (s.Spec.Environment == "") {
+		errs = append(errs, field.Invalid(path, s.Spec.Database+s.Spec.Environment, "exactly one of database or environment is required"))
+	}
+	if _, err := s.ParseSchedule(); err != nil {
+		errs = append(errs, field.Invalid(path.Child("schedule"), s.Spec.Schedule, err.Error()))
+	}
+	errs = append(errs, s.Spec.Target.Validate(path.Child("target"))...)
+	errs = append(errs, s.Spec.Retention.validate(path.Child("retention"))...)
+	if err := errs.ToAggregate(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+
+	var oldp protectable
+	if old != nil {
+		oldp = old
+	}
+	if err := ValidateDeletionProtection(s, oldp); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r BackupRetention) validate(path *field.Path) (errs field.ErrorList) {
+	rules := []struct {
+		name  string
+		value int32
+	}{
+		{"keepLast", r.KeepLast},
+		{"daily", r.Daily},
+		{"weekly", r.Weekly},
+		{"monthly", r.Monthly},
+	}
+	for _, rule := range rules {
+		if rule.value < 0 {
+			errs = append(errs, field.Invalid(path.Child(rule.name), rule.value, "must be greater than or equal to 0"))
+		}
+	}
+	return
+}
@@ -0,0 +1,134 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Important: Run "operator-sdk generate k8s && operator-sdk generate crds" to regenerate code after modifying this file
+// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+
+// DatabaseRestoreSpec defines the desired state of DatabaseRestore
+// +k8s:openapi-gen=true
+type DatabaseRestoreSpec struct {
+	// Backup is the name of the DatabaseBackup to restore, in the same namespace
+	Backup string `json:"backup"`
+	// Database is the name of the Database to restore the backup into, in the same namespace. It may be another Database
+	// than the one that was backed up.
+	Database string `json:"database"`
+	// Maintenance puts the Sites of the Database into maintenance while it's restored, so that they respond with
+	// 503 Service Unavailable
+	Maintenance bool `json:"maintenance,omitempty"` // +optional
+}
+
+// DatabaseRestoreStatus defines the observed state of DatabaseRestore
+// +k8s:openapi-gen=true
+type DatabaseRestoreStatus struct {
+	Phase DatabaseJobPhase `json:"phase,omitempty"` // +optional
+	// Message explains the phase, e.g. why the restore failed
+	Message        string       `json:"message,omitempty"`        // +optional
+	StartTime      *metav1.Time `json:"startTime,omitempty"`      // +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"` // +optional
+	// Duration is how long the restore Job ran
+	Duration *metav1.Duration `json:"duration,omitempty"` // +optional
+	// MaintenanceSites are the names of the Sites that the restore put into maintenance
+	MaintenanceSites []string `json:"maintenanceSites,omitempty"` // +optional
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseRestore is the Schema for the databaserestores API
+// +kubebuilder:resource:shortName=dbrestore,scope=Namespaced
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Backup",type="string",JSONPath=".spec.backup"
+// +kubebuilder:printcolumn:name="Database",type="string",JSONPath=".spec.database"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type DatabaseRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseRestoreSpec   `json:"spec,omitempty"`
+	Status DatabaseRestoreStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseRestoreList contains a list of DatabaseRestore
+type DatabaseRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseRestore{}, &DatabaseRestoreList{})
+}
+
+// MaintenanceReason returns the value of the MaintenanceAnnotation of the Sites that the restore puts into maintenance
+func (r *DatabaseRestore) MaintenanceReason() string {
+	return "databaserestore/" + r.Name
+}
+
+var _ webhook.Validator = &DatabaseRestore{}
+
+func (r *DatabaseRestore) ValidateCreate() error {
+	log := logf.Log.WithName("databaserestorevalidator").WithValues("operation", "create")
+	return validateDatabaseRestore(log, r, nil)
+}
+
+func (r *DatabaseRestore) ValidateUpdate(old runtime.Object) error {
+	log := logf.Log.WithName("databaserestorevalidator").WithValues("operation", "update")
+	oldr, ok := old.(*DatabaseRestore)
+	if !ok {
+		return fmt.Errorf("invalid old object passed.")
+	}
+	return validateDatabaseRestore(log, r, oldr)
+}
+
+func (r *DatabaseRestore) ValidateDelete() error {
+	log := logf.Log.WithName("databaserestorevalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(r); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// validateDatabaseRestore validates a created (if old is nil) or updated DatabaseRestore. The spec can't be updated,
+// since the restore runs once.
+func validateDatabaseRestore(log logr.Logger, r *DatabaseRestore, old *DatabaseRestore) error {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+	if r.Spec.Backup == "" {
+		errs = append(errs, field.Required(path.Child("backup"), ""))
+	}
+	if r.Spec.Database == "" {
+		errs = append(errs, field.Required(path.Child("database"), ""))
+	}
+	if old != nil && !equality.Semantic.DeepEqual(r.Spec, old.Spec) {
+		errs = append(errs, field.Forbidden(path, "is immutable"))
+	}
+	if err := errs.ToAggregate(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+
+	var oldp protectable
+	if old != nil {
+		oldp = old
+	}
+	if err := ValidateDeletionProtection(r, oldp); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
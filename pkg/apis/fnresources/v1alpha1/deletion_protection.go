@@ -0,0 +1,120 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DeletionProtectionAnnotation sets the DeletionProtection of a resource
+	DeletionProtectionAnnotation = LabelPrefix + "deletion-protection"
+	// DeletionUnlockedByAnnotation records the user who disabled the deletion protection of a resource
+	DeletionUnlockedByAnnotation = LabelPrefix + "deletion-unlocked-by"
+	// DeletionUnlockedAtAnnotation records when the deletion protection of a resource was disabled, in RFC 3339 format
+	DeletionUnlockedAtAnnotation = LabelPrefix + "deletion-unlocked-at"
+)
+
+// DeletionProtection says whether a resource may be deleted. Protection is disabled in two steps: from "enabled" to
+// "unlock-requested", and then to "disabled".
+type DeletionProtection string
+
+const (
+	DeletionProtectionEnabled         DeletionProtection = "enabled"
+	DeletionProtectionUnlockRequested DeletionProtection = "unlock-requested"
+	DeletionProtectionDisabled        DeletionProtection = "disabled"
+)
+
+// IsValid returns true for the known deletion protections
+func (p DeletionProtection) IsValid() bool {
+	return p == DeletionProtectionEnabled || p == DeletionProtectionUnlockRequested || p == DeletionProtectionDisabled
+}
+
+// Protects returns true if the resource may not be deleted
+func (p DeletionProtection) Protects() bool {
+	return p != DeletionProtectionDisabled
+}
+
+// protectable is a type whose objects may be protected from deletion with the DeletionProtectionAnnotation
+type protectable interface {
+	metav1.Object
+
+	// deletionProtectedByDefault reports whether the object is protected if it isn't annotated
+	deletionProtectedByDefault() bool
+}
+
+// GetDeletionProtection returns the deletion protection the object is annotated with, or else its default: "enabled"
+// for production DrupalEnvironments and their Databases, and "disabled" otherwise
+func GetDeletionProtection(obj protectable) DeletionProtection {
+	if p, ok := obj.GetAnnotations()[DeletionProtectionAnnotation]; ok {
+		return DeletionProtection(p)
+	}
+	if obj.deletionProtectedByDefault() {
+		return DeletionProtectionEnabled
+	}
+	return DeletionProtectionDisabled
+}
+
+// ValidateDeletion denies deleting objects that are protected
+func ValidateDeletion(obj protectable) error {
+	p := GetDeletionProtection(obj)
+	if !p.Protects() {
+		return nil
+	}
+	if p == DeletionProtectionUnlockRequested {
+		return fmt.Errorf("%s is protected from deletion; set the %s annotation to %q to unlock it", obj.GetName(), DeletionProtectionAnnotation, DeletionProtectionDisabled)
+	}
+	return fmt.Errorf("%s is protected from deletion; set the %s annotation to %q, and then to %q, to unlock it",
+		obj.GetName(), DeletionProtectionAnnotation, DeletionProtectionUnlockRequested, DeletionProtectionDisabled)
+}
+
+// ValidateDeletionProtection checks the deletion protection annotation of a created (if old is nil) or updated object.
+// Protection can only be disabled if an unlock was requested by a previous update.
+func ValidateDeletionProtection(obj, old protectable) error {
+	p := GetDeletionProtection(obj)
+	if !p.IsValid() {
+		return fmt.Errorf("%s must be one of %q, %q or %q", DeletionProtectionAnnotation, DeletionProtectionEnabled, DeletionProtectionUnlockRequested, DeletionProtectionDisabled)
+	}
+	if old == nil || p.Protects() {
+		return nil
+	}
+
+	oldp := GetDeletionProtection(old)
+	if oldp.Protects() && oldp != DeletionProtectionUnlockRequested {
+		return fmt.Errorf("deletion protection can't be disabled in one step; set %s to %q first", DeletionProtectionAnnotation, DeletionProtectionUnlockRequested)
+	}
+	return nil
+}
+
+func (a *DrupalApplication) deletionProtectedByDefault() bool {
+	return false
+}
+
+func (e *DrupalEnvironment) deletionProtectedByDefault() bool {
+	return e.Spec.Production
+}
+
+func (s *Site) deletionProtectedByDefault() bool {
+	return false
+}
+
+// Databases can't refer to their DrupalEnvironment, so the Site Controller labels those of production environments
+func (d *Database) deletionProtectedByDefault() bool {
+	return d.Labels[ProductionLabel] == "true"
+}
+
+func (c *Command) deletionProtectedByDefault() bool {
+	return false
+}
+
+func (b *DatabaseBackup) deletionProtectedByDefault() bool {
+	return false
+}
+
+func (r *DatabaseRestore) deletionProtectedByDefault() bool {
+	return false
+}
+
+func (s *DatabaseBackupSchedule) deletionProtectedByDefault() bool {
+	return false
+}
@@ -0,0 +1,166 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func protectedEnvironment(production bool, protection DeletionProtection) *DrupalEnvironment {
+	env := &DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-prod"},
+		Spec:       DrupalEnvironmentSpec{Production: production},
+	}
+	if protection != "" {
+		env.Annotations = map[string]string{DeletionProtectionAnnotation: string(protection)}
+	}
+	return env
+}
+
+func TestValidateDeletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		production bool
+		protection DeletionProtection
+		err        string
+	}{
+		{
+			name: "unprotected by default",
+		},
+		{
+			name:       "protected by default in production",
+			production: true,
+			err:        `wlgore-prod is protected from deletion; set the fnresources.acquia.io/deletion-protection annotation to "unlock-requested", and then to "disabled", to unlock it`,
+		},
+		{
+			name:       "protected",
+			protection: DeletionProtectionEnabled,
+			err:        "wlgore-prod is protected from deletion",
+		},
+		{
+			name:       "unlock requested",
+			production: true,
+			protection: DeletionProtectionUnlockRequested,
+			err:        `wlgore-prod is protected from deletion; set the fnresources.acquia.io/deletion-protection annotation to "disabled" to unlock it`,
+		},
+		{
+			name:       "unlocked",
+			production: true,
+			protection: DeletionProtectionDisabled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := protectedEnvironment(test.production, test.protection).ValidateDelete()
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestValidateDeletionProtection(t *testing.T) {
+	tests := []struct {
+		name          string
+		production    bool
+		oldProtection DeletionProtection
+		protection    DeletionProtection
+		err           string
+	}{
+		{
+			name:          "protect",
+			oldProtection: DeletionProtectionDisabled,
+			protection:    DeletionProtectionEnabled,
+		},
+		{
+			name:          "request an unlock",
+			oldProtection: DeletionProtectionEnabled,
+			protection:    DeletionProtectionUnlockRequested,
+		},
+		{
+			name:          "cancel an unlock request",
+			oldProtection: DeletionProtectionUnlockRequested,
+			protection:    DeletionProtectionEnabled,
+		},
+		{
+			name:          "unlock",
+			oldProtection: DeletionProtectionUnlockRequested,
+			protection:    DeletionProtectionDisabled,
+		},
+		{
+			name:          "unlock in one step",
+			oldProtection: DeletionProtectionEnabled,
+			protection:    DeletionProtectionDisabled,
+			err:           `deletion protection can't be disabled in one step; set fnresources.acquia.io/deletion-protection to "unlock-requested" first`,
+		},
+		{
+			name:       "unlock the production default in one step",
+			production: true,
+			protection: DeletionProtectionDisabled,
+			err:        "deletion protection can't be disabled in one step",
+		},
+		{
+			name:          "remove the annotation of a protected object",
+			oldProtection: DeletionProtectionEnabled,
+			err:           "deletion protection can't be disabled in one step",
+		},
+		{
+			name:       "invalid value",
+			protection: "true",
+			err:        `fnresources.acquia.io/deletion-protection must be one of "enabled", "unlock-requested" or "disabled"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := protectedEnvironment(test.production, test.protection)
+			old := protectedEnvironment(test.production, test.oldProtection)
+			err := ValidateDeletionProtection(env, old)
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestDatabase_ValidateDeletionProtection(t *testing.T) {
+	d := &Database{ObjectMeta: metav1.ObjectMeta{
+		Name:        "wlgore-database",
+		Annotations: map[string]string{DeletionProtectionAnnotation: string(DeletionProtectionEnabled)},
+	}}
+	require.Error(t, d.ValidateDelete())
+
+	unlocked := d.DeepCopy()
+	unlocked.Annotations[DeletionProtectionAnnotation] = string(DeletionProtectionDisabled)
+	require.Error(t, unlocked.ValidateUpdate(d))
+	require.NoError(t, d.ValidateCreate())
+}
+
+func TestDatabase_ValidateDelete_Production(t *testing.T) {
+	// Databases of production environments are protected by default
+	d := &Database{ObjectMeta: metav1.ObjectMeta{
+		Name:   "wlgore-database",
+		Labels: map[string]string{ProductionLabel: "true"},
+	}}
+	require.Error(t, d.ValidateDelete())
+
+	// Removing the label disables protection in one step
+	unlabelled := d.DeepCopy()
+	delete(unlabelled.Labels, ProductionLabel)
+	require.NoError(t, unlabelled.ValidateDelete())
+	require.Error(t, unlabelled.ValidateUpdate(d))
+
+	unlocked := d.DeepCopy()
+	unlocked.Annotations = map[string]string{DeletionProtectionAnnotation: string(DeletionProtectionDisabled)}
+	require.Error(t, unlocked.ValidateUpdate(d))
+	unlocked.Annotations[DeletionProtectionAnnotation] = string(DeletionProtectionUnlockRequested)
+	require.NoError(t, unlocked.ValidateUpdate(d))
+	require.Error(t, unlocked.ValidateDelete())
+}
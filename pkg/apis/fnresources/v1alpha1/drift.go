@@ -0,0 +1,18 @@
+package v1alpha1
+
+// DriftedCondition is True when child resources were changed outside of the operator, and the changes were kept
+// because of their drift policy (see DriftPolicyAnnotation). Its message lists the changed objects and fields.
+const DriftedCondition ConditionType = "Drifted"
+
+// AppliedResource records the desired state of a child resource that the operator last applied, to tell changes to
+// the desired state apart from changes made to the child outside of the operator
+// +k8s:openapi-gen=true
+type AppliedResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// AppliedHash is a hash of the desired state that was last applied
+	AppliedHash string `json:"appliedHash"`
+	// AdoptedFields are the JSON pointers of the fields whose live values were adopted, rather than reverted to the
+	// desired state
+	AdoptedFields []string `json:"adoptedFields,omitempty"` // +optional
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/acquia/fn-go-utils/pkg/operatorutils"
 	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -27,6 +28,52 @@ var appChildLabels = []string{
 type DrupalApplicationSpec struct {
 	ImageRepo string `json:"imageRepo,omitempty"` // +optional
 	GitRepo   string `json:"gitRepo"`
+
+	// QuotaProfiles, keyed by environment stage (e.g. "prod", "test", "dev"), override the operator's default quota
+	// profiles for this application's environments
+	QuotaProfiles map[string]QuotaProfile `json:"quotaProfiles,omitempty"` // +optional
+
+	// EnvironmentTemplates, keyed by name, hold the defaults of the Drupal, Apache and PHP-FPM settings of this
+	// application's environments. Environments use the template they name, or else the one named after their stage.
+	EnvironmentTemplates map[string]EnvironmentTemplate `json:"environmentTemplates,omitempty"` // +optional
+
+	// Environments are provisioned by the operator, each as a DrupalEnvironment in a namespace of its own
+	// +listType=map
+	// +listMapKey=name
+	Environments []ProvisionedEnvironment `json:"environments,omitempty"` // +optional
+}
+
+// EnvironmentTemplate holds the defaults of settings of a DrupalEnvironment's spec. Settings that the environment sets
+// override the template's.
+// +k8s:openapi-gen=true
+type EnvironmentTemplate struct {
+	CustomEnvironmentVariables []v1.EnvVar `json:"customEnvironmentVariables,omitempty"` // +optional
+
+	Drupal SpecDrupal `json:"drupal,omitempty"` // +optional
+	Apache SpecApache `json:"apache,omitempty"` // +optional
+	Phpfpm SpecPhpFpm `json:"phpfpm,omitempty"` // +optional
+}
+
+// ProvisionedEnvironment declares a DrupalEnvironment that the operator creates, along with its namespace
+// +k8s:openapi-gen=true
+type ProvisionedEnvironment struct {
+	// Name is the name of both the DrupalEnvironment and its namespace
+	Name string `json:"name"`
+	// NamespaceLabels are added to the namespace, along with the operator's standard labels
+	NamespaceLabels map[string]string `json:"namespaceLabels,omitempty"` // +optional
+	// NamespaceAnnotations are added to the namespace
+	NamespaceAnnotations map[string]string `json:"namespaceAnnotations,omitempty"` // +optional
+	// Spec is the spec of the DrupalEnvironment. Its application is always set to this DrupalApplication.
+	Spec DrupalEnvironmentSpec `json:"spec"`
+}
+
+// QuotaProfile defines the ResourceQuota and LimitRange applied to the namespace of a DrupalEnvironment
+// +k8s:openapi-gen=true
+type QuotaProfile struct {
+	// Hard is the set of hard limits for the namespace's ResourceQuota
+	Hard v1.ResourceList `json:"hard,omitempty"` // +optional
+	// Limits are the items of the namespace's LimitRange
+	Limits []v1.LimitRangeItem `json:"limits,omitempty"` // +optional
 }
 
 // DrupalEnvironmentRef defines a reference to a DrupalEnvironment
@@ -112,7 +159,7 @@ var _ webhook.Validator = &DrupalApplication{}
 
 func (a *DrupalApplication) ValidateCreate() error {
 	log := logf.Log.WithName("drupalapplicationvalidator").WithValues("operation", "create")
-	return validateApp(log, a, &DrupalApplication{})
+	return validateApp(log, a, nil)
 }
 
 func (a *DrupalApplication) ValidateUpdate(old runtime.Object) error {
@@ -125,30 +172,19 @@ func (a *DrupalApplication) ValidateUpdate(old runtime.Object) error {
 }
 
 func (a *DrupalApplication) ValidateDelete() error {
+	log := logf.Log.WithName("drupalapplicationvalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(a); err != nil {
+		log.Info(err.Error())
+		return err
+	}
 	return nil
 }
 
-func validateApp(log logr.Logger, a *DrupalApplication, olda *DrupalApplication) error {
-	// THIS IS JUST AN EXAMPLE
-	// The behavior is essentially anytime you annotate an application
-	// with `deny: "true"`, this webhook will deny the request UNLESS
-	// it was previously annotated with "deny: allow-next"
-	// Once you've set it to "deny : allow-next", you can set `deny: "true"`
-	// on the server.  At which point, ALL updates will be refused until you
-	// set "allow-next" again which allows you to remove the annotation.
-	// Delete is exempt from this behavior.
-	ann := a.GetAnnotations()
-	oldann := olda.GetAnnotations()
-
-	if ann["deny"] == "true" && oldann["deny"] != "allow-next" {
-		log.Info("Denying your request.")
-		return fmt.Errorf("request denied.  change 'deny' to 'allow-next' to allow.")
+// validateApp validates a created (if olda is nil) or updated DrupalApplication
+func validateApp(log logr.Logger, a *DrupalApplication, olda protectable) error {
+	if err := ValidateDeletionProtection(a, olda); err != nil {
+		log.Info(err.Error())
+		return err
 	}
-
-	if oldann["deny"] == "true" && ann["deny"] != "allow-next" {
-		log.Info("Denying your request.")
-		return fmt.Errorf("request denied.  change 'deny' to 'allow-next' to allow.")
-	}
-
 	return nil
 }
@@ -5,12 +5,18 @@ package v1alpha1
 // SEE: https://book.kubebuilder.io/reference/generating-crd.html
 
 import (
+	"fmt"
+	"reflect"
 	"strings"
 
+	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/acquia/fn-go-utils/pkg/operatorutils"
 )
@@ -44,66 +50,97 @@ type DrupalEnvironmentSpec struct {
 	Stage                      string      `json:"stage"`
 	CustomEnvironmentVariables []v1.EnvVar `json:"customEnvironmentVariables,omitempty"` // +optional
 
-	Drupal SpecDrupal `json:"drupal"`
-	Apache SpecApache `json:"apache"`
-	Phpfpm SpecPhpFpm `json:"phpfpm"`
+	// Template names the DrupalApplication's environment template, which the Drupal, Apache and PHP-FPM settings that
+	// are left out default to. Defaults to the template named after the stage, if there is one.
+	Template string `json:"template,omitempty"` // +optional
+
+	Drupal SpecDrupal `json:"drupal,omitempty"` // +optional
+	Apache SpecApache `json:"apache,omitempty"` // +optional
+	Phpfpm SpecPhpFpm `json:"phpfpm,omitempty"` // +optional
 }
 
 // SpecDrupal represents drupalenvironment.spec.drupal
 type SpecDrupal struct {
-	Tag                            string        `json:"tag"`
-	PullPolicy                     v1.PullPolicy `json:"pullPolicy"`
-	MinReplicas                    int32         `json:"minReplicas"`
-	MaxReplicas                    int32         `json:"maxReplicas"`
+	Tag                            string        `json:"tag,omitempty"`
+	PullPolicy                     v1.PullPolicy `json:"pullPolicy,omitempty"`
+	MinReplicas                    *int32        `json:"minReplicas,omitempty"`
+	MaxReplicas                    *int32        `json:"maxReplicas,omitempty"`
 	TargetCPUUtilizationPercentage *int32        `json:"targetCPUUtilizationPercentage,omitempty"`
 
-	Liveness  HTTPProbe `json:"livenessProbe"`
-	Readiness HTTPProbe `json:"readinessProbe"`
+	Liveness  HTTPProbe `json:"livenessProbe,omitempty"`
+	Readiness HTTPProbe `json:"readinessProbe,omitempty"`
 }
 
 // SpecApache represents drupalenvironment.spec.apache
 type SpecApache struct {
 	CustomImage string `json:"customImage,omitempty"` // +optional
-	Tag         string `json:"tag"`
+	Tag         string `json:"tag,omitempty"`
 
-	WebRoot string    `json:"webRoot"`
-	Cpu     Resources `json:"cpu"`
-	Memory  Resources `json:"memory"`
+	WebRoot string    `json:"webRoot,omitempty"`
+	Cpu     Resources `json:"cpu,omitempty"`
+	Memory  Resources `json:"memory,omitempty"`
 }
 
 // SpecPhpFpm represents drupalenvironment.spec.phpfpm
 type SpecPhpFpm struct {
 	CustomImage string `json:"customImage,omitempty"` // +optional
-	Tag         string `json:"tag"`
-
-	Procs                           int32     `json:"procs"`
-	MaxInputVars                    int32     `json:"maxInputVars"`
-	MaxExecutionTime                int32     `json:"maxExecutionTime"`
-	ProcMemoryLimitMiB              int32     `json:"procMemoryLimitMiB"`
-	PostMaxSizeMiB                  int32     `json:"postMaxSizeMiB"`
-	OpcacheMemoryLimitMiB           int32     `json:"opcacheMemoryLimitMiB"`
-	OpcacheInternedStringsBufferMiB int32     `json:"opcacheInternedStringsBufferMiB"`
-	ApcMemoryLimitMiB               int32     `json:"apcMemoryLimitMiB"`
-	Cpu                             Resources `json:"cpu"`
-
-	NewRelicSecret  string `json:"newRelicSecret,omitempty"`  // +optional
+	Tag         string `json:"tag,omitempty"`
+
+	Procs                           *int32    `json:"procs,omitempty"`
+	MaxInputVars                    *int32    `json:"maxInputVars,omitempty"`
+	MaxExecutionTime                *int32    `json:"maxExecutionTime,omitempty"`
+	ProcMemoryLimitMiB              *int32    `json:"procMemoryLimitMiB,omitempty"`
+	PostMaxSizeMiB                  *int32    `json:"postMaxSizeMiB,omitempty"`
+	OpcacheMemoryLimitMiB           *int32    `json:"opcacheMemoryLimitMiB,omitempty"`
+	OpcacheInternedStringsBufferMiB *int32    `json:"opcacheInternedStringsBufferMiB,omitempty"`
+	ApcMemoryLimitMiB               *int32    `json:"apcMemoryLimitMiB,omitempty"`
+	Cpu                             Resources `json:"cpu,omitempty"`
+
+	// Apm configures Application Performance Monitoring of PHP
+	Apm SpecAPM `json:"apm,omitempty"` // +optional
+
+	// Deprecated: use Apm instead. Migrated automatically to an Apm section with the "newrelic" provider.
+	NewRelicSecret string `json:"newRelicSecret,omitempty"` // +optional
+	// Deprecated: use Apm instead. Migrated automatically to an Apm section with the "newrelic" provider.
 	NewRelicAppName string `json:"newRelicAppName,omitempty"` // +optional
 }
 
+// APMProvider names a supported Application Performance Monitoring provider
+// +kubebuilder:validation:Enum=newrelic;datadog;opentelemetry
+type APMProvider string
+
+const (
+	APMProviderNewRelic      APMProvider = "newrelic"
+	APMProviderDatadog       APMProvider = "datadog"
+	APMProviderOpenTelemetry APMProvider = "opentelemetry"
+)
+
+// SpecAPM represents drupalenvironment.spec.phpfpm.apm
+type SpecAPM struct {
+	// Provider is the APM provider to instrument PHP for. APM is disabled if empty.
+	Provider APMProvider `json:"provider,omitempty"` // +optional
+	// Secret is the name of a Secret holding the provider's credentials, if it needs any
+	Secret string `json:"secret,omitempty"` // +optional
+	// AppName is the application (or service) name reported to the provider. Defaults to "<application> - <environment>".
+	AppName string `json:"appName,omitempty"` // +optional
+	// Settings holds provider-specific settings
+	Settings map[string]string `json:"settings,omitempty"` // +optional
+}
+
 // Resources specifies container resource requests and limits
 type Resources struct {
-	Request resource.Quantity `json:"request"`
-	Limit   resource.Quantity `json:"limit"`
+	Request resource.Quantity `json:"request,omitempty"`
+	Limit   resource.Quantity `json:"limit,omitempty"`
 }
 
 // HTTPProbe specifies a container's HTTP liveness/readiness probe
 type HTTPProbe struct {
-	Enabled          bool   `json:"enabled"`
-	HTTPPath         string `json:"httpPath"`
-	TimeoutSeconds   int32  `json:"timeoutSeconds"`
-	FailureThreshold int32  `json:"failureThreshold"`
-	SuccessThreshold int32  `json:"successThreshold"`
-	PeriodSeconds    int32  `json:"periodSeconds"`
+	Enabled          *bool  `json:"enabled,omitempty"`
+	HTTPPath         string `json:"httpPath,omitempty"`
+	TimeoutSeconds   *int32 `json:"timeoutSeconds,omitempty"`
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+	PeriodSeconds    *int32 `json:"periodSeconds,omitempty"`
 }
 
 // DrupalEnvironmentStatus defines the observed state of DrupalEnvironment
@@ -111,8 +148,21 @@ type HTTPProbe struct {
 type DrupalEnvironmentStatus struct {
 	NumDrupal int32                       `json:"numDrupal"`
 	Status    DrupalEnvironmentStatusType `json:"status"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"` // +optional
+	// AppliedResources records the desired state of the child resources last applied, for drift detection
+	AppliedResources []AppliedResource `json:"appliedResources,omitempty"` // +optional
+	// EffectiveSpec is the spec last reconciled, resolved from the environment's template
+	EffectiveSpec *DrupalEnvironmentSpec `json:"effectiveSpec,omitempty"` // +optional
 }
 
+const (
+	// QuotaExceededCondition is True when the environment can't scale to its maximum size within its namespace's
+	// ResourceQuota
+	QuotaExceededCondition ConditionType = "QuotaExceeded"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // DrupalEnvironment is the Schema for the drupalenvironments API
@@ -185,6 +235,177 @@ func (e DrupalEnvironment) ChildLabels() map[string]string {
 	return ls
 }
 
+// ChildName returns the name of the environment's child resource for the given component, such as "drupal" or
+// "php-config"
+func (e DrupalEnvironment) ChildName(component string) string {
+	return EnvironmentChildName(e.Name, component)
+}
+
+// EnvironmentChildName returns the name of the child resource for the given component of the named DrupalEnvironment.
+// Children are prefixed with the environment's name, so that several environments can share a namespace.
+func EnvironmentChildName(environment, component string) string {
+	return environment + "-" + component
+}
+
+// ResolveSpec returns the environment's spec, with the settings it leaves unset taken from its template in the given
+// DrupalApplication: the one it names, or else the one named after its stage, if any. Structs are resolved field by
+// field, while other settings (such as lists and maps) are taken from the template as a whole. Booleans and numbers are
+// pointers, so that they can be overridden with false or 0.
+func (e *DrupalEnvironment) ResolveSpec(app *DrupalApplication) (DrupalEnvironmentSpec, error) {
+	spec := *e.Spec.DeepCopy()
+
+	name := e.Spec.Template
+	template, ok := app.Spec.EnvironmentTemplates[name]
+	if name == "" {
+		template, ok = app.Spec.EnvironmentTemplates[e.Spec.Stage]
+		if !ok {
+			return spec, nil
+		}
+	} else if !ok {
+		return spec, fmt.Errorf("environment template %q not found in DrupalApplication %q", name, app.Name)
+	}
+
+	template = *template.DeepCopy()
+	if spec.CustomEnvironmentVariables == nil {
+		spec.CustomEnvironmentVariables = template.CustomEnvironmentVariables
+	}
+	inheritUnset(reflect.ValueOf(&spec.Drupal).Elem(), reflect.ValueOf(template.Drupal))
+	inheritUnset(reflect.ValueOf(&spec.Apache).Elem(), reflect.ValueOf(template.Apache))
+	inheritUnset(reflect.ValueOf(&spec.Phpfpm).Elem(), reflect.ValueOf(template.Phpfpm))
+	return spec, nil
+}
+
+// inheritUnset sets the unset (nil or empty) fields of the struct dst to those of src, recursing into the structs of this
+// package. Structs of other packages (e.g. resource.Quantity) are inherited as a whole.
+func inheritUnset(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, s := dst.Field(i), src.Field(i)
+		switch {
+		case d.Kind() == reflect.Struct && d.Type().PkgPath() == dst.Type().PkgPath():
+			inheritUnset(d, s)
+		case d.IsZero():
+			d.Set(s)
+		}
+	}
+}
+
+// DefaultTargetCPUUtilizationPercentage is the average CPU utilization of Drupal Pods that autoscaling targets, unless
+// set otherwise
+const DefaultTargetCPUUtilizationPercentage int32 = 50
+
+// SetDefaults sets the settings that are still unset once the spec is resolved (see ResolveSpec) to their defaults
+func (s *DrupalEnvironmentSpec) SetDefaults() {
+	if s.Drupal.MinReplicas == nil {
+		minReplicas := int32(1)
+		s.Drupal.MinReplicas = &minReplicas
+	}
+	if s.Drupal.MaxReplicas == nil {
+		maxReplicas := *s.Drupal.MinReplicas
+		s.Drupal.MaxReplicas = &maxReplicas
+	}
+	if s.Drupal.TargetCPUUtilizationPercentage == nil {
+		target := DefaultTargetCPUUtilizationPercentage
+		s.Drupal.TargetCPUUtilizationPercentage = &target
+	}
+}
+
+// Validate checks the settings of the spec. Unset settings are skipped, since they may be left to a template.
+func (s *DrupalEnvironmentSpec) Validate() error {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+
+	if s.Application == "" {
+		errs = append(errs, field.Required(path.Child("application"), ""))
+	}
+	if s.Stage == "" {
+		errs = append(errs, field.Required(path.Child("stage"), ""))
+	}
+
+	drupal := path.Child("drupal")
+	minReplicas, maxReplicas := s.Drupal.MinReplicas, s.Drupal.MaxReplicas
+	if minReplicas != nil && *minReplicas < 1 {
+		errs = append(errs, field.Invalid(drupal.Child("minReplicas"), *minReplicas, "must be positive"))
+	}
+	if maxReplicas != nil && *maxReplicas < 1 {
+		errs = append(errs, field.Invalid(drupal.Child("maxReplicas"), *maxReplicas, "must be positive"))
+	}
+	if minReplicas != nil && maxReplicas != nil && *minReplicas > *maxReplicas {
+		errs = append(errs, field.Invalid(drupal.Child("minReplicas"), *minReplicas, fmt.Sprintf("must not be greater than maxReplicas (%d)", *maxReplicas)))
+	}
+	if target := s.Drupal.TargetCPUUtilizationPercentage; target != nil && *target <= 0 {
+		errs = append(errs, field.Invalid(drupal.Child("targetCPUUtilizationPercentage"), *target, "must be positive"))
+	}
+	switch s.Drupal.PullPolicy {
+	case "", v1.PullAlways, v1.PullIfNotPresent, v1.PullNever:
+	default:
+		errs = append(errs, field.NotSupported(drupal.Child("pullPolicy"), string(s.Drupal.PullPolicy), []string{string(v1.PullAlways), string(v1.PullIfNotPresent), string(v1.PullNever)}))
+	}
+
+	apache := path.Child("apache")
+	errs = append(errs, s.Apache.Cpu.validate(apache.Child("cpu"))...)
+	errs = append(errs, s.Apache.Memory.validate(apache.Child("memory"))...)
+	errs = append(errs, s.Phpfpm.Cpu.validate(path.Child("phpfpm", "cpu"))...)
+
+	return errs.ToAggregate()
+}
+
+// validate checks that the limit isn't lower than the request, if both are set
+func (r Resources) validate(path *field.Path) field.ErrorList {
+	if r.Request.IsZero() || r.Limit.IsZero() || r.Limit.Cmp(r.Request) >= 0 {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(path.Child("limit"), r.Limit.String(), fmt.Sprintf("must not be lower than the request (%s)", r.Request.String()))}
+}
+
+var _ webhook.Validator = &DrupalEnvironment{}
+var _ webhook.Defaulter = &DrupalEnvironment{}
+
+func (e *DrupalEnvironment) ValidateCreate() error {
+	log := logf.Log.WithName("drupalenvironmentvalidator").WithValues("operation", "create")
+	return validateEnvironment(log, e, nil)
+}
+
+func (e *DrupalEnvironment) ValidateUpdate(old runtime.Object) error {
+	log := logf.Log.WithName("drupalenvironmentvalidator").WithValues("operation", "update")
+	olde, ok := old.(*DrupalEnvironment)
+	if !ok {
+		return fmt.Errorf("invalid old object passed.")
+	}
+	return validateEnvironment(log, e, olde)
+}
+
+func (e *DrupalEnvironment) ValidateDelete() error {
+	log := logf.Log.WithName("drupalenvironmentvalidator").WithValues("operation", "delete")
+	if err := ValidateDeletion(e); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// validateEnvironment validates a created (if old is nil) or updated DrupalEnvironment
+func validateEnvironment(log logr.Logger, e *DrupalEnvironment, old protectable) error {
+	if err := e.Spec.Validate(); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	if err := ValidateDeletionProtection(e, old); err != nil {
+		log.Info(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Default migrates the spec to its latest version. The settings that templates may set are only defaulted once the
+// spec is resolved, by the DrupalEnvironment Controller (see SetDefaults). Admission webhooks can't record Events, so
+// the warnings of the migration are only logged.
+func (e *DrupalEnvironment) Default() {
+	log := logf.Log.WithName("drupalenvironmentdefaulter")
+	if report := Migrate(e); report != nil {
+		log.Info("Migrated spec", "version", report.To, "steps", report.Steps, "warnings", report.Warnings)
+	}
+}
+
 /*****************
 **  Migrations  **
 *****************/
@@ -192,19 +413,42 @@ func (e DrupalEnvironment) ChildLabels() map[string]string {
 // Ensure DrupalEnvironment implements "versionedType"
 var _ versionedType = &DrupalEnvironment{}
 
+// drupalEnvironmentMigrations are the migration steps of DrupalEnvironments. To change the spec in a way that existing
+// objects need migrating, append a step to the next version.
+var drupalEnvironmentMigrations = []MigrationStep{
+	{
+		Version:     2,
+		Description: "Back-fill spec.stage from the name",
+		Migrate:     func(o metav1.Object) []string { return migrateEnvironmentStage(o.(*DrupalEnvironment)) },
+		Needed:      func(o metav1.Object) bool { return o.(*DrupalEnvironment).Spec.Stage == "" },
+	},
+	{
+		Version:     3,
+		Description: "Move the New Relic settings of spec.phpfpm into spec.phpfpm.apm",
+		Migrate:     func(o metav1.Object) []string { return migrateEnvironmentNewRelic(o.(*DrupalEnvironment)) },
+		Needed: func(o metav1.Object) bool {
+			phpfpm := o.(*DrupalEnvironment).Spec.Phpfpm
+			return phpfpm.NewRelicSecret != "" || phpfpm.NewRelicAppName != ""
+		},
+	},
+}
+
 // SpecVersion returns the latest resource Spec version number for this type. Any resources with an earlier version
-// label (or no label) should be processed by doMigrate().
+// label (or no label) should be processed by Migrate().
 func (e *DrupalEnvironment) SpecVersion() string {
-	return "2"
+	return latestVersion(drupalEnvironmentMigrations)
 }
 
-func (e *DrupalEnvironment) migrationNeeded() bool {
-	return e.Spec.Stage == ""
+func (e *DrupalEnvironment) migrationSteps() []MigrationStep {
+	return drupalEnvironmentMigrations
 }
 
-func (e *DrupalEnvironment) doMigrate() {
-	// Migrate version "1" -> "2":
-	// Back-fill Stage field based on Name (and ensure Production field is in sync)
+// migrateEnvironmentStage migrates version "1" to "2": it back-fills the Stage based on the name, and syncs the
+// Production field with it. Since the stage is a guess, it's reported in a warning.
+func migrateEnvironmentStage(e *DrupalEnvironment) []string {
+	if e.Spec.Stage != "" {
+		return nil
+	}
 
 	e.Spec.Production = false
 	if strings.Contains(e.Name, "dev") {
@@ -215,4 +459,25 @@ func (e *DrupalEnvironment) doMigrate() {
 		e.Spec.Production = true
 		e.Spec.Stage = "prod"
 	}
+	return []string{fmt.Sprintf("spec.stage was guessed to be %q from the name %q; set it if that's wrong", e.Spec.Stage, e.Name)}
+}
+
+// migrateEnvironmentNewRelic migrates version "2" to "3": it moves the New Relic settings into the generic APM section,
+// unless that already configures a provider
+func migrateEnvironmentNewRelic(e *DrupalEnvironment) (warnings []string) {
+	phpfpm := &e.Spec.Phpfpm
+	if phpfpm.NewRelicSecret != "" {
+		if phpfpm.Apm.Provider == "" {
+			phpfpm.Apm = SpecAPM{
+				Provider: APMProviderNewRelic,
+				Secret:   phpfpm.NewRelicSecret,
+				AppName:  phpfpm.NewRelicAppName,
+			}
+		} else {
+			warnings = append(warnings, fmt.Sprintf("the New Relic settings were dropped, since spec.phpfpm.apm already configures the %q provider", phpfpm.Apm.Provider))
+		}
+	}
+	phpfpm.NewRelicSecret = ""
+	phpfpm.NewRelicAppName = ""
+	return warnings
 }
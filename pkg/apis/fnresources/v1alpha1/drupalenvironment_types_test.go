@@ -0,0 +1,220 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestResolveSpec(t *testing.T) {
+	app := &DrupalApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore"},
+		Spec: DrupalApplicationSpec{
+			EnvironmentTemplates: map[string]EnvironmentTemplate{
+				"dev": {
+					Drupal: SpecDrupal{Tag: "latest", MinReplicas: pointer.Int32Ptr(1), MaxReplicas: pointer.Int32Ptr(2)},
+				},
+				"large": {
+					CustomEnvironmentVariables: []v1.EnvVar{{Name: "SIZE", Value: "large"}},
+					Drupal:                     SpecDrupal{Tag: "stable", MinReplicas: pointer.Int32Ptr(4), MaxReplicas: pointer.Int32Ptr(16)},
+					Apache:                     SpecApache{Cpu: Resources{Request: resource.MustParse("500m"), Limit: resource.MustParse("1")}},
+				},
+			},
+		},
+	}
+
+	env := &DrupalEnvironment{
+		Spec: DrupalEnvironmentSpec{
+			Stage:    "dev",
+			Template: "large",
+			Drupal:   SpecDrupal{MaxReplicas: pointer.Int32Ptr(8)},
+			Apache:   SpecApache{Cpu: Resources{Limit: resource.MustParse("2")}},
+		},
+	}
+	spec, err := env.ResolveSpec(app)
+	require.NoError(t, err)
+	require.Equal(t, SpecDrupal{Tag: "stable", MinReplicas: pointer.Int32Ptr(4), MaxReplicas: pointer.Int32Ptr(8)}, spec.Drupal)
+	require.Equal(t, resource.MustParse("500m"), spec.Apache.Cpu.Request)
+	require.Equal(t, resource.MustParse("2"), spec.Apache.Cpu.Limit)
+	require.Equal(t, []v1.EnvVar{{Name: "SIZE", Value: "large"}}, spec.CustomEnvironmentVariables)
+	require.Equal(t, SpecDrupal{MaxReplicas: pointer.Int32Ptr(8)}, env.Spec.Drupal, "the environment's own spec shouldn't change")
+
+	// Without a named template, the one named after the stage is used
+	env.Spec.Template = ""
+	spec, err = env.ResolveSpec(app)
+	require.NoError(t, err)
+	require.Equal(t, SpecDrupal{Tag: "latest", MinReplicas: pointer.Int32Ptr(1), MaxReplicas: pointer.Int32Ptr(8)}, spec.Drupal)
+
+	// Settings can be overridden with false and 0
+	app.Spec.EnvironmentTemplates["dev"] = EnvironmentTemplate{
+		Drupal: SpecDrupal{Liveness: HTTPProbe{Enabled: pointer.BoolPtr(true), PeriodSeconds: pointer.Int32Ptr(10)}},
+		Phpfpm: SpecPhpFpm{MaxExecutionTime: pointer.Int32Ptr(30), Procs: pointer.Int32Ptr(4)},
+	}
+	overrides := env.DeepCopy()
+	overrides.Spec.Drupal = SpecDrupal{Liveness: HTTPProbe{Enabled: pointer.BoolPtr(false)}}
+	overrides.Spec.Phpfpm = SpecPhpFpm{MaxExecutionTime: pointer.Int32Ptr(0)}
+	spec, err = overrides.ResolveSpec(app)
+	require.NoError(t, err)
+	require.Equal(t, HTTPProbe{Enabled: pointer.BoolPtr(false), PeriodSeconds: pointer.Int32Ptr(10)}, spec.Drupal.Liveness)
+	require.Equal(t, pointer.Int32Ptr(0), spec.Phpfpm.MaxExecutionTime)
+	require.Equal(t, pointer.Int32Ptr(4), spec.Phpfpm.Procs)
+
+	// Environments of stages without a template are left as they are
+	env.Spec.Stage = "prod"
+	spec, err = env.ResolveSpec(app)
+	require.NoError(t, err)
+	require.Equal(t, env.Spec, spec)
+
+	env.Spec.Template = "missing"
+	_, err = env.ResolveSpec(app)
+	require.EqualError(t, err, `environment template "missing" not found in DrupalApplication "wlgore"`)
+}
+
+func TestDrupalEnvironmentSpec_Validate(t *testing.T) {
+	negative := int32(-1)
+
+	tests := []struct {
+		name   string
+		modify func(*DrupalEnvironmentSpec)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(*DrupalEnvironmentSpec) {},
+		},
+		{
+			name:   "settings left to a template",
+			modify: func(s *DrupalEnvironmentSpec) { s.Drupal = SpecDrupal{}; s.Apache = SpecApache{} },
+		},
+		{
+			name:   "missing stage",
+			modify: func(s *DrupalEnvironmentSpec) { s.Stage = "" },
+			err:    "spec.stage: Required value",
+		},
+		{
+			name:   "more minReplicas than maxReplicas",
+			modify: func(s *DrupalEnvironmentSpec) { s.Drupal.MinReplicas = pointer.Int32Ptr(3) },
+			err:    "spec.drupal.minReplicas: Invalid value: 3: must not be greater than maxReplicas (2)",
+		},
+		{
+			name:   "minReplicas without maxReplicas",
+			modify: func(s *DrupalEnvironmentSpec) { s.Drupal.MinReplicas = pointer.Int32Ptr(3); s.Drupal.MaxReplicas = nil },
+		},
+		{
+			name: "negative maxReplicas",
+			modify: func(s *DrupalEnvironmentSpec) {
+				s.Drupal.MinReplicas = nil
+				s.Drupal.MaxReplicas = pointer.Int32Ptr(-1)
+			},
+			err: "spec.drupal.maxReplicas: Invalid value: -1: must be positive",
+		},
+		{
+			name:   "zero minReplicas",
+			modify: func(s *DrupalEnvironmentSpec) { s.Drupal.MinReplicas = pointer.Int32Ptr(0) },
+			err:    "spec.drupal.minReplicas: Invalid value: 0: must be positive",
+		},
+		{
+			name:   "negative target CPU utilization",
+			modify: func(s *DrupalEnvironmentSpec) { s.Drupal.TargetCPUUtilizationPercentage = &negative },
+			err:    "spec.drupal.targetCPUUtilizationPercentage: Invalid value: -1: must be positive",
+		},
+		{
+			name:   "unknown pull policy",
+			modify: func(s *DrupalEnvironmentSpec) { s.Drupal.PullPolicy = "Sometimes" },
+			err:    `spec.drupal.pullPolicy: Unsupported value: "Sometimes": supported values: "Always", "IfNotPresent", "Never"`,
+		},
+		{
+			name:   "Apache memory limit lower than its request",
+			modify: func(s *DrupalEnvironmentSpec) { s.Apache.Memory.Limit = resource.MustParse("128Mi") },
+			err:    "spec.apache.memory.limit: Invalid value: \"128Mi\": must not be lower than the request (256Mi)",
+		},
+		{
+			name: "PHP-FPM CPU limit lower than its request",
+			modify: func(s *DrupalEnvironmentSpec) {
+				s.Phpfpm.Cpu = Resources{Request: resource.MustParse("1"), Limit: resource.MustParse("500m")}
+			},
+			err: "spec.phpfpm.cpu.limit: Invalid value: \"500m\": must not be lower than the request (1)",
+		},
+		{
+			name:   "CPU limit without a request",
+			modify: func(s *DrupalEnvironmentSpec) { s.Apache.Cpu = Resources{Limit: resource.MustParse("500m")} },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := DrupalEnvironmentSpec{
+				Application: "wlgore",
+				Stage:       "dev",
+				Drupal:      SpecDrupal{MinReplicas: pointer.Int32Ptr(1), MaxReplicas: pointer.Int32Ptr(2), PullPolicy: v1.PullAlways},
+				Apache: SpecApache{
+					Memory: Resources{Request: resource.MustParse("256Mi"), Limit: resource.MustParse("512Mi")},
+				},
+			}
+			test.modify(&spec)
+
+			env := &DrupalEnvironment{Spec: spec}
+			if test.err == "" {
+				require.NoError(t, env.ValidateCreate())
+				require.NoError(t, env.ValidateUpdate(&DrupalEnvironment{}))
+			} else {
+				require.EqualError(t, env.ValidateCreate(), test.err)
+				require.EqualError(t, env.ValidateUpdate(&DrupalEnvironment{}), test.err)
+			}
+		})
+	}
+}
+
+func TestDrupalEnvironmentSpec_SetDefaults(t *testing.T) {
+	target := int32(80)
+	defaultTarget := DefaultTargetCPUUtilizationPercentage
+
+	tests := []struct {
+		name     string
+		drupal   SpecDrupal
+		expected SpecDrupal
+	}{
+		{
+			name:     "unset",
+			drupal:   SpecDrupal{},
+			expected: SpecDrupal{MinReplicas: pointer.Int32Ptr(1), MaxReplicas: pointer.Int32Ptr(1), TargetCPUUtilizationPercentage: &defaultTarget},
+		},
+		{
+			name:     "minReplicas set",
+			drupal:   SpecDrupal{MinReplicas: pointer.Int32Ptr(3)},
+			expected: SpecDrupal{MinReplicas: pointer.Int32Ptr(3), MaxReplicas: pointer.Int32Ptr(3), TargetCPUUtilizationPercentage: &defaultTarget},
+		},
+		{
+			name:     "all set",
+			drupal:   SpecDrupal{MinReplicas: pointer.Int32Ptr(2), MaxReplicas: pointer.Int32Ptr(4), TargetCPUUtilizationPercentage: &target},
+			expected: SpecDrupal{MinReplicas: pointer.Int32Ptr(2), MaxReplicas: pointer.Int32Ptr(4), TargetCPUUtilizationPercentage: &target},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := DrupalEnvironmentSpec{Drupal: test.drupal}
+			spec.SetDefaults()
+			require.Equal(t, test.expected, spec.Drupal)
+		})
+	}
+}
+
+func TestDrupalEnvironment_Default(t *testing.T) {
+	env := &DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-dev"},
+		Spec: DrupalEnvironmentSpec{
+			Phpfpm: SpecPhpFpm{NewRelicSecret: "newrelic"},
+		},
+	}
+	env.Default()
+
+	require.Equal(t, "dev", env.Spec.Stage)
+	require.Equal(t, SpecAPM{Provider: APMProviderNewRelic, Secret: "newrelic"}, env.Spec.Phpfpm.Apm)
+	require.Equal(t, env.SpecVersion(), ObjectVersion(env))
+	require.Equal(t, SpecDrupal{}, env.Spec.Drupal, "templated settings should be left unset")
+}
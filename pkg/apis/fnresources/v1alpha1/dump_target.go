@@ -0,0 +1,62 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DatabaseDumpTarget is the storage that dumps of a Database's schema are written to, and restored from. Exactly one of
+// PersistentVolumeClaim and S3 is set.
+type DatabaseDumpTarget struct {
+	// PersistentVolumeClaim is the name of a PVC in the Database's namespace
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"` // +optional
+	// S3 is a bucket of S3, or of an S3-compatible service such as MinIO
+	S3 *S3Target `json:"s3,omitempty"` // +optional
+	// Path is the directory within the volume or bucket that dumps are written to. Defaults to the root.
+	Path string `json:"path,omitempty"` // +optional
+}
+
+// S3Target is an S3 bucket that dumps are written to
+type S3Target struct {
+	Bucket string `json:"bucket"`
+	// Endpoint is the URL of an S3-compatible service, such as http://minio.minio:9000. Defaults to AWS S3.
+	Endpoint string `json:"endpoint,omitempty"` // +optional
+	// Region is the region of the bucket. Defaults to the region of the operator.
+	Region string `json:"region,omitempty"` // +optional
+	// CredentialsSecret is the name of a Secret in the Database's namespace with the "accessKeyId" and "secretAccessKey"
+	// of the bucket. Defaults to the credentials of the Jobs' Pods, e.g. from an IAM role.
+	CredentialsSecret string `json:"credentialsSecret,omitempty"` // +optional
+}
+
+// Validate checks that exactly one storage is set
+func (t *DatabaseDumpTarget) Validate(p *field.Path) (errs field.ErrorList) {
+	switch {
+	case t.PersistentVolumeClaim == "" && t.S3 == nil:
+		errs = append(errs, field.Required(p, "one of persistentVolumeClaim or s3 is required"))
+	case t.PersistentVolumeClaim != "" && t.S3 != nil:
+		errs = append(errs, field.Invalid(p, t.PersistentVolumeClaim, "only one of persistentVolumeClaim or s3 may be set"))
+	case t.S3 != nil:
+		if t.S3.Bucket == "" {
+			errs = append(errs, field.Required(p.Child("s3", "bucket"), ""))
+		}
+		if t.S3.Endpoint != "" {
+			if u, err := url.Parse(t.S3.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, field.Invalid(p.Child("s3", "endpoint"), t.S3.Endpoint, "must be a URL such as http://minio:9000"))
+			}
+		}
+	}
+	return errs
+}
+
+// Location returns the URL of a dump file within the target, e.g. "s3://backups/wlgore/dump.sql.gz", or
+// "pvc://wlgore-backups/wlgore/dump.sql.gz" for a PVC
+func (t *DatabaseDumpTarget) Location(file string) string {
+	key := path.Join(t.Path, file)
+	if t.S3 != nil {
+		return fmt.Sprintf("s3://%s/%s", t.S3.Bucket, key)
+	}
+	return fmt.Sprintf("pvc://%s/%s", t.PersistentVolumeClaim, key)
+}
@@ -1,36 +1,93 @@
 package v1alpha1
 
 import (
+	"strconv"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// versionedType is a type whose objects are migrated to the latest version of its spec, step by step. The version of
+// an object is its VersionLabel; objects without one are of version "1".
 type versionedType interface {
 	metav1.Object
 
 	// SpecVersion returns the latest resource Spec version number for this type. Any resources with an earlier version
-	// label (or no label) should be processed by doMigrate().
+	// label (or no label) should be processed by Migrate().
 	SpecVersion() string
-	migrationNeeded() bool
-	doMigrate()
+	// migrationSteps returns the registry of the type's migration steps, ordered by version
+	migrationSteps() []MigrationStep
 }
 
-func Migrate(t versionedType) bool {
-	if !t.migrationNeeded() && t.SpecVersion() == ObjectVersion(t) {
-		return false
-	}
+// MigrationStep migrates objects of a versionedType from the previous version to Version
+type MigrationStep struct {
+	// Version is the version the step migrates to. The first step migrates to version 2, and each of the following ones
+	// to the next version.
+	Version int
+	// Description says what the step changes
+	Description string
+	// Migrate changes the object, which is of the step's type. It returns warnings about the changes that should be
+	// reviewed, such as settings it had to guess.
+	Migrate func(obj metav1.Object) (warnings []string)
+	// Needed reports whether an object of Version (or later) still needs the step, e.g. because a client set a
+	// deprecated field again. It may be left nil if the step is never needed again.
+	Needed func(obj metav1.Object) bool
+}
 
-	if t.migrationNeeded() {
-		t.doMigrate()
+// MigrationReport describes the migration of an object by Migrate
+type MigrationReport struct {
+	// From is the object's version label before the migration, which is empty for objects of version "1"
+	From string
+	// To is the object's version label after the migration
+	To string
+	// Steps are the descriptions of the steps applied, in order
+	Steps []string
+	// Warnings are the warnings of the steps applied
+	Warnings []string
+}
+
+// Migrate applies the pending migration steps to the object, and labels it with the latest version. The steps pending
+// are those to a later version than the object's, and those it still needs (see MigrationStep.Needed). Migrate returns
+// nil if the object is up to date.
+func Migrate(t versionedType) *MigrationReport {
+	report := &MigrationReport{From: ObjectVersion(t), To: t.SpecVersion()}
+
+	current := objectVersionNumber(t)
+	for _, step := range t.migrationSteps() {
+		if step.Version <= current && (step.Needed == nil || !step.Needed(t)) {
+			continue
+		}
+		report.Steps = append(report.Steps, step.Description)
+		report.Warnings = append(report.Warnings, step.Migrate(t)...)
 	}
 
-	setObjectVersion(t, t.SpecVersion())
-	return true
+	if len(report.Steps) == 0 && report.From == report.To {
+		return nil
+	}
+	setObjectVersion(t, report.To)
+	return report
 }
 
 func ObjectVersion(t versionedType) string {
 	return t.GetLabels()[VersionLabel]
 }
 
+// objectVersionNumber returns the object's version, which is 1 if its version label is missing or invalid
+func objectVersionNumber(t versionedType) int {
+	version, err := strconv.Atoi(ObjectVersion(t))
+	if err != nil || version < 1 {
+		return 1
+	}
+	return version
+}
+
+// latestVersion returns the version that the last of the migration steps migrates to
+func latestVersion(steps []MigrationStep) string {
+	if len(steps) == 0 {
+		return "1"
+	}
+	return strconv.Itoa(steps[len(steps)-1].Version)
+}
+
 func setObjectVersion(t versionedType, version string) {
 	l := t.GetLabels()
 	if l == nil {
@@ -0,0 +1,191 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMigrationSteps(t *testing.T) {
+	registries := map[string][]MigrationStep{
+		"DrupalEnvironment": drupalEnvironmentMigrations,
+		"Database":          databaseMigrations,
+	}
+
+	for kind, steps := range registries {
+		t.Run(kind, func(t *testing.T) {
+			for i, step := range steps {
+				require.Equal(t, i+2, step.Version, "steps must migrate to consecutive versions, starting from 2")
+				require.NotEmpty(t, step.Description)
+				require.NotNil(t, step.Migrate)
+			}
+		})
+	}
+}
+
+func TestMigrateDatabaseAdopt(t *testing.T) {
+	d := &Database{ObjectMeta: metav1.ObjectMeta{Name: "wlgore-database"}}
+	report := Migrate(d)
+	require.NotNil(t, report)
+	require.True(t, d.Spec.Adopt, "Databases created before spec.adopt should adopt their schema")
+
+	d = &Database{ObjectMeta: metav1.ObjectMeta{Name: "wlgore-database"}}
+	d.Default()
+	require.False(t, d.Spec.Adopt)
+}
+
+func TestMigrateEnvironmentStage(t *testing.T) {
+	tests := []struct {
+		name               string
+		stage              string
+		expectedStage      string
+		expectedProduction bool
+		expectWarning      bool
+	}{
+		{
+			name:          "wlgore-dev",
+			expectedStage: "dev",
+			expectWarning: true,
+		},
+		{
+			name:          "wlgore-test",
+			expectedStage: "test",
+			expectWarning: true,
+		},
+		{
+			name:               "wlgore-live",
+			expectedStage:      "prod",
+			expectedProduction: true,
+			expectWarning:      true,
+		},
+		{
+			name:          "wlgore-prod",
+			stage:         "dev",
+			expectedStage: "dev",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := &DrupalEnvironment{
+				ObjectMeta: metav1.ObjectMeta{Name: test.name},
+				Spec:       DrupalEnvironmentSpec{Stage: test.stage},
+			}
+
+			warnings := migrateEnvironmentStage(env)
+			require.Equal(t, test.expectedStage, env.Spec.Stage)
+			require.Equal(t, test.expectedProduction, env.Spec.Production)
+			if test.expectWarning {
+				require.Len(t, warnings, 1)
+				require.Contains(t, warnings[0], test.name)
+			} else {
+				require.Empty(t, warnings)
+			}
+		})
+	}
+}
+
+func TestMigrateEnvironmentNewRelic(t *testing.T) {
+	tests := []struct {
+		name          string
+		phpfpm        SpecPhpFpm
+		expectedApm   SpecAPM
+		expectWarning bool
+	}{
+		{
+			name:        "moves the settings",
+			phpfpm:      SpecPhpFpm{NewRelicSecret: "newrelic", NewRelicAppName: "wlgore"},
+			expectedApm: SpecAPM{Provider: APMProviderNewRelic, Secret: "newrelic", AppName: "wlgore"},
+		},
+		{
+			name: "keeps another provider",
+			phpfpm: SpecPhpFpm{
+				NewRelicSecret: "newrelic",
+				Apm:            SpecAPM{Provider: APMProviderDatadog},
+			},
+			expectedApm:   SpecAPM{Provider: APMProviderDatadog},
+			expectWarning: true,
+		},
+		{
+			name:   "drops an app name without a secret",
+			phpfpm: SpecPhpFpm{NewRelicAppName: "wlgore"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := &DrupalEnvironment{Spec: DrupalEnvironmentSpec{Phpfpm: test.phpfpm}}
+
+			warnings := migrateEnvironmentNewRelic(env)
+			require.Equal(t, test.expectedApm, env.Spec.Phpfpm.Apm)
+			require.Empty(t, env.Spec.Phpfpm.NewRelicSecret)
+			require.Empty(t, env.Spec.Phpfpm.NewRelicAppName)
+			require.Equal(t, test.expectWarning, len(warnings) > 0)
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name          string
+		version       string
+		spec          DrupalEnvironmentSpec
+		expectedSteps int
+	}{
+		{
+			name:          "without version",
+			expectedSteps: 2,
+		},
+		{
+			name:          "invalid version",
+			version:       "two",
+			spec:          DrupalEnvironmentSpec{Stage: "dev"},
+			expectedSteps: 2,
+		},
+		{
+			name:          "pending step",
+			version:       "2",
+			spec:          DrupalEnvironmentSpec{Stage: "dev"},
+			expectedSteps: 1,
+		},
+		{
+			name:    "step needed again",
+			version: "3",
+			spec: DrupalEnvironmentSpec{
+				Stage:  "dev",
+				Phpfpm: SpecPhpFpm{NewRelicSecret: "newrelic"},
+			},
+			expectedSteps: 1,
+		},
+		{
+			name:    "up to date",
+			version: "3",
+			spec:    DrupalEnvironmentSpec{Stage: "dev"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := &DrupalEnvironment{
+				ObjectMeta: metav1.ObjectMeta{Name: "wlgore-dev"},
+				Spec:       test.spec,
+			}
+			if test.version != "" {
+				env.Labels = map[string]string{VersionLabel: test.version}
+			}
+
+			report := Migrate(env)
+			require.Equal(t, env.SpecVersion(), ObjectVersion(env))
+			if test.expectedSteps == 0 {
+				require.Nil(t, report)
+				return
+			}
+			require.NotNil(t, report)
+			require.Equal(t, test.version, report.From)
+			require.Equal(t, env.SpecVersion(), report.To)
+			require.Len(t, report.Steps, test.expectedSteps)
+			require.Nil(t, Migrate(env), "a migrated object should be up to date")
+		})
+	}
+}
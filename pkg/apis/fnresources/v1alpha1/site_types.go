@@ -69,6 +69,11 @@ const (
 type SiteStatus struct {
 	Status  Status       `json:"status"`
 	Domains DomainStatus `json:"domains"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"` // +optional
+	// AppliedResources records the desired state of the child resources last applied, for drift detection
+	AppliedResources []AppliedResource `json:"appliedResources,omitempty"` // +optional
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -145,14 +150,15 @@ func sanitize(old string) string {
 	return old
 }
 
-func (s *Site) IngressRules() []extv1b1.IngressRule {
+// IngressRules returns the rules routing the site's domains to the given Service of its DrupalEnvironment
+func (s *Site) IngressRules(serviceName string) []extv1b1.IngressRule {
 	value := extv1b1.IngressRuleValue{
 		HTTP: &extv1b1.HTTPIngressRuleValue{
 			Paths: []extv1b1.HTTPIngressPath{
 				{
 					Path: "/",
 					Backend: extv1b1.IngressBackend{
-						ServiceName: "drupal",
+						ServiceName: serviceName,
 						ServicePort: intstr.FromInt(80),
 					},
 				},
@@ -201,6 +207,12 @@ func (s *Site) IngressCertIssuer() string {
 	return def
 }
 
+// InMaintenance returns true if the Site is annotated with the MaintenanceAnnotation
+func (s *Site) InMaintenance() bool {
+	_, ok := s.Annotations[MaintenanceAnnotation]
+	return ok
+}
+
 // SetSiteDomainStatus sets the site domain status.
 func (s *Site) SetDomainStatus(status DomainStatus) {
 	s.Status.Domains = status
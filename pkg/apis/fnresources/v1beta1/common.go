@@ -0,0 +1,32 @@
+package v1beta1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is the type of a status Condition
+type ConditionType string
+
+// Condition describes one aspect of the observed state of a resource
+// +k8s:openapi-gen=true
+type Condition struct {
+	Type               ConditionType      `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime,omitempty"` // +optional
+	Reason             string             `json:"reason,omitempty"`             // +optional
+	Message            string             `json:"message,omitempty"`            // +optional
+}
+
+// AppliedResource records the desired state of a child resource that the operator last applied, to tell changes to
+// the desired state apart from changes made to the child outside of the operator
+// +k8s:openapi-gen=true
+type AppliedResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// AppliedHash is a hash of the desired state that was last applied
+	AppliedHash string `json:"appliedHash"`
+	// AdoptedFields are the JSON pointers of the fields whose live values were adopted, rather than reverted to the
+	// desired state
+	AdoptedFields []string `json:"adoptedFields,omitempty"` // +optional
+}
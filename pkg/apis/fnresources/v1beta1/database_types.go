@@ -0,0 +1,155 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Important: Run "operator-sdk generate k8s && operator-sdk generate crds" to regenerate code after modifying this file
+// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
+
+// DatabaseSpec defines the desired state of Database
+// +k8s:openapi-gen=true
+type DatabaseSpec struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	SchemaName  string `json:"schemaName"`
+	User        string `json:"user"`
+	AdminSecret string `json:"adminSecret,omitempty"` // +optional
+	UserSecret  string `json:"userSecret"`
+
+	// ReclaimPolicy says what happens to the schema and its user when the Database is deleted. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Retain;Delete;Snapshot
+	ReclaimPolicy DatabaseReclaimPolicy `json:"reclaimPolicy,omitempty"` // +optional
+	// SnapshotTarget is where the schema is dumped to before it's dropped, with the Snapshot reclaim policy
+	SnapshotTarget *DatabaseDumpTarget `json:"snapshotTarget,omitempty"` // +optional
+	// Adopt lets the Database take over a schema that already exists, such as one retained by a deleted Database
+	Adopt bool `json:"adopt,omitempty"` // +optional
+	// RotationInterval is how often the credentials of the user are rotated
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"` // +optional
+	// TLS configures TLS connections to the MySQL server, of both the operator and Drupal
+	TLS *DatabaseTLS `json:"tls,omitempty"` // +optional
+}
+
+// DatabaseReclaimPolicy says what happens to the schema and user of a Database when it's deleted
+type DatabaseReclaimPolicy string
+
+const (
+	DatabaseReclaimRetain   DatabaseReclaimPolicy = "Retain"
+	DatabaseReclaimDelete   DatabaseReclaimPolicy = "Delete"
+	DatabaseReclaimSnapshot DatabaseReclaimPolicy = "Snapshot"
+)
+
+// DatabaseTLS configures TLS connections to the MySQL server of a Database
+type DatabaseTLS struct {
+	// CASecret is the name of a Secret with the CA bundle that the server's certificate is verified with, in "ca.crt"
+	CASecret string `json:"caSecret"`
+	// VerifyMode says how much of the server's certificate is verified. Defaults to VerifyIdentity. PHP can't verify
+	// a certificate without its host, so Drupal only encrypts connections with VerifyCA, like with Required.
+	// +kubebuilder:validation:Enum=Required;VerifyCA;VerifyIdentity
+	VerifyMode DatabaseTLSVerifyMode `json:"verifyMode,omitempty"` // +optional
+	// ClientCertSecret is the name of a kubernetes.io/tls Secret with the client certificate and key
+	ClientCertSecret string `json:"clientCertSecret,omitempty"` // +optional
+}
+
+// DatabaseTLSVerifyMode says how much of the certificate of a Database's server is verified
+type DatabaseTLSVerifyMode string
+
+const (
+	DatabaseTLSRequired       DatabaseTLSVerifyMode = "Required"
+	DatabaseTLSVerifyCA       DatabaseTLSVerifyMode = "VerifyCA"
+	DatabaseTLSVerifyIdentity DatabaseTLSVerifyMode = "VerifyIdentity"
+)
+
+// DatabaseDumpTarget is the storage that dumps of a Database's schema are written to, and restored from. Exactly one of
+// PersistentVolumeClaim and S3 is set.
+type DatabaseDumpTarget struct {
+	// PersistentVolumeClaim is the name of a PVC in the Database's namespace
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"` // +optional
+	// S3 is a bucket of S3, or of an S3-compatible service such as MinIO
+	S3 *S3Target `json:"s3,omitempty"` // +optional
+	// Path is the directory within the volume or bucket that dumps are written to. Defaults to the root.
+	Path string `json:"path,omitempty"` // +optional
+}
+
+// S3Target is an S3 bucket that dumps are written to
+type S3Target struct {
+	Bucket string `json:"bucket"`
+	// Endpoint is the URL of an S3-compatible service, such as http://minio.minio:9000. Defaults to AWS S3.
+	Endpoint string `json:"endpoint,omitempty"` // +optional
+	// Region is the region of the bucket. Defaults to the region of the operator.
+	Region string `json:"region,omitempty"` // +optional
+	// CredentialsSecret is the name of a Secret in the Database's namespace with the "accessKeyId" and "secretAccessKey"
+	// of the bucket. Defaults to the credentials of the Jobs' Pods, e.g. from an IAM role.
+	CredentialsSecret string `json:"credentialsSecret,omitempty"` // +optional
+}
+
+// DatabaseStatus defines the observed state of Database
+// +k8s:openapi-gen=true
+type DatabaseStatus struct {
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"` // +optional
+	// Provisioned is set once the schema was created, or adopted, by the Database
+	Provisioned bool `json:"provisioned,omitempty"` // +optional
+	// ProvisionedUser is the user last given the password of the user Secret and privileges on the schema. The user is
+	// only provisioned again when it changes, as credentials are rotated.
+	ProvisionedUser string `json:"provisionedUser,omitempty"` // +optional
+	// LastBackup is the latest successful DatabaseBackup of the Database, recorded by its DatabaseBackupSchedule
+	LastBackup *DatabaseLastBackup `json:"lastBackup,omitempty"` // +optional
+	// Credentials describe the MySQL users of the Database, once its credentials were first rotated
+	Credentials *DatabaseCredentials `json:"credentials,omitempty"` // +optional
+}
+
+// DatabaseLastBackup describes the latest successful DatabaseBackup of a Database
+// +k8s:openapi-gen=true
+type DatabaseLastBackup struct {
+	// Name is the name of the DatabaseBackup
+	Name string `json:"name"`
+	// Location is the URL of the dump
+	Location       string      `json:"location,omitempty"` // +optional
+	CompletionTime metav1.Time `json:"completionTime"`
+}
+
+// DatabaseCredentials describe the MySQL users that the credentials of a Database are rotated between
+// +k8s:openapi-gen=true
+type DatabaseCredentials struct {
+	// User is the user in the user Secret
+	User string `json:"user"`
+	// PreviousUser is the user that the Secret held before the last rotation, until it's dropped
+	PreviousUser     string      `json:"previousUser,omitempty"` // +optional
+	LastRotationTime metav1.Time `json:"lastRotationTime"`
+	// RotationRequest is the value of the rotate-credentials annotation that was last acted on
+	RotationRequest string `json:"rotationRequest,omitempty"` // +optional
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Database is the Schema for the databases API
+// +k8s:openapi-gen=true
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Last Backup",type="date",JSONPath=".status.lastBackup.completionTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type Database struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseSpec   `json:"spec,omitempty"`
+	Status DatabaseStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DatabaseList contains a list of Database
+type DatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Database `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Database{}, &DatabaseList{})
+}
+
+// Hub marks v1beta1 as the version that the other versions of Database are converted to and from
+func (*Database) Hub() {}
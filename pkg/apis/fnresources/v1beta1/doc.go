@@ -0,0 +1,4 @@
+// Package v1beta1 contains API Schema definitions for the fnresources v1beta1 API group
+// +k8s:deepcopy-gen=package,register
+// +groupName=fnresources.acquia.io
+package v1beta1
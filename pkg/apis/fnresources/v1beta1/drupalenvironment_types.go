@@ -0,0 +1,182 @@
+package v1beta1
+
+// IMPORTANT: Run "operator-sdk generate k8s && operator-sdk generate crds"
+// to regenerate code after modifying this file.
+// SEE: https://book.kubebuilder.io/reference/generating-crd.html
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProductionStage is the stage of production environments
+const ProductionStage = "prod"
+
+// Describes the status of the environment.
+type DrupalEnvironmentStatusType string
+
+// DrupalEnvironmentSpec defines the desired state of DrupalEnvironment
+// +k8s:openapi-gen=true
+type DrupalEnvironmentSpec struct {
+	Application string `json:"application"`
+	GitRef      string `json:"gitRef"`
+	// Stage is the environment's stage name, such as "dev", "test" or "prod". Environments of the "prod" stage are
+	// production environments.
+	Stage string `json:"stage"`
+	// Storage configures where the environment's shared files are stored
+	Storage                    StorageSpec `json:"storage"`
+	CustomEnvironmentVariables []v1.EnvVar `json:"customEnvironmentVariables,omitempty"` // +optional
+
+	// Template names the DrupalApplication's environment template, which the Drupal, Apache and PHP-FPM settings that
+	// are left out default to. Defaults to the template named after the stage, if there is one.
+	Template string `json:"template,omitempty"` // +optional
+
+	Drupal SpecDrupal `json:"drupal,omitempty"` // +optional
+	Apache SpecApache `json:"apache,omitempty"` // +optional
+	Phpfpm SpecPhpFpm `json:"phpfpm,omitempty"` // +optional
+}
+
+// IsProduction returns true if the environment is of the production stage
+func (s *DrupalEnvironmentSpec) IsProduction() bool {
+	return s.Stage == ProductionStage
+}
+
+// StorageSpec represents drupalenvironment.spec.storage
+type StorageSpec struct {
+	// EFS stores the shared files on an AWS Elastic File System
+	EFS *EFSStorage `json:"efs,omitempty"` // +optional
+}
+
+// EFSStorage represents drupalenvironment.spec.storage.efs
+type EFSStorage struct {
+	// FileSystemID is the ID of the Elastic File System, e.g. "fs-0123abcd"
+	FileSystemID string `json:"fileSystemID"`
+}
+
+// SpecDrupal represents drupalenvironment.spec.drupal
+type SpecDrupal struct {
+	Tag                            string        `json:"tag,omitempty"`
+	PullPolicy                     v1.PullPolicy `json:"pullPolicy,omitempty"`
+	MinReplicas                    *int32        `json:"minReplicas,omitempty"`
+	MaxReplicas                    *int32        `json:"maxReplicas,omitempty"`
+	TargetCPUUtilizationPercentage *int32        `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	Liveness  HTTPProbe `json:"livenessProbe,omitempty"`
+	Readiness HTTPProbe `json:"readinessProbe,omitempty"`
+}
+
+// SpecApache represents drupalenvironment.spec.apache
+type SpecApache struct {
+	CustomImage string `json:"customImage,omitempty"` // +optional
+	Tag         string `json:"tag,omitempty"`
+
+	WebRoot string    `json:"webRoot,omitempty"`
+	Cpu     Resources `json:"cpu,omitempty"`
+	Memory  Resources `json:"memory,omitempty"`
+}
+
+// SpecPhpFpm represents drupalenvironment.spec.phpfpm
+type SpecPhpFpm struct {
+	CustomImage string `json:"customImage,omitempty"` // +optional
+	Tag         string `json:"tag,omitempty"`
+
+	Procs                           *int32    `json:"procs,omitempty"`
+	MaxInputVars                    *int32    `json:"maxInputVars,omitempty"`
+	MaxExecutionTime                *int32    `json:"maxExecutionTime,omitempty"`
+	ProcMemoryLimitMiB              *int32    `json:"procMemoryLimitMiB,omitempty"`
+	PostMaxSizeMiB                  *int32    `json:"postMaxSizeMiB,omitempty"`
+	OpcacheMemoryLimitMiB           *int32    `json:"opcacheMemoryLimitMiB,omitempty"`
+	OpcacheInternedStringsBufferMiB *int32    `json:"opcacheInternedStringsBufferMiB,omitempty"`
+	ApcMemoryLimitMiB               *int32    `json:"apcMemoryLimitMiB,omitempty"`
+	Cpu                             Resources `json:"cpu,omitempty"`
+
+	// Apm configures Application Performance Monitoring of PHP
+	Apm SpecAPM `json:"apm,omitempty"` // +optional
+}
+
+// APMProvider names a supported Application Performance Monitoring provider
+// +kubebuilder:validation:Enum=newrelic;datadog;opentelemetry
+type APMProvider string
+
+// SpecAPM represents drupalenvironment.spec.phpfpm.apm
+type SpecAPM struct {
+	// Provider is the APM provider to instrument PHP for. APM is disabled if empty.
+	Provider APMProvider `json:"provider,omitempty"` // +optional
+	// Secret is the name of a Secret holding the provider's credentials, if it needs any
+	Secret string `json:"secret,omitempty"` // +optional
+	// AppName is the application (or service) name reported to the provider. Defaults to "<application> - <environment>".
+	AppName string `json:"appName,omitempty"` // +optional
+	// Settings holds provider-specific settings
+	Settings map[string]string `json:"settings,omitempty"` // +optional
+}
+
+// Resources specifies container resource requests and limits
+type Resources struct {
+	Request resource.Quantity `json:"request,omitempty"`
+	Limit   resource.Quantity `json:"limit,omitempty"`
+}
+
+// HTTPProbe specifies a container's HTTP liveness/readiness probe
+type HTTPProbe struct {
+	Enabled          *bool  `json:"enabled,omitempty"`
+	HTTPPath         string `json:"httpPath,omitempty"`
+	TimeoutSeconds   *int32 `json:"timeoutSeconds,omitempty"`
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+	PeriodSeconds    *int32 `json:"periodSeconds,omitempty"`
+}
+
+// DrupalEnvironmentStatus defines the observed state of DrupalEnvironment
+// +k8s:openapi-gen=true
+type DrupalEnvironmentStatus struct {
+	NumDrupal int32                       `json:"numDrupal"`
+	Status    DrupalEnvironmentStatusType `json:"status"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"` // +optional
+	// AppliedResources records the desired state of the child resources last applied, for drift detection
+	AppliedResources []AppliedResource `json:"appliedResources,omitempty"` // +optional
+	// EffectiveSpec is the spec last reconciled, resolved from the environment's template
+	EffectiveSpec *DrupalEnvironmentSpec `json:"effectiveSpec,omitempty"` // +optional
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DrupalEnvironment is the Schema for the drupalenvironments API
+// +kubebuilder:resource:shortName=drenv;drenvs,scope=Namespaced
+// +k8s:openapi-gen=true
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.numDrupal",description="The number of Drupal Pods in ready state"
+// +kubebuilder:printcolumn:name="PHP-Tag",type="string",JSONPath=".spec.phpfpm.tag",description="Tagged Version of PHP"
+// +kubebuilder:printcolumn:name="Drupal-Tag",type="string",JSONPath=".spec.drupal.tag",description="The tag of Drupal Image"
+// +kubebuilder:printcolumn:name="Stage",type="string",JSONPath=".spec.stage",description="The environment's stage name"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status",description="Current status of the environment"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="Git-Ref",priority=1,type="string",JSONPath=".spec.gitRef",description="Deployed git ref"
+// +kubebuilder:printcolumn:name="Custom-Apache",priority=1,type="string",JSONPath=".spec.apache.customImage",description="Custom apache image"
+// +kubebuilder:printcolumn:name="Custom-PHP",priority=1,type="string",JSONPath=".spec.phpfpm.customImage",description="Custom php-fpm image"
+type DrupalEnvironment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DrupalEnvironmentSpec   `json:"spec,omitempty"`
+	Status DrupalEnvironmentStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DrupalEnvironmentList contains a list of DrupalEnvironment
+type DrupalEnvironmentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DrupalEnvironment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DrupalEnvironment{}, &DrupalEnvironmentList{})
+}
+
+// Hub marks v1beta1 as the version that the other versions of DrupalEnvironment are converted to and from
+func (*DrupalEnvironment) Hub() {}
@@ -0,0 +1,89 @@
+package v1beta1
+
+// IMPORTANT: Run "operator-sdk generate k8s && operator-sdk generate crds"
+// to regenerate code after modifying this file.
+// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/reference/generating-crd.html
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SiteSpec defines the desired state of Site
+// +k8s:openapi-gen=true
+type SiteSpec struct {
+	// +listType=set
+	Domains     []string    `json:"domains"`
+	Environment string      `json:"environment"`
+	Database    string      `json:"database"`
+	Install     InstallSpec `json:"install,omitempty"` // +optional
+	// TLS serves the site's domains over HTTPS, with a certificate issued by cert-manager. Left out, the site is only
+	// served over HTTP.
+	TLS          *TLSSpec `json:"tls,omitempty"`          // +optional
+	IngressClass string   `json:"ingressClass,omitempty"` // +optional
+}
+
+// Information to install the site
+// +k8s:openapi-gen=true
+type InstallSpec struct {
+	InstallProfile string `json:"installProfile"`
+	AdminUsername  string `json:"adminUsername"`
+	AdminEmail     string `json:"adminEmail"`
+}
+
+// TLSSpec represents site.spec.tls
+type TLSSpec struct {
+	// CertIssuer is the cert-manager ClusterIssuer of the site's certificate. Defaults to "letsencrypt-staging".
+	CertIssuer string `json:"certIssuer,omitempty"` // +optional
+}
+
+// Status describes the status of the site.
+type Status string
+
+type DomainStatus string
+
+// SiteStatus defines the observed state of Site
+// +k8s:openapi-gen=true
+type SiteStatus struct {
+	Status  Status       `json:"status"`
+	Domains DomainStatus `json:"domains"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"` // +optional
+	// AppliedResources records the desired state of the child resources last applied, for drift detection
+	AppliedResources []AppliedResource `json:"appliedResources,omitempty"` // +optional
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Site is the Schema for the sites API
+// +kubebuilder:resource:scope=Namespaced
+// +k8s:openapi-gen=true
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="status",type="string",JSONPath=".status.status"
+// +kubebuilder:printcolumn:name="domains",type="string",JSONPath=".spec.domains"
+// +kubebuilder:printcolumn:name="cert-issuer",type="string",JSONPath=".spec.tls.certIssuer"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type Site struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SiteSpec   `json:"spec,omitempty"`
+	Status SiteStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SiteList contains a list of Site
+type SiteList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Site `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Site{}, &SiteList{})
+}
+
+// Hub marks v1beta1 as the version that the other versions of Site are converted to and from
+func (*Site) Hub() {}
@@ -0,0 +1,125 @@
+// Package apm provides Application Performance Monitoring integrations for the PHP containers of a DrupalEnvironment.
+package apm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+const (
+	// PhpIniFile is the key of the APM configuration file in the "php-config" ConfigMap
+	PhpIniFile = "apm.ini"
+	// PhpIniMountPath is where PhpIniFile is mounted in PHP containers
+	PhpIniMountPath = "/usr/local/php/etc/conf.d/" + PhpIniFile
+)
+
+// Provider instruments PHP for an APM service
+type Provider interface {
+	// PhpIni renders the php.ini fragment that loads and configures the provider's PHP extension
+	PhpIni(c client.Client) (string, error)
+	// EnvVars returns environment variables to set on PHP containers
+	EnvVars() []v1.EnvVar
+	// Destinations returns the addresses that Drupal Pods send APM data to, for their egress NetworkPolicy
+	Destinations() []Destination
+}
+
+// Destination is an address that Drupal Pods send APM data to
+type Destination struct {
+	// Host is a hostname or IP, or empty for the node of the Pod
+	Host     string
+	Port     int
+	Protocol v1.Protocol
+}
+
+// hostPortDestination returns the TCP Destination of a "host:port" address, or nil if it has no port (e.g. a Unix
+// socket)
+func hostPortDestination(address string) []Destination {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil
+	}
+	return []Destination{{Host: host, Port: p, Protocol: v1.ProtocolTCP}}
+}
+
+// ForEnvironment returns the APM Provider configured for the given DrupalEnvironment, or nil if APM is disabled
+func ForEnvironment(app *fnv1alpha1.DrupalApplication, env *fnv1alpha1.DrupalEnvironment) (Provider, error) {
+	spec := env.Spec.Phpfpm.Apm
+
+	base := base{
+		spec:      spec,
+		appName:   spec.AppName,
+		stage:     env.Spec.Stage,
+		namespace: env.Namespace,
+	}
+	if base.appName == "" {
+		base.appName = fmt.Sprintf("%v - %v", app.Name, env.Name)
+	}
+
+	switch spec.Provider {
+	case "":
+		return nil, nil
+	case fnv1alpha1.APMProviderNewRelic:
+		return &newRelic{base}, nil
+	case fnv1alpha1.APMProviderDatadog:
+		return &datadog{base}, nil
+	case fnv1alpha1.APMProviderOpenTelemetry:
+		return newOpenTelemetry(base)
+	default:
+		return nil, fmt.Errorf("unknown APM provider %q", spec.Provider)
+	}
+}
+
+// base holds what's common to all providers
+type base struct {
+	spec      fnv1alpha1.SpecAPM
+	appName   string
+	stage     string
+	namespace string
+}
+
+func (b *base) setting(name, defaultValue string) string {
+	if v, ok := b.spec.Settings[name]; ok && v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// secretValue returns the value of the given key of the provider's Secret
+func (b *base) secretValue(c client.Client, key string) (string, error) {
+	if b.spec.Secret == "" {
+		return "", fmt.Errorf("no Secret specified for APM provider %q", b.spec.Provider)
+	}
+
+	secret := &v1.Secret{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: b.namespace, Name: b.spec.Secret}, secret); err != nil {
+		return "", err
+	}
+
+	value := string(secret.Data[key])
+	if value == "" {
+		return "", fmt.Errorf("%v key not specified in Secret", key)
+	}
+	return value, nil
+}
+
+func render(tmpl *template.Template, values interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,193 @@
+package apm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+const testNamespace = "wlgore-app-prod"
+
+var testApp = &fnv1alpha1.DrupalApplication{
+	ObjectMeta: metav1.ObjectMeta{Name: "wlgore-app"},
+}
+
+func testEnv(apm fnv1alpha1.SpecAPM) *fnv1alpha1.DrupalEnvironment {
+	return &fnv1alpha1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: testNamespace},
+		Spec: fnv1alpha1.DrupalEnvironmentSpec{
+			Stage:  "prod",
+			Phpfpm: fnv1alpha1.SpecPhpFpm{Apm: apm},
+		},
+	}
+}
+
+func testSecret(key, value string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "apm", Namespace: testNamespace},
+		Data:       map[string][]byte{key: []byte(value)},
+	}
+}
+
+func TestForEnvironment(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{}))
+		require.NoError(t, err)
+		require.Nil(t, provider)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{Provider: "appdynamics"}))
+		require.Error(t, err)
+	})
+
+	t.Run("OpenTelemetry without endpoint", func(t *testing.T) {
+		_, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{Provider: fnv1alpha1.APMProviderOpenTelemetry}))
+		require.Error(t, err)
+
+		// The collector sidecar is no longer supported
+		_, err = ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderOpenTelemetry,
+			Settings: map[string]string{"collectorImage": "otel/opentelemetry-collector:0.18.0"},
+		}))
+		require.Error(t, err)
+	})
+}
+
+func TestNewRelic(t *testing.T) {
+	_ = os.Setenv("NEWRELIC_DAEMON_ADDR", "newrelic.newrelic.svc.cluster.local:9999")
+	c := testhelpers.NewFakeClient([]runtime.Object{testSecret(NewRelicLicenseSecretKey, "1234567890abcdef")})
+
+	t.Run("default app name", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderNewRelic,
+			Secret:   "apm",
+		}))
+		require.NoError(t, err)
+
+		ini, err := provider.PhpIni(c)
+		require.NoError(t, err)
+		require.Contains(t, ini, `newrelic.license = "1234567890abcdef"`)
+		require.Contains(t, ini, `newrelic.appname = "wlgore-app - prod"`)
+		require.Contains(t, ini, `newrelic.daemon.address = "newrelic.newrelic.svc.cluster.local:9999"`)
+		require.Empty(t, provider.EnvVars())
+		require.Equal(t, []Destination{{Host: "newrelic.newrelic.svc.cluster.local", Port: 9999, Protocol: v1.ProtocolTCP}}, provider.Destinations())
+	})
+
+	t.Run("daemon address setting", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderNewRelic,
+			Secret:   "apm",
+			AppName:  "Test App",
+			Settings: map[string]string{"daemonAddress": "localhost:31339"},
+		}))
+		require.NoError(t, err)
+
+		ini, err := provider.PhpIni(c)
+		require.NoError(t, err)
+		require.Contains(t, ini, `newrelic.appname = "Test App"`)
+		require.Contains(t, ini, `newrelic.daemon.address = "localhost:31339"`)
+		require.Equal(t, []Destination{{Host: "localhost", Port: 31339, Protocol: v1.ProtocolTCP}}, provider.Destinations())
+	})
+
+	t.Run("daemon socket", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderNewRelic,
+			Secret:   "apm",
+			Settings: map[string]string{"daemonAddress": "/tmp/.newrelic.sock"},
+		}))
+		require.NoError(t, err)
+		require.Empty(t, provider.Destinations())
+	})
+
+	t.Run("missing license", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderNewRelic,
+			Secret:   "apm",
+		}))
+		require.NoError(t, err)
+
+		_, err = provider.PhpIni(testhelpers.NewFakeClient([]runtime.Object{testSecret("other", "x")}))
+		require.Error(t, err)
+	})
+}
+
+func TestDatadog(t *testing.T) {
+	t.Run("node agent", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{Provider: fnv1alpha1.APMProviderDatadog}))
+		require.NoError(t, err)
+
+		ini, err := provider.PhpIni(testhelpers.NewFakeClient(nil))
+		require.NoError(t, err)
+		require.Contains(t, ini, `extension = "ddtrace.so"`)
+		require.Contains(t, ini, `datadog.service = "wlgore-app - prod"`)
+		require.Contains(t, ini, `datadog.env = "prod"`)
+
+		env := provider.EnvVars()
+		require.Len(t, env, 2)
+		require.Equal(t, "DD_AGENT_HOST", env[0].Name)
+		require.Equal(t, "status.hostIP", env[0].ValueFrom.FieldRef.FieldPath)
+		require.Equal(t, v1.EnvVar{Name: "DD_TRACE_AGENT_PORT", Value: "8126"}, env[1])
+		require.Equal(t, []Destination{{Port: 8126, Protocol: v1.ProtocolTCP}}, provider.Destinations())
+	})
+
+	t.Run("agent settings", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderDatadog,
+			Settings: map[string]string{"agentHost": "datadog.monitoring", "agentPort": "9126"},
+		}))
+		require.NoError(t, err)
+		require.Equal(t, []v1.EnvVar{
+			{Name: "DD_AGENT_HOST", Value: "datadog.monitoring"},
+			{Name: "DD_TRACE_AGENT_PORT", Value: "9126"},
+		}, provider.EnvVars())
+		require.Equal(t, []Destination{{Host: "datadog.monitoring", Port: 9126, Protocol: v1.ProtocolTCP}}, provider.Destinations())
+	})
+}
+
+func TestOpenTelemetry(t *testing.T) {
+	t.Run("external endpoint", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderOpenTelemetry,
+			Secret:   "apm",
+			Settings: map[string]string{"endpoint": "https://otlp.example.com"},
+		}))
+		require.NoError(t, err)
+
+		ini, err := provider.PhpIni(testhelpers.NewFakeClient(nil))
+		require.NoError(t, err)
+		require.Contains(t, ini, `extension = "opentelemetry.so"`)
+
+		env := map[string]v1.EnvVar{}
+		for _, e := range provider.EnvVars() {
+			env[e.Name] = e
+		}
+		require.Equal(t, "wlgore-app - prod", env["OTEL_SERVICE_NAME"].Value)
+		require.Equal(t, "deployment.environment=prod", env["OTEL_RESOURCE_ATTRIBUTES"].Value)
+		require.Equal(t, "http/protobuf", env["OTEL_EXPORTER_OTLP_PROTOCOL"].Value)
+		require.Equal(t, "https://otlp.example.com", env["OTEL_EXPORTER_OTLP_ENDPOINT"].Value)
+		require.Equal(t, "apm", env["OTEL_EXPORTER_OTLP_HEADERS"].ValueFrom.SecretKeyRef.Name)
+		require.Equal(t, OpenTelemetryHeadersSecretKey, env["OTEL_EXPORTER_OTLP_HEADERS"].ValueFrom.SecretKeyRef.Key)
+		require.Equal(t, []Destination{{Host: "otlp.example.com", Port: 443, Protocol: v1.ProtocolTCP}}, provider.Destinations())
+	})
+
+	t.Run("endpoint port", func(t *testing.T) {
+		provider, err := ForEnvironment(testApp, testEnv(fnv1alpha1.SpecAPM{
+			Provider: fnv1alpha1.APMProviderOpenTelemetry,
+			Settings: map[string]string{"endpoint": "http://otel-collector.observability.svc:4318"},
+		}))
+		require.NoError(t, err)
+		require.Equal(t, []Destination{{Host: "otel-collector.observability.svc", Port: 4318, Protocol: v1.ProtocolTCP}}, provider.Destinations())
+
+		for _, e := range provider.EnvVars() {
+			require.NotEqual(t, "OTEL_EXPORTER_OTLP_HEADERS", e.Name)
+		}
+	})
+}
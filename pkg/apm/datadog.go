@@ -0,0 +1,63 @@
+package apm
+
+import (
+	"strconv"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const datadogConfTemplate = `
+extension = "ddtrace.so"
+
+[datadog]
+datadog.service = "{{ .Service }}"
+datadog.env = "{{ .Env }}"
+`
+
+var tmplDatadogConf = template.Must(template.New("tmplDatadogConf").Parse(datadogConfTemplate))
+
+// datadog sends traces to a Datadog agent, by default the one running on the Pod's node. The "agentHost" and
+// "agentPort" settings override the agent's address and trace port (8126).
+type datadog struct {
+	base
+}
+
+func (p *datadog) PhpIni(c client.Client) (string, error) {
+	return render(tmplDatadogConf, struct {
+		Service, Env string
+	}{
+		Service: p.appName,
+		Env:     p.stage,
+	})
+}
+
+func (p *datadog) EnvVars() []v1.EnvVar {
+	agentHost := v1.EnvVar{Name: "DD_AGENT_HOST"}
+	if host := p.setting("agentHost", ""); host != "" {
+		agentHost.Value = host
+	} else {
+		agentHost.ValueFrom = &v1.EnvVarSource{
+			FieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "status.hostIP"},
+		}
+	}
+
+	return []v1.EnvVar{
+		agentHost,
+		{Name: "DD_TRACE_AGENT_PORT", Value: p.agentPort()},
+	}
+}
+
+func (p *datadog) agentPort() string {
+	return p.setting("agentPort", "8126")
+}
+
+// Destinations returns the agent's trace port, on the Pod's node unless "agentHost" is set
+func (p *datadog) Destinations() []Destination {
+	port, err := strconv.Atoi(p.agentPort())
+	if err != nil {
+		return nil
+	}
+	return []Destination{{Host: p.setting("agentHost", ""), Port: port, Protocol: v1.ProtocolTCP}}
+}
@@ -0,0 +1,65 @@
+package apm
+
+import (
+	"fmt"
+	"os"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewRelicLicenseSecretKey is the key of the license in the New Relic Secret
+const NewRelicLicenseSecretKey = "license"
+
+const newRelicConfTemplate = `
+extension = "newrelic.so"
+
+[newrelic]
+newrelic.license = "{{ .License }}"
+newrelic.logfile = "/var/log/newrelic/php_agent.log"
+newrelic.appname = "{{ .AppName }}"
+newrelic.daemon.address = "{{ .Address }}"
+newrelic.daemon.dont_launch = 3 ; Never start the New Relic daemon in this container (there's a Deployment for that)
+`
+
+var tmplNewRelicConf = template.Must(template.New("tmplNewRelicConf").Parse(newRelicConfTemplate))
+
+// newRelic sends data to a cluster-wide New Relic daemon. The "daemonAddress" setting overrides the daemon address
+// given by the NEWRELIC_DAEMON_ADDR environment variable.
+type newRelic struct {
+	base
+}
+
+func (p *newRelic) daemonAddress() string {
+	return p.setting("daemonAddress", os.Getenv("NEWRELIC_DAEMON_ADDR"))
+}
+
+func (p *newRelic) PhpIni(c client.Client) (string, error) {
+	daemonAddr := p.daemonAddress()
+	if daemonAddr == "" {
+		return "", fmt.Errorf("NEWRELIC_DAEMON_ADDR not set")
+	}
+
+	license, err := p.secretValue(c, NewRelicLicenseSecretKey)
+	if err != nil {
+		return "", err
+	}
+
+	return render(tmplNewRelicConf, struct {
+		License, AppName, Address string
+	}{
+		License: license,
+		AppName: p.appName,
+		Address: daemonAddr,
+	})
+}
+
+func (p *newRelic) EnvVars() []v1.EnvVar {
+	return nil
+}
+
+// Destinations returns the daemon, which reports to New Relic itself
+func (p *newRelic) Destinations() []Destination {
+	return hostPortDestination(p.daemonAddress())
+}
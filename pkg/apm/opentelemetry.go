@@ -0,0 +1,83 @@
+package apm
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OpenTelemetryHeadersSecretKey is the key of the (optional) OTLP exporter headers in the OpenTelemetry Secret, e.g.
+// for an API key
+const OpenTelemetryHeadersSecretKey = "headers"
+
+const (
+	openTelemetryPhpIni          = "\nextension = \"opentelemetry.so\"\n"
+	openTelemetryDefaultProtocol = "http/protobuf"
+)
+
+// openTelemetry exports traces over OTLP to the "endpoint" setting, e.g. a collector in the cluster. The "protocol"
+// setting overrides the OTLP protocol ("http/protobuf").
+type openTelemetry struct {
+	base
+}
+
+func newOpenTelemetry(b base) (*openTelemetry, error) {
+	p := &openTelemetry{b}
+	if p.endpoint() == "" {
+		return nil, fmt.Errorf("OpenTelemetry APM needs the \"endpoint\" setting")
+	}
+	return p, nil
+}
+
+func (p *openTelemetry) endpoint() string {
+	return p.setting("endpoint", "")
+}
+
+func (p *openTelemetry) PhpIni(c client.Client) (string, error) {
+	return openTelemetryPhpIni, nil
+}
+
+func (p *openTelemetry) EnvVars() []v1.EnvVar {
+	env := []v1.EnvVar{
+		{Name: "OTEL_PHP_AUTOLOAD_ENABLED", Value: "true"},
+		{Name: "OTEL_SERVICE_NAME", Value: p.appName},
+		{Name: "OTEL_RESOURCE_ATTRIBUTES", Value: "deployment.environment=" + p.stage},
+		{Name: "OTEL_TRACES_EXPORTER", Value: "otlp"},
+		{Name: "OTEL_EXPORTER_OTLP_PROTOCOL", Value: p.setting("protocol", openTelemetryDefaultProtocol)},
+		{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: p.endpoint()},
+	}
+
+	if p.spec.Secret != "" {
+		optional := true
+		env = append(env, v1.EnvVar{
+			Name: "OTEL_EXPORTER_OTLP_HEADERS",
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: p.spec.Secret},
+					Key:                  OpenTelemetryHeadersSecretKey,
+					Optional:             &optional,
+				},
+			},
+		})
+	}
+	return env
+}
+
+// Destinations returns the host and port of the OTLP endpoint
+func (p *openTelemetry) Destinations() []Destination {
+	u, err := url.Parse(p.endpoint())
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return hostPortDestination(net.JoinHostPort(u.Hostname(), port))
+}
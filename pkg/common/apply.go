@@ -0,0 +1,83 @@
+package common
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// FieldManager is the field manager of the operator's server-side apply patches
+const FieldManager = "fn-drupal-operator"
+
+// Apply creates or updates an object with a server-side apply patch, owned by FieldManager. The object must only hold
+// the fields the operator manages (including its labels and owner references): fields defaulted by the API server or
+// set by other controllers are left alone, and fields the operator previously applied but no longer sets are removed.
+// Conflicting fields owned by other managers are taken over. The object is updated with the result.
+func Apply(c client.Client, scheme *runtime.Scheme, obj runtime.Object) (controllerutil.OperationResult, error) {
+	live, err := getLive(c, scheme, obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return patch(c, obj, live)
+}
+
+// getLive sets the apiVersion and kind of obj, which apply patches must include, and returns the live copy of obj, or
+// nil if it doesn't exist
+func getLive(c client.Client, scheme *runtime.Scheme, obj runtime.Object) (runtime.Object, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	key, err := client.ObjectKeyFromObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get into a new object rather than a copy of obj, so that none of its fields linger when the live copy lacks them
+	live, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Get(context.TODO(), key, live); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return live, nil
+}
+
+// patch applies obj, and tells whether that changed anything by comparing resource versions with its live copy (nil
+// if it didn't exist), since no-op applies don't bump it
+func patch(c client.Client, obj, live runtime.Object) (controllerutil.OperationResult, error) {
+	var resourceVersion string
+	if live != nil {
+		if accessor, err := meta.Accessor(live); err == nil {
+			resourceVersion = accessor.GetResourceVersion()
+		}
+	}
+
+	if err := c.Patch(context.TODO(), obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	switch {
+	case resourceVersion == "":
+		return controllerutil.OperationResultCreated, nil
+	case accessor.GetResourceVersion() != resourceVersion:
+		return controllerutil.OperationResultUpdated, nil
+	default:
+		return controllerutil.OperationResultNone, nil
+	}
+}
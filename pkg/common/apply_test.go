@@ -0,0 +1,47 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+func TestApply(t *testing.T) {
+	c := testhelpers.NewFakeClient(nil)
+	ctx := context.TODO()
+
+	configMap := func(value string) *v1.ConfigMap {
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test", Labels: map[string]string{"app": "test"}},
+			Data:       map[string]string{"key": value},
+		}
+	}
+
+	cm := configMap("a")
+	op, err := Apply(c, scheme.Scheme, cm)
+	require.NoError(t, err)
+	require.Equal(t, controllerutil.OperationResultCreated, op)
+	require.Equal(t, "ConfigMap", cm.Kind)
+
+	op, err = Apply(c, scheme.Scheme, configMap("a"))
+	require.NoError(t, err)
+	require.Equal(t, controllerutil.OperationResultNone, op)
+
+	// Fields set by others are kept
+	cm.Annotations = map[string]string{"other": "value"}
+	require.NoError(t, c.Update(ctx, cm))
+
+	cm = configMap("b")
+	op, err = Apply(c, scheme.Scheme, cm)
+	require.NoError(t, err)
+	require.Equal(t, controllerutil.OperationResultUpdated, op)
+	require.Equal(t, "b", cm.Data["key"])
+	require.Equal(t, "value", cm.Annotations["other"])
+}
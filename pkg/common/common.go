@@ -3,6 +3,7 @@ package common
 import (
 	"crypto/rand"
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"os"
@@ -16,6 +17,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 )
 
 const (
@@ -24,6 +27,24 @@ const (
 	useDynamicProvisioningEnv = "USE_DYNAMIC_PROVISIONING"
 	realmEnv                  = "AH_REALM"
 	isAwsEc2DisabledEnv       = "AWS_EC2_METADATA_DISABLED"
+
+	networkPoliciesEnabledEnv         = "NETWORK_POLICIES_ENABLED"
+	ingressNamespaceSelectorEnv       = "NETWORK_POLICY_INGRESS_NAMESPACE_SELECTOR"
+	istioGatewayNamespaceSelectorEnv  = "NETWORK_POLICY_ISTIO_GATEWAY_NAMESPACE_SELECTOR"
+	sshProxyNamespaceSelectorEnv      = "NETWORK_POLICY_SSH_PROXY_NAMESPACE_SELECTOR"
+	dnsNamespaceSelectorEnv           = "NETWORK_POLICY_DNS_NAMESPACE_SELECTOR"
+	dnsPodSelectorEnv                 = "NETWORK_POLICY_DNS_POD_SELECTOR"
+	egressAllowedNamespaceSelectorEnv = "NETWORK_POLICY_EGRESS_NAMESPACE_SELECTOR"
+	egressAllowedCIDRsEnv             = "NETWORK_POLICY_EGRESS_ALLOWLIST"
+
+	quotaProfilesEnv = "QUOTA_PROFILES"
+	driftPolicyEnv   = "DRIFT_POLICY"
+
+	operatorNamespaceEnv    = "OPERATOR_NAMESPACE"
+	namespacePullSecretsEnv = "NAMESPACE_PULL_SECRETS"
+
+	mysqlClientImageEnv = "MYSQL_CLIENT_IMAGE"
+	s3ClientImageEnv    = "S3_CLIENT_IMAGE"
 )
 
 var (
@@ -32,6 +53,24 @@ var (
 	useDynamicProvisioning = false
 	awsRegion              = ""
 	realm                  = ""
+
+	networkPoliciesEnabled         = false
+	ingressNamespaceSelector       = "name=ingress-nginx"
+	istioGatewayNamespaceSelector  = "name=istio-system"
+	sshProxyNamespaceSelector      = "name=acquia-polaris-system"
+	dnsNamespaceSelector           = "name=kube-system"
+	dnsPodSelector                 = "k8s-app=kube-dns"
+	egressAllowedNamespaceSelector = ""
+	egressAllowedCIDRs             []string
+
+	quotaProfiles      map[string]fnv1alpha1.QuotaProfile
+	defaultDriftPolicy = DriftPolicyRevert
+
+	operatorNamespace    = ""
+	namespacePullSecrets []string
+
+	mysqlClientImage = "mysql:5.7"
+	s3ClientImage    = "amazon/aws-cli:2.0.30"
 )
 var log = logf.Log.WithName("common")
 
@@ -50,6 +89,46 @@ func parseEnvVarValues() {
 	if r, exists := os.LookupEnv(realmEnv); exists {
 		realm = r
 	}
+
+	networkPoliciesEnabled, _ = strconv.ParseBool(os.Getenv(networkPoliciesEnabledEnv))
+	if s, exists := os.LookupEnv(ingressNamespaceSelectorEnv); exists {
+		ingressNamespaceSelector = s
+	}
+	if s, exists := os.LookupEnv(istioGatewayNamespaceSelectorEnv); exists {
+		istioGatewayNamespaceSelector = s
+	}
+	if s, exists := os.LookupEnv(sshProxyNamespaceSelectorEnv); exists {
+		sshProxyNamespaceSelector = s
+	}
+	if s, exists := os.LookupEnv(dnsNamespaceSelectorEnv); exists {
+		dnsNamespaceSelector = s
+	}
+	if s, exists := os.LookupEnv(dnsPodSelectorEnv); exists {
+		dnsPodSelector = s
+	}
+	egressAllowedNamespaceSelector = os.Getenv(egressAllowedNamespaceSelectorEnv)
+	egressAllowedCIDRs = splitList(os.Getenv(egressAllowedCIDRsEnv))
+
+	if p := os.Getenv(quotaProfilesEnv); p != "" {
+		if err := json.Unmarshal([]byte(p), &quotaProfiles); err != nil {
+			log.Error(err, "Failed to parse quota profiles, ignoring them", "env", quotaProfilesEnv)
+		}
+	}
+	if p := DriftPolicy(os.Getenv(driftPolicyEnv)); p != "" {
+		if p.IsValid() {
+			defaultDriftPolicy = p
+		} else {
+			log.Info("Ignoring invalid drift policy", "env", driftPolicyEnv, "policy", p)
+		}
+	}
+	operatorNamespace = os.Getenv(operatorNamespaceEnv)
+	namespacePullSecrets = splitList(os.Getenv(namespacePullSecretsEnv))
+	if i, exists := os.LookupEnv(mysqlClientImageEnv); exists && i != "" {
+		mysqlClientImage = i
+	}
+	if i, exists := os.LookupEnv(s3ClientImageEnv); exists && i != "" {
+		s3ClientImage = i
+	}
 	initAwsRegion()
 
 }
@@ -100,6 +179,90 @@ func UseDynamicProvisioning() bool {
 	return useDynamicProvisioning
 }
 
+// NetworkPoliciesEnabled returns true if NetworkPolicies should be managed for DrupalEnvironments, derived from an
+// environment variable.
+func NetworkPoliciesEnabled() bool {
+	return networkPoliciesEnabled
+}
+
+// IngressNamespaceSelector returns the label selector (in string form) matching the namespace(s) of the ingress
+// controller, derived from an environment variable.
+func IngressNamespaceSelector() string {
+	return ingressNamespaceSelector
+}
+
+// IstioGatewayNamespaceSelector returns the label selector (in string form) matching the namespace(s) of the Istio
+// ingress gateway and control plane, derived from an environment variable.
+func IstioGatewayNamespaceSelector() string {
+	return istioGatewayNamespaceSelector
+}
+
+// SSHProxyNamespaceSelector returns the label selector (in string form) matching the namespace(s) of the SSH proxy,
+// derived from an environment variable.
+func SSHProxyNamespaceSelector() string {
+	return sshProxyNamespaceSelector
+}
+
+// DNSNamespaceSelector returns the label selector (in string form) matching the namespace of the cluster DNS, derived
+// from an environment variable.
+func DNSNamespaceSelector() string {
+	return dnsNamespaceSelector
+}
+
+// DNSPodSelector returns the label selector (in string form) matching the cluster DNS Pods, derived from an environment
+// variable.
+func DNSPodSelector() string {
+	return dnsPodSelector
+}
+
+// EgressAllowedNamespaceSelector returns the label selector (in string form) matching namespaces which Drupal pods may
+// always connect to (e.g. for the New Relic daemon), derived from an environment variable. It is empty if unset.
+func EgressAllowedNamespaceSelector() string {
+	return egressAllowedNamespaceSelector
+}
+
+// EgressAllowedCIDRs returns the CIDRs which Drupal pods may always connect to, derived from a comma-separated
+// environment variable.
+func EgressAllowedCIDRs() []string {
+	return egressAllowedCIDRs
+}
+
+// DefaultQuotaProfile returns the operator-wide QuotaProfile for environments of the given stage, derived from a JSON
+// environment variable. DrupalApplications may override these.
+func DefaultQuotaProfile(stage string) (profile fnv1alpha1.QuotaProfile, ok bool) {
+	profile, ok = quotaProfiles[stage]
+	return
+}
+
+// DefaultDriftPolicy returns the drift policy of child resources without a DriftPolicyAnnotation, derived from an
+// environment variable.
+func DefaultDriftPolicy() DriftPolicy {
+	return defaultDriftPolicy
+}
+
+// OperatorNamespace returns the namespace the operator is deployed in, derived from an environment variable.
+func OperatorNamespace() string {
+	return operatorNamespace
+}
+
+// NamespacePullSecrets returns the names of the image pull Secrets in the operator's namespace that are copied to the
+// namespaces of provisioned environments, derived from a comma-separated environment variable.
+func NamespacePullSecrets() []string {
+	return namespacePullSecrets
+}
+
+// MysqlClientImage returns the image of the Jobs that dump databases with mysqldump, and restore them with mysql,
+// derived from an environment variable.
+func MysqlClientImage() string {
+	return mysqlClientImage
+}
+
+// S3ClientImage returns the image that copies database dumps to and from S3 with the AWS CLI, derived from an
+// environment variable.
+func S3ClientImage() string {
+	return s3ClientImage
+}
+
 func SetIsIstioEnabled_ForTestsOnly(b bool) {
 	isIstioEnabled = b
 }
@@ -120,6 +283,52 @@ func SetRealm_ForTestsOnly(s string) {
 	realm = s
 }
 
+func SetNetworkPoliciesEnabled_ForTestsOnly(b bool) {
+	networkPoliciesEnabled = b
+}
+
+func SetEgressAllowedCIDRs_ForTestsOnly(cidrs []string) {
+	egressAllowedCIDRs = cidrs
+}
+
+func SetQuotaProfiles_ForTestsOnly(p map[string]fnv1alpha1.QuotaProfile) {
+	quotaProfiles = p
+}
+
+func SetEgressAllowedNamespaceSelector_ForTestsOnly(s string) {
+	egressAllowedNamespaceSelector = s
+}
+
+func SetDefaultDriftPolicy_ForTestsOnly(p DriftPolicy) {
+	defaultDriftPolicy = p
+}
+
+func SetOperatorNamespace_ForTestsOnly(s string) {
+	operatorNamespace = s
+}
+
+func SetNamespacePullSecrets_ForTestsOnly(names []string) {
+	namespacePullSecrets = names
+}
+
+func SetMysqlClientImage_ForTestsOnly(i string) {
+	mysqlClientImage = i
+}
+
+func SetS3ClientImage_ForTestsOnly(i string) {
+	s3ClientImage = i
+}
+
+// splitList splits a comma-separated list, trimming whitespace and dropping empty entries
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
 func RandPassword() (string, error) {
 	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
 		"abcdefghijklmnopqrstuvwxyz" +
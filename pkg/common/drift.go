@@ -0,0 +1,461 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/metrics"
+)
+
+// DriftPolicy chooses what happens to changes made to a child resource outside of the operator. It is set per child
+// resource with the fnv1alpha1.DriftPolicyAnnotation, or else by DefaultDriftPolicy().
+type DriftPolicy string
+
+const (
+	// DriftPolicyRevert applies the desired state over changed fields
+	DriftPolicyRevert DriftPolicy = "revert"
+	// DriftPolicyReport keeps changed fields and reports them in the owner's Drifted condition, until the desired
+	// state of the resource changes
+	DriftPolicyReport DriftPolicy = "report"
+	// DriftPolicyAdopt keeps changed fields for good, even when the desired state of the resource changes
+	DriftPolicyAdopt DriftPolicy = "adopt"
+)
+
+// IsValid returns true for the known drift policies
+func (p DriftPolicy) IsValid() bool {
+	return p == DriftPolicyRevert || p == DriftPolicyReport || p == DriftPolicyAdopt
+}
+
+// Drift describes the fields of a child resource that were changed outside of the operator
+type Drift struct {
+	Kind string
+	Name string
+	// Fields are the JSON pointers (RFC 6901) of the changed fields
+	Fields []string
+	Policy DriftPolicy
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%v %v (%v)", d.Kind, d.Name, strings.Join(d.Fields, ", "))
+}
+
+// DriftDetector applies the child resources of an owner, detecting the changes made to them outside of the operator
+// since it last applied them. It's given the records of the last applied resources from the owner's status, and
+// returns new ones to save there once the resources are applied.
+type DriftDetector struct {
+	client     client.Client
+	scheme     *runtime.Scheme
+	controller string
+
+	previous map[string]fnv1alpha1.AppliedResource
+	applied  map[string]fnv1alpha1.AppliedResource
+	// adopted holds the adopted fields found by Detect, until Record saves them
+	adopted  map[string][]string
+	complete bool
+
+	// Drifts holds the drift found in this pass
+	Drifts []Drift
+}
+
+// NewDriftDetector returns a DriftDetector for the child resources of an owner, given the records of its last applied
+// resources
+func NewDriftDetector(c client.Client, scheme *runtime.Scheme, controller string, applied []fnv1alpha1.AppliedResource) *DriftDetector {
+	d := &DriftDetector{
+		client:     c,
+		scheme:     scheme,
+		controller: controller,
+		previous:   map[string]fnv1alpha1.AppliedResource{},
+		applied:    map[string]fnv1alpha1.AppliedResource{},
+		adopted:    map[string][]string{},
+	}
+	for _, a := range applied {
+		d.previous[appliedKey(a.Kind, a.Name)] = a
+	}
+	return d
+}
+
+func appliedKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// Apply is Apply, detecting the drift of the live object first. Drifted fields that are kept per the object's drift
+// policy are applied with their live values. The ignored fields (JSON pointers) are controlled by others once the
+// object exists, such as replicas controlled by an autoscaler: they aren't checked for drift, and keep their live
+// values.
+func (d *DriftDetector) Apply(obj runtime.Object, ignored ...string) (controllerutil.OperationResult, error) {
+	live, err := getLive(d.client, d.scheme, obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	desired, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	kind, name := obj.GetObjectKind().GroupVersionKind().Kind, accessor.GetName()
+
+	compared := runtime.DeepCopyJSON(desired)
+	for _, field := range ignored {
+		setFieldValue(compared, field, nil, false)
+	}
+	hash := HashValueOf(compared)
+
+	if live != nil {
+		liveFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+		if err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+
+		keep := d.Detect(kind, name, hash, DriftedFields(compared, liveFields), d.Policy(live))
+		for _, field := range ignored {
+			if _, found := fieldValue(liveFields, field); found {
+				keep = append(keep, field)
+			}
+		}
+		if len(keep) > 0 {
+			for _, field := range keep {
+				value, found := fieldValue(liveFields, field)
+				setFieldValue(desired, field, value, found)
+			}
+			if err = runtime.DefaultUnstructuredConverter.FromUnstructured(desired, obj); err != nil {
+				return controllerutil.OperationResultNone, err
+			}
+		}
+	}
+
+	op, err := patch(d.client, obj, live)
+	if err == nil {
+		d.Record(kind, name, hash)
+	}
+	return op, err
+}
+
+// Check detects the drift of an object that the operator creates but can't update, such as a PersistentVolumeClaim,
+// given its live copy. Since its drift can't be reverted, it's reported unless its policy is to adopt it.
+func (d *DriftDetector) Check(obj, live runtime.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, d.scheme)
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	desired, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	liveFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return err
+	}
+
+	policy := d.Policy(live)
+	if policy == DriftPolicyRevert {
+		policy = DriftPolicyReport
+	}
+	hash := HashValueOf(desired)
+	d.Detect(gvk.Kind, accessor.GetName(), hash, DriftedFields(desired, liveFields), policy)
+	d.Record(gvk.Kind, accessor.GetName(), hash)
+	return nil
+}
+
+// Policy returns the drift policy of a live object, from its DriftPolicyAnnotation or else the default
+func (d *DriftDetector) Policy(live runtime.Object) DriftPolicy {
+	accessor, err := meta.Accessor(live)
+	if err != nil {
+		return DefaultDriftPolicy()
+	}
+
+	value, ok := accessor.GetAnnotations()[fnv1alpha1.DriftPolicyAnnotation]
+	if !ok {
+		return DefaultDriftPolicy()
+	}
+	if policy := DriftPolicy(value); policy.IsValid() {
+		return policy
+	}
+	log.Info("Ignoring invalid drift policy", "Namespace", accessor.GetNamespace(), "Name", accessor.GetName(), "policy", value)
+	return DefaultDriftPolicy()
+}
+
+// Detect takes the fields of a resource whose live values differ from its desired state, given a hash of the desired
+// state, and returns the ones whose live values should be kept. The differences are only drift if the desired state is
+// the one last applied; otherwise it's the desired state that changed. Adopted fields are kept whatever the desired
+// state, for as long as the policy is to adopt them.
+func (d *DriftDetector) Detect(kind, name, hash string, fields []string, policy DriftPolicy) (keep []string) {
+	key := appliedKey(kind, name)
+	previous, applied := d.previous[key]
+
+	var adopted []string
+	if policy == DriftPolicyAdopt {
+		adopted = previous.AdoptedFields
+	}
+
+	var drifted []string
+	for _, field := range fields {
+		if isAdopted(adopted, field) {
+			keep = append(keep, field)
+		} else if applied && previous.AppliedHash == hash {
+			drifted = append(drifted, field)
+		}
+	}
+
+	if len(drifted) > 0 {
+		d.Drifts = append(d.Drifts, Drift{Kind: kind, Name: name, Fields: drifted, Policy: policy})
+		switch policy {
+		case DriftPolicyReport:
+			keep = append(keep, drifted...)
+		case DriftPolicyAdopt:
+			keep = append(keep, drifted...)
+			adopted = append(adopted, drifted...)
+			sort.Strings(adopted)
+		}
+	}
+	d.adopted[key] = adopted
+	return keep
+}
+
+// isAdopted returns true if the field, or a field containing it, is one of the adopted fields
+func isAdopted(adopted []string, field string) bool {
+	for _, a := range adopted {
+		if field == a || strings.HasPrefix(field, a+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Record records that the desired state with the given hash was applied to a resource
+func (d *DriftDetector) Record(kind, name, hash string) {
+	key := appliedKey(kind, name)
+	d.applied[key] = fnv1alpha1.AppliedResource{
+		Kind:          kind,
+		Name:          name,
+		AppliedHash:   hash,
+		AdoptedFields: d.adopted[key],
+	}
+}
+
+// Complete marks that all of the owner's child resources were applied in this pass, so that its Drifted condition and
+// records of applied resources can be updated in full
+func (d *DriftDetector) Complete() {
+	d.complete = true
+}
+
+// AppliedResources returns the records of the applied resources to save in the owner's status, sorted by kind and
+// name. Unless the pass was complete, the previous records of resources it didn't apply are kept.
+func (d *DriftDetector) AppliedResources() []fnv1alpha1.AppliedResource {
+	records := map[string]fnv1alpha1.AppliedResource{}
+	if !d.complete {
+		for key, a := range d.previous {
+			records[key] = a
+		}
+	}
+	for key, a := range d.applied {
+		records[key] = a
+	}
+
+	var list []fnv1alpha1.AppliedResource
+	for _, a := range records {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return appliedKey(list[i].Kind, list[i].Name) < appliedKey(list[j].Kind, list[j].Name)
+	})
+	return list
+}
+
+// Report records Events and metrics for the drift found in this pass, and if the pass was complete, sets the owner's
+// Drifted condition to the drift that was kept without being adopted
+func (d *DriftDetector) Report(recorder record.EventRecorder, owner runtime.Object, conditions *[]fnv1alpha1.Condition) {
+	var reported []string
+	for _, drift := range d.Drifts {
+		switch drift.Policy {
+		case DriftPolicyRevert:
+			recorder.Eventf(owner, v1.EventTypeNormal, ReasonDriftReverted, "Reverted changes to %v", drift)
+			metrics.DriftDetected(d.controller, drift.Kind, string(drift.Policy))
+		case DriftPolicyAdopt:
+			recorder.Eventf(owner, v1.EventTypeNormal, ReasonDriftAdopted, "Adopted changes to %v", drift)
+			metrics.DriftDetected(d.controller, drift.Kind, string(drift.Policy))
+		default:
+			reported = append(reported, drift.String())
+		}
+	}
+	if !d.complete {
+		return
+	}
+
+	if len(reported) == 0 {
+		fnv1alpha1.SetCondition(conditions, fnv1alpha1.Condition{
+			Type:   fnv1alpha1.DriftedCondition,
+			Status: v1.ConditionFalse,
+			Reason: "NoDrift",
+		})
+		return
+	}
+
+	message := "Changed outside of the operator: " + strings.Join(reported, "; ")
+	if c := fnv1alpha1.FindCondition(*conditions, fnv1alpha1.DriftedCondition); c == nil || c.Status != v1.ConditionTrue || c.Message != message {
+		// Report drift once, rather than on every pass that keeps it
+		recorder.Event(owner, v1.EventTypeWarning, ReasonDriftDetected, message)
+		for _, drift := range d.Drifts {
+			if drift.Policy == DriftPolicyReport {
+				metrics.DriftDetected(d.controller, drift.Kind, string(drift.Policy))
+			}
+		}
+	}
+	fnv1alpha1.SetCondition(conditions, fnv1alpha1.Condition{
+		Type:    fnv1alpha1.DriftedCondition,
+		Status:  v1.ConditionTrue,
+		Reason:  "DriftDetected",
+		Message: message,
+	})
+}
+
+// DriftedFields compares the desired and live states of an object, as converted by
+// runtime.DefaultUnstructuredConverter, and returns the JSON pointers of the fields that differ. Only the fields that
+// the desired state sets to non-empty values are compared, since the API server and other controllers set many more,
+// and the status isn't compared at all. Lists of the same length are compared item by item, other lists as a whole.
+func DriftedFields(desired, live map[string]interface{}) []string {
+	var fields []string
+	for key, value := range desired {
+		// Typed objects may lack their apiVersion and kind when read
+		if key == "apiVersion" || key == "kind" || key == "status" {
+			continue
+		}
+		fields = append(fields, driftedFields([]string{key}, value, live[key])...)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func driftedFields(path []string, desired, live interface{}) (fields []string) {
+	// Copy the path before appending to it, since it's shared between siblings
+	child := func(token string) []string {
+		return append(append([]string{}, path...), token)
+	}
+
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		if len(d) == 0 {
+			return nil
+		}
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{JSONPointer(path...)}
+		}
+		for key, value := range d {
+			fields = append(fields, driftedFields(child(key), value, l[key])...)
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			return nil
+		}
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return []string{JSONPointer(path...)}
+		}
+		for i := range d {
+			fields = append(fields, driftedFields(child(strconv.Itoa(i)), d[i], l[i])...)
+		}
+	default:
+		if desired == nil || reflect.ValueOf(desired).IsZero() {
+			return nil
+		}
+		if !reflect.DeepEqual(desired, live) {
+			return []string{JSONPointer(path...)}
+		}
+	}
+	return
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// JSONPointer returns the JSON pointer (RFC 6901) of a field, given the keys and list indexes of its path
+func JSONPointer(path ...string) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteString("/")
+		b.WriteString(pointerEscaper.Replace(token))
+	}
+	return b.String()
+}
+
+func parseJSONPointer(pointer string) (path []string) {
+	if pointer == "" {
+		return nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		path = append(path, pointerUnescaper.Replace(token))
+	}
+	return
+}
+
+// fieldValue returns the value of the field of an object at a JSON pointer, and whether it was found
+func fieldValue(obj interface{}, pointer string) (interface{}, bool) {
+	for _, token := range parseJSONPointer(pointer) {
+		switch o := obj.(type) {
+		case map[string]interface{}:
+			value, ok := o[token]
+			if !ok {
+				return nil, false
+			}
+			obj = value
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(o) {
+				return nil, false
+			}
+			obj = o[i]
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// setFieldValue sets the field of an object at a JSON pointer, or removes it from its map if found is false. Nothing is
+// set if the field's parent doesn't exist.
+func setFieldValue(obj interface{}, pointer string, value interface{}, found bool) {
+	path := parseJSONPointer(pointer)
+	if len(path) == 0 {
+		return
+	}
+	parent, ok := fieldValue(obj, JSONPointer(path[:len(path)-1]...))
+	if !ok {
+		return
+	}
+
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if found {
+			p[last] = value
+		} else {
+			delete(p, last)
+		}
+	case []interface{}:
+		if i, err := strconv.Atoi(last); err == nil && i >= 0 && i < len(p) && found {
+			p[i] = value
+		}
+	}
+}
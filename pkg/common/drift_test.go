@@ -0,0 +1,164 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+func TestDriftedFields(t *testing.T) {
+	desired := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":              "test",
+			"creationTimestamp": nil,
+			"annotations":       map[string]interface{}{"example.com/a~b": "desired"},
+		},
+		"data":   map[string]interface{}{"same": "value", "changed": "desired", "removed": "desired", "empty": ""},
+		"list":   []interface{}{map[string]interface{}{"name": "a", "value": int64(1)}},
+		"short":  []interface{}{"a", "b"},
+		"status": map[string]interface{}{"phase": "desired"},
+	}
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":            "test",
+			"resourceVersion": "42",
+			"annotations":     map[string]interface{}{"example.com/a~b": "live", "other": "value"},
+		},
+		"data":   map[string]interface{}{"same": "value", "changed": "live", "other": "value"},
+		"list":   []interface{}{map[string]interface{}{"name": "a", "value": int64(2), "defaulted": true}},
+		"short":  []interface{}{"a"},
+		"status": map[string]interface{}{"phase": "live"},
+	}
+
+	require.Equal(t, []string{
+		"/data/changed",
+		"/data/removed",
+		"/list/0/value",
+		"/metadata/annotations/example.com~1a~0b",
+		"/short",
+	}, DriftedFields(desired, live))
+	require.Empty(t, DriftedFields(desired, desired))
+}
+
+func TestJSONPointer(t *testing.T) {
+	pointer := JSONPointer("data", "a/b~c")
+	require.Equal(t, "/data/a~1b~0c", pointer)
+	require.Equal(t, []string{"data", "a/b~c"}, parseJSONPointer(pointer))
+
+	obj := map[string]interface{}{"data": map[string]interface{}{"a/b~c": "value"}}
+	value, found := fieldValue(obj, pointer)
+	require.True(t, found)
+	require.Equal(t, "value", value)
+
+	setFieldValue(obj, pointer, nil, false)
+	_, found = fieldValue(obj, pointer)
+	require.False(t, found)
+}
+
+func TestDriftDetector(t *testing.T) {
+	defer SetDefaultDriftPolicy_ForTestsOnly(DefaultDriftPolicy())
+	SetDefaultDriftPolicy_ForTestsOnly(DriftPolicyRevert)
+
+	c := testhelpers.NewFakeClient(nil)
+	recorder := testhelpers.NewFakeRecorder()
+	ctx := context.TODO()
+	key := types.NamespacedName{Namespace: "test", Name: "test"}
+
+	configMap := func(value string) *v1.ConfigMap {
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Data:       map[string]string{"key": value, "replicas": "1"},
+		}
+	}
+	// edit changes the live ConfigMap, as someone else would
+	edit := func(value, policy string) {
+		cm := &v1.ConfigMap{}
+		require.NoError(t, c.Get(ctx, key, cm))
+		cm.Data["key"] = value
+		cm.Annotations = map[string]string{fnv1alpha1.DriftPolicyAnnotation: policy}
+		require.NoError(t, c.Update(ctx, cm))
+	}
+	liveValue := func() string {
+		cm := &v1.ConfigMap{}
+		require.NoError(t, c.Get(ctx, key, cm))
+		return cm.Data["key"]
+	}
+
+	// pass applies a ConfigMap with a new DriftDetector, as a controller's pass would, and returns it
+	var status fnv1alpha1.DrupalEnvironmentStatus
+	pass := func(cm *v1.ConfigMap, ignored ...string) *DriftDetector {
+		d := NewDriftDetector(c, scheme.Scheme, "test-controller", status.AppliedResources)
+		_, err := d.Apply(cm, ignored...)
+		require.NoError(t, err)
+		d.Complete()
+		d.Report(recorder, cm, &status.Conditions)
+		status.AppliedResources = d.AppliedResources()
+		return d
+	}
+
+	d := pass(configMap("a"))
+	require.Empty(t, d.Drifts)
+	require.Len(t, status.AppliedResources, 1)
+	require.False(t, fnv1alpha1.IsConditionTrue(status.Conditions, fnv1alpha1.DriftedCondition))
+
+	t.Run("reverts drift", func(t *testing.T) {
+		edit("b", string(DriftPolicyRevert))
+		d := pass(configMap("a"))
+		require.Equal(t, []Drift{{Kind: "ConfigMap", Name: "test", Fields: []string{"/data/key"}, Policy: DriftPolicyRevert}}, d.Drifts)
+		require.Equal(t, "a", liveValue())
+		testhelpers.RequireEvent(t, recorder, v1.EventTypeNormal, ReasonDriftReverted)
+	})
+
+	t.Run("reports drift until the desired state changes", func(t *testing.T) {
+		edit("b", string(DriftPolicyReport))
+		for i := 0; i < 2; i++ {
+			d := pass(configMap("a"))
+			require.Len(t, d.Drifts, 1)
+			require.Equal(t, "b", liveValue())
+			require.True(t, fnv1alpha1.IsConditionTrue(status.Conditions, fnv1alpha1.DriftedCondition))
+			require.Contains(t, fnv1alpha1.FindCondition(status.Conditions, fnv1alpha1.DriftedCondition).Message, "ConfigMap test (/data/key)")
+		}
+		testhelpers.RequireEvent(t, recorder, v1.EventTypeWarning, ReasonDriftDetected)
+
+		d := pass(configMap("c"))
+		require.Empty(t, d.Drifts)
+		require.Equal(t, "c", liveValue())
+		require.False(t, fnv1alpha1.IsConditionTrue(status.Conditions, fnv1alpha1.DriftedCondition))
+	})
+
+	t.Run("adopts drift", func(t *testing.T) {
+		edit("b", string(DriftPolicyAdopt))
+		d := pass(configMap("c"))
+		require.Len(t, d.Drifts, 1)
+		require.Equal(t, []string{"/data/key"}, status.AppliedResources[0].AdoptedFields)
+		testhelpers.RequireEvent(t, recorder, v1.EventTypeNormal, ReasonDriftAdopted)
+
+		// Adopted fields are kept when the desired state changes
+		d = pass(configMap("d"))
+		require.Empty(t, d.Drifts)
+		require.Equal(t, "b", liveValue())
+		require.False(t, fnv1alpha1.IsConditionTrue(status.Conditions, fnv1alpha1.DriftedCondition))
+	})
+
+	t.Run("keeps ignored fields", func(t *testing.T) {
+		cm := &v1.ConfigMap{}
+		require.NoError(t, c.Get(ctx, key, cm))
+		cm.Data["replicas"] = "3"
+		require.NoError(t, c.Update(ctx, cm))
+
+		d := pass(configMap("d"), "/data/replicas")
+		require.Empty(t, d.Drifts)
+		require.NoError(t, c.Get(ctx, key, cm))
+		require.Equal(t, "3", cm.Data["replicas"])
+	})
+}
@@ -0,0 +1,76 @@
+package common
+
+// Reasons of the Kubernetes Events recorded by the controllers. These can be relied upon to filter Events (e.g.
+// `kubectl get events --field-selector reason=RolloutUpdated`), so existing values must not be changed.
+const (
+	// Shared
+	ReasonMigrated         = "Migrated"
+	ReasonMigrationWarning = "MigrationWarning"
+	ReasonFinalizerBlocked = "FinalizerBlocked"
+	ReasonReconcileFailed  = "ReconcileFailed"
+	ReasonDriftReverted    = "DriftReverted"
+	ReasonDriftDetected    = "DriftDetected"
+	ReasonDriftAdopted     = "DriftAdopted"
+
+	// DrupalApplication
+	ReasonImageRepoSet             = "ImageRepoSet"
+	ReasonEnvironmentsChanged      = "EnvironmentsChanged"
+	ReasonNamespaceProvisioned     = "NamespaceProvisioned"
+	ReasonNamespaceConflict        = "NamespaceConflict"
+	ReasonNamespaceNotEmpty        = "NamespaceNotEmpty"
+	ReasonNamespaceDeleted         = "NamespaceDeleted"
+	ReasonEnvironmentProvisioned   = "EnvironmentProvisioned"
+	ReasonEnvironmentDeprovisioned = "EnvironmentDeprovisioned"
+	ReasonEnvironmentProtected     = "EnvironmentProtected"
+
+	// DrupalEnvironment
+	ReasonParentApplicationMissing = "ParentApplicationMissing"
+	ReasonPersistentVolumeCreated  = "PersistentVolumeCreated"
+	ReasonPersistentVolumeFailed   = "PersistentVolumeFailed"
+	ReasonAPMConfigInvalid         = "APMConfigInvalid"
+	ReasonRolloutCreated           = "RolloutCreated"
+	ReasonRolloutUpdated           = "RolloutUpdated"
+	ReasonQuotaExceeded            = "QuotaExceeded"
+	ReasonTemplateMissing          = "TemplateMissing"
+	ReasonSpecInvalid              = "SpecInvalid"
+
+	// Site
+	ReasonParentEnvironmentMissing = "ParentEnvironmentMissing"
+	ReasonDatabaseMissing          = "DatabaseMissing"
+	ReasonSiteSettingsUpdated      = "SiteSettingsUpdated"
+	ReasonIngressUpdated           = "IngressUpdated"
+
+	// Database
+	ReasonUserSecretCreated       = "UserSecretCreated"
+	ReasonDatabasePingFailed      = "DatabasePingFailed"
+	ReasonDatabaseProvisioned     = "DatabaseProvisioned"
+	ReasonDatabaseProvisionFailed = "DatabaseProvisionFailed"
+	ReasonDatabaseDropped         = "DatabaseDropped"
+	ReasonDatabaseRetained        = "DatabaseRetained"
+	ReasonDatabaseSnapshotStarted = "DatabaseSnapshotStarted"
+	ReasonCredentialsRotated      = "CredentialsRotated"
+	ReasonPreviousUserDropped     = "PreviousUserDropped"
+
+	// DatabaseBackup and DatabaseRestore
+	ReasonBackupStarted      = "BackupStarted"
+	ReasonBackupSucceeded    = "BackupSucceeded"
+	ReasonBackupFailed       = "BackupFailed"
+	ReasonBackupNotReady     = "BackupNotReady"
+	ReasonRestoreStarted     = "RestoreStarted"
+	ReasonRestoreSucceeded   = "RestoreSucceeded"
+	ReasonRestoreFailed      = "RestoreFailed"
+	ReasonSitesInMaintenance = "SitesInMaintenance"
+	ReasonSitesReleased      = "SitesReleased"
+
+	// DatabaseBackupSchedule
+	ReasonBackupScheduled = "BackupScheduled"
+	ReasonBackupsPruned   = "BackupsPruned"
+	ReasonBackupOverdue   = "BackupOverdue"
+	ReasonInvalidSchedule = "InvalidSchedule"
+
+	// Command
+	ReasonInvalidTarget  = "InvalidTarget"
+	ReasonJobCreated     = "JobCreated"
+	ReasonCronJobCreated = "CronJobCreated"
+	ReasonCronJobUpdated = "CronJobUpdated"
+)
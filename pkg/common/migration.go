@@ -0,0 +1,18 @@
+package common
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+// RecordMigration records the migration of an object as Events: a Normal one for the migration, and a Warning one for
+// each warning of its steps.
+func RecordMigration(recorder record.EventRecorder, obj runtime.Object, report *fnv1alpha1.MigrationReport) {
+	recorder.Eventf(obj, v1.EventTypeNormal, ReasonMigrated, "Migrated from version %q to %q", report.From, report.To)
+	for _, warning := range report.Warnings {
+		recorder.Event(obj, v1.EventTypeWarning, ReasonMigrationWarning, warning)
+	}
+}
@@ -0,0 +1,12 @@
+// +build !test
+
+package controller
+
+import (
+	"github.com/acquia/fn-drupal-operator/pkg/controller/databasebackup"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, databasebackup.Add)
+}
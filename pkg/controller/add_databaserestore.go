@@ -0,0 +1,12 @@
+// +build !test
+
+package controller
+
+import (
+	"github.com/acquia/fn-drupal-operator/pkg/controller/databaserestore"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, databaserestore.Add)
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/go-test/deep"
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
@@ -15,6 +14,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -27,13 +28,26 @@ import (
 	fnresources "github.com/acquia/fn-drupal-operator/pkg/apis"
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/metrics"
 )
 
+// controllerName is the name of this controller, used for its Events and metrics
+const controllerName = "command-controller"
+
 var log = logf.Log.WithName("controller_command")
 
 // Add creates a new Command Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
+// Also registers webhooks for this type.
 func Add(mgr manager.Manager) error {
+	err := builder.
+		WebhookManagedBy(mgr).
+		For(&fnv1alpha1.Command{}).
+		Complete()
+	if err != nil {
+		log.Error(err, "could not create command webhook")
+		return err
+	}
 	return add(mgr, newReconciler(mgr))
 }
 
@@ -43,13 +57,22 @@ func newReconciler(mgr manager.Manager) reconcile.Reconciler {
 	if err := fnresources.AddToScheme(scheme); err != nil {
 		panic(err)
 	}
-	return &ReconcileCommand{client: mgr.GetClient(), scheme: scheme}
+	return NewReconciler(mgr.GetClient(), scheme, mgr.GetEventRecorderFor(controllerName))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileCommand{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("command-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
@@ -75,8 +98,9 @@ var _ reconcile.Reconciler = &ReconcileCommand{}
 type ReconcileCommand struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 type requestHandler struct {
@@ -142,6 +166,13 @@ func (rh *requestHandler) doReconcile(request reconcile.Request) (result reconci
 	rh.jobParams, target, err = rh.generateJobParams()
 	if err != nil {
 		rh.logger.Error(err, "Failed to generate jobParams")
+		rh.r.recorder.Eventf(rh.cmd, corev1.EventTypeWarning, common.ReasonInvalidTarget, "Failed to resolve targetRef: %v", err)
+		result.RequeueAfter = 60 * time.Second
+		return result, nil
+	}
+	if err = rh.cmd.Spec.ValidateTargetVolumes(rh.jobParams.volumes); err != nil {
+		rh.logger.Info("Additional volumes clash with the target's", "Error", err.Error())
+		rh.r.recorder.Eventf(rh.cmd, corev1.EventTypeWarning, common.ReasonInvalidTarget, "Invalid additional volumes: %v", err)
 		result.RequeueAfter = 60 * time.Second
 		return result, nil
 	}
@@ -158,10 +189,10 @@ func (rh *requestHandler) doReconcile(request reconcile.Request) (result reconci
 
 	// Create or Update the Job/CronJob
 	if rh.isCommandScheduled() {
-		return rh.reconcileCronJob()
+		return metrics.StepResult(controllerName, "cronjob", rh.reconcileCronJob)
 	} else if len(rh.cmd.Status.Job.Conditions) == 0 {
 		// Only reconcile if Job has not yet started, in case the Job is missing because it was deleted
-		return rh.reconcileJob()
+		return metrics.StepResult(controllerName, "job", rh.reconcileJob)
 	}
 
 	return
@@ -190,6 +221,10 @@ func (rh *requestHandler) needsReconcile() (needsReconcile bool, err error) {
 		job := &batchv1.Job{}
 		err = rh.r.client.Get(context.TODO(), key, job)
 		if err == nil {
+			// Count the Job's result the first time we see it finished
+			if jobResult(job.Status) != "" && jobResult(rh.cmd.Status.Job) == "" {
+				metrics.CommandJobFinished(rh.cmd, jobResult(job.Status))
+			}
 			// Update our status while we have the object handy
 			rh.cmd.Status.Job = job.Status
 		}
@@ -201,6 +236,22 @@ func (rh *requestHandler) needsReconcile() (needsReconcile bool, err error) {
 	return true, nil
 }
 
+// jobResult returns metrics.JobSucceeded or metrics.JobFailed if a Job has finished, otherwise ""
+func jobResult(status batchv1.JobStatus) string {
+	for _, c := range status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return metrics.JobSucceeded
+		case batchv1.JobFailed:
+			return metrics.JobFailed
+		}
+	}
+	return ""
+}
+
 func (rh *requestHandler) generateJobParams() (jobParams jobParams, target metav1.Object, err error) {
 	// Call the API Group handler for this targetRef's GroupVersion
 	var gv schema.GroupVersion
@@ -223,30 +274,24 @@ func (rh *requestHandler) reconcileCronJob() (result reconcile.Result, err error
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jobName(rh.cmd),
 			Namespace: rh.cmd.Namespace,
+			Labels:    rh.jobParams.labels,
 		},
+		Spec: rh.cronJobSpec(),
 	}
+	// Set Command instance as the owner and controller (will never error, since the CronJob has no other controller)
+	_ = controllerutil.SetControllerReference(rh.cmd, cronJob, rh.r.scheme)
 
 	var op controllerutil.OperationResult
-	op, err = controllerutil.CreateOrUpdate(context.TODO(), rh.r.client, cronJob, func() error {
-		desiredSpec := rh.cronJobSpec()
-
-		if cronJob.CreationTimestamp.IsZero() {
-			// Creating new CronJob. Set Command instance as the owner and controller (will never error since CronJob is new)
-			_ = controllerutil.SetControllerReference(rh.cmd, cronJob, rh.r.scheme)
-		}
-
-		if diff := deep.Equal(cronJob.Spec, desiredSpec); diff != nil {
-			rh.logger.Info("CronJob Spec needs update", "current != desired", diff)
-			cronJob.Spec = desiredSpec
-		}
-
-		cronJob.Labels = common.MergeLabels(cronJob.Labels, rh.jobParams.labels)
-
-		return nil
-	})
+	op, err = common.Apply(rh.r.client, rh.r.scheme, cronJob)
 	if err != nil {
 		return
 	}
+	switch op {
+	case controllerutil.OperationResultCreated:
+		rh.r.recorder.Eventf(rh.cmd, corev1.EventTypeNormal, common.ReasonCronJobCreated, "Created CronJob %q", cronJob.Name)
+	case controllerutil.OperationResultUpdated:
+		rh.r.recorder.Eventf(rh.cmd, corev1.EventTypeNormal, common.ReasonCronJobUpdated, "Updated CronJob %q", cronJob.Name)
+	}
 	if op != controllerutil.OperationResultNone {
 		rh.logger.Info("Successfully reconciled CronJob", "Operation", op)
 		result.Requeue = true
@@ -261,13 +306,17 @@ func (rh *requestHandler) reconcileJob() (result reconcile.Result, err error) {
 	_ = controllerutil.SetControllerReference(rh.cmd, job, rh.r.scheme)
 
 	err = rh.r.client.Create(context.TODO(), job)
-	if err != nil && errors.IsAlreadyExists(err) {
-		// Allow "already exists" error
-		rh.logger.Info("Job already exists", "Name", job.Name)
-		return result, nil
+	if err != nil {
+		if errors.IsAlreadyExists(err) {
+			// Allow "already exists" error
+			rh.logger.Info("Job already exists", "Name", job.Name)
+			return result, nil
+		}
+		return
 	}
 
 	rh.logger.Info("Created Job", "Name", job.Name)
+	rh.r.recorder.Eventf(rh.cmd, corev1.EventTypeNormal, common.ReasonJobCreated, "Created Job %q", job.Name)
 	result.Requeue = true
 	return
 }
@@ -277,14 +326,15 @@ func (rh *requestHandler) newJob() *batchv1.Job {
 	completions := int32(1)
 	terminationGracePeriod := int64(corev1.DefaultTerminationGracePeriodSeconds)
 
-	activeDeadlineSeconds := int64(3600) // By default, Job has one hour to complete or it will be killed
+	// Commands created before the webhook defaulted these settings may still leave them unset
+	activeDeadlineSeconds := fnv1alpha1.DefaultCommandActiveDeadlineSeconds
 	if rh.cmd.Spec.ActiveDeadlineSeconds != nil {
 		activeDeadlineSeconds = *rh.cmd.Spec.ActiveDeadlineSeconds
 	}
 
 	restartPolicy := rh.cmd.Spec.RestartPolicy
 	if restartPolicy == "" {
-		restartPolicy = corev1.RestartPolicyNever
+		restartPolicy = fnv1alpha1.DefaultCommandRestartPolicy
 	}
 
 	customerContainer := rh.jobParams.container
@@ -375,10 +425,9 @@ func (rh *requestHandler) cronJobSpec() batchv1beta1.CronJobSpec {
 		suspend = true
 	}
 
-	// Default concurrencyPolicy is Forbid
 	concurrencyPolicy := rh.cmd.Spec.ConcurrencyPolicy
 	if concurrencyPolicy == "" {
-		concurrencyPolicy = batchv1beta1.ForbidConcurrent
+		concurrencyPolicy = fnv1alpha1.DefaultCommandConcurrencyPolicy
 	}
 
 	job := rh.newJob()
@@ -9,12 +9,15 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
 	"github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	fntesthelpers "github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 	"github.com/acquia/fn-go-utils/pkg/testhelpers"
 )
 
@@ -79,6 +82,7 @@ func Test_UnsupportedTargetRef(t *testing.T) {
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
 		require.Equal(t, requeueAfterResult, res)
+		fntesthelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonInvalidTarget)
 	})
 
 	t.Run("Verify failure on unsupported API Group", func(t *testing.T) {
@@ -198,6 +202,7 @@ func Test_ReconcileDefaultCommand(t *testing.T) {
 	require.NoError(t, err)
 
 	require.True(t, testhelpers.GoldenSpec(t, "basicCommandJobSpec", job.Spec))
+	fntesthelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonJobCreated)
 
 	// Reconcile to verify no changes or requeueing
 	res, err = r.Reconcile(req)
@@ -348,6 +353,7 @@ func Test_ReconcileCronCommand(t *testing.T) {
 	require.NoError(t, err)
 
 	require.True(t, testhelpers.GoldenSpec(t, "cronCommandCronSpec", cron.Spec))
+	fntesthelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonCronJobCreated)
 
 	// Explicitly set CreationTimestamp on CronJob, so controllerutil.CreateOrUpdate() works properly
 	cron.CreationTimestamp = testCreationTimestamp
@@ -550,3 +556,20 @@ func Test_NoMatchingContainer(t *testing.T) {
 		require.Equal(t, requeueAfterResult, res)
 	})
 }
+
+// Test_AdditionalVolumeClash verifies that no Job is created if an additional volume has the name of a target's volume
+func Test_AdditionalVolumeClash(t *testing.T) {
+	pod := drupalPod.DeepCopy()
+	pod.Spec.Volumes = []corev1.Volume{{Name: additionalVolumes[0].Name}}
+
+	r := BuildFakeReconcile([]runtime.Object{drupalApplication, drupalEnvironment, site, pod, defaultCommandOnSite})
+	commandKey := types.NamespacedName{Name: defaultCommandOnSite.Name, Namespace: defaultCommandOnSite.Namespace}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: commandKey})
+	require.NoError(t, err)
+	require.Equal(t, reconcile.Result{RequeueAfter: 60 * time.Second}, res)
+	fntesthelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonInvalidTarget)
+
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: "command-" + defaultCommandOnSite.Name, Namespace: defaultCommandOnSite.Namespace}, &batchv1.Job{})
+	require.True(t, errors.IsNotFound(err))
+}
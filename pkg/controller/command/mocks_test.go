@@ -291,7 +291,8 @@ func BuildFakeReconcile(objects []runtime.Object) *ReconcileCommand {
 
 	// create a ReconcileDrupalApplication object with the scheme and fake client
 	return &ReconcileCommand{
-		client: c,
-		scheme: scheme.Scheme,
+		client:   c,
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
 	}
 }
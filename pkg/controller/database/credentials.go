@@ -0,0 +1,239 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	fn "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
+)
+
+// now returns the current time. Useful for mocking the time credentials are rotated at.
+var now = time.Now
+
+// rolloutCheckInterval is how often the rollout of rotated credentials to the Sites of a Database is checked on, once
+// the grace period of the previous user passed
+const rolloutCheckInterval = 30 * time.Second
+
+// reconcileCredentials rotates the credentials of a Database when they're requested with the
+// RotateCredentialsAnnotation, or when its RotationInterval passed. Credentials are rotated between the user of the spec
+// and its alternate user: the user that isn't in use gets a new password and replaces the current user in the user
+// Secret, which the Sites of the Database render into their settings, rolling out new Drupal Pods. The previous user
+// keeps working for at least the CredentialsGracePeriod, and until the new credentials were rolled out to all the
+// Sites, so that Pods still using it aren't cut off, and is then dropped. Another rotation waits for the previous user
+// to be dropped.
+func (rh *requestHandler) reconcileCredentials(adminDB *sql.DB, user string) error {
+	db := rh.database
+	t := now()
+	if user != db.Spec.User && user != db.AlternateUser() {
+		rh.logger.Info("Not rotating credentials of a user that the Database doesn't manage", "User", user)
+		return nil
+	}
+
+	// Finish recording a rotation that updated the user Secret but not the status
+	recorded := db.Spec.User
+	if db.Status.Credentials != nil {
+		recorded = db.Status.Credentials.User
+	}
+	if user != recorded {
+		return rh.recordRotation(user, recorded, t)
+	}
+
+	if creds := db.Status.Credentials; creds != nil && creds.PreviousUser != "" {
+		if drop := creds.LastRotationTime.Add(fn.CredentialsGracePeriod); t.Before(drop) {
+			rh.requeueAfter = drop.Sub(t)
+			return nil
+		}
+		if rolledOut, err := rh.credentialsRolledOut(creds); err != nil {
+			return err
+		} else if !rolledOut {
+			rh.requeueAfter = rolloutCheckInterval
+			return nil
+		}
+		if err := rh.dropPreviousUser(adminDB); err != nil {
+			return err
+		}
+	}
+
+	next := rh.nextRotation(t)
+	if next.IsZero() {
+		return nil
+	}
+	if t.Before(next) {
+		rh.requeueAfter = next.Sub(t)
+		return nil
+	}
+	return rh.rotateCredentials(adminDB, user, t)
+}
+
+// nextRotation returns when the credentials of the Database are rotated next: at t if a rotation was requested, after
+// the RotationInterval passed since the last rotation, or never (the zero time) without an interval
+func (rh *requestHandler) nextRotation(t time.Time) time.Time {
+	db := rh.database
+	creds := db.Status.Credentials
+	if request := db.GetAnnotations()[fn.RotateCredentialsAnnotation]; request != "" && (creds == nil || request != creds.RotationRequest) {
+		return t
+	}
+	if db.Spec.RotationInterval == nil {
+		return time.Time{}
+	}
+
+	last := db.CreationTimestamp.Time
+	if creds != nil {
+		last = creds.LastRotationTime.Time
+	}
+	return last.Add(db.Spec.RotationInterval.Duration)
+}
+
+// rotateCredentials gives a new password to the user that isn't in use, and replaces the current user with it in the
+// user Secret
+func (rh *requestHandler) rotateCredentials(adminDB *sql.DB, user string, t time.Time) error {
+	db := rh.database
+	next := db.AlternateUser()
+	if user == next {
+		next = db.Spec.User
+	}
+
+	password, err := common.RandPassword()
+	if err != nil {
+		return err
+	}
+	if err := rh.provisionUser(adminDB, next, password); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	if err := rh.reconciler.client.Get(context.TODO(), types.NamespacedName{Namespace: db.Namespace, Name: db.Spec.UserSecret}, secret); err != nil {
+		return err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data["username"] = []byte(next)
+	secret.Data["password"] = []byte(password)
+	if err := rh.reconciler.client.Update(context.TODO(), secret); err != nil {
+		return err
+	}
+
+	rh.logger.Info("Rotated credentials", "User", next, "PreviousUser", user)
+	rh.reconciler.recorder.Eventf(db, corev1.EventTypeNormal, common.ReasonCredentialsRotated, "Rotated credentials from user %q to %q", user, next)
+	return rh.recordRotation(next, user, t)
+}
+
+// recordRotation records in the Database's status that its credentials were rotated from the previous user to user,
+// which was provisioned before the user Secret was updated. The value of the RotateCredentialsAnnotation is recorded as
+// acted on, since the rotation fulfills any request.
+func (rh *requestHandler) recordRotation(user, previous string, t time.Time) error {
+	rh.database.Status.ProvisionedUser = user
+	rh.database.Status.Credentials = &fn.DatabaseCredentials{
+		User:             user,
+		PreviousUser:     previous,
+		LastRotationTime: metav1.NewTime(t),
+		RotationRequest:  rh.database.GetAnnotations()[fn.RotateCredentialsAnnotation],
+	}
+	rh.requeueAfter = fn.CredentialsGracePeriod
+	return rh.reconciler.client.Status().Update(context.TODO(), rh.database)
+}
+
+// credentialsRolledOut returns whether no Drupal Pod of the Sites of the Database uses its previous user anymore: the
+// settings of each Site, in the "env-config" Secret of its DrupalEnvironment, connect as the current user, and each
+// environment finished rolling out Drupal Pods created since the rotation. Sites whose DrupalEnvironment doesn't exist
+// have no Pods.
+func (rh *requestHandler) credentialsRolledOut(creds *fn.DatabaseCredentials) (bool, error) {
+	db := rh.database
+	c := rh.reconciler.client
+	sites := &fn.SiteList{}
+	if err := c.List(context.TODO(), sites, client.InNamespace(db.Namespace)); err != nil {
+		return false, err
+	}
+
+	checked := map[string]bool{}
+	for i := range sites.Items {
+		site := &sites.Items[i]
+		if site.Spec.Database != db.Name {
+			continue
+		}
+		env := &fn.DrupalEnvironment{}
+		err := c.Get(context.TODO(), types.NamespacedName{Namespace: db.Namespace, Name: site.Spec.Environment}, env)
+		if err != nil && errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		envConfig := &corev1.Secret{}
+		err = c.Get(context.TODO(), types.NamespacedName{Namespace: db.Namespace, Name: envconfig.SecretName(env.Name)}, envConfig)
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		if !settingsUseUser(envConfig.Data[envconfig.SettingsFileName(site)], creds.User) {
+			rh.logger.Info("Waiting for the Site's settings to use the rotated credentials", "Site", site.Name, "User", creds.User)
+			return false, nil
+		}
+
+		if checked[env.Name] {
+			continue
+		}
+		checked[env.Name] = true
+		if rolledOut, err := rh.environmentRolledOut(env, creds.LastRotationTime.Time); !rolledOut || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// environmentRolledOut returns whether a DrupalEnvironment is synced, with all its Drupal Pods created since the given
+// time
+func (rh *requestHandler) environmentRolledOut(env *fn.DrupalEnvironment, since time.Time) (bool, error) {
+	if env.Status.Status != fn.DrupalEnvironmentStatusSynced {
+		rh.logger.Info("Waiting for the DrupalEnvironment to roll out the rotated credentials", "DrupalEnvironment", env.Name, "Status", env.Status.Status)
+		return false, nil
+	}
+
+	// The labels of the environment's Drupal Pods, whether they belong to its Rollout or to a legacy Deployment
+	labels := common.MergeLabels(env.ChildLabels(), map[string]string{"app": "drupal"})
+	pods := &corev1.PodList{}
+	if err := rh.reconciler.client.List(context.TODO(), pods, client.InNamespace(env.Namespace), client.MatchingLabels(labels)); err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		if pod.CreationTimestamp.Time.Before(since) {
+			rh.logger.Info("Waiting for the Drupal Pods created before the rotation to be replaced", "DrupalEnvironment", env.Name, "Pod", pod.Name)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// settingsUseUser returns whether a Site's settings include file, as rendered by the Site controller, connects to its
+// database as the given user
+func settingsUseUser(settingsInc []byte, user string) bool {
+	return bytes.Contains(settingsInc, []byte(fmt.Sprintf("'username' => '%s',", user)))
+}
+
+// dropPreviousUser drops the user that the credentials were last rotated from
+func (rh *requestHandler) dropPreviousUser(adminDB *sql.DB) error {
+	db := rh.database
+	previous := db.Status.Credentials.PreviousUser
+	if _, err := adminDB.Exec(fmt.Sprintf("DROP USER '%s'@'%%'", previous)); err != nil {
+		// 1396 is ERR_CANNOT_USER, in this case because the user was already dropped
+		if driverError, ok := err.(*mysql.MySQLError); !ok || driverError.Number != 1396 {
+			return err
+		}
+	}
+	rh.reconciler.recorder.Eventf(db, corev1.EventTypeNormal, common.ReasonPreviousUserDropped, "Dropped previous user %q", previous)
+
+	db.Status.Credentials.PreviousUser = ""
+	return rh.reconciler.client.Status().Update(context.TODO(), db)
+}
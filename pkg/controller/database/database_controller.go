@@ -9,12 +9,15 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/go-sql-driver/mysql"
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -27,8 +30,12 @@ import (
 
 	fn "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/metrics"
 )
 
+// controllerName is the name of this controller, used for its Events and metrics
+const controllerName = "database-controller"
+
 // dbPwdSecretFinalizer defines the database password secret finalizer.
 const dbPwdSecretFinalizer = "database.fnresources.acquia.com/password"
 
@@ -51,13 +58,17 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileDatabase{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileDatabase{
+		client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor(controllerName),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("database-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
@@ -77,6 +88,15 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch for changes to snapshot Jobs, to finish deleting their Database once they complete
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &fn.Database{},
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -87,8 +107,9 @@ var _ reconcile.Reconciler = &ReconcileDatabase{}
 type ReconcileDatabase struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 // requestHandler gets initialized per request to have thread-safe code.
@@ -97,6 +118,8 @@ type requestHandler struct {
 	namespace  string
 	database   *fn.Database
 	logger     logr.Logger
+	// requeueAfter is when the Database is reconciled again, to rotate its credentials or drop its previous user
+	requeueAfter time.Duration
 }
 
 // Useful for mocking the MYSQL datbase
@@ -130,9 +153,9 @@ func (r *ReconcileDatabase) Reconcile(request reconcile.Request) (reconcile.Resu
 
 	// migrate to new Spec FIRST before anything else so we know for the rest
 	// of reconciliation that the type we have is safe
-	currentVersion := fn.ObjectVersion(rh.database)
-	if fn.Migrate(rh.database) {
-		rh.logger.Info("MIGRATING", "current version", currentVersion, "target version", rh.database.SpecVersion())
+	if report := fn.Migrate(rh.database); report != nil {
+		rh.logger.Info("MIGRATING", "current version", report.From, "target version", report.To, "steps", report.Steps)
+		common.RecordMigration(r.recorder, rh.database, report)
 		return reconcile.Result{Requeue: true}, r.client.Update(context.TODO(), rh.database)
 	}
 
@@ -146,9 +169,13 @@ func (r *ReconcileDatabase) Reconcile(request reconcile.Request) (reconcile.Resu
 
 	isDatabaseMarkedToBeDeleted := rh.database.GetDeletionTimestamp() != nil
 	if isDatabaseMarkedToBeDeleted {
-		if err := rh.finalizeDatabase(); err != nil {
+		if wait, err := rh.reclaimDatabase(); wait || err != nil {
+			if err != nil {
+				r.recorder.Eventf(rh.database, corev1.EventTypeWarning, common.ReasonFinalizerBlocked, "Failed to reclaim database: %v", err)
+			}
 			return reconcile.Result{}, err
 		}
+		metrics.ForgetDatabase(rh.database)
 
 		if requeue, err := rh.removeDbAdminFinalizer(); requeue || err != nil {
 			return reconcile.Result{Requeue: requeue}, err
@@ -166,19 +193,41 @@ func (r *ReconcileDatabase) Reconcile(request reconcile.Request) (reconcile.Resu
 		return reconcile.Result{Requeue: requeue}, err
 	}
 
-	if requeue, err := rh.reconcileUserSecret(); requeue || err != nil {
+	if requeue, err := metrics.Step(controllerName, "user-secret", rh.reconcileUserSecret); requeue || err != nil {
 		return reconcile.Result{Requeue: requeue}, err
 	}
 
-	if requeue, err := rh.reconcileDatabase(); requeue || err != nil {
+	if requeue, err := metrics.Step(controllerName, "database", rh.reconcileDatabase); requeue || err != nil {
 		if err != nil {
 			rh.logger.Error(err, "Failed to reconcile Database")
+			metrics.DatabaseProvisionFailed(rh.database)
+			r.recorder.Eventf(rh.database, corev1.EventTypeWarning, common.ReasonDatabaseProvisionFailed, "Failed to provision database: %v", err)
+			if errStatus := rh.updateReadyCondition(corev1.ConditionFalse, "ProvisionFailed", err.Error()); errStatus != nil {
+				rh.logger.Error(errStatus, "Failed to update Database status")
+			}
 			return reconcile.Result{}, err
 		}
-		return reconcile.Result{RequeueAfter: time.Second * 10}, nil
+		return reconcile.Result{RequeueAfter: time.Second * 10}, rh.updateReadyCondition(corev1.ConditionFalse, "Pending", "Waiting for the database server")
+	}
+
+	return reconcile.Result{RequeueAfter: rh.requeueAfter}, rh.updateReadyCondition(corev1.ConditionTrue, "Provisioned", "")
+}
+
+// updateReadyCondition sets the Database's Ready condition, updating its status if the condition changed
+func (rh *requestHandler) updateReadyCondition(status corev1.ConditionStatus, reason, message string) error {
+	conditions := rh.database.DeepCopy().Status.Conditions
+	fn.SetCondition(&conditions, fn.Condition{
+		Type:    fn.DatabaseReadyCondition,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+	if cmp.Equal(conditions, rh.database.Status.Conditions) {
+		return nil
 	}
 
-	return reconcile.Result{}, nil
+	rh.database.Status.Conditions = conditions
+	return rh.reconciler.client.Status().Update(context.TODO(), rh.database)
 }
 
 // associateResourceWithController sets subresource ownership
@@ -212,12 +261,13 @@ func (rh *requestHandler) reconcileDatabase() (requeue bool, err error) {
 	}
 
 	dbName := rh.database.DatabaseName()
-	dbUser := rh.database.Spec.User
 
-	pwd, err := rh.database.GetPassword(r.client)
+	// The user may be the alternate one, once credentials were rotated
+	conn, err := rh.database.GetConnectionConfig(r.client)
 	if err != nil {
 		return false, err
 	}
+	dbUser := conn.User
 
 	adminDB, err := getAdminDatabaseConnection(rh.database, r.client)
 	if err != nil {
@@ -225,14 +275,18 @@ func (rh *requestHandler) reconcileDatabase() (requeue bool, err error) {
 	}
 
 	defer func() {
-		err = adminDB.Close()
-		if err != nil {
-			rh.logger.Error(err, "adminDB.Close() failed")
+		// Don't hide the error the database was provisioned with behind a successful close
+		if errClose := adminDB.Close(); errClose != nil {
+			rh.logger.Error(errClose, "adminDB.Close() failed")
+			if err == nil {
+				err = errClose
+			}
 		}
 	}()
 
 	if err := adminDB.Ping(); err != nil {
 		rh.logger.Error(err, "adminDB.Ping() failed ")
+		r.recorder.Eventf(rh.database, corev1.EventTypeWarning, common.ReasonDatabasePingFailed, "Failed to connect to the database server: %v", err)
 		return true, nil
 	}
 
@@ -240,43 +294,85 @@ func (rh *requestHandler) reconcileDatabase() (requeue bool, err error) {
 		return requeue, err
 	}
 
-	_, err = adminDB.Exec("CREATE DATABASE IF NOT EXISTS `" + dbName + "`")
+	if err := rh.claimSchema(adminDB); err != nil {
+		return false, err
+	}
+
+	res, err := adminDB.Exec("CREATE DATABASE IF NOT EXISTS `" + dbName + "`")
 	if err != nil {
 		rh.logger.Error(err, "Create database failed")
 		return false, err
 	}
 
-	if _, err := adminDB.Exec(fmt.Sprintf("CREATE USER '%s'@'%%'", dbUser)); err != nil {
+	// The user is only provisioned along with the schema, or when it changes as credentials are rotated
+	if rh.database.Status.ProvisionedUser != dbUser {
+		if err := rh.provisionUser(adminDB, dbUser, conn.Password); err != nil {
+			return false, err
+		}
+		rh.database.Status.ProvisionedUser = dbUser
+		if err := r.client.Status().Update(context.TODO(), rh.database); err != nil {
+			return false, err
+		}
+	}
+
+	rh.logger.V(1).Info("MySQL db/user reconciled", "Database", dbName, "User", dbUser)
+	if created, _ := res.RowsAffected(); created > 0 {
+		r.recorder.Eventf(rh.database, corev1.EventTypeNormal, common.ReasonDatabaseProvisioned, "Created database %q for user %q", dbName, dbUser)
+		metrics.DatabaseProvisioned(rh.database)
+	}
+
+	return false, rh.reconcileCredentials(adminDB, dbUser)
+}
+
+// provisionUser creates a MySQL user if it doesn't exist yet, and sets its password and its privileges on the schema
+func (rh *requestHandler) provisionUser(adminDB *sql.DB, user, password string) error {
+	if _, err := adminDB.Exec(fmt.Sprintf("CREATE USER '%s'@'%%'", user)); err != nil {
 		// 1396 is ERR_CANNOT_USER in mysql5.6. In this case, it means the user already
 		// exists in the system and cannot be created again.  This is the only error we
 		// are happy to see, so we just log that there is nothing to do and move on.  All
 		// other errors are failure cases.
 		if driverError, ok := err.(*mysql.MySQLError); !ok || driverError.Number != 1396 {
-			return false, err
+			return err
 		}
-		rh.logger.Info("Can't create user, it already exists", "User", dbUser)
+		rh.logger.Info("Can't create user, it already exists", "User", user)
 	}
 
-	if _, err := adminDB.Exec(fmt.Sprintf("SET PASSWORD FOR '%s'@'%%' = PASSWORD('%s')", dbUser, pwd)); err != nil {
-		return false, err
+	if _, err := adminDB.Exec(fmt.Sprintf("SET PASSWORD FOR '%s'@'%%' = PASSWORD('%s')", user, password)); err != nil {
+		return err
 	}
 
-	_, err = adminDB.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'", dbName, dbUser))
-	if err != nil {
-		return false, err
+	if _, err := adminDB.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'", rh.database.DatabaseName(), user)); err != nil {
+		return err
 	}
 
-	_, err = adminDB.Exec(fmt.Sprintf("FLUSH PRIVILEGES"))
-	if err != nil {
-		return false, err
+	_, err := adminDB.Exec("FLUSH PRIVILEGES")
+	return err
+}
+
+// claimSchema records in the Database's status that it provisioned its schema, before the schema is created. Unless
+// the Database adopts existing schemas, claiming fails if the schema already exists, so that a Database doesn't take over
+// a schema retained by another one (or still in use by it) by mistake.
+func (rh *requestHandler) claimSchema(adminDB *sql.DB) error {
+	if rh.database.Status.Provisioned {
+		return nil
 	}
 
-	rh.logger.V(1).Info("MySQL db/user reconciled", "Database", dbName, "User", dbUser)
+	if !rh.database.Spec.Adopt {
+		var name string
+		err := adminDB.QueryRow("SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?", rh.database.DatabaseName()).Scan(&name)
+		if err == nil {
+			return fmt.Errorf("database %q already exists; set spec.adopt to take it over", rh.database.DatabaseName())
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
 
-	return false, nil
+	rh.database.Status.Provisioned = true
+	return rh.reconciler.client.Status().Update(context.TODO(), rh.database)
 }
 
-// reconcileUserSecret creates user-password secret for each database object
+// reconcileUserSecret creates user-password secret for each database object. The Secret also holds the user, which
+// changes when credentials are rotated, so it's added to Secrets created before credentials could be rotated.
 func (rh *requestHandler) reconcileUserSecret() (requeue bool, err error) {
 	userSecret := &corev1.Secret{}
 
@@ -297,6 +393,7 @@ func (rh *requestHandler) reconcileUserSecret() (requeue bool, err error) {
 			},
 			// Defaulting sql user to databasename-user
 			Data: map[string][]byte{
+				"username": []byte(rh.database.Spec.User),
 				"password": []byte(password),
 			},
 			Type: "Opaque",
@@ -304,14 +401,24 @@ func (rh *requestHandler) reconcileUserSecret() (requeue bool, err error) {
 		// Associating secret with database controller
 		rh.reconciler.associateResourceWithController(userSecret, rh.database)
 
-		err = rh.reconciler.client.Create(context.TODO(), userSecret)
-		return true, err
+		if err := rh.reconciler.client.Create(context.TODO(), userSecret); err != nil {
+			return false, err
+		}
+		rh.reconciler.recorder.Eventf(rh.database, corev1.EventTypeNormal, common.ReasonUserSecretCreated, "Created user Secret %q", userSecret.Name)
+		return true, nil
 
 	} else if err != nil {
 		return false, err
 	}
 
-	return false, err
+	if _, ok := userSecret.Data["username"]; !ok {
+		if userSecret.Data == nil {
+			userSecret.Data = map[string][]byte{}
+		}
+		userSecret.Data["username"] = []byte(rh.database.Spec.User)
+		return false, rh.reconciler.client.Update(context.TODO(), userSecret)
+	}
+	return false, nil
 }
 
 // removeDbAdminFinalizer removes the database admin secret finalizer.
@@ -364,6 +471,23 @@ func (rh *requestHandler) removeFinalizer() (requeue bool, err error) {
 	return false, nil
 }
 
+// reclaimDatabase handles the schema and user of a deleted Database according to its reclaim policy. It returns wait
+// if the schema is being dumped, in which case the Database is reconciled again when the snapshot Job finishes.
+func (rh *requestHandler) reclaimDatabase() (wait bool, err error) {
+	db := rh.database
+	switch db.GetReclaimPolicy() {
+	case fn.DatabaseReclaimRetain:
+		rh.logger.Info("Retaining database", "Database", db.DatabaseName(), "User", db.Spec.User)
+		rh.reconciler.recorder.Eventf(db, corev1.EventTypeNormal, common.ReasonDatabaseRetained, "Retained database %q and user %q", db.DatabaseName(), db.Spec.User)
+		return false, nil
+	case fn.DatabaseReclaimSnapshot:
+		if done, err := rh.snapshotDatabase(); !done || err != nil {
+			return !done, err
+		}
+	}
+	return false, rh.finalizeDatabase()
+}
+
 func (rh *requestHandler) finalizeDatabase() error {
 	db := rh.database
 	adminDB, err := getAdminDatabaseConnection(rh.database, rh.reconciler.client)
@@ -391,12 +515,20 @@ func (rh *requestHandler) finalizeDatabase() error {
 		return err
 	}
 
-	if _, err = adminDB.Exec(fmt.Sprintf("DROP USER '%s'@'%%'", db.Spec.User)); err != nil {
-		if driverError, ok := err.(*mysql.MySQLError); !ok || driverError.Number != 1396 {
-			return err
+	// Either user may exist once credentials were rotated
+	users := []string{db.Spec.User}
+	if db.Status.Credentials != nil {
+		users = append(users, db.AlternateUser())
+	}
+	for _, user := range users {
+		if _, err = adminDB.Exec(fmt.Sprintf("DROP USER '%s'@'%%'", user)); err != nil {
+			if driverError, ok := err.(*mysql.MySQLError); !ok || driverError.Number != 1396 {
+				return err
+			}
+			rh.logger.Info("Cannot drop user, user not found", "User", user)
 		}
-		rh.logger.Info("Cannot drop user, user not found", "User", db.Spec.User)
 	}
+	rh.reconciler.recorder.Eventf(db, corev1.EventTypeNormal, common.ReasonDatabaseDropped, "Dropped database %q and user %q", db.DatabaseName(), db.Spec.User)
 
 	return nil
 }
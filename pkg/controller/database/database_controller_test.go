@@ -2,21 +2,25 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 
 	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
 )
 
 func TestDatabaseController_UnknownName(t *testing.T) {
@@ -52,7 +56,8 @@ func testMigration(r *ReconcileDatabase, req reconcile.Request) func(t *testing.
 		database := &fnv1alpha1.Database{}
 		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, database)
 		require.NoError(t, err)
-		require.Equal(t, "2", database.GetLabels()[fnv1alpha1.VersionLabel])
+		require.Equal(t, "3", database.GetLabels()[fnv1alpha1.VersionLabel])
+		require.True(t, database.Spec.Adopt, "Databases created before spec.adopt should adopt their schema")
 	}
 }
 
@@ -115,12 +120,21 @@ func TestDatabaseController_KnownName(t *testing.T) {
 		// Verify that Owner References have been applied
 		require.Equal(t, secret.OwnerReferences[0].Kind, "Database")
 		require.Equal(t, secret.OwnerReferences[0].Name, testName)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonUserSecretCreated)
 	})
 
 	t.Run("should not reconcile database and throw error", func(t *testing.T) {
 		_, err := r.Reconcile(req)
 		// expecting an error because of missing "admin secrets".
 		require.EqualError(t, err, "secrets \"wlgore-admin-secret\" not found")
+
+		database := &fnv1alpha1.Database{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, database)
+		require.NoError(t, err)
+		ready := fnv1alpha1.FindCondition(database.Status.Conditions, fnv1alpha1.DatabaseReadyCondition)
+		require.NotNil(t, ready)
+		require.Equal(t, corev1.ConditionFalse, ready.Status)
+		require.Equal(t, "ProvisionFailed", ready.Reason)
 	})
 
 	// Manually creating the admin secrets
@@ -149,7 +163,7 @@ func TestDatabaseController_KnownName(t *testing.T) {
 		defer restoreAdminConnectionFunc()
 
 		res, err := r.Reconcile(req)
-		require.EqualError(t, err, "all expectations were already fulfilled, call to database Close was not expected")
+		require.EqualError(t, err, "Error 1396: User already exists")
 		require.False(t, res.Requeue)
 	})
 
@@ -164,16 +178,101 @@ func TestDatabaseController_KnownName(t *testing.T) {
 	})
 
 	t.Run("should create the database", func(t *testing.T) {
-		// Mocking of SQL queries
-		setAdminConnectionFunc(mockCreateDatabaseAndUser)
+		// Mocking of SQL queries. The user was provisioned by the previous attempt, so it isn't provisioned again.
+		setAdminConnectionFunc(mockCreateDatabase)
 		defer restoreAdminConnectionFunc()
 
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
 		require.False(t, res.Requeue)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonDatabaseProvisioned)
+
+		database := &fnv1alpha1.Database{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, database)
+		require.NoError(t, err)
+		require.True(t, fnv1alpha1.IsConditionTrue(database.Status.Conditions, fnv1alpha1.DatabaseReadyCondition))
+		require.Equal(t, testUser, database.Status.ProvisionedUser)
+	})
+}
+
+func TestDatabaseController_ExistingSchema(t *testing.T) {
+	// Set the logger to development mode for verbose logs.
+	logf.SetLogger(logf.ZapLogger(true))
+
+	fakeObjects := []runtime.Object{provisionedDatabase(), userSecret, adminSecretWithFinalizer}
+	r := buildFakeReconcile(fakeObjects)
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      testName,
+			Namespace: testNameSpace,
+		},
+	}
+
+	t.Run("should not take over an existing schema", func(t *testing.T) {
+		setAdminConnectionFunc(mockSchemaExists)
+		defer restoreAdminConnectionFunc()
+
+		_, err := r.Reconcile(req)
+		require.EqualError(t, err, `database "wlgoredatabase" already exists; set spec.adopt to take it over`)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonDatabaseProvisionFailed)
+
+		database := &fnv1alpha1.Database{}
+		err = r.client.Get(context.TODO(), req.NamespacedName, database)
+		require.NoError(t, err)
+		require.False(t, database.Status.Provisioned)
+		require.False(t, fnv1alpha1.IsConditionTrue(database.Status.Conditions, fnv1alpha1.DatabaseReadyCondition))
+	})
+
+	t.Run("should claim and create a new schema", func(t *testing.T) {
+		setAdminConnectionFunc(mockCreateNewSchema)
+		defer restoreAdminConnectionFunc()
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+
+		database := &fnv1alpha1.Database{}
+		err = r.client.Get(context.TODO(), req.NamespacedName, database)
+		require.NoError(t, err)
+		require.True(t, database.Status.Provisioned)
+		require.True(t, fnv1alpha1.IsConditionTrue(database.Status.Conditions, fnv1alpha1.DatabaseReadyCondition))
+	})
+
+	t.Run("should keep managing its own schema", func(t *testing.T) {
+		// The schema isn't looked up again once the Database provisioned it, nor is its user provisioned again
+		setAdminConnectionFunc(mockCreateDatabase)
+		defer restoreAdminConnectionFunc()
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
 	})
 }
 
+func TestDatabaseController_Adopt(t *testing.T) {
+	// Set the logger to development mode for verbose logs.
+	logf.SetLogger(logf.ZapLogger(true))
+
+	database := provisionedDatabase()
+	database.Spec.Adopt = true
+	r := buildFakeReconcile([]runtime.Object{database, userSecret, adminSecretWithFinalizer})
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      testName,
+			Namespace: testNameSpace,
+		},
+	}
+
+	setAdminConnectionFunc(mockCreateDatabaseAndUser)
+	defer restoreAdminConnectionFunc()
+
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+
+	err = r.client.Get(context.TODO(), req.NamespacedName, database)
+	require.NoError(t, err)
+	require.True(t, database.Status.Provisioned)
+	require.True(t, fnv1alpha1.IsConditionTrue(database.Status.Conditions, fnv1alpha1.DatabaseReadyCondition))
+}
+
 // func TestDatabaseController_KnownNameWithoutAdminSecret(t *testing.T) {
 // 	// Set the logger to development mode for verbose logs.
 // 	logf.SetLogger(logf.ZapLogger(true))
@@ -300,6 +399,7 @@ func TestDatabaseController_Deletion(t *testing.T) {
 		res, err := r.Reconcile(req)
 		require.EqualError(t, err, "Error 1: Something went wrong")
 		require.False(t, res.Requeue)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonFinalizerBlocked)
 	})
 
 	t.Run("should throw error during deletion of user", func(t *testing.T) {
@@ -405,3 +505,298 @@ func TestDatabaseController_DeletionNoAdminSecret(t *testing.T) {
 		require.False(t, res.Requeue)
 	})
 }
+
+func TestDatabaseController_ReclaimRetain(t *testing.T) {
+	// Set the logger to development mode for verbose logs.
+	logf.SetLogger(logf.ZapLogger(true))
+
+	fakeObjects := []runtime.Object{deletedDatabase(fnv1alpha1.DatabaseReclaimRetain), userSecret, adminSecretWithFinalizer}
+	r := buildFakeReconcile(fakeObjects)
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      testName,
+			Namespace: testNameSpace,
+		},
+	}
+
+	// The database server must not be touched
+	setAdminConnectionFunc(func(*fnv1alpha1.Database, client.Client) (*sql.DB, error) {
+		require.FailNow(t, "the retained database was connected to")
+		return nil, nil
+	})
+	defer restoreAdminConnectionFunc()
+
+	res, err := r.Reconcile(req)
+	require.NoError(t, err)
+	require.True(t, res.Requeue)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonDatabaseRetained)
+
+	res, err = r.Reconcile(req)
+	require.NoError(t, err)
+	require.True(t, res.Requeue)
+
+	database := &fnv1alpha1.Database{}
+	err = r.client.Get(context.TODO(), req.NamespacedName, database)
+	require.NoError(t, err)
+	require.False(t, common.HasFinalizer(database, dbPwdSecretFinalizer))
+}
+
+func TestDatabaseController_ReclaimSnapshot(t *testing.T) {
+	// Set the logger to development mode for verbose logs.
+	logf.SetLogger(logf.ZapLogger(true))
+
+	fakeObjects := []runtime.Object{deletedDatabase(fnv1alpha1.DatabaseReclaimSnapshot), userSecret, adminSecretWithFinalizer}
+	r := buildFakeReconcile(fakeObjects)
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      testName,
+			Namespace: testNameSpace,
+		},
+	}
+	jobName := types.NamespacedName{Name: testName + "-snapshot", Namespace: testNameSpace}
+
+	t.Run("should start the snapshot Job", func(t *testing.T) {
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.False(t, res.Requeue)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonDatabaseSnapshotStarted)
+
+		job := &batchv1.Job{}
+		require.NoError(t, r.client.Get(context.TODO(), jobName, job))
+		require.Equal(t, "Database", job.OwnerReferences[0].Kind)
+		pod := job.Spec.Template.Spec
+		require.Equal(t, "wlgore-snapshots", pod.Volumes[0].PersistentVolumeClaim.ClaimName)
+		require.Contains(t, pod.Containers[0].Env, corev1.EnvVar{Name: "DUMP_FILE", Value: "/dumps/databases/wlgoredatabase-20200301-120000.sql.gz"})
+		require.Contains(t, pod.Containers[0].Env, corev1.EnvVar{Name: "MYSQL_DATABASE", Value: testName})
+	})
+
+	t.Run("should wait for the snapshot", func(t *testing.T) {
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.False(t, res.Requeue)
+
+		database := &fnv1alpha1.Database{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, database))
+		require.True(t, common.HasFinalizer(database, dbPwdSecretFinalizer))
+	})
+
+	setJobCondition := func(t *testing.T, condition batchv1.JobConditionType) {
+		job := &batchv1.Job{}
+		require.NoError(t, r.client.Get(context.TODO(), jobName, job))
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+		require.NoError(t, r.client.Status().Update(context.TODO(), job))
+	}
+
+	t.Run("should not drop the database if the snapshot failed", func(t *testing.T) {
+		setJobCondition(t, batchv1.JobFailed)
+
+		_, err := r.Reconcile(req)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `snapshot Job "wlgoredatabase-snapshot" failed`)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonFinalizerBlocked)
+	})
+
+	t.Run("should drop the database after the snapshot", func(t *testing.T) {
+		setJobCondition(t, batchv1.JobComplete)
+		setAdminConnectionFunc(mockRemoveGetAdminDatabaseConnection)
+		defer restoreAdminConnectionFunc()
+
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.True(t, res.Requeue)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonDatabaseDropped)
+	})
+}
+
+func TestDatabaseController_RotateCredentials(t *testing.T) {
+	// Set the logger to development mode for verbose logs.
+	logf.SetLogger(logf.ZapLogger(true))
+
+	database := provisionedDatabase()
+	database.Spec.AdminSecret = "wlgore-admin-secret"
+	database.Annotations = map[string]string{fnv1alpha1.RotateCredentialsAnnotation: "1"}
+	database.Status.Provisioned = true
+	database.Status.ProvisionedUser = testUser
+	admin := adminSecretWithFinalizer.DeepCopy()
+	admin.Name = database.Spec.AdminSecret
+	r := buildFakeReconcile([]runtime.Object{database, userSecret, admin})
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      testName,
+			Namespace: testNameSpace,
+		},
+	}
+	defer func() { now = time.Now }()
+
+	reconcileAt := func(t *testing.T, at time.Time, mock func(*fnv1alpha1.Database, client.Client) (*sql.DB, error)) reconcile.Result {
+		now = func() time.Time { return at }
+		setAdminConnectionFunc(mock)
+		defer restoreAdminConnectionFunc()
+
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		return res
+	}
+	getCredentials := func(t *testing.T) (*corev1.Secret, *fnv1alpha1.DatabaseCredentials) {
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: testUserSecret, Namespace: testNameSpace}, secret)
+		require.NoError(t, err)
+		database := &fnv1alpha1.Database{}
+		err = r.client.Get(context.TODO(), req.NamespacedName, database)
+		require.NoError(t, err)
+		return secret, database.Status.Credentials
+	}
+
+	t.Run("should rotate credentials to the alternate user when requested", func(t *testing.T) {
+		res := reconcileAt(t, time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), mockRotateCredentials("", "wlgore_b"))
+		require.Equal(t, time.Hour, res.RequeueAfter)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonCredentialsRotated)
+
+		secret, credentials := getCredentials(t)
+		require.Equal(t, "wlgore_b", string(secret.Data["username"]))
+		require.NotEqual(t, "dummypassword", string(secret.Data["password"]))
+		require.Equal(t, "wlgore_b", credentials.User)
+		require.Equal(t, "wlgore", credentials.PreviousUser)
+		require.Equal(t, "1", credentials.RotationRequest)
+
+		database := &fnv1alpha1.Database{}
+		err := r.client.Get(context.TODO(), req.NamespacedName, database)
+		require.NoError(t, err)
+		require.Equal(t, "wlgore_b", database.Status.ProvisionedUser)
+	})
+
+	t.Run("should keep the previous user during the grace period", func(t *testing.T) {
+		// The alternate user is the one provisioned now
+		res := reconcileAt(t, time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC), mockRotateCredentials("", ""))
+		require.Equal(t, 30*time.Minute, res.RequeueAfter)
+
+		database := &fnv1alpha1.Database{}
+		err := r.client.Get(context.TODO(), req.NamespacedName, database)
+		require.NoError(t, err)
+		database.Annotations[fnv1alpha1.RotateCredentialsAnnotation] = "2"
+		err = r.client.Update(context.TODO(), database)
+		require.NoError(t, err)
+
+		res = reconcileAt(t, time.Date(2020, 3, 1, 12, 40, 0, 0, time.UTC), mockRotateCredentials("", ""))
+		require.Equal(t, 20*time.Minute, res.RequeueAfter, "rotations wait for the previous user to be dropped")
+	})
+
+	t.Run("should drop the previous user before rotating again", func(t *testing.T) {
+		res := reconcileAt(t, time.Date(2020, 3, 1, 13, 0, 0, 0, time.UTC), mockRotateCredentials("wlgore", "wlgore"))
+		require.Equal(t, time.Hour, res.RequeueAfter)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonPreviousUserDropped)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonCredentialsRotated)
+
+		secret, credentials := getCredentials(t)
+		require.Equal(t, "wlgore", string(secret.Data["username"]))
+		require.Equal(t, "wlgore_b", credentials.PreviousUser)
+		require.Equal(t, "2", credentials.RotationRequest)
+	})
+
+	t.Run("should rotate credentials on their interval", func(t *testing.T) {
+		database := &fnv1alpha1.Database{}
+		err := r.client.Get(context.TODO(), req.NamespacedName, database)
+		require.NoError(t, err)
+		database.Spec.RotationInterval = &metav1.Duration{Duration: 30 * 24 * time.Hour}
+		err = r.client.Update(context.TODO(), database)
+		require.NoError(t, err)
+
+		res := reconcileAt(t, time.Date(2020, 3, 2, 13, 0, 0, 0, time.UTC), mockRotateCredentials("wlgore_b", ""))
+		require.Equal(t, 29*24*time.Hour, res.RequeueAfter)
+
+		res = reconcileAt(t, time.Date(2020, 3, 31, 13, 0, 0, 0, time.UTC), mockRotateCredentials("", "wlgore_b"))
+		require.Equal(t, time.Hour, res.RequeueAfter)
+		_, credentials := getCredentials(t)
+		require.Equal(t, "wlgore_b", credentials.User)
+	})
+}
+
+func TestDatabaseController_DropPreviousUserAfterRollout(t *testing.T) {
+	// Set the logger to development mode for verbose logs.
+	logf.SetLogger(logf.ZapLogger(true))
+
+	rotatedAt := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	database := provisionedDatabase()
+	database.Spec.AdminSecret = "wlgore-admin-secret"
+	database.Status.Provisioned = true
+	database.Status.ProvisionedUser = "wlgore_b"
+	database.Status.Credentials = &fnv1alpha1.DatabaseCredentials{User: "wlgore_b", PreviousUser: "wlgore", LastRotationTime: metav1.NewTime(rotatedAt)}
+	admin := adminSecretWithFinalizer.DeepCopy()
+	admin.Name = database.Spec.AdminSecret
+	user := userSecret.DeepCopy()
+	user.Data["username"] = []byte("wlgore_b")
+
+	envLabels := map[string]string{fnv1alpha1.ApplicationIdLabel: "wlgore-app-id", fnv1alpha1.EnvironmentIdLabel: "wlgore-prod-id"}
+	env := &fnv1alpha1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-prod", Namespace: testNameSpace, Labels: envLabels},
+		Status:     fnv1alpha1.DrupalEnvironmentStatus{Status: fnv1alpha1.DrupalEnvironmentStatusDeploying},
+	}
+	site := &fnv1alpha1.Site{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore", Namespace: testNameSpace},
+		Spec:       fnv1alpha1.SiteSpec{Environment: env.Name, Database: testName},
+	}
+	settings := func(user string) []byte {
+		return []byte("$databases['default']['default'] = [\n  'database' => 'wlgoredatabase',\n  'username' => '" + user + "',\n];\n")
+	}
+	envConfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: envconfig.SecretName(env.Name), Namespace: testNameSpace},
+		Data:       map[string][]byte{envconfig.SettingsFileName(site): settings("wlgore")},
+	}
+	drupalPod := func(name string, createdAt time.Time) *corev1.Pod {
+		labels := map[string]string{"app": "drupal"}
+		for k, v := range envLabels {
+			labels[k] = v
+		}
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         testNameSpace,
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(createdAt),
+		}}
+	}
+	oldPod := drupalPod("wlgore-prod-drupal-old", rotatedAt.Add(-time.Hour))
+
+	r := buildFakeReconcile([]runtime.Object{database, user, admin, env, site, envConfig, oldPod})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testName, Namespace: testNameSpace}}
+	now = func() time.Time { return rotatedAt.Add(fnv1alpha1.CredentialsGracePeriod + 10*time.Minute) }
+	defer func() { now = time.Now }()
+
+	reconcileWaiting := func(t *testing.T) {
+		setAdminConnectionFunc(mockRotateCredentials("", ""))
+		defer restoreAdminConnectionFunc()
+
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.Equal(t, rolloutCheckInterval, res.RequeueAfter)
+		database := &fnv1alpha1.Database{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, database))
+		require.Equal(t, "wlgore", database.Status.Credentials.PreviousUser)
+	}
+
+	t.Run("should wait for the settings to use the new user", reconcileWaiting)
+
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: envConfig.Name, Namespace: testNameSpace}, envConfig))
+	envConfig.Data[envconfig.SettingsFileName(site)] = settings("wlgore_b")
+	require.NoError(t, r.client.Update(context.TODO(), envConfig))
+	t.Run("should wait for the environment to roll out", reconcileWaiting)
+
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: env.Name, Namespace: testNameSpace}, env))
+	env.Status.Status = fnv1alpha1.DrupalEnvironmentStatusSynced
+	require.NoError(t, r.client.Status().Update(context.TODO(), env))
+	t.Run("should wait for the Pods created before the rotation to be replaced", reconcileWaiting)
+
+	t.Run("should drop the previous user once the new credentials were rolled out", func(t *testing.T) {
+		require.NoError(t, r.client.Delete(context.TODO(), oldPod))
+		require.NoError(t, r.client.Create(context.TODO(), drupalPod("wlgore-prod-drupal-new", rotatedAt.Add(5*time.Minute))))
+		setAdminConnectionFunc(mockRotateCredentials("wlgore", ""))
+		defer restoreAdminConnectionFunc()
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonPreviousUserDropped)
+
+		database := &fnv1alpha1.Database{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, database))
+		require.Empty(t, database.Status.Credentials.PreviousUser)
+	})
+}
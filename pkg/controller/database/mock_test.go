@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-sql-driver/mysql"
@@ -109,6 +110,30 @@ var (
 	}
 )
 
+// provisionedDatabase returns a Database of the latest spec version that was labeled and finalized, like the ones the
+// Database webhooks and controller create
+func provisionedDatabase() *fnv1alpha1.Database {
+	d := testDatabase.DeepCopy()
+	d.Labels = map[string]string{
+		fnv1alpha1.VersionLabel:    d.SpecVersion(),
+		fnv1alpha1.DatabaseIdLabel: "7e3ee8f5-2d4b-4cc6-9ef0-2e1a1e3a7d2c",
+	}
+	d.Finalizers = []string{dbPwdSecretFinalizer}
+	return d
+}
+
+// deletedDatabase returns a provisioned Database with the given reclaim policy that is being deleted
+func deletedDatabase(policy fnv1alpha1.DatabaseReclaimPolicy) *fnv1alpha1.Database {
+	d := provisionedDatabase()
+	d.Spec.ReclaimPolicy = policy
+	if policy == fnv1alpha1.DatabaseReclaimSnapshot {
+		d.Spec.SnapshotTarget = &fnv1alpha1.DatabaseDumpTarget{PersistentVolumeClaim: "wlgore-snapshots", Path: "databases"}
+	}
+	d.Status.Provisioned = true
+	d.DeletionTimestamp = &metav1.Time{Time: time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)}
+	return d
+}
+
 func setAdminConnectionFunc(mockFunc func(*fnv1alpha1.Database, client.Client) (*sql.DB, error)) {
 	originalAdminConnectionFunc = getAdminDatabaseConnection
 	getAdminDatabaseConnection = mockFunc
@@ -124,8 +149,9 @@ func buildFakeReconcile(objects []runtime.Object) *ReconcileDatabase {
 
 	// create a ReconcileDatabase object with the scheme and fake client
 	return &ReconcileDatabase{
-		client: client,
-		scheme: scheme.Scheme,
+		client:   client,
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
 	}
 }
 
@@ -151,9 +177,13 @@ func mockCreateDatabseSQLError(database *fnv1alpha1.Database, client client.Clie
 	return db, err
 }
 
-func setCreateDBWithUserMock(mock sqlmock.Sqlmock) {
+func setCreateDBMock(mock sqlmock.Sqlmock) {
 	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS *").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func setCreateDBWithUserMock(mock sqlmock.Sqlmock) {
+	setCreateDBMock(mock)
 
 	// Mysql error code 1396 if user already exists
 	error := mysql.MySQLError{Number: 1396, Message: "User already exists"}
@@ -170,6 +200,31 @@ func setCreateDBWithUserMock(mock sqlmock.Sqlmock) {
 		WillReturnResult(sqlmock.NewResult(1, 1))
 }
 
+func mockSchemaExists(database *fnv1alpha1.Database, client client.Client) (*sql.DB, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+	mock.ExpectQuery("SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA").
+		WithArgs(testName).
+		WillReturnRows(sqlmock.NewRows([]string{"SCHEMA_NAME"}).AddRow(testName))
+	mock.ExpectClose()
+	return db, err
+}
+
+func mockCreateNewSchema(database *fnv1alpha1.Database, client client.Client) (*sql.DB, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+	mock.ExpectQuery("SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA").
+		WithArgs(testName).
+		WillReturnRows(sqlmock.NewRows([]string{"SCHEMA_NAME"}))
+	setCreateDBWithUserMock(mock)
+	mock.ExpectClose()
+	return db, err
+}
+
 func mockCreateDatabaseAndUserWithoutClose(database *fnv1alpha1.Database, client client.Client) (*sql.DB, error) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -179,6 +234,17 @@ func mockCreateDatabaseAndUserWithoutClose(database *fnv1alpha1.Database, client
 	return db, err
 }
 
+// mockCreateDatabase creates the schema of a Database whose user was provisioned already
+func mockCreateDatabase(database *fnv1alpha1.Database, client client.Client) (*sql.DB, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+	setCreateDBMock(mock)
+	mock.ExpectClose()
+	return db, err
+}
+
 func mockCreateDatabaseAndUser(database *fnv1alpha1.Database, client client.Client) (*sql.DB, error) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -237,3 +303,31 @@ func mockRemoveGetAdminDatabaseConnection(database *fnv1alpha1.Database, client
 	mock.ExpectClose()
 	return db, err
 }
+
+// mockRotateCredentials creates the schema of a Database whose user was provisioned already, and then drops the previous
+// user, if any, and rotates the credentials to the given user
+func mockRotateCredentials(previous, user string) func(*fnv1alpha1.Database, client.Client) (*sql.DB, error) {
+	return func(database *fnv1alpha1.Database, client client.Client) (*sql.DB, error) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			return nil, err
+		}
+		setCreateDBMock(mock)
+		if previous != "" {
+			mock.ExpectExec("DROP USER '" + previous + "'@").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		if user != "" {
+			mock.ExpectExec("CREATE USER '" + user + "'@").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SET PASSWORD FOR '" + user + "'@").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("GRANT ALL PRIVILEGES ON `wlgoredatabase`.* TO '" + user + "'").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("FLUSH PRIVILEGES").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectClose()
+		return db, err
+	}
+}
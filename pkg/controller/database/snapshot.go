@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	fn "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/dbdump"
+)
+
+// snapshotJobName returns the name of the Job that dumps the schema of a deleted Database
+func snapshotJobName(db *fn.Database) string {
+	return db.Name + "-snapshot"
+}
+
+// snapshotFile returns the name of a deleted Database's snapshot within the path of its snapshot target. It's named
+// after the schema and the time the Database was deleted.
+func snapshotFile(db *fn.Database) string {
+	return fmt.Sprintf("%s-%s.sql.gz", db.DatabaseName(), db.GetDeletionTimestamp().UTC().Format("20060102-150405"))
+}
+
+// snapshotDatabase dumps the schema of a deleted Database to its snapshot target with a Job. It returns done once the
+// Job completed, or if the admin Secret is gone, in which case the schema can be neither dumped nor dropped.
+func (rh *requestHandler) snapshotDatabase() (done bool, err error) {
+	db := rh.database
+	c := rh.reconciler.client
+	if db.Spec.SnapshotTarget == nil {
+		return false, fmt.Errorf("spec.snapshotTarget is required with the %s reclaimPolicy", fn.DatabaseReclaimSnapshot)
+	}
+	if _, err := db.GetAdminSecret(c); err != nil && errors.IsNotFound(err) {
+		rh.logger.Info("Database admin Secret not found, skipping snapshot", "Secret Name", db.Spec.AdminSecret)
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	job := &batchv1.Job{}
+	err = c.Get(context.TODO(), types.NamespacedName{Namespace: db.Namespace, Name: snapshotJobName(db)}, job)
+	if err != nil && errors.IsNotFound(err) {
+		job = rh.snapshotJob()
+		rh.reconciler.associateResourceWithController(job, db)
+		if err := c.Create(context.TODO(), job); err != nil {
+			return false, err
+		}
+		rh.logger.Info("Dumping database before dropping it", "Database", db.DatabaseName(), "Job", job.Name)
+		rh.reconciler.recorder.Eventf(db, corev1.EventTypeNormal, common.ReasonDatabaseSnapshotStarted, "Dumping database %q to %s",
+			db.DatabaseName(), db.Spec.SnapshotTarget.Location(snapshotFile(db)))
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch phase, message, _ := dbdump.JobPhase(job); phase {
+	case fn.DatabaseJobSucceeded:
+		return true, nil
+	case fn.DatabaseJobFailed:
+		return false, fmt.Errorf("snapshot Job %q failed: %s; set spec.reclaimPolicy to %q to drop the database without a snapshot, "+
+			"or delete the Job to retry", job.Name, message, fn.DatabaseReclaimDelete)
+	}
+	return false, nil
+}
+
+// snapshotJob returns the Job that dumps the schema of a deleted Database to its snapshot target, using the admin
+// credentials
+func (rh *requestHandler) snapshotJob() *batchv1.Job {
+	db := rh.database
+	return dbdump.DumpJob(dbdump.Options{
+		Name:        snapshotJobName(db),
+		Namespace:   db.Namespace,
+		Labels:      db.ChildLabels(),
+		Database:    db,
+		Credentials: dbdump.AdminCredentials(db),
+		Target:      *db.Spec.SnapshotTarget,
+		File:        snapshotFile(db),
+	})
+}
@@ -0,0 +1,260 @@
+package databasebackup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	fnresources "github.com/acquia/fn-drupal-operator/pkg/apis"
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/dbdump"
+)
+
+// controllerName is the name of this controller, used for its Events
+const controllerName = "databasebackup-controller"
+
+// missingDatabaseRequeueAfter is how often a backup of a missing Database is retried
+const missingDatabaseRequeueAfter = 30 * time.Second
+
+var log = logf.Log.WithName("controller_databasebackup")
+
+// Add creates a new DatabaseBackup Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+// Also registers webhooks for this type.
+func Add(mgr manager.Manager) error {
+	err := builder.
+		WebhookManagedBy(mgr).
+		For(&fnv1alpha1.DatabaseBackup{}).
+		Complete()
+	if err != nil {
+		log.Error(err, "could not create databasebackup webhook")
+		return err
+	}
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	scheme := mgr.GetScheme()
+	if err := fnresources.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return NewReconciler(mgr.GetClient(), scheme, mgr.GetEventRecorderFor(controllerName))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileDatabaseBackup{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource DatabaseBackup
+	err = c.Watch(&source.Kind{Type: &fnv1alpha1.DatabaseBackup{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the backup Jobs and requeue the owner DatabaseBackup
+	return common.WatchOwned(c, &fnv1alpha1.DatabaseBackup{}, []runtime.Object{&batchv1.Job{}})
+}
+
+// blank assignment to verify that ReconcileDatabaseBackup implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileDatabaseBackup{}
+
+// ReconcileDatabaseBackup reconciles a DatabaseBackup object
+type ReconcileDatabaseBackup struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+type requestHandler struct {
+	r      *ReconcileDatabaseBackup
+	logger logr.Logger
+	backup *fnv1alpha1.DatabaseBackup
+}
+
+// Reconcile runs the Job that dumps the Database of a DatabaseBackup, once, and records its result in the status of the
+// DatabaseBackup
+func (r *ReconcileDatabaseBackup) Reconcile(request reconcile.Request) (result reconcile.Result, err error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	logger.V(1).Info("Reconciling DatabaseBackup")
+
+	backup := &fnv1alpha1.DatabaseBackup{}
+	err = r.client.Get(context.TODO(), request.NamespacedName, backup)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, likely deleted after reconcile request, so ignore.
+			return result, nil
+		}
+		return
+	}
+	if backup.Status.Phase.Finished() || !backup.DeletionTimestamp.IsZero() {
+		return
+	}
+
+	rh := requestHandler{r: r, logger: logger, backup: backup}
+	result, err = rh.reconcileJob()
+
+	if errStatus := r.client.Status().Update(context.TODO(), rh.backup); errStatus != nil {
+		logger.Error(errStatus, "Failed to update Status")
+		if err == nil {
+			err = errStatus
+		}
+	}
+	return
+}
+
+// reconcileJob starts the backup Job, or records its result once it finished
+func (rh *requestHandler) reconcileJob() (result reconcile.Result, err error) {
+	backup := rh.backup
+	job := &batchv1.Job{}
+	err = rh.r.client.Get(context.TODO(), types.NamespacedName{Name: jobName(backup), Namespace: backup.Namespace}, job)
+	if err != nil && errors.IsNotFound(err) {
+		if backup.Status.Phase == fnv1alpha1.DatabaseJobRunning {
+			rh.fail(metav1.Now(), fmt.Sprintf("Job %q was deleted", jobName(backup)))
+			return result, nil
+		}
+		return rh.startJob()
+	} else if err != nil {
+		return
+	}
+
+	phase, message, finishedAt := dbdump.JobPhase(job)
+	switch phase {
+	case fnv1alpha1.DatabaseJobSucceeded:
+		err = rh.succeed(job, finishedAt)
+	case fnv1alpha1.DatabaseJobFailed:
+		rh.fail(finishedAt, message)
+	}
+	return
+}
+
+// startJob creates the Job that dumps the Database to the backup's target
+func (rh *requestHandler) startJob() (result reconcile.Result, err error) {
+	backup := rh.backup
+	db := &fnv1alpha1.Database{}
+	err = rh.r.client.Get(context.TODO(), types.NamespacedName{Name: backup.Spec.Database, Namespace: backup.Namespace}, db)
+	if err != nil && errors.IsNotFound(err) {
+		backup.Status.Phase = fnv1alpha1.DatabaseJobPending
+		backup.Status.Message = fmt.Sprintf("Database %q not found", backup.Spec.Database)
+		rh.r.recorder.Event(backup, corev1.EventTypeWarning, common.ReasonDatabaseMissing, backup.Status.Message)
+		result.RequeueAfter = missingDatabaseRequeueAfter
+		return result, nil
+	} else if err != nil {
+		return
+	}
+
+	options := dbdump.Options{
+		Name:        jobName(backup),
+		Namespace:   backup.Namespace,
+		Labels:      db.ChildLabels(),
+		Database:    db,
+		Credentials: dbdump.UserCredentials(db),
+		Target:      backup.Spec.Target,
+		File:        backup.Name + ".sql.gz",
+	}
+	job := dbdump.DumpJob(options)
+	// Set DatabaseBackup instance as the owner and controller (will never error since Job is new)
+	_ = controllerutil.SetControllerReference(backup, job, rh.r.scheme)
+	if err = rh.r.client.Create(context.TODO(), job); err != nil && !errors.IsAlreadyExists(err) {
+		return
+	}
+
+	now := metav1.Now()
+	backup.Status.Phase = fnv1alpha1.DatabaseJobRunning
+	backup.Status.Message = ""
+	backup.Status.File = options.Key()
+	backup.Status.Location = backup.Spec.Target.Location(options.File)
+	backup.Status.StartTime = &now
+	rh.logger.Info("Created backup Job", "Name", job.Name, "Location", backup.Status.Location)
+	rh.r.recorder.Eventf(backup, corev1.EventTypeNormal, common.ReasonBackupStarted, "Dumping database %q to %s", db.DatabaseName(), backup.Status.Location)
+	return result, nil
+}
+
+// succeed records the size and checksum that the dump container of the Job's Pod reported
+func (rh *requestHandler) succeed(job *batchv1.Job, finishedAt metav1.Time) error {
+	backup := rh.backup
+	pods := &corev1.PodList{}
+	err := rh.r.client.List(context.TODO(), pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name})
+	if err != nil {
+		return err
+	}
+
+	var dump *dbdump.Result
+	for i := range pods.Items {
+		if dump, err = dbdump.ParseResult(&pods.Items[i]); err != nil {
+			return err
+		} else if dump != nil {
+			break
+		}
+	}
+	if dump == nil {
+		rh.fail(finishedAt, fmt.Sprintf("Job %q completed, but none of its Pods reported the dump", job.Name))
+		return nil
+	}
+
+	backup.Status.Phase = fnv1alpha1.DatabaseJobSucceeded
+	backup.Status.SizeBytes = dump.SizeBytes
+	backup.Status.Checksum = dump.Checksum
+	rh.complete(finishedAt)
+	rh.logger.Info("Backup succeeded", "Location", backup.Status.Location, "Size", dump.SizeBytes)
+	rh.r.recorder.Eventf(backup, corev1.EventTypeNormal, common.ReasonBackupSucceeded, "Dumped %d bytes to %s in %v",
+		dump.SizeBytes, backup.Status.Location, backup.Status.Duration.Duration)
+	return nil
+}
+
+func (rh *requestHandler) fail(finishedAt metav1.Time, message string) {
+	rh.backup.Status.Phase = fnv1alpha1.DatabaseJobFailed
+	rh.backup.Status.Message = message
+	rh.complete(finishedAt)
+	rh.logger.Info("Backup failed", "Message", message)
+	rh.r.recorder.Eventf(rh.backup, corev1.EventTypeWarning, common.ReasonBackupFailed, "Backup failed: %s", message)
+}
+
+// complete records when the backup finished, and how long it took
+func (rh *requestHandler) complete(finishedAt metav1.Time) {
+	status := &rh.backup.Status
+	if finishedAt.IsZero() {
+		finishedAt = metav1.Now()
+	}
+	status.CompletionTime = &finishedAt
+	status.Duration = &metav1.Duration{}
+	if status.StartTime != nil {
+		status.Duration.Duration = finishedAt.Sub(status.StartTime.Time)
+	}
+}
+
+// jobName returns the name of the Job that dumps the Database of a DatabaseBackup
+func jobName(backup *fnv1alpha1.DatabaseBackup) string {
+	return "databasebackup-" + backup.Name
+}
@@ -0,0 +1,183 @@
+package databasebackup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/dbdump"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+const (
+	testNamespace = "wlgore"
+	testBackup    = "wlgore-backup"
+)
+
+var (
+	testDatabase = &fnv1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgoredatabase", Namespace: testNamespace},
+		Spec: fnv1alpha1.DatabaseSpec{
+			Host:       "mysql.default.svc.cluster.local",
+			Port:       3306,
+			SchemaName: "wlgoredatabase",
+			User:       "wlgore",
+			UserSecret: "wlgore-user-secret",
+		},
+	}
+
+	testStartTime = metav1.NewTime(time.Now().Add(-time.Minute))
+	testEndTime   = metav1.NewTime(testStartTime.Add(42 * time.Second))
+)
+
+func newBackup() *fnv1alpha1.DatabaseBackup {
+	return &fnv1alpha1.DatabaseBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: testBackup, Namespace: testNamespace},
+		Spec: fnv1alpha1.DatabaseBackupSpec{
+			Database: testDatabase.Name,
+			Target: fnv1alpha1.DatabaseDumpTarget{
+				S3:   &fnv1alpha1.S3Target{Bucket: "wlgore-backups", Endpoint: "http://minio:9000", CredentialsSecret: "minio"},
+				Path: "databases",
+			},
+		},
+	}
+}
+
+func buildFakeReconcile(objects []runtime.Object) *ReconcileDatabaseBackup {
+	return &ReconcileDatabaseBackup{
+		client:   testhelpers.NewFakeClient(objects),
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
+	}
+}
+
+func TestDatabaseBackupController(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	r := buildFakeReconcile([]runtime.Object{testDatabase, newBackup()})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testBackup, Namespace: testNamespace}}
+	jobKey := types.NamespacedName{Name: "databasebackup-" + testBackup, Namespace: testNamespace}
+
+	getBackup := func(t *testing.T) *fnv1alpha1.DatabaseBackup {
+		backup := &fnv1alpha1.DatabaseBackup{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, backup))
+		return backup
+	}
+
+	t.Run("should start the backup Job", func(t *testing.T) {
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonBackupStarted)
+
+		job := &batchv1.Job{}
+		require.NoError(t, r.client.Get(context.TODO(), jobKey, job))
+		require.Equal(t, "DatabaseBackup", job.OwnerReferences[0].Kind)
+		require.Equal(t, dbdump.DumpContainerName, job.Spec.Template.Spec.InitContainers[0].Name)
+
+		backup := getBackup(t)
+		require.Equal(t, fnv1alpha1.DatabaseJobRunning, backup.Status.Phase)
+		require.Equal(t, "databases/wlgore-backup.sql.gz", backup.Status.File)
+		require.Equal(t, "s3://wlgore-backups/databases/wlgore-backup.sql.gz", backup.Status.Location)
+		require.NotNil(t, backup.Status.StartTime)
+	})
+
+	t.Run("should wait for the Job", func(t *testing.T) {
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.Equal(t, fnv1alpha1.DatabaseJobRunning, getBackup(t).Status.Phase)
+	})
+
+	t.Run("should record the result of the dump", func(t *testing.T) {
+		backup := getBackup(t)
+		backup.Status.StartTime = &testStartTime
+		require.NoError(t, r.client.Status().Update(context.TODO(), backup))
+
+		job := &batchv1.Job{}
+		require.NoError(t, r.client.Get(context.TODO(), jobKey, job))
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: testEndTime}}
+		require.NoError(t, r.client.Status().Update(context.TODO(), job))
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: jobKey.Name + "-x7k2p", Namespace: testNamespace, Labels: map[string]string{"job-name": jobKey.Name}},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name: dbdump.DumpContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Message: `{"sizeBytes":1048576,"checksum":"sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}`,
+					}},
+				}},
+			},
+		}
+		require.NoError(t, r.client.Create(context.TODO(), pod))
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonBackupSucceeded)
+
+		backup = getBackup(t)
+		require.Equal(t, fnv1alpha1.DatabaseJobSucceeded, backup.Status.Phase)
+		require.Equal(t, int64(1048576), backup.Status.SizeBytes)
+		require.Equal(t, "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", backup.Status.Checksum)
+		require.Equal(t, 42*time.Second, backup.Status.Duration.Duration)
+	})
+
+	t.Run("should not run again", func(t *testing.T) {
+		require.NoError(t, r.client.Delete(context.TODO(), &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobKey.Name, Namespace: testNamespace}}))
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.Equal(t, fnv1alpha1.DatabaseJobSucceeded, getBackup(t).Status.Phase)
+	})
+}
+
+func TestDatabaseBackupController_Failed(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	r := buildFakeReconcile([]runtime.Object{testDatabase, newBackup()})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testBackup, Namespace: testNamespace}}
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+
+	job := &batchv1.Job{}
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "databasebackup-" + testBackup, Namespace: testNamespace}, job))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	require.NoError(t, r.client.Status().Update(context.TODO(), job))
+
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonBackupFailed)
+
+	backup := &fnv1alpha1.DatabaseBackup{}
+	require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, backup))
+	require.Equal(t, fnv1alpha1.DatabaseJobFailed, backup.Status.Phase)
+	require.Equal(t, "Job has reached the specified backoff limit", backup.Status.Message)
+	require.NotNil(t, backup.Status.CompletionTime)
+}
+
+func TestDatabaseBackupController_MissingDatabase(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	r := buildFakeReconcile([]runtime.Object{newBackup()})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testBackup, Namespace: testNamespace}}
+	res, err := r.Reconcile(req)
+	require.NoError(t, err)
+	require.Equal(t, missingDatabaseRequeueAfter, res.RequeueAfter)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonDatabaseMissing)
+
+	backup := &fnv1alpha1.DatabaseBackup{}
+	require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, backup))
+	require.Equal(t, fnv1alpha1.DatabaseJobPending, backup.Status.Phase)
+	require.Contains(t, backup.Status.Message, `Database "wlgoredatabase" not found`)
+}
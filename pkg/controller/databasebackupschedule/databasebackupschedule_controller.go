@@ -0,0 +1,443 @@
+package databasebackupschedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	fnresources "github.com/acquia/fn-drupal-operator/pkg/apis"
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/metrics"
+)
+
+// controllerName is the name of this controller, used for its Events
+const controllerName = "databasebackupschedule-controller"
+
+var log = logf.Log.WithName("controller_databasebackupschedule")
+
+// Useful for mocking the current time
+var now = time.Now
+
+// Add creates a new DatabaseBackupSchedule Controller and adds it to the Manager. The Manager will set fields on the
+// Controller and Start it when the Manager is Started.
+// Also registers webhooks for this type.
+func Add(mgr manager.Manager) error {
+	err := builder.
+		WebhookManagedBy(mgr).
+		For(&fnv1alpha1.DatabaseBackupSchedule{}).
+		Complete()
+	if err != nil {
+		log.Error(err, "could not create databasebackupschedule webhook")
+		return err
+	}
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	scheme := mgr.GetScheme()
+	if err := fnresources.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return NewReconciler(mgr.GetClient(), scheme, mgr.GetEventRecorderFor(controllerName))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileDatabaseBackupSchedule{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource DatabaseBackupSchedule
+	err = c.Watch(&source.Kind{Type: &fnv1alpha1.DatabaseBackupSchedule{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to DatabaseBackups, including those not created by a schedule, to record the latest ones in the
+	// status of their Database
+	err = c.Watch(&source.Kind{Type: &fnv1alpha1.DatabaseBackup{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: matchingSchedules(mgr.GetClient(), backupMatches),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Databases and Sites, which change the Databases backed up by a schedule
+	err = c.Watch(&source.Kind{Type: &fnv1alpha1.Database{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: matchingSchedules(mgr.GetClient(), databaseMatches),
+	})
+	if err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &fnv1alpha1.Site{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: matchingSchedules(mgr.GetClient(), siteMatches),
+	})
+}
+
+// matchingSchedules maps an object to reconcile requests for the DatabaseBackupSchedules in its namespace that it
+// matches
+func matchingSchedules(c client.Client, matches func(o handler.MapObject, s *fnv1alpha1.DatabaseBackupSchedule) bool) handler.ToRequestsFunc {
+	return func(o handler.MapObject) (requests []reconcile.Request) {
+		schedules := &fnv1alpha1.DatabaseBackupScheduleList{}
+		if err := c.List(context.TODO(), schedules, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list DatabaseBackupSchedules", "Namespace", o.Meta.GetNamespace())
+			return nil
+		}
+		for i := range schedules.Items {
+			if s := &schedules.Items[i]; matches(o, s) {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: s.Namespace, Name: s.Name},
+				})
+			}
+		}
+		return
+	}
+}
+
+func backupMatches(o handler.MapObject, s *fnv1alpha1.DatabaseBackupSchedule) bool {
+	backup, ok := o.Object.(*fnv1alpha1.DatabaseBackup)
+	return ok && (backup.Labels[fnv1alpha1.BackupScheduleLabel] == s.Name || containsString(s.Status.Databases, backup.Spec.Database))
+}
+
+func databaseMatches(o handler.MapObject, s *fnv1alpha1.DatabaseBackupSchedule) bool {
+	return s.Spec.Database == o.Meta.GetName() || containsString(s.Status.Databases, o.Meta.GetName())
+}
+
+func siteMatches(o handler.MapObject, s *fnv1alpha1.DatabaseBackupSchedule) bool {
+	site, ok := o.Object.(*fnv1alpha1.Site)
+	return ok && s.Spec.Environment != "" && s.Spec.Environment == site.Spec.Environment
+}
+
+// blank assignment to verify that ReconcileDatabaseBackupSchedule implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileDatabaseBackupSchedule{}
+
+// ReconcileDatabaseBackupSchedule reconciles a DatabaseBackupSchedule object
+type ReconcileDatabaseBackupSchedule struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+type requestHandler struct {
+	r        *ReconcileDatabaseBackupSchedule
+	logger   logr.Logger
+	schedule *fnv1alpha1.DatabaseBackupSchedule
+	now      time.Time
+}
+
+// Reconcile creates the DatabaseBackups of a DatabaseBackupSchedule when they're due, prunes those that its retention
+// doesn't keep, and records the latest backup of its Databases in their status
+func (r *ReconcileDatabaseBackupSchedule) Reconcile(request reconcile.Request) (result reconcile.Result, err error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	logger.V(1).Info("Reconciling DatabaseBackupSchedule")
+
+	schedule := &fnv1alpha1.DatabaseBackupSchedule{}
+	err = r.client.Get(context.TODO(), request.NamespacedName, schedule)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, likely deleted after reconcile request, so ignore.
+			return result, nil
+		}
+		return
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return
+	}
+
+	rh := requestHandler{r: r, logger: logger, schedule: schedule, now: now().UTC()}
+	result, err = rh.reconcile()
+
+	if errStatus := r.client.Status().Update(context.TODO(), rh.schedule); errStatus != nil {
+		logger.Error(errStatus, "Failed to update Status")
+		if err == nil {
+			err = errStatus
+		}
+	}
+	return
+}
+
+func (rh *requestHandler) reconcile() (result reconcile.Result, err error) {
+	schedule := rh.schedule
+	sched, err := schedule.ParseSchedule()
+	if err != nil {
+		rh.r.recorder.Eventf(schedule, corev1.EventTypeWarning, common.ReasonInvalidSchedule, "Invalid schedule %q: %v", schedule.Spec.Schedule, err)
+		return result, nil
+	}
+
+	databases, err := rh.databases()
+	if err != nil {
+		return
+	}
+	schedule.Status.Databases = nil
+	for _, db := range databases {
+		schedule.Status.Databases = append(schedule.Status.Databases, db.Name)
+	}
+
+	// Only the latest of the times missed since backups were last taken is caught up on
+	latest := scheduledBefore(sched, rh.now.Add(time.Nanosecond))
+	lastScheduled := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		lastScheduled = schedule.Status.LastScheduleTime.Time
+	}
+	if !schedule.Spec.Suspend && latest.After(lastScheduled) {
+		for _, db := range databases {
+			if err = rh.createBackup(db, latest); err != nil {
+				return
+			}
+		}
+		schedule.Status.LastScheduleTime = &metav1.Time{Time: latest}
+	}
+	next := sched.Next(rh.now)
+	schedule.Status.NextScheduleTime = &metav1.Time{Time: next}
+
+	backups := &fnv1alpha1.DatabaseBackupList{}
+	if err = rh.r.client.List(context.TODO(), backups, client.InNamespace(schedule.Namespace)); err != nil {
+		return
+	}
+	if err = rh.pruneBackups(backups.Items); err != nil {
+		return
+	}
+	schedules := &fnv1alpha1.DatabaseBackupScheduleList{}
+	if err = rh.r.client.List(context.TODO(), schedules, client.InNamespace(schedule.Namespace)); err != nil {
+		return
+	}
+	for _, db := range databases {
+		if err = rh.updateDatabaseStatus(db, backups.Items, schedules.Items); err != nil {
+			return
+		}
+	}
+
+	result.RequeueAfter = next.Sub(rh.now)
+	return
+}
+
+// databases returns the Databases backed up by the schedule: its Database, or the Databases of the Sites of its
+// DrupalEnvironment, sorted by name. Databases that don't exist, or are being deleted, are left out.
+func (rh *requestHandler) databases() ([]*fnv1alpha1.Database, error) {
+	schedule := rh.schedule
+	names := []string{schedule.Spec.Database}
+	if schedule.Spec.Environment != "" {
+		sites := &fnv1alpha1.SiteList{}
+		if err := rh.r.client.List(context.TODO(), sites, client.InNamespace(schedule.Namespace)); err != nil {
+			return nil, err
+		}
+		names = nil
+		for _, site := range sites.Items {
+			if site.Spec.Environment == schedule.Spec.Environment && !containsString(names, site.Spec.Database) {
+				names = append(names, site.Spec.Database)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	var databases []*fnv1alpha1.Database
+	for _, name := range names {
+		db := &fnv1alpha1.Database{}
+		err := rh.r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: schedule.Namespace}, db)
+		if err != nil && errors.IsNotFound(err) {
+			rh.r.recorder.Eventf(schedule, corev1.EventTypeWarning, common.ReasonDatabaseMissing, "Database %q not found", name)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if db.DeletionTimestamp.IsZero() {
+			databases = append(databases, db)
+		}
+	}
+	return databases, nil
+}
+
+// createBackup creates the DatabaseBackup of a Database for the given time of the schedule, unless it exists already
+func (rh *requestHandler) createBackup(db *fnv1alpha1.Database, at time.Time) error {
+	schedule := rh.schedule
+	labels := map[string]string{fnv1alpha1.BackupScheduleLabel: schedule.Name}
+	for k, v := range db.ChildLabels() {
+		labels[k] = v
+	}
+	backup := &fnv1alpha1.DatabaseBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupName(schedule, db, at),
+			Namespace: schedule.Namespace,
+			Labels:    labels,
+		},
+		Spec: fnv1alpha1.DatabaseBackupSpec{
+			Database: db.Name,
+			Target:   *schedule.Spec.Target.DeepCopy(),
+		},
+	}
+	if err := rh.r.client.Create(context.TODO(), backup); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	rh.logger.Info("Created DatabaseBackup", "Name", backup.Name, "Database", db.Name)
+	rh.r.recorder.Eventf(schedule, corev1.EventTypeNormal, common.ReasonBackupScheduled, "Created DatabaseBackup %q of Database %q", backup.Name, db.Name)
+	return nil
+}
+
+// pruneBackups deletes the DatabaseBackups created by the schedule that its retention doesn't keep. Backups protected
+// from deletion are kept.
+func (rh *requestHandler) pruneBackups(backups []fnv1alpha1.DatabaseBackup) error {
+	byDatabase := map[string][]*fnv1alpha1.DatabaseBackup{}
+	for i := range backups {
+		if b := &backups[i]; b.Labels[fnv1alpha1.BackupScheduleLabel] == rh.schedule.Name {
+			byDatabase[b.Spec.Database] = append(byDatabase[b.Spec.Database], b)
+		}
+	}
+
+	var deleted []string
+	for _, databaseBackups := range byDatabase {
+		for _, b := range pruneBackups(databaseBackups, rh.schedule.Spec.Retention) {
+			if fnv1alpha1.GetDeletionProtection(b).Protects() {
+				continue
+			}
+			if err := rh.r.client.Delete(context.TODO(), b); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			deleted = append(deleted, b.Name)
+		}
+	}
+	if len(deleted) > 0 {
+		sort.Strings(deleted)
+		rh.logger.Info("Pruned DatabaseBackups", "Names", deleted)
+		rh.r.recorder.Eventf(rh.schedule, corev1.EventTypeNormal, common.ReasonBackupsPruned, "Deleted DatabaseBackups %s", strings.Join(deleted, ", "))
+	}
+	return nil
+}
+
+// updateDatabaseStatus records the latest successful backup of a Database in its status, and whether its backups failed
+// or are overdue, according to all the schedules that back it up. Each of them computes the same status, so they don't
+// overwrite each other's.
+func (rh *requestHandler) updateDatabaseStatus(db *fnv1alpha1.Database, backups []fnv1alpha1.DatabaseBackup, schedules []fnv1alpha1.DatabaseBackupSchedule) error {
+	var lastSucceeded, lastFinished *fnv1alpha1.DatabaseBackup
+	for i := range backups {
+		b := &backups[i]
+		if b.Spec.Database != db.Name || !b.Status.Phase.Finished() || b.Status.CompletionTime == nil {
+			continue
+		}
+		if lastFinished == nil || lastFinished.Status.CompletionTime.Before(b.Status.CompletionTime) {
+			lastFinished = b
+		}
+		if b.Status.Phase == fnv1alpha1.DatabaseJobSucceeded && (lastSucceeded == nil || lastSucceeded.Status.CompletionTime.Before(b.Status.CompletionTime)) {
+			lastSucceeded = b
+		}
+	}
+
+	status := db.Status.DeepCopy()
+	if lastSucceeded != nil {
+		status.LastBackup = &fnv1alpha1.DatabaseLastBackup{
+			Name:           lastSucceeded.Name,
+			Location:       lastSucceeded.Status.Location,
+			CompletionTime: *lastSucceeded.Status.CompletionTime,
+		}
+		metrics.DatabaseBackedUp(db, lastSucceeded.Status.CompletionTime.Time)
+	}
+
+	failed := fnv1alpha1.Condition{Type: fnv1alpha1.DatabaseBackupFailedCondition, Status: corev1.ConditionFalse, Reason: "NoBackups"}
+	if lastFinished != nil && lastFinished.Status.Phase == fnv1alpha1.DatabaseJobFailed {
+		failed.Status = corev1.ConditionTrue
+		failed.Reason = "BackupFailed"
+		failed.Message = fmt.Sprintf("DatabaseBackup %q failed: %s", lastFinished.Name, lastFinished.Status.Message)
+	} else if lastFinished != nil {
+		failed.Reason = "BackupSucceeded"
+	}
+	fnv1alpha1.SetCondition(&status.Conditions, failed)
+
+	overdue := rh.overdueCondition(db, lastSucceeded, schedules)
+	if overdue.Status == corev1.ConditionTrue && !fnv1alpha1.IsConditionTrue(status.Conditions, overdue.Type) {
+		rh.r.recorder.Event(db, corev1.EventTypeWarning, common.ReasonBackupOverdue, overdue.Message)
+	}
+	fnv1alpha1.SetCondition(&status.Conditions, overdue)
+
+	if cmp.Equal(*status, db.Status) {
+		return nil
+	}
+	db.Status = *status
+	return rh.r.client.Status().Update(context.TODO(), db)
+}
+
+// overdueCondition returns the BackupOverdue condition of a Database, given its latest successful backup. It's overdue
+// if no backup succeeded since the time before the latest time of any of the schedules that back it up and aren't
+// suspended, whose backup has had a whole period to complete.
+func (rh *requestHandler) overdueCondition(db *fnv1alpha1.Database, lastSucceeded *fnv1alpha1.DatabaseBackup, schedules []fnv1alpha1.DatabaseBackupSchedule) fnv1alpha1.Condition {
+	overdue := fnv1alpha1.Condition{Type: fnv1alpha1.DatabaseBackupOverdueCondition, Status: corev1.ConditionFalse, Reason: "Suspended"}
+	var deadline time.Time
+	var deadlineSchedule string
+	for i := range schedules {
+		s := &schedules[i]
+		if s.Name == rh.schedule.Name {
+			// The listed schedule may not have the Databases just found yet
+			s = rh.schedule
+		}
+		if !s.DeletionTimestamp.IsZero() || !containsString(s.Status.Databases, db.Name) || s.Spec.Suspend {
+			continue
+		}
+		overdue.Reason = "OnSchedule"
+		sched, err := s.ParseSchedule()
+		if err != nil {
+			continue
+		}
+		d := scheduledBefore(sched, scheduledBefore(sched, rh.now.Add(time.Nanosecond)))
+		if d.IsZero() || d.Before(s.CreationTimestamp.Time) {
+			// The schedule didn't exist for a whole period yet
+			continue
+		}
+		if d.After(deadline) {
+			deadline, deadlineSchedule = d, s.Name
+		}
+	}
+
+	if !deadline.IsZero() && (lastSucceeded == nil || lastSucceeded.Status.CompletionTime.Time.Before(deadline)) {
+		overdue.Status = corev1.ConditionTrue
+		overdue.Reason = "Overdue"
+		overdue.Message = fmt.Sprintf("No backup succeeded since %s, as scheduled by DatabaseBackupSchedule %q", deadline.Format(time.RFC3339), deadlineSchedule)
+	}
+	return overdue
+}
+
+// backupName returns the name of the DatabaseBackup of a Database for the given time of a schedule. It includes the
+// name of the schedule, so that schedules backing up the same Database at the same time don't share backups.
+func backupName(schedule *fnv1alpha1.DatabaseBackupSchedule, db *fnv1alpha1.Database, at time.Time) string {
+	return fmt.Sprintf("%s-%s-%s", schedule.Name, db.Name, at.UTC().Format("20060102-1504"))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
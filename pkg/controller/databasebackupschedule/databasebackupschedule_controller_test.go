@@ -0,0 +1,275 @@
+package databasebackupschedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+const (
+	testNamespace = "wlgore"
+	testSchedule  = "wlgore-hourly"
+)
+
+var testTarget = fnv1alpha1.DatabaseDumpTarget{
+	S3:   &fnv1alpha1.S3Target{Bucket: "wlgore-backups", Endpoint: "http://minio:9000", CredentialsSecret: "minio"},
+	Path: "wlgore-prod",
+}
+
+func newDatabase(name string) *fnv1alpha1.Database {
+	return &fnv1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels:    map[string]string{fnv1alpha1.DatabaseIdLabel: name + "-id"},
+		},
+		Spec: fnv1alpha1.DatabaseSpec{SchemaName: name, User: "wlgore", UserSecret: name + "-user"},
+	}
+}
+
+func newSite(name, environment, database string) *fnv1alpha1.Site {
+	return &fnv1alpha1.Site{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       fnv1alpha1.SiteSpec{Environment: environment, Database: database},
+	}
+}
+
+// setNow sets the time the controller runs at, until the test finishes
+func setNow(t *testing.T, at time.Time) {
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func buildFakeReconcile(objects []runtime.Object) *ReconcileDatabaseBackupSchedule {
+	return &ReconcileDatabaseBackupSchedule{
+		client:   testhelpers.NewFakeClient(objects),
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
+	}
+}
+
+func TestDatabaseBackupScheduleController(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	schedule := &fnv1alpha1.DatabaseBackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              testSchedule,
+			Namespace:         testNamespace,
+			CreationTimestamp: metav1.NewTime(time.Date(2020, 3, 1, 11, 30, 0, 0, time.UTC)),
+		},
+		Spec: fnv1alpha1.DatabaseBackupScheduleSpec{
+			Environment: "wlgore-prod",
+			Schedule:    "@hourly",
+			Target:      testTarget,
+		},
+	}
+	r := buildFakeReconcile([]runtime.Object{
+		schedule,
+		newDatabase("wlgoredatabase"),
+		newDatabase("otherdatabase"),
+		newSite("wlgore", "wlgore-prod", "wlgoredatabase"),
+		newSite("wlgore-fr", "wlgore-prod", "wlgoredatabase"),
+		newSite("other", "other-prod", "otherdatabase"),
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testSchedule, Namespace: testNamespace}}
+
+	getSchedule := func(t *testing.T) *fnv1alpha1.DatabaseBackupSchedule {
+		schedule := &fnv1alpha1.DatabaseBackupSchedule{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, schedule))
+		return schedule
+	}
+	getDatabase := func(t *testing.T) *fnv1alpha1.Database {
+		db := &fnv1alpha1.Database{}
+		require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "wlgoredatabase", Namespace: testNamespace}, db))
+		return db
+	}
+	finishBackup := func(t *testing.T, name string, phase fnv1alpha1.DatabaseJobPhase, at time.Time) {
+		backup := &fnv1alpha1.DatabaseBackup{}
+		require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, backup))
+		completed := metav1.NewTime(at)
+		backup.Status = fnv1alpha1.DatabaseBackupStatus{Phase: phase, Message: "Job has reached the specified backoff limit", CompletionTime: &completed}
+		require.NoError(t, r.client.Status().Update(context.TODO(), backup))
+	}
+
+	t.Run("should back up the Databases of the environment when due", func(t *testing.T) {
+		setNow(t, time.Date(2020, 3, 1, 12, 10, 0, 0, time.UTC))
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.Equal(t, 50*time.Minute, res.RequeueAfter)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonBackupScheduled)
+
+		backup := &fnv1alpha1.DatabaseBackup{}
+		require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "wlgore-hourly-wlgoredatabase-20200301-1200", Namespace: testNamespace}, backup))
+		require.Equal(t, "wlgoredatabase", backup.Spec.Database)
+		require.Equal(t, testTarget, backup.Spec.Target)
+		require.Equal(t, testSchedule, backup.Labels[fnv1alpha1.BackupScheduleLabel])
+		require.Equal(t, "wlgoredatabase-id", backup.Labels[fnv1alpha1.DatabaseIdLabel])
+
+		backups := &fnv1alpha1.DatabaseBackupList{}
+		require.NoError(t, r.client.List(context.TODO(), backups))
+		require.Len(t, backups.Items, 1)
+
+		schedule := getSchedule(t)
+		require.Equal(t, []string{"wlgoredatabase"}, schedule.Status.Databases)
+		require.Equal(t, time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), schedule.Status.LastScheduleTime.UTC())
+		require.Equal(t, time.Date(2020, 3, 1, 13, 0, 0, 0, time.UTC), schedule.Status.NextScheduleTime.UTC())
+
+		db := getDatabase(t)
+		require.Nil(t, db.Status.LastBackup)
+		require.False(t, fnv1alpha1.IsConditionTrue(db.Status.Conditions, fnv1alpha1.DatabaseBackupFailedCondition))
+		require.False(t, fnv1alpha1.IsConditionTrue(db.Status.Conditions, fnv1alpha1.DatabaseBackupOverdueCondition))
+	})
+
+	t.Run("should record the latest successful backup", func(t *testing.T) {
+		setNow(t, time.Date(2020, 3, 1, 12, 20, 0, 0, time.UTC))
+		finishBackup(t, "wlgore-hourly-wlgoredatabase-20200301-1200", fnv1alpha1.DatabaseJobSucceeded, time.Date(2020, 3, 1, 12, 5, 0, 0, time.UTC))
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+
+		db := getDatabase(t)
+		require.Equal(t, "wlgore-hourly-wlgoredatabase-20200301-1200", db.Status.LastBackup.Name)
+		require.Equal(t, time.Date(2020, 3, 1, 12, 5, 0, 0, time.UTC), db.Status.LastBackup.CompletionTime.UTC())
+		require.Equal(t, "BackupSucceeded", fnv1alpha1.FindCondition(db.Status.Conditions, fnv1alpha1.DatabaseBackupFailedCondition).Reason)
+	})
+
+	t.Run("should report overdue and failed backups", func(t *testing.T) {
+		// The backup of 13:00 was missed
+		setNow(t, time.Date(2020, 3, 1, 14, 10, 0, 0, time.UTC))
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonBackupOverdue)
+		require.True(t, fnv1alpha1.IsConditionTrue(getDatabase(t).Status.Conditions, fnv1alpha1.DatabaseBackupOverdueCondition))
+
+		finishBackup(t, "wlgore-hourly-wlgoredatabase-20200301-1400", fnv1alpha1.DatabaseJobFailed, time.Date(2020, 3, 1, 14, 20, 0, 0, time.UTC))
+		_, err = r.Reconcile(req)
+		require.NoError(t, err)
+
+		db := getDatabase(t)
+		failed := fnv1alpha1.FindCondition(db.Status.Conditions, fnv1alpha1.DatabaseBackupFailedCondition)
+		require.Equal(t, corev1.ConditionTrue, failed.Status)
+		require.Equal(t, `DatabaseBackup "wlgore-hourly-wlgoredatabase-20200301-1400" failed: Job has reached the specified backoff limit`, failed.Message)
+		require.Equal(t, "wlgore-hourly-wlgoredatabase-20200301-1200", db.Status.LastBackup.Name)
+	})
+}
+
+func TestDatabaseBackupScheduleController_SharedDatabase(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+	setNow(t, time.Date(2020, 3, 1, 14, 10, 0, 0, time.UTC))
+
+	newSchedule := func(name string, suspend bool) *fnv1alpha1.DatabaseBackupSchedule {
+		return &fnv1alpha1.DatabaseBackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         testNamespace,
+				CreationTimestamp: metav1.NewTime(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)),
+			},
+			Spec: fnv1alpha1.DatabaseBackupScheduleSpec{
+				Database: "wlgoredatabase",
+				Schedule: "@hourly",
+				Target:   testTarget,
+				Suspend:  suspend,
+			},
+			Status: fnv1alpha1.DatabaseBackupScheduleStatus{Databases: []string{"wlgoredatabase"}},
+		}
+	}
+	r := buildFakeReconcile([]runtime.Object{
+		newSchedule("wlgore-hourly", false),
+		newSchedule("wlgore-suspended", true),
+		newDatabase("wlgoredatabase"),
+	})
+	overdue := func(t *testing.T) *fnv1alpha1.Condition {
+		db := &fnv1alpha1.Database{}
+		require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "wlgoredatabase", Namespace: testNamespace}, db))
+		return fnv1alpha1.FindCondition(db.Status.Conditions, fnv1alpha1.DatabaseBackupOverdueCondition)
+	}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "wlgore-hourly", Namespace: testNamespace}})
+	require.NoError(t, err)
+	require.Equal(t, "Overdue", overdue(t).Reason)
+
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "wlgore-suspended", Namespace: testNamespace}})
+	require.NoError(t, err)
+	require.Equal(t, "Overdue", overdue(t).Reason, "a suspended schedule doesn't clear the condition set for another one")
+
+	backups := &fnv1alpha1.DatabaseBackupList{}
+	require.NoError(t, r.client.List(context.TODO(), backups))
+	require.Len(t, backups.Items, 1)
+	require.Equal(t, "wlgore-hourly-wlgoredatabase-20200301-1400", backups.Items[0].Name)
+}
+
+func TestDatabaseBackupScheduleController_Retention(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+	setNow(t, time.Date(2020, 3, 1, 12, 10, 0, 0, time.UTC))
+
+	schedule := &fnv1alpha1.DatabaseBackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              testSchedule,
+			Namespace:         testNamespace,
+			CreationTimestamp: metav1.NewTime(time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		Spec: fnv1alpha1.DatabaseBackupScheduleSpec{
+			Database:  "wlgoredatabase",
+			Schedule:  "@hourly",
+			Target:    testTarget,
+			Retention: fnv1alpha1.BackupRetention{KeepLast: 1},
+			Suspend:   true,
+		},
+	}
+	backup := func(name string, hour int, labels, annotations map[string]string) *fnv1alpha1.DatabaseBackup {
+		completed := metav1.NewTime(time.Date(2020, 3, 1, hour, 5, 0, 0, time.UTC))
+		return &fnv1alpha1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         testNamespace,
+				Labels:            labels,
+				Annotations:       annotations,
+				CreationTimestamp: metav1.NewTime(time.Date(2020, 3, 1, hour, 0, 0, 0, time.UTC)),
+			},
+			Spec:   fnv1alpha1.DatabaseBackupSpec{Database: "wlgoredatabase", Target: testTarget},
+			Status: fnv1alpha1.DatabaseBackupStatus{Phase: fnv1alpha1.DatabaseJobSucceeded, CompletionTime: &completed},
+		}
+	}
+	scheduled := map[string]string{fnv1alpha1.BackupScheduleLabel: testSchedule}
+	protected := map[string]string{fnv1alpha1.DeletionProtectionAnnotation: string(fnv1alpha1.DeletionProtectionEnabled)}
+
+	r := buildFakeReconcile([]runtime.Object{
+		schedule,
+		newDatabase("wlgoredatabase"),
+		backup("wlgoredatabase-20200301-0900", 9, scheduled, nil),
+		backup("wlgoredatabase-20200301-1000", 10, scheduled, protected),
+		backup("wlgoredatabase-manual", 10, nil, nil),
+		backup("wlgoredatabase-20200301-1100", 11, scheduled, nil),
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testSchedule, Namespace: testNamespace}}
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonBackupsPruned)
+
+	backups := &fnv1alpha1.DatabaseBackupList{}
+	require.NoError(t, r.client.List(context.TODO(), backups))
+	var names []string
+	for _, b := range backups.Items {
+		names = append(names, b.Name)
+	}
+	require.ElementsMatch(t, []string{"wlgoredatabase-20200301-1000", "wlgoredatabase-manual", "wlgoredatabase-20200301-1100"}, names,
+		"suspended schedules don't take backups, but still prune them")
+
+	db := &fnv1alpha1.Database{}
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "wlgoredatabase", Namespace: testNamespace}, db))
+	require.Equal(t, "wlgoredatabase-20200301-1100", db.Status.LastBackup.Name)
+	require.Equal(t, "Suspended", fnv1alpha1.FindCondition(db.Status.Conditions, fnv1alpha1.DatabaseBackupOverdueCondition).Reason)
+}
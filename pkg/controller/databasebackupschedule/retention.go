@@ -0,0 +1,93 @@
+package databasebackupschedule
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+// scheduleLookbacks are how far back scheduledBefore looks for a time of a schedule, from hourly to yearly schedules
+var scheduleLookbacks = []time.Duration{time.Hour, 24 * time.Hour, 31 * 24 * time.Hour, 366 * 24 * time.Hour}
+
+// scheduledBefore returns the latest time of the schedule before t, or the zero time if there is none in the previous
+// year. Cron schedules can only be iterated forward, so the schedule is iterated from increasingly earlier times. Next
+// returns the zero time for schedules that never happen, such as on February 30th.
+func scheduledBefore(schedule cron.Schedule, t time.Time) time.Time {
+	for _, lookback := range scheduleLookbacks {
+		var latest time.Time
+		for next := schedule.Next(t.Add(-lookback)); !next.IsZero() && next.Before(t); next = schedule.Next(next) {
+			latest = next
+		}
+		if !latest.IsZero() {
+			return latest
+		}
+	}
+	return time.Time{}
+}
+
+// retentionRule keeps the latest backup of each bucket, for the given number of buckets
+type retentionRule struct {
+	keep   int32
+	bucket func(t time.Time, name string) string
+}
+
+// pruneBackups returns the backups of a Database that the retention doesn't keep. Successful backups are kept by the
+// rules of the retention, failed ones until a later backup succeeds, and those that didn't finish always. Backups are
+// bucketed into days, weeks and months by their creation time, in UTC.
+func pruneBackups(backups []*fnv1alpha1.DatabaseBackup, retention fnv1alpha1.BackupRetention) (pruned []*fnv1alpha1.DatabaseBackup) {
+	if retention.IsZero() {
+		return nil
+	}
+
+	// Latest first
+	sorted := append([]*fnv1alpha1.DatabaseBackup(nil), backups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+
+	rules := []retentionRule{
+		{retention.KeepLast, func(_ time.Time, name string) string { return name }},
+		{retention.Daily, func(t time.Time, _ string) string { return t.Format("2006-01-02") }},
+		{retention.Weekly, func(t time.Time, _ string) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{retention.Monthly, func(t time.Time, _ string) string { return t.Format("2006-01") }},
+	}
+	kept := map[*fnv1alpha1.DatabaseBackup]bool{}
+	for _, rule := range rules {
+		buckets := map[string]bool{}
+		for _, b := range sorted {
+			if int32(len(buckets)) >= rule.keep {
+				break
+			}
+			if b.Status.Phase != fnv1alpha1.DatabaseJobSucceeded {
+				continue
+			}
+			if bucket := rule.bucket(b.CreationTimestamp.UTC(), b.Name); !buckets[bucket] {
+				buckets[bucket] = true
+				kept[b] = true
+			}
+		}
+	}
+
+	succeeded := false
+	for _, b := range sorted {
+		switch b.Status.Phase {
+		case fnv1alpha1.DatabaseJobSucceeded:
+			succeeded = true
+			if !kept[b] {
+				pruned = append(pruned, b)
+			}
+		case fnv1alpha1.DatabaseJobFailed:
+			if succeeded {
+				pruned = append(pruned, b)
+			}
+		}
+	}
+	return
+}
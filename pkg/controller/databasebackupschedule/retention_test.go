@@ -0,0 +1,89 @@
+package databasebackupschedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+func Test_scheduledBefore(t *testing.T) {
+	at := time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		expected time.Time
+	}{
+		{"*/5 * * * *", time.Date(2020, 3, 1, 12, 25, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2020, 3, 1, 2, 0, 0, 0, time.UTC)},
+		{"0 3 * * 1", time.Date(2020, 2, 24, 3, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.schedule, func(t *testing.T) {
+			schedule, err := cron.ParseStandard(test.schedule)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, scheduledBefore(schedule, at))
+		})
+	}
+
+	hourly, _ := cron.ParseStandard("@hourly")
+	require.Equal(t, time.Date(2020, 3, 1, 11, 0, 0, 0, time.UTC), scheduledBefore(hourly, time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)),
+		"times of the schedule are strictly before t")
+}
+
+func Test_pruneBackups(t *testing.T) {
+	backup := func(name string, created time.Time, phase fnv1alpha1.DatabaseJobPhase) *fnv1alpha1.DatabaseBackup {
+		return &fnv1alpha1.DatabaseBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Status:     fnv1alpha1.DatabaseBackupStatus{Phase: phase},
+		}
+	}
+	// Daily backups at 02:00 for 60 days, up to Sunday, March 1st 2020, and hourly backups on March 1st
+	var backups []*fnv1alpha1.DatabaseBackup
+	for day := time.Date(2020, 1, 2, 2, 0, 0, 0, time.UTC); !day.After(time.Date(2020, 3, 1, 2, 0, 0, 0, time.UTC)); day = day.AddDate(0, 0, 1) {
+		backups = append(backups, backup(day.Format("daily-0102"), day, fnv1alpha1.DatabaseJobSucceeded))
+	}
+	for hour := 3; hour <= 12; hour++ {
+		backups = append(backups, backup(time.Date(2020, 3, 1, hour, 0, 0, 0, time.UTC).Format("hourly-0102-15"), time.Date(2020, 3, 1, hour, 0, 0, 0, time.UTC), fnv1alpha1.DatabaseJobSucceeded))
+	}
+	failed := backup("failed-0229", time.Date(2020, 2, 29, 14, 0, 0, 0, time.UTC), fnv1alpha1.DatabaseJobFailed)
+	running := backup("running-0101", time.Date(2020, 1, 1, 2, 0, 0, 0, time.UTC), fnv1alpha1.DatabaseJobRunning)
+	backups = append(backups, failed, running)
+
+	names := func(backups []*fnv1alpha1.DatabaseBackup) (kept []string) {
+		pruned := map[*fnv1alpha1.DatabaseBackup]bool{}
+		for _, b := range pruneBackups(backups, fnv1alpha1.BackupRetention{KeepLast: 3, Daily: 3, Weekly: 2, Monthly: 3}) {
+			pruned[b] = true
+		}
+		for _, b := range backups {
+			if !pruned[b] {
+				kept = append(kept, b.Name)
+			}
+		}
+		return
+	}
+
+	require.ElementsMatch(t, []string{
+		"daily-0131",     // Monthly, January
+		"daily-0223",     // Weekly, ending Sunday, February 23rd
+		"daily-0228",     // Daily
+		"daily-0229",     // Daily, Monthly, February
+		"hourly-0301-10", // Last
+		"hourly-0301-11", // Last
+		"hourly-0301-12", // Last, Daily, Weekly, Monthly, March
+		"running-0101",   // Not finished
+	}, names(backups))
+
+	require.Empty(t, pruneBackups(backups, fnv1alpha1.BackupRetention{}), "all backups are kept without retention")
+
+	onlyFailed := []*fnv1alpha1.DatabaseBackup{failed, running}
+	require.Empty(t, pruneBackups(onlyFailed, fnv1alpha1.BackupRetention{KeepLast: 1}), "failed backups are kept until one succeeds")
+}
@@ -0,0 +1,355 @@
+package databaserestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	fnresources "github.com/acquia/fn-drupal-operator/pkg/apis"
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/dbdump"
+)
+
+const (
+	// controllerName is the name of this controller, used for its Events
+	controllerName = "databaserestore-controller"
+	// maintenanceFinalizer releases the Sites that a restore put into maintenance, if it's deleted while it runs
+	maintenanceFinalizer = "databaserestores.fnresources.acquia.io/maintenance"
+	// pendingRequeueAfter is how often a restore checks whether its backup and Database are ready
+	pendingRequeueAfter = 30 * time.Second
+)
+
+var log = logf.Log.WithName("controller_databaserestore")
+
+// Add creates a new DatabaseRestore Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+// Also registers webhooks for this type.
+func Add(mgr manager.Manager) error {
+	err := builder.
+		WebhookManagedBy(mgr).
+		For(&fnv1alpha1.DatabaseRestore{}).
+		Complete()
+	if err != nil {
+		log.Error(err, "could not create databaserestore webhook")
+		return err
+	}
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	scheme := mgr.GetScheme()
+	if err := fnresources.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return NewReconciler(mgr.GetClient(), scheme, mgr.GetEventRecorderFor(controllerName))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileDatabaseRestore{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource DatabaseRestore
+	err = c.Watch(&source.Kind{Type: &fnv1alpha1.DatabaseRestore{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the restore Jobs and requeue the owner DatabaseRestore
+	return common.WatchOwned(c, &fnv1alpha1.DatabaseRestore{}, []runtime.Object{&batchv1.Job{}})
+}
+
+// blank assignment to verify that ReconcileDatabaseRestore implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileDatabaseRestore{}
+
+// ReconcileDatabaseRestore reconciles a DatabaseRestore object
+type ReconcileDatabaseRestore struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+type requestHandler struct {
+	r       *ReconcileDatabaseRestore
+	logger  logr.Logger
+	restore *fnv1alpha1.DatabaseRestore
+}
+
+// Reconcile runs the Job that restores a DatabaseBackup into a Database, once, and records its result in the status of
+// the DatabaseRestore. Sites of the Database are kept in maintenance while the Job runs, if the restore asks for it.
+func (r *ReconcileDatabaseRestore) Reconcile(request reconcile.Request) (result reconcile.Result, err error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	logger.V(1).Info("Reconciling DatabaseRestore")
+
+	restore := &fnv1alpha1.DatabaseRestore{}
+	err = r.client.Get(context.TODO(), request.NamespacedName, restore)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, likely deleted after reconcile request, so ignore.
+			return result, nil
+		}
+		return
+	}
+
+	rh := requestHandler{r: r, logger: logger, restore: restore}
+	if !restore.DeletionTimestamp.IsZero() {
+		return rh.finalize()
+	}
+	if restore.Status.Phase.Finished() {
+		return
+	}
+	if restore.Spec.Maintenance && !common.HasFinalizer(restore, maintenanceFinalizer) {
+		controllerutil.AddFinalizer(restore, maintenanceFinalizer)
+		result.Requeue = true
+		return result, r.client.Update(context.TODO(), restore)
+	}
+
+	result, err = rh.reconcileJob()
+
+	if errStatus := r.client.Status().Update(context.TODO(), rh.restore); errStatus != nil {
+		logger.Error(errStatus, "Failed to update Status")
+		if err == nil {
+			err = errStatus
+		}
+	}
+	return
+}
+
+// finalize releases the Sites of a deleted restore. The Job is deleted with the restore, by garbage collection.
+func (rh *requestHandler) finalize() (result reconcile.Result, err error) {
+	if !common.HasFinalizer(rh.restore, maintenanceFinalizer) {
+		return
+	}
+	if err = rh.releaseSites(); err != nil {
+		return
+	}
+	controllerutil.RemoveFinalizer(rh.restore, maintenanceFinalizer)
+	return result, rh.r.client.Update(context.TODO(), rh.restore)
+}
+
+// reconcileJob starts the restore Job, or records its result once it finished
+func (rh *requestHandler) reconcileJob() (result reconcile.Result, err error) {
+	restore := rh.restore
+	job := &batchv1.Job{}
+	err = rh.r.client.Get(context.TODO(), types.NamespacedName{Name: jobName(restore), Namespace: restore.Namespace}, job)
+	if err != nil && errors.IsNotFound(err) {
+		if restore.Status.Phase == fnv1alpha1.DatabaseJobRunning {
+			return result, rh.finish(fnv1alpha1.DatabaseJobFailed, metav1.Now(), fmt.Sprintf("Job %q was deleted", jobName(restore)))
+		}
+		return rh.startJob()
+	} else if err != nil {
+		return
+	}
+
+	phase, message, finishedAt := dbdump.JobPhase(job)
+	if phase.Finished() {
+		err = rh.finish(phase, finishedAt, message)
+	}
+	return
+}
+
+// startJob creates the Job that restores the backup, once the backup succeeded, after putting the Sites of the Database
+// into maintenance
+func (rh *requestHandler) startJob() (result reconcile.Result, err error) {
+	restore := rh.restore
+	c := rh.r.client
+
+	backup := &fnv1alpha1.DatabaseBackup{}
+	err = c.Get(context.TODO(), types.NamespacedName{Name: restore.Spec.Backup, Namespace: restore.Namespace}, backup)
+	if err != nil && errors.IsNotFound(err) {
+		return rh.pending(fmt.Sprintf("DatabaseBackup %q not found", restore.Spec.Backup))
+	} else if err != nil {
+		return
+	}
+	switch backup.Status.Phase {
+	case fnv1alpha1.DatabaseJobSucceeded:
+	case fnv1alpha1.DatabaseJobFailed:
+		return result, rh.finish(fnv1alpha1.DatabaseJobFailed, metav1.Now(), fmt.Sprintf("DatabaseBackup %q failed", backup.Name))
+	default:
+		return rh.pending(fmt.Sprintf("DatabaseBackup %q hasn't succeeded yet", backup.Name))
+	}
+
+	db := &fnv1alpha1.Database{}
+	err = c.Get(context.TODO(), types.NamespacedName{Name: restore.Spec.Database, Namespace: restore.Namespace}, db)
+	if err != nil && errors.IsNotFound(err) {
+		return rh.pending(fmt.Sprintf("Database %q not found", restore.Spec.Database))
+	} else if err != nil {
+		return
+	}
+
+	if restore.Spec.Maintenance {
+		if err = rh.enterMaintenance(); err != nil {
+			return
+		}
+	}
+
+	// The backup's file includes the path of its target
+	target := backup.Spec.Target
+	target.Path = ""
+	job := dbdump.RestoreJob(dbdump.Options{
+		Name:        jobName(restore),
+		Namespace:   restore.Namespace,
+		Labels:      db.ChildLabels(),
+		Database:    db,
+		Credentials: dbdump.UserCredentials(db),
+		Target:      target,
+		File:        backup.Status.File,
+		Checksum:    backup.Status.Checksum,
+	})
+	// Set DatabaseRestore instance as the owner and controller (will never error since Job is new)
+	_ = controllerutil.SetControllerReference(restore, job, rh.r.scheme)
+	if err = c.Create(context.TODO(), job); err != nil && !errors.IsAlreadyExists(err) {
+		return
+	}
+
+	now := metav1.Now()
+	restore.Status.Phase = fnv1alpha1.DatabaseJobRunning
+	restore.Status.Message = ""
+	restore.Status.StartTime = &now
+	rh.logger.Info("Created restore Job", "Name", job.Name, "Location", backup.Status.Location)
+	rh.r.recorder.Eventf(restore, corev1.EventTypeNormal, common.ReasonRestoreStarted, "Restoring database %q from %s", db.DatabaseName(), backup.Status.Location)
+	return result, nil
+}
+
+// pending records why the restore can't start yet, and retries it later
+func (rh *requestHandler) pending(message string) (result reconcile.Result, err error) {
+	if rh.restore.Status.Message != message {
+		rh.r.recorder.Event(rh.restore, corev1.EventTypeWarning, common.ReasonBackupNotReady, message)
+	}
+	rh.restore.Status.Phase = fnv1alpha1.DatabaseJobPending
+	rh.restore.Status.Message = message
+	result.RequeueAfter = pendingRequeueAfter
+	return result, nil
+}
+
+// finish records the result of the restore, and releases its Sites
+func (rh *requestHandler) finish(phase fnv1alpha1.DatabaseJobPhase, finishedAt metav1.Time, message string) error {
+	if err := rh.releaseSites(); err != nil {
+		return err
+	}
+
+	status := &rh.restore.Status
+	status.Phase = phase
+	status.Message = message
+	status.CompletionTime = &finishedAt
+	status.Duration = &metav1.Duration{}
+	if status.StartTime != nil {
+		status.Duration.Duration = finishedAt.Sub(status.StartTime.Time)
+	}
+
+	if phase == fnv1alpha1.DatabaseJobFailed {
+		rh.logger.Info("Restore failed", "Message", message)
+		rh.r.recorder.Eventf(rh.restore, corev1.EventTypeWarning, common.ReasonRestoreFailed, "Restore failed: %s", message)
+	} else {
+		rh.logger.Info("Restore succeeded")
+		rh.r.recorder.Eventf(rh.restore, corev1.EventTypeNormal, common.ReasonRestoreSucceeded, "Restored DatabaseBackup %q in %v", rh.restore.Spec.Backup, status.Duration.Duration)
+	}
+	return nil
+}
+
+// enterMaintenance puts the Sites of the restored Database into maintenance. Sites that are already in maintenance
+// for another reason are left alone.
+func (rh *requestHandler) enterMaintenance() error {
+	restore := rh.restore
+	sites := &fnv1alpha1.SiteList{}
+	if err := rh.r.client.List(context.TODO(), sites, client.InNamespace(restore.Namespace)); err != nil {
+		return err
+	}
+
+	var names []string
+	for i := range sites.Items {
+		site := &sites.Items[i]
+		if site.Spec.Database != restore.Spec.Database {
+			continue
+		}
+		if reason, ok := site.Annotations[fnv1alpha1.MaintenanceAnnotation]; ok {
+			if reason == restore.MaintenanceReason() {
+				names = append(names, site.Name)
+			} else {
+				rh.logger.Info("Site is already in maintenance", "Site", site.Name, "Reason", reason)
+			}
+			continue
+		}
+
+		if site.Annotations == nil {
+			site.Annotations = map[string]string{}
+		}
+		site.Annotations[fnv1alpha1.MaintenanceAnnotation] = restore.MaintenanceReason()
+		if err := rh.r.client.Update(context.TODO(), site); err != nil {
+			return err
+		}
+		names = append(names, site.Name)
+	}
+
+	restore.Status.MaintenanceSites = names
+	if len(names) > 0 {
+		rh.r.recorder.Eventf(restore, corev1.EventTypeNormal, common.ReasonSitesInMaintenance, "Put Sites into maintenance: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// releaseSites takes the Sites that the restore put into maintenance out of it
+func (rh *requestHandler) releaseSites() error {
+	restore := rh.restore
+	if len(restore.Status.MaintenanceSites) == 0 {
+		return nil
+	}
+
+	for _, name := range restore.Status.MaintenanceSites {
+		site := &fnv1alpha1.Site{}
+		err := rh.r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: restore.Namespace}, site)
+		if err != nil && errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if site.Annotations[fnv1alpha1.MaintenanceAnnotation] != restore.MaintenanceReason() {
+			continue
+		}
+		delete(site.Annotations, fnv1alpha1.MaintenanceAnnotation)
+		if err = rh.r.client.Update(context.TODO(), site); err != nil {
+			return err
+		}
+	}
+
+	rh.r.recorder.Eventf(restore, corev1.EventTypeNormal, common.ReasonSitesReleased, "Took Sites out of maintenance: %s", strings.Join(restore.Status.MaintenanceSites, ", "))
+	restore.Status.MaintenanceSites = nil
+	return nil
+}
+
+// jobName returns the name of the Job that restores the backup of a DatabaseRestore
+func jobName(restore *fnv1alpha1.DatabaseRestore) string {
+	return "databaserestore-" + restore.Name
+}
@@ -0,0 +1,220 @@
+package databaserestore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/dbdump"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+const (
+	testNamespace = "wlgore"
+	testRestore   = "wlgore-restore"
+	testChecksum  = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+var (
+	testDatabase = &fnv1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgoredatabase", Namespace: testNamespace},
+		Spec: fnv1alpha1.DatabaseSpec{
+			Host:       "mysql.default.svc.cluster.local",
+			Port:       3306,
+			SchemaName: "wlgoredatabase",
+			User:       "wlgore",
+			UserSecret: "wlgore-user-secret",
+		},
+	}
+
+	testBackup = &fnv1alpha1.DatabaseBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-backup", Namespace: testNamespace},
+		Spec: fnv1alpha1.DatabaseBackupSpec{
+			Database: testDatabase.Name,
+			Target: fnv1alpha1.DatabaseDumpTarget{
+				S3:   &fnv1alpha1.S3Target{Bucket: "wlgore-backups", Endpoint: "http://minio:9000", CredentialsSecret: "minio"},
+				Path: "databases",
+			},
+		},
+		Status: fnv1alpha1.DatabaseBackupStatus{
+			Phase:    fnv1alpha1.DatabaseJobSucceeded,
+			File:     "databases/wlgore-backup.sql.gz",
+			Location: "s3://wlgore-backups/databases/wlgore-backup.sql.gz",
+			Checksum: testChecksum,
+		},
+	}
+)
+
+func newRestore(maintenance bool) *fnv1alpha1.DatabaseRestore {
+	return &fnv1alpha1.DatabaseRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: testRestore, Namespace: testNamespace},
+		Spec: fnv1alpha1.DatabaseRestoreSpec{
+			Backup:      testBackup.Name,
+			Database:    testDatabase.Name,
+			Maintenance: maintenance,
+		},
+	}
+}
+
+func newSite(name, database string, annotations map[string]string) *fnv1alpha1.Site {
+	return &fnv1alpha1.Site{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Annotations: annotations},
+		Spec:       fnv1alpha1.SiteSpec{Database: database},
+	}
+}
+
+func buildFakeReconcile(objects []runtime.Object) *ReconcileDatabaseRestore {
+	return &ReconcileDatabaseRestore{
+		client:   testhelpers.NewFakeClient(objects),
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
+	}
+}
+
+func TestDatabaseRestoreController(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	otherMaintenance := map[string]string{fnv1alpha1.MaintenanceAnnotation: "upgrade"}
+	r := buildFakeReconcile([]runtime.Object{
+		testDatabase,
+		testBackup,
+		newRestore(true),
+		newSite("wlgore-site", testDatabase.Name, nil),
+		newSite("wlgore-upgrading", testDatabase.Name, otherMaintenance),
+		newSite("other-site", "otherdatabase", nil),
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testRestore, Namespace: testNamespace}}
+	jobKey := types.NamespacedName{Name: "databaserestore-" + testRestore, Namespace: testNamespace}
+
+	getRestore := func(t *testing.T) *fnv1alpha1.DatabaseRestore {
+		restore := &fnv1alpha1.DatabaseRestore{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, restore))
+		return restore
+	}
+	siteAnnotations := func(t *testing.T, name string) map[string]string {
+		site := &fnv1alpha1.Site{}
+		require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, site))
+		return site.Annotations
+	}
+
+	t.Run("should add the maintenance finalizer", func(t *testing.T) {
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.True(t, res.Requeue)
+		require.True(t, common.HasFinalizer(getRestore(t), maintenanceFinalizer))
+	})
+
+	t.Run("should put the Sites into maintenance and start the restore Job", func(t *testing.T) {
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonSitesInMaintenance)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonRestoreStarted)
+
+		restore := getRestore(t)
+		require.Equal(t, fnv1alpha1.DatabaseJobRunning, restore.Status.Phase)
+		require.Equal(t, []string{"wlgore-site"}, restore.Status.MaintenanceSites)
+		require.Equal(t, restore.MaintenanceReason(), siteAnnotations(t, "wlgore-site")[fnv1alpha1.MaintenanceAnnotation])
+		require.Equal(t, otherMaintenance, siteAnnotations(t, "wlgore-upgrading"))
+		require.Empty(t, siteAnnotations(t, "other-site"))
+
+		job := &batchv1.Job{}
+		require.NoError(t, r.client.Get(context.TODO(), jobKey, job))
+		require.Equal(t, "DatabaseRestore", job.OwnerReferences[0].Kind)
+		pod := job.Spec.Template.Spec
+		require.Contains(t, pod.InitContainers[0].Env, corev1.EnvVar{Name: "S3_KEY", Value: "databases/wlgore-backup.sql.gz"})
+		require.Equal(t, dbdump.RestoreContainerName, pod.Containers[0].Name)
+		require.Contains(t, pod.Containers[0].Env, corev1.EnvVar{Name: "DUMP_CHECKSUM", Value: testChecksum})
+	})
+
+	t.Run("should release the Sites once the restore finished", func(t *testing.T) {
+		job := &batchv1.Job{}
+		require.NoError(t, r.client.Get(context.TODO(), jobKey, job))
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}}
+		require.NoError(t, r.client.Status().Update(context.TODO(), job))
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonSitesReleased)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonRestoreSucceeded)
+
+		restore := getRestore(t)
+		require.Equal(t, fnv1alpha1.DatabaseJobSucceeded, restore.Status.Phase)
+		require.Empty(t, restore.Status.MaintenanceSites)
+		require.NotNil(t, restore.Status.Duration)
+		require.Empty(t, siteAnnotations(t, "wlgore-site"))
+		require.Equal(t, otherMaintenance, siteAnnotations(t, "wlgore-upgrading"))
+	})
+}
+
+func TestDatabaseRestoreController_Deleted(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	restore := newRestore(true)
+	restore.Finalizers = []string{maintenanceFinalizer}
+	restore.Status = fnv1alpha1.DatabaseRestoreStatus{Phase: fnv1alpha1.DatabaseJobRunning, MaintenanceSites: []string{"wlgore-site"}}
+	now := metav1.Now()
+	restore.DeletionTimestamp = &now
+	site := newSite("wlgore-site", testDatabase.Name, map[string]string{fnv1alpha1.MaintenanceAnnotation: restore.MaintenanceReason()})
+
+	r := buildFakeReconcile([]runtime.Object{testDatabase, testBackup, restore, site})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testRestore, Namespace: testNamespace}}
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonSitesReleased)
+
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: site.Name, Namespace: testNamespace}, site))
+	require.NotContains(t, site.Annotations, fnv1alpha1.MaintenanceAnnotation)
+}
+
+func TestDatabaseRestoreController_BackupNotReady(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	tests := []struct {
+		name          string
+		backupPhase   fnv1alpha1.DatabaseJobPhase
+		expectedPhase fnv1alpha1.DatabaseJobPhase
+	}{
+		{
+			name:          "running backup",
+			backupPhase:   fnv1alpha1.DatabaseJobRunning,
+			expectedPhase: fnv1alpha1.DatabaseJobPending,
+		},
+		{
+			name:          "failed backup",
+			backupPhase:   fnv1alpha1.DatabaseJobFailed,
+			expectedPhase: fnv1alpha1.DatabaseJobFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backup := testBackup.DeepCopy()
+			backup.Status.Phase = test.backupPhase
+			r := buildFakeReconcile([]runtime.Object{testDatabase, backup, newRestore(false)})
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testRestore, Namespace: testNamespace}}
+
+			_, err := r.Reconcile(req)
+			require.NoError(t, err)
+
+			restore := &fnv1alpha1.DatabaseRestore{}
+			require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, restore))
+			require.Equal(t, test.expectedPhase, restore.Status.Phase)
+			require.Contains(t, restore.Status.Message, `DatabaseBackup "wlgore-backup"`)
+
+			jobs := &batchv1.JobList{}
+			require.NoError(t, r.client.List(context.TODO(), jobs))
+			require.Empty(t, jobs.Items)
+		})
+	}
+}
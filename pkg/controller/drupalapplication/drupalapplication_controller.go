@@ -7,9 +7,11 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -43,7 +45,16 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileDrupalApplication{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return NewReconciler(mgr.GetClient(), mgr.GetScheme(), mgr.GetEventRecorderFor("drupalapplication-controller"))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileDrupalApplication{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -86,8 +97,9 @@ var _ reconcile.Reconciler = &ReconcileDrupalApplication{}
 type ReconcileDrupalApplication struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 type requestHandler struct {
@@ -130,6 +142,10 @@ func (r *ReconcileDrupalApplication) Reconcile(request reconcile.Request) (recon
 		return reconcile.Result{Requeue: true}, nil
 	}
 
+	if rh.app.GetDeletionTimestamp() != nil {
+		return rh.finalize()
+	}
+
 	if rh.app.Spec.ImageRepo == "" {
 		rh.app.Spec.ImageRepo = customercontainer.ECRRepoURIFromGitRepoURL(rh.app.Spec.GitRepo)
 
@@ -137,6 +153,7 @@ func (r *ReconcileDrupalApplication) Reconcile(request reconcile.Request) (recon
 		if err := r.client.Update(context.TODO(), rh.app); err != nil {
 			return reconcile.Result{}, err
 		}
+		r.recorder.Eventf(rh.app, corev1.EventTypeNormal, common.ReasonImageRepoSet, "Set ImageRepo to %q based on GitRepo", rh.app.Spec.ImageRepo)
 		return reconcile.Result{Requeue: true}, nil
 	}
 
@@ -155,6 +172,12 @@ func (r *ReconcileDrupalApplication) Reconcile(request reconcile.Request) (recon
 		return reconcile.Result{Requeue: true}, nil
 	}
 
+	// Provision the declared environments, and tear down the ones no longer declared
+	result, err := rh.reconcileProvisionedEnvironments()
+	if err != nil || result.Requeue {
+		return result, err
+	}
+
 	// Find all DrupalEnvironments with this Application ID
 	drenvList := &fnv1alpha1.DrupalEnvironmentList{}
 	labels := map[string]string{fnv1alpha1.ApplicationIdLabel: string(rh.app.Id())}
@@ -191,7 +214,8 @@ func (r *ReconcileDrupalApplication) Reconcile(request reconcile.Request) (recon
 			rh.logger.Error(err, "Failed to Update DrupalApplication")
 			return reconcile.Result{}, err
 		}
+		r.recorder.Eventf(rh.app, corev1.EventTypeNormal, common.ReasonEnvironmentsChanged, "DrupalApplication has %d DrupalEnvironments", count)
 	}
 
-	return reconcile.Result{}, nil
+	return result, nil
 }
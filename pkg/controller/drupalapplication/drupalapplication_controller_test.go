@@ -7,9 +7,11 @@ import (
 	"testing"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 	goldenHelper "github.com/acquia/fn-go-utils/pkg/testhelpers"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -118,6 +120,7 @@ func TestApplicationController_ReconcileWithEnvironment(t *testing.T) {
 		require.NoError(t, err)
 
 		require.Equal(t, "881217801864.dkr.ecr.us-east-1.amazonaws.com/customer/svn-2.archteam.srvs.ahdev.co/nebula", drupalApp.Spec.ImageRepo)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonImageRepoSet)
 	})
 
 	t.Run("should set git repo label", func(t *testing.T) {
@@ -146,6 +149,7 @@ func TestApplicationController_ReconcileWithEnvironment(t *testing.T) {
 		drupalApp := &fnv1alpha1.DrupalApplication{}
 		r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalApp)
 		require.Equal(t, drupalApp.Status.NumEnvironments, int32(2))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonEnvironmentsChanged)
 	})
 
 	t.Run("should have Sorted DrupalEnvironments", func(t *testing.T) {
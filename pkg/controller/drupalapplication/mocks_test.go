@@ -1,19 +1,23 @@
 package drupalapplication
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 )
 
 const (
-	testNamespace = "wlgore-app"
-	testAppName   = "wlgore-app"
-	testImageRepo = "881217801864.dkr.ecr.us-east-1.amazonaws.com/kpoc/default"
-	testGitRepo   = "nebula@svn-2.archteam.srvs.ahdev.co:nebula.git"
+	testOperatorNamespace = "acquia-polaris-system"
+	testPullSecretName    = "registry"
+	testNamespace         = "wlgore-app"
+	testAppName           = "wlgore-app"
+	testImageRepo         = "881217801864.dkr.ecr.us-east-1.amazonaws.com/kpoc/default"
+	testGitRepo           = "nebula@svn-2.archteam.srvs.ahdev.co:nebula.git"
 )
 
 var testAppID = "d8de5846-fbec-4a35-b888-aed09bb1733b"
@@ -73,6 +77,40 @@ var (
 		},
 		Spec: fnv1alpha1.DrupalEnvironmentSpec{},
 	}
+
+	drupalApplicationWithEnvironments = &fnv1alpha1.DrupalApplication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: testAppName,
+			Labels: map[string]string{
+				fnv1alpha1.ApplicationIdLabel: testAppID,
+				fnv1alpha1.GitRepoLabel:       common.HashValueForLabel(testGitRepo),
+			},
+		},
+		Spec: fnv1alpha1.DrupalApplicationSpec{
+			ImageRepo: testImageRepo,
+			GitRepo:   testGitRepo,
+			Environments: []fnv1alpha1.ProvisionedEnvironment{
+				{
+					Name:                 testNamespace + "-dev",
+					NamespaceLabels:      map[string]string{"team": "wlgore"},
+					NamespaceAnnotations: map[string]string{"owner": "wlgore@example.com"},
+					Spec: fnv1alpha1.DrupalEnvironmentSpec{
+						GitRef: "master",
+						Stage:  "dev",
+					},
+				},
+			},
+		},
+	}
+
+	testPullSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testOperatorNamespace,
+			Name:      testPullSecretName,
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}
 )
 
 // buildFakeReconcile return reconcile with fake client, schemes and runtime objects
@@ -81,7 +119,8 @@ func buildFakeReconcile(objects []runtime.Object) *ReconcileDrupalApplication {
 
 	// create a ReconcileDrupalApplication object with the scheme and fake client
 	return &ReconcileDrupalApplication{
-		client: client,
-		scheme: scheme.Scheme,
+		client:   client,
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
 	}
 }
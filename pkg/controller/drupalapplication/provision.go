@@ -0,0 +1,316 @@
+package drupalapplication
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+const (
+	// provisionFinalizer holds a DrupalApplication until the namespaces provisioned for it are torn down
+	provisionFinalizer = "drupalapplications.fnresources.acquia.io/provisioned-environments"
+
+	// teardownRequeueDelay is how often the teardown of provisioned namespaces is checked on
+	teardownRequeueDelay = 10 * time.Second
+)
+
+// provisionedLabels returns the labels of the namespaces and DrupalEnvironments provisioned for the DrupalApplication
+func (rh *requestHandler) provisionedLabels() map[string]string {
+	return map[string]string{
+		fnv1alpha1.ApplicationIdLabel: string(rh.app.Id()),
+		fnv1alpha1.ProvisionedLabel:   "true",
+	}
+}
+
+// isProvisioned returns whether the object was provisioned for the DrupalApplication
+func (rh *requestHandler) isProvisioned(obj metav1.Object) bool {
+	labels := obj.GetLabels()
+	return labels[fnv1alpha1.ApplicationIdLabel] == string(rh.app.Id()) && labels[fnv1alpha1.ProvisionedLabel] == "true"
+}
+
+// provisionedNamespaces lists the namespaces provisioned for the DrupalApplication, including ones being deleted
+func (rh *requestHandler) provisionedNamespaces() ([]corev1.Namespace, error) {
+	namespaces := &corev1.NamespaceList{}
+	err := rh.reconciler.client.List(context.TODO(), namespaces, client.MatchingLabels(rh.provisionedLabels()))
+	if err != nil {
+		rh.logger.Error(err, "Failed to list provisioned namespaces")
+		return nil, err
+	}
+	return namespaces.Items, nil
+}
+
+// reconcileProvisionedEnvironments provisions the environments declared by the DrupalApplication, and tears down the
+// namespaces of the ones that no longer are
+func (rh *requestHandler) reconcileProvisionedEnvironments() (result reconcile.Result, err error) {
+	if len(rh.app.Spec.Environments) > 0 {
+		if requeue, err := rh.addFinalizer(); requeue || err != nil {
+			return reconcile.Result{Requeue: requeue}, err
+		}
+	}
+
+	declared := make(map[string]bool, len(rh.app.Spec.Environments))
+	for i := range rh.app.Spec.Environments {
+		declared[rh.app.Spec.Environments[i].Name] = true
+		if err = rh.provisionEnvironment(&rh.app.Spec.Environments[i]); err != nil {
+			return
+		}
+	}
+
+	namespaces, err := rh.provisionedNamespaces()
+	if err != nil {
+		return
+	}
+	for i := range namespaces {
+		if declared[namespaces[i].Name] {
+			continue
+		}
+		// Kept namespaces are checked on again too, to be deleted once they're empty
+		if _, err = rh.teardownNamespace(&namespaces[i]); err != nil {
+			return
+		}
+		result.RequeueAfter = teardownRequeueDelay
+	}
+	return
+}
+
+// provisionEnvironment applies the namespace of a declared environment, its image pull Secrets and its
+// DrupalEnvironment. Namespaces that weren't provisioned for the DrupalApplication are left alone.
+func (rh *requestHandler) provisionEnvironment(penv *fnv1alpha1.ProvisionedEnvironment) error {
+	r := rh.reconciler
+	logger := rh.logger.WithValues("Environment", penv.Name)
+
+	existing := &corev1.Namespace{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: penv.Name}, existing)
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		logger.Error(err, "Failed to get namespace")
+		return err
+	case !rh.isProvisioned(existing):
+		logger.Info("Namespace already exists, but wasn't provisioned for this DrupalApplication")
+		r.recorder.Eventf(rh.app, corev1.EventTypeWarning, common.ReasonNamespaceConflict, "Namespace %q already exists, but wasn't provisioned for this DrupalApplication", penv.Name)
+		return nil
+	case existing.GetDeletionTimestamp() != nil:
+		// Wait for the namespace of an environment that was removed and declared again to be deleted
+		logger.Info("Waiting for namespace to be deleted before provisioning it again")
+		return nil
+	}
+
+	op, err := common.Apply(r.client, r.scheme, rh.namespaceFor(penv))
+	if err != nil {
+		logger.Error(err, "Failed to apply namespace")
+		return err
+	}
+	if op == controllerutil.OperationResultCreated {
+		r.recorder.Eventf(rh.app, corev1.EventTypeNormal, common.ReasonNamespaceProvisioned, "Provisioned namespace %q", penv.Name)
+	}
+
+	if err = rh.provisionPullSecrets(penv.Name); err != nil {
+		logger.Error(err, "Failed to provision image pull Secrets")
+		return err
+	}
+
+	env := &fnv1alpha1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: penv.Name,
+			Name:      penv.Name,
+			Labels:    rh.provisionedLabels(),
+		},
+		Spec: *penv.Spec.DeepCopy(),
+	}
+	env.Spec.Application = rh.app.Name
+
+	if op, err = common.Apply(r.client, r.scheme, env); err != nil {
+		logger.Error(err, "Failed to apply DrupalEnvironment")
+		return err
+	}
+	if op == controllerutil.OperationResultCreated {
+		r.recorder.Eventf(rh.app, corev1.EventTypeNormal, common.ReasonEnvironmentProvisioned, "Provisioned DrupalEnvironment %q", penv.Name)
+	}
+	return nil
+}
+
+// namespaceFor returns the namespace of a declared environment, with the operator's standard labels on top of the
+// declared ones
+func (rh *requestHandler) namespaceFor(penv *fnv1alpha1.ProvisionedEnvironment) *corev1.Namespace {
+	labels := make(map[string]string, len(penv.NamespaceLabels)+4)
+	for k, v := range penv.NamespaceLabels {
+		labels[k] = v
+	}
+	for k, v := range rh.provisionedLabels() {
+		labels[k] = v
+	}
+	labels[fnv1alpha1.StageLabel] = penv.Spec.Stage
+	// NetworkPolicy namespace selectors conventionally match on the "name" label
+	labels["name"] = penv.Name
+
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        penv.Name,
+			Labels:      labels,
+			Annotations: penv.NamespaceAnnotations,
+		},
+	}
+}
+
+// provisionPullSecrets copies the operator's namespace pull Secrets to the given namespace, and has its default
+// ServiceAccount, which runs the Drupal Pods, use them
+func (rh *requestHandler) provisionPullSecrets(namespace string) error {
+	r := rh.reconciler
+	names := common.NamespacePullSecrets()
+	if len(names) == 0 {
+		return nil
+	}
+
+	refs := make([]corev1.LocalObjectReference, len(names))
+	for i, name := range names {
+		src := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: common.OperatorNamespace(), Name: name}, src)
+		if err != nil {
+			return err
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels:    rh.provisionedLabels(),
+			},
+			Type: src.Type,
+			Data: src.Data,
+		}
+		if _, err = common.Apply(r.client, r.scheme, secret); err != nil {
+			return err
+		}
+		refs[i].Name = name
+	}
+
+	sa := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Namespace: namespace, Name: "default"},
+		ImagePullSecrets: refs,
+	}
+	_, err := common.Apply(r.client, r.scheme, sa)
+	return err
+}
+
+// teardownNamespace deletes a provisioned namespace that's no longer declared, and returns whether its teardown is
+// done. Its provisioned DrupalEnvironments are deleted first, so that their finalizers can run. The namespace itself is
+// kept if other DrupalEnvironments, Sites or Databases are left in it, since deleting those would take customer data
+// along, or if a provisioned DrupalEnvironment is protected from deletion. The teardown of a kept namespace is done.
+func (rh *requestHandler) teardownNamespace(ns *corev1.Namespace) (done bool, err error) {
+	r := rh.reconciler
+	logger := rh.logger.WithValues("Namespace", ns.Name)
+	if ns.GetDeletionTimestamp() != nil {
+		return false, nil
+	}
+
+	envs := &fnv1alpha1.DrupalEnvironmentList{}
+	if err := r.client.List(context.TODO(), envs, client.InNamespace(ns.Name)); err != nil {
+		logger.Error(err, "Failed to list DrupalEnvironments")
+		return false, err
+	}
+	deleting, protected, others := 0, 0, 0
+	for i := range envs.Items {
+		env := &envs.Items[i]
+		switch {
+		case !rh.isProvisioned(env):
+			others++
+			continue
+		case env.GetDeletionTimestamp() != nil:
+			deleting++
+			continue
+		}
+		if err := fnv1alpha1.ValidateDeletion(env); err != nil {
+			logger.Info("Not deleting protected DrupalEnvironment", "DrupalEnvironment", env.Name)
+			r.recorder.Eventf(rh.app, corev1.EventTypeWarning, common.ReasonEnvironmentProtected, "Not deleting DrupalEnvironment %q, nor its namespace: %v", env.Name, err)
+			protected++
+			continue
+		}
+
+		logger.Info("Deleting provisioned DrupalEnvironment", "DrupalEnvironment", env.Name)
+		if err := r.client.Delete(context.TODO(), env); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete DrupalEnvironment", "DrupalEnvironment", env.Name)
+			return false, err
+		}
+		r.recorder.Eventf(rh.app, corev1.EventTypeNormal, common.ReasonEnvironmentDeprovisioned, "Deleted DrupalEnvironment %q", env.Name)
+		deleting++
+	}
+	if deleting > 0 {
+		// Wait for the provisioned DrupalEnvironments to be gone
+		return false, nil
+	}
+	if protected > 0 {
+		return true, nil
+	}
+
+	sites := &fnv1alpha1.SiteList{}
+	if err := r.client.List(context.TODO(), sites, client.InNamespace(ns.Name)); err != nil {
+		logger.Error(err, "Failed to list Sites")
+		return false, err
+	}
+	databases := &fnv1alpha1.DatabaseList{}
+	if err := r.client.List(context.TODO(), databases, client.InNamespace(ns.Name)); err != nil {
+		logger.Error(err, "Failed to list Databases")
+		return false, err
+	}
+	if others > 0 || len(sites.Items) > 0 || len(databases.Items) > 0 {
+		logger.Info("Not deleting namespace, which still holds DrupalEnvironments, Sites or Databases")
+		r.recorder.Eventf(rh.app, corev1.EventTypeWarning, common.ReasonNamespaceNotEmpty, "Not deleting namespace %q, which still holds %d DrupalEnvironments, %d Sites and %d Databases", ns.Name, others, len(sites.Items), len(databases.Items))
+		return true, nil
+	}
+
+	logger.Info("Deleting provisioned namespace")
+	if err := r.client.Delete(context.TODO(), ns); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to delete namespace")
+		return false, err
+	}
+	r.recorder.Eventf(rh.app, corev1.EventTypeNormal, common.ReasonNamespaceDeleted, "Deleted namespace %q", ns.Name)
+	return false, nil
+}
+
+// finalize tears down the namespaces provisioned for the DrupalApplication, then removes its finalizer
+func (rh *requestHandler) finalize() (reconcile.Result, error) {
+	namespaces, err := rh.provisionedNamespaces()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	pending := false
+	for i := range namespaces {
+		done, err := rh.teardownNamespace(&namespaces[i])
+		if err != nil {
+			rh.reconciler.recorder.Eventf(rh.app, corev1.EventTypeWarning, common.ReasonFinalizerBlocked, "Failed to tear down namespace %q: %v", namespaces[i].Name, err)
+			return reconcile.Result{}, err
+		}
+		pending = pending || !done
+	}
+	if pending {
+		return reconcile.Result{RequeueAfter: teardownRequeueDelay}, nil
+	}
+
+	if common.HasFinalizer(rh.app, provisionFinalizer) {
+		rh.logger.Info("Removing finalizer")
+		controllerutil.RemoveFinalizer(rh.app, provisionFinalizer)
+		return reconcile.Result{}, rh.reconciler.client.Update(context.TODO(), rh.app)
+	}
+	return reconcile.Result{}, nil
+}
+
+// addFinalizer adds a finalizer to the DrupalApplication, to tear down the namespaces provisioned for it
+func (rh *requestHandler) addFinalizer() (requeue bool, err error) {
+	if !common.HasFinalizer(rh.app, provisionFinalizer) {
+		rh.logger.Info("Adding finalizer")
+		controllerutil.AddFinalizer(rh.app, provisionFinalizer)
+		return true, rh.reconciler.client.Update(context.TODO(), rh.app)
+	}
+	return false, nil
+}
@@ -0,0 +1,201 @@
+package drupalapplication
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+// reconcileUntilDone reconciles until no immediate requeue is requested, and returns the last result
+func reconcileUntilDone(t *testing.T, r *ReconcileDrupalApplication, req reconcile.Request) (result reconcile.Result) {
+	for i := 0; i < 10; i++ {
+		var err error
+		result, err = r.Reconcile(req)
+		require.NoError(t, err)
+		if !result.Requeue {
+			return
+		}
+	}
+	require.FailNow(t, "Reconcile still requeued after 10 passes")
+	return
+}
+
+func TestApplicationController_ProvisionsEnvironments(t *testing.T) {
+	common.SetOperatorNamespace_ForTestsOnly(testOperatorNamespace)
+	common.SetNamespacePullSecrets_ForTestsOnly([]string{testPullSecretName})
+	defer common.SetOperatorNamespace_ForTestsOnly("")
+	defer common.SetNamespacePullSecrets_ForTestsOnly(nil)
+
+	conflictingNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace + "-test"}}
+	app := drupalApplicationWithEnvironments.DeepCopy()
+	app.Spec.Environments = append(app.Spec.Environments, fnv1alpha1.ProvisionedEnvironment{
+		Name: conflictingNamespace.Name,
+		Spec: fnv1alpha1.DrupalEnvironmentSpec{Stage: "test"},
+	})
+
+	r := buildFakeReconcile([]runtime.Object{app, testPullSecret, conflictingNamespace})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: app.Name}}
+	envName := testNamespace + "-dev"
+
+	get := func(obj runtime.Object, namespace, name string) error {
+		return r.client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, obj)
+	}
+
+	t.Run("should provision the namespace and DrupalEnvironment", func(t *testing.T) {
+		reconcileUntilDone(t, r, req)
+
+		ns := &corev1.Namespace{}
+		require.NoError(t, get(ns, "", envName))
+		require.Equal(t, map[string]string{
+			"team":                        "wlgore",
+			"name":                        envName,
+			fnv1alpha1.ApplicationIdLabel: testAppID,
+			fnv1alpha1.ProvisionedLabel:   "true",
+			fnv1alpha1.StageLabel:         "dev",
+		}, ns.Labels)
+		require.Equal(t, "wlgore@example.com", ns.Annotations["owner"])
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonNamespaceProvisioned)
+
+		env := &fnv1alpha1.DrupalEnvironment{}
+		require.NoError(t, get(env, envName, envName))
+		require.Equal(t, app.Name, env.Spec.Application)
+		require.Equal(t, "master", env.Spec.GitRef)
+		require.Equal(t, "true", env.Labels[fnv1alpha1.ProvisionedLabel])
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonEnvironmentProvisioned)
+
+		secret := &corev1.Secret{}
+		require.NoError(t, get(secret, envName, testPullSecretName))
+		require.Equal(t, testPullSecret.Data, secret.Data)
+		sa := &corev1.ServiceAccount{}
+		require.NoError(t, get(sa, envName, "default"))
+		require.Equal(t, []corev1.LocalObjectReference{{Name: testPullSecretName}}, sa.ImagePullSecrets)
+
+		drupalApp := &fnv1alpha1.DrupalApplication{}
+		require.NoError(t, get(drupalApp, "", app.Name))
+		require.Contains(t, drupalApp.Finalizers, provisionFinalizer)
+	})
+
+	t.Run("should not take over an existing namespace", func(t *testing.T) {
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonNamespaceConflict)
+
+		ns := &corev1.Namespace{}
+		require.NoError(t, get(ns, "", conflictingNamespace.Name))
+		require.Empty(t, ns.Labels)
+		require.True(t, errors.IsNotFound(get(&fnv1alpha1.DrupalEnvironment{}, conflictingNamespace.Name, conflictingNamespace.Name)))
+	})
+
+	t.Run("should keep the namespace of a removed environment while it holds Sites", func(t *testing.T) {
+		site := &fnv1alpha1.Site{ObjectMeta: metav1.ObjectMeta{Namespace: envName, Name: "wlgore-site"}}
+		require.NoError(t, r.client.Create(context.TODO(), site))
+
+		drupalApp := &fnv1alpha1.DrupalApplication{}
+		require.NoError(t, get(drupalApp, "", app.Name))
+		drupalApp.Spec.Environments = nil
+		require.NoError(t, r.client.Update(context.TODO(), drupalApp))
+
+		result := reconcileUntilDone(t, r, req)
+		require.NotZero(t, result.RequeueAfter)
+		result = reconcileUntilDone(t, r, req)
+		require.NotZero(t, result.RequeueAfter)
+
+		require.True(t, errors.IsNotFound(get(&fnv1alpha1.DrupalEnvironment{}, envName, envName)))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonEnvironmentDeprovisioned)
+		require.NoError(t, get(&corev1.Namespace{}, "", envName))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonNamespaceNotEmpty)
+
+		require.NoError(t, r.client.Delete(context.TODO(), site))
+		reconcileUntilDone(t, r, req)
+
+		require.True(t, errors.IsNotFound(get(&corev1.Namespace{}, "", envName)))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonNamespaceDeleted)
+		require.NoError(t, get(&corev1.Namespace{}, "", conflictingNamespace.Name))
+	})
+}
+
+func TestApplicationController_TearsDownProvisionedEnvironmentsOnDeletion(t *testing.T) {
+	app := drupalApplicationWithEnvironments.DeepCopy()
+	r := buildFakeReconcile([]runtime.Object{app})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: app.Name}}
+	envName := testNamespace + "-dev"
+
+	reconcileUntilDone(t, r, req)
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, &corev1.Namespace{}))
+
+	drupalApp := &fnv1alpha1.DrupalApplication{}
+	require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, drupalApp))
+	now := metav1.Now()
+	drupalApp.DeletionTimestamp = &now
+	require.NoError(t, r.client.Update(context.TODO(), drupalApp))
+
+	// The first pass deletes the DrupalEnvironment, the next one its namespace, and the last one the finalizer
+	for i := 0; i < 3; i++ {
+		reconcileUntilDone(t, r, req)
+	}
+
+	require.True(t, errors.IsNotFound(r.client.Get(context.TODO(), types.NamespacedName{Name: envName}, &corev1.Namespace{})))
+	require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, drupalApp))
+	require.NotContains(t, drupalApp.Finalizers, provisionFinalizer)
+}
+
+func TestApplicationController_FinalizesWithoutDeletingKeptEnvironments(t *testing.T) {
+	app := drupalApplicationWithEnvironments.DeepCopy()
+	app.Spec.Environments[0].Spec.Production = true
+	app.Spec.Environments = append(app.Spec.Environments, fnv1alpha1.ProvisionedEnvironment{
+		Name: testNamespace + "-test",
+		Spec: fnv1alpha1.DrupalEnvironmentSpec{Stage: "test"},
+	})
+	r := buildFakeReconcile([]runtime.Object{app})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: app.Name}}
+	prodName := testNamespace + "-dev"
+	testName := testNamespace + "-test"
+
+	get := func(obj runtime.Object, namespace, name string) error {
+		return r.client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, obj)
+	}
+
+	reconcileUntilDone(t, r, req)
+
+	// A DrupalEnvironment the DrupalApplication didn't provision
+	other := &fnv1alpha1.DrupalEnvironment{ObjectMeta: metav1.ObjectMeta{Namespace: testName, Name: "other"}}
+	require.NoError(t, r.client.Create(context.TODO(), other))
+
+	drupalApp := &fnv1alpha1.DrupalApplication{}
+	require.NoError(t, get(drupalApp, "", app.Name))
+	now := metav1.Now()
+	drupalApp.DeletionTimestamp = &now
+	require.NoError(t, r.client.Update(context.TODO(), drupalApp))
+
+	// The first pass deletes the unprotected DrupalEnvironment, and the next one removes the finalizer
+	for i := 0; i < 2; i++ {
+		reconcileUntilDone(t, r, req)
+	}
+
+	t.Run("should not delete a protected DrupalEnvironment", func(t *testing.T) {
+		require.NoError(t, get(&fnv1alpha1.DrupalEnvironment{}, prodName, prodName))
+		require.NoError(t, get(&corev1.Namespace{}, "", prodName))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonEnvironmentProtected)
+	})
+
+	t.Run("should keep the namespace of DrupalEnvironments it didn't provision", func(t *testing.T) {
+		require.True(t, errors.IsNotFound(get(&fnv1alpha1.DrupalEnvironment{}, testName, testName)))
+		require.NoError(t, get(&fnv1alpha1.DrupalEnvironment{}, testName, other.Name))
+		require.NoError(t, get(&corev1.Namespace{}, "", testName))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonNamespaceNotEmpty)
+	})
+
+	t.Run("should remove the finalizer", func(t *testing.T) {
+		require.NoError(t, get(drupalApp, "", app.Name))
+		require.NotContains(t, drupalApp.Finalizers, provisionFinalizer)
+	})
+}
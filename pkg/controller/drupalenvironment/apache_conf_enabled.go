@@ -5,26 +5,18 @@ import (
 
 	"github.com/acquia/fn-drupal-operator/pkg/customercontainer"
 	v1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // reconcileApacheConfEnabledConfigMap reconciles the "apache-conf-enabled" ConfigMap for the requested
 // DrupalEnvironment. This ConfigMap contains ".conf" files that will be enabled on the Apache container.
-func (rh *requestHandler) reconcileApacheConfEnabledConfigMap() (result reconcile.Result, err error) {
+func (rh *requestHandler) reconcileApacheConfEnabledConfigMap() (changed bool, err error) {
 	environmentVariables := customercontainer.EnvironmentVariables(rh.env)
 
 	environmentVariableNames := environmentVariableNames(environmentVariables)
 
-	var requeue bool
-	requeue, err = rh.reconcileConfigMap("apache-conf-enabled", map[string]string{
+	return rh.reconcileConfigMap(apacheConfEnabledConfigMapName, map[string]string{
 		"passenv.conf": "PassEnv " + strings.Join(environmentVariableNames, " "),
 	})
-
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	return
 }
 
 func environmentVariableNames(environmentVariables []v1.EnvVar) []string {
@@ -0,0 +1,101 @@
+package drupalenvironment
+
+import (
+	"context"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
+)
+
+// drupalConfigMapNames are the components of the ConfigMaps holding configuration files that Drupal Pods only read at
+// startup
+var drupalConfigMapNames = []string{phpConfigMapName, phpfpmConfigMapName, apacheConfEnabledConfigMapName}
+
+// computeConfigHash hashes the rendered contents of all configuration that Drupal Pods only read at startup: the config
+// file ConfigMaps, the "env-config" Secret, and any Secrets referenced by the DrupalEnvironment. The hash is set as a
+// Pod annotation, so that any change triggers a (blue-green) rollout of new Pods. The environment's own ConfigMaps and
+// Secret are hashed by component, so that the hash doesn't depend on the environment's name.
+func (rh *requestHandler) computeConfigHash() (string, error) {
+	c := rh.reconciler.client
+	var values []interface{}
+
+	for _, name := range drupalConfigMapNames {
+		// Prefer the data applied earlier in this pass, since the cache may not have caught up with it yet
+		if data, ok := rh.appliedConfigMaps[name]; ok {
+			values = append(values, name, data)
+			continue
+		}
+		cm := &v1.ConfigMap{}
+		err := c.Get(context.TODO(), types.NamespacedName{Namespace: rh.namespace, Name: rh.env.ChildName(name)}, cm)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		values = append(values, name, cm.Data)
+	}
+
+	keys := append([]string{envconfig.SecretComponent}, referencedSecretNames(rh.env)...)
+	names := append([]string{envconfig.SecretName(rh.env.Name)}, referencedSecretNames(rh.env)...)
+	for i, name := range names {
+		secret := &v1.Secret{}
+		err := c.Get(context.TODO(), types.NamespacedName{Namespace: rh.namespace, Name: name}, secret)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		values = append(values, keys[i], secret.Data)
+	}
+
+	return common.HashValueOf(values...), nil
+}
+
+// referencedSecretNames returns the sorted names of the (non-owned) Secrets referenced by a DrupalEnvironment
+func referencedSecretNames(env *fnv1alpha1.DrupalEnvironment) []string {
+	names := map[string]bool{}
+	for _, envVar := range env.Spec.CustomEnvironmentVariables {
+		if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil {
+			names[envVar.ValueFrom.SecretKeyRef.Name] = true
+		}
+	}
+	if env.Spec.Phpfpm.Apm.Secret != "" {
+		names[env.Spec.Phpfpm.Apm.Secret] = true
+	}
+
+	var list []string
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// referencingEnvironments returns a mapping from a Secret to the DrupalEnvironments in its namespace that reference it
+func referencingEnvironments(c client.Client) handler.ToRequestsFunc {
+	return func(o handler.MapObject) (requests []reconcile.Request) {
+		envs := &fnv1alpha1.DrupalEnvironmentList{}
+		if err := c.List(context.TODO(), envs, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list DrupalEnvironments", "Namespace", o.Meta.GetNamespace())
+			return nil
+		}
+
+		for i := range envs.Items {
+			env := &envs.Items[i]
+			for _, name := range referencedSecretNames(env) {
+				if name == o.Meta.GetName() {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{Namespace: env.Namespace, Name: env.Name},
+					})
+					break
+				}
+			}
+		}
+		return
+	}
+}
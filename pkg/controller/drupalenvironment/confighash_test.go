@@ -0,0 +1,135 @@
+package drupalenvironment
+
+import (
+	"context"
+	"testing"
+
+	rolloutsv1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
+)
+
+const testCustomSecretName = "custom-env"
+
+var testCustomSecret = &v1.Secret{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      testCustomSecretName,
+		Namespace: testNonProdNamespace,
+	},
+	Data: map[string][]byte{
+		"api-key": []byte("abc123"),
+	},
+}
+
+func environmentWithSecretEnvVar() *fnv1alpha1.DrupalEnvironment {
+	env := drupalEnvironmentWithNonProdValues.DeepCopy()
+	env.Spec.CustomEnvironmentVariables = append(env.Spec.CustomEnvironmentVariables, v1.EnvVar{
+		Name: "API_KEY",
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: testCustomSecretName},
+				Key:                  "api-key",
+			},
+		},
+	})
+	return env
+}
+
+func Test_referencedSecretNames(t *testing.T) {
+	require.Equal(t, []string{testCustomSecretName, testNewRelicSecretName}, referencedSecretNames(environmentWithSecretEnvVar()))
+
+	env := drupalEnvironmentWithNonProdValues.DeepCopy()
+	env.Spec.Phpfpm.Apm = fnv1alpha1.SpecAPM{}
+	require.Empty(t, referencedSecretNames(env))
+}
+
+func Test_referencingEnvironments(t *testing.T) {
+	env := environmentWithSecretEnvVar()
+	r := buildFakeReconcile([]runtime.Object{env, testCustomSecret})
+	toRequests := referencingEnvironments(r.client)
+
+	requests := toRequests(handler.MapObject{Meta: testCustomSecret, Object: testCustomSecret})
+	require.Equal(t, []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Namespace: env.Namespace, Name: env.Name},
+	}}, requests)
+
+	other := testCustomSecret.DeepCopy()
+	other.Name = "unrelated"
+	require.Empty(t, toRequests(handler.MapObject{Meta: other, Object: other}))
+}
+
+func TestReconcileDrupalEnvironment_ConfigHash(t *testing.T) {
+	nonProdSshConfigMap := testSshAuthorizedKeysConfigMap.DeepCopy()
+	nonProdSshConfigMap.Namespace = testNonProdNamespace
+
+	env := environmentWithSecretEnvVar()
+	objects := []runtime.Object{
+		env,
+		testNonProdNamespaceResource,
+		drupalApplicationWithID,
+		testNonProdNewRelicSecret,
+		testCustomSecret,
+		nonProdSshConfigMap,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      env.Name,
+			Namespace: env.Namespace,
+		},
+	}
+
+	configHash := func() string {
+		rollout := &rolloutsv1alpha1.Rollout{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithNonProdValues.ChildName(drupalRolloutName), Namespace: testNonProdNamespace}, rollout)
+		require.NoError(t, err)
+		return rollout.Spec.Template.Annotations[fnv1alpha1.ConfigHashAnnotation]
+	}
+
+	reconcileUntilDone(t, r, req)
+	before := configHash()
+	require.NotEmpty(t, before)
+
+	t.Run("should not change without configuration changes", func(t *testing.T) {
+		reconcileUntilDone(t, r, req)
+		require.Equal(t, before, configHash())
+	})
+
+	t.Run("should change when a referenced Secret changes", func(t *testing.T) {
+		secret := &v1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: testCustomSecretName, Namespace: testNonProdNamespace}, secret)
+		require.NoError(t, err)
+
+		secret.Data["api-key"] = []byte("def456")
+		err = r.client.Update(context.TODO(), secret)
+		require.NoError(t, err)
+
+		reconcileUntilDone(t, r, req)
+		require.NotEqual(t, before, configHash())
+	})
+
+	t.Run("should change when the env-config Secret changes", func(t *testing.T) {
+		before := configHash()
+
+		secret := &v1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithNonProdValues.ChildName(envconfig.SecretComponent), Namespace: testNonProdNamespace}, secret)
+		require.NoError(t, err)
+
+		secret.Data["default.settings.inc"] = []byte("<?php\n")
+		err = r.client.Update(context.TODO(), secret)
+		require.NoError(t, err)
+
+		reconcileUntilDone(t, r, req)
+		require.NotEqual(t, before, configHash())
+	})
+}
@@ -0,0 +1,82 @@
+package drupalenvironment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+func TestReconcileDrupalEnvironment_Drift(t *testing.T) {
+	objects := []runtime.Object{
+		drupalEnvironmentWithNonProdValues,
+		testNonProdNamespaceResource,
+		drupalApplicationWithID,
+		testNonProdNewRelicSecret,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      drupalEnvironmentWithNonProdValues.Name,
+			Namespace: drupalEnvironmentWithNonProdValues.Namespace,
+		},
+	}
+	reconcileUntilDone(t, r, req)
+
+	serviceKey := types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(drupalServiceName)}
+	// editService changes the port of the drupal Service by hand, with the given drift policy
+	editService := func(policy common.DriftPolicy) {
+		svc := &v1.Service{}
+		require.NoError(t, r.client.Get(context.TODO(), serviceKey, svc))
+		svc.Spec.Ports[0].Port = 8080
+		svc.Annotations = map[string]string{fnv1alpha1.DriftPolicyAnnotation: string(policy)}
+		require.NoError(t, r.client.Update(context.TODO(), svc))
+	}
+	servicePort := func() int32 {
+		svc := &v1.Service{}
+		require.NoError(t, r.client.Get(context.TODO(), serviceKey, svc))
+		return svc.Spec.Ports[0].Port
+	}
+	driftedCondition := func() *fnv1alpha1.Condition {
+		env := &fnv1alpha1.DrupalEnvironment{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, env))
+		require.NotEmpty(t, env.Status.AppliedResources)
+		return fnv1alpha1.FindCondition(env.Status.Conditions, fnv1alpha1.DriftedCondition)
+	}
+
+	t.Run("should record that nothing drifted", func(t *testing.T) {
+		cond := driftedCondition()
+		require.NotNil(t, cond)
+		require.Equal(t, v1.ConditionFalse, cond.Status)
+	})
+
+	t.Run("should revert changes made by hand", func(t *testing.T) {
+		editService(common.DriftPolicyRevert)
+		reconcileUntilDone(t, r, req)
+
+		require.Equal(t, int32(80), servicePort())
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeNormal, common.ReasonDriftReverted)
+		require.Equal(t, v1.ConditionFalse, driftedCondition().Status)
+	})
+
+	t.Run("should report changes made by hand with the report policy", func(t *testing.T) {
+		editService(common.DriftPolicyReport)
+		reconcileUntilDone(t, r, req)
+
+		require.Equal(t, int32(8080), servicePort())
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeWarning, common.ReasonDriftDetected)
+		cond := driftedCondition()
+		require.Equal(t, v1.ConditionTrue, cond.Status)
+		require.Contains(t, cond.Message, "Service "+serviceKey.Name+" (/spec/ports/0/port)")
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	rolloutsv1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
-	"github.com/go-test/deep"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -14,25 +13,40 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/customercontainer"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
 )
 
 const (
 	// phpMemoryOverprovisionFactor is the ratio of "memory requested" : "memory limit" for PHP-FPM containers
 	phpMemoryOverprovisionFactor = 1.0 / 3.0
 
-	drupalRolloutName   = "drupal"
-	DrupalServiceName   = "drupal"
 	phpFpmContainerName = "php-fpm"
 	defaultCustomImage  = "default"
 
 	ecrRoot = "881217801864.dkr.ecr.us-east-1.amazonaws.com" // TODO: env var
 )
 
+// Child resources are named after their environment, suffixed with these components (see
+// DrupalEnvironment.ChildName). Older versions of the operator used the components alone, which only allowed a single
+// environment per namespace.
+const (
+	drupalRolloutName = "drupal"
+	drupalServiceName = "drupal"
+
+	phpConfigMapName               = "php-config"
+	phpfpmConfigMapName            = "phpfpm-config"
+	apacheConfEnabledConfigMapName = "apache-conf-enabled"
+)
+
+// DrupalServiceName returns the name of the Service in front of the Drupal Pods of the named DrupalEnvironment
+func DrupalServiceName(environment string) string {
+	return fnv1alpha1.EnvironmentChildName(environment, drupalServiceName)
+}
+
 func drupalCodeMount(path string) v1.VolumeMount {
 	return v1.VolumeMount{
 		Name:      "drupal-code",
@@ -40,39 +54,39 @@ func drupalCodeMount(path string) v1.VolumeMount {
 	}
 }
 
-func EnvConfigSecretVolume() v1.Volume {
+func EnvConfigSecretVolume(env *fnv1alpha1.DrupalEnvironment) v1.Volume {
 	defaultMode := int32(0644)
 	return v1.Volume{
 		Name: "env-config",
 		VolumeSource: v1.VolumeSource{
 			Secret: &v1.SecretVolumeSource{
-				SecretName:  "env-config",
+				SecretName:  envconfig.SecretName(env.Name),
 				DefaultMode: &defaultMode, // to prevent recurring Update()s
 			},
 		},
 	}
 }
 
-func PhpConfigVolume() v1.Volume {
+func PhpConfigVolume(env *fnv1alpha1.DrupalEnvironment) v1.Volume {
 	defaultMode := int32(0644)
 	return v1.Volume{
 		Name: "php-config",
 		VolumeSource: v1.VolumeSource{
 			ConfigMap: &v1.ConfigMapVolumeSource{
-				LocalObjectReference: v1.LocalObjectReference{Name: "php-config"},
+				LocalObjectReference: v1.LocalObjectReference{Name: env.ChildName(phpConfigMapName)},
 				DefaultMode:          &defaultMode, // to prevent recurring Update()s
 			},
 		},
 	}
 }
 
-func ApacheConfEnabled() v1.Volume {
+func ApacheConfEnabled(env *fnv1alpha1.DrupalEnvironment) v1.Volume {
 	defaultMode := int32(0644)
 	return v1.Volume{
 		Name: "apache-conf-enabled",
 		VolumeSource: v1.VolumeSource{
 			ConfigMap: &v1.ConfigMapVolumeSource{
-				LocalObjectReference: v1.LocalObjectReference{Name: "apache-conf-enabled"},
+				LocalObjectReference: v1.LocalObjectReference{Name: env.ChildName(apacheConfEnabledConfigMapName)},
 				DefaultMode:          &defaultMode, // to prevent recurring Update()s
 			},
 		},
@@ -120,7 +134,7 @@ func apacheContainer(env *fnv1alpha1.DrupalEnvironment) v1.Container {
 		TerminationMessagePolicy: v1.TerminationMessageReadFile,
 	}
 
-	if drupal.Liveness.Enabled {
+	if boolValue(drupal.Liveness.Enabled) {
 		apacheContainer.LivenessProbe = &v1.Probe{
 			Handler: v1.Handler{
 				HTTPGet: &v1.HTTPGetAction{
@@ -130,15 +144,15 @@ func apacheContainer(env *fnv1alpha1.DrupalEnvironment) v1.Container {
 					HTTPHeaders: []v1.HTTPHeader{{Name: "Host", Value: "localhost"}}, // "Spoof" host so Drupal trusted hosts settings don't reject
 				},
 			},
-			SuccessThreshold:    drupal.Liveness.SuccessThreshold,
-			FailureThreshold:    drupal.Liveness.FailureThreshold,
-			TimeoutSeconds:      drupal.Liveness.TimeoutSeconds,
-			PeriodSeconds:       drupal.Liveness.PeriodSeconds,
+			SuccessThreshold:    int32Value(drupal.Liveness.SuccessThreshold),
+			FailureThreshold:    int32Value(drupal.Liveness.FailureThreshold),
+			TimeoutSeconds:      int32Value(drupal.Liveness.TimeoutSeconds),
+			PeriodSeconds:       int32Value(drupal.Liveness.PeriodSeconds),
 			InitialDelaySeconds: 1,
 		}
 	}
 
-	if drupal.Readiness.Enabled {
+	if boolValue(drupal.Readiness.Enabled) {
 		apacheContainer.ReadinessProbe = &v1.Probe{
 			Handler: v1.Handler{
 				HTTPGet: &v1.HTTPGetAction{
@@ -148,10 +162,10 @@ func apacheContainer(env *fnv1alpha1.DrupalEnvironment) v1.Container {
 					HTTPHeaders: []v1.HTTPHeader{{Name: "Host", Value: "localhost"}}, // "Spoof" host so Drupal trusted hosts settings don't reject
 				},
 			},
-			SuccessThreshold:    drupal.Readiness.SuccessThreshold,
-			FailureThreshold:    drupal.Readiness.FailureThreshold,
-			TimeoutSeconds:      drupal.Readiness.TimeoutSeconds,
-			PeriodSeconds:       drupal.Readiness.PeriodSeconds,
+			SuccessThreshold:    int32Value(drupal.Readiness.SuccessThreshold),
+			FailureThreshold:    int32Value(drupal.Readiness.FailureThreshold),
+			TimeoutSeconds:      int32Value(drupal.Readiness.TimeoutSeconds),
+			PeriodSeconds:       int32Value(drupal.Readiness.PeriodSeconds),
 			InitialDelaySeconds: 1,
 		}
 	}
@@ -163,10 +177,10 @@ func (rh *requestHandler) phpFpmContainer() v1.Container {
 	phpfpm := rh.env.Spec.Phpfpm
 
 	phpMemoryLimit := int64(
-		phpfpm.Procs*phpfpm.ProcMemoryLimitMiB+
-			phpfpm.OpcacheMemoryLimitMiB+
-			phpfpm.OpcacheInternedStringsBufferMiB+
-			phpfpm.ApcMemoryLimitMiB,
+		int32Value(phpfpm.Procs)*int32Value(phpfpm.ProcMemoryLimitMiB)+
+			int32Value(phpfpm.OpcacheMemoryLimitMiB)+
+			int32Value(phpfpm.OpcacheInternedStringsBufferMiB)+
+			int32Value(phpfpm.ApcMemoryLimitMiB),
 	) * 1024 * 1024
 
 	customImage := defaultCustomImage
@@ -215,7 +229,7 @@ func (rh *requestHandler) drupalRolloutSpec() rolloutsv1alpha1.RolloutSpec {
 		},
 		Strategy: rolloutsv1alpha1.RolloutStrategy{
 			BlueGreenStrategy: &rolloutsv1alpha1.BlueGreenStrategy{
-				ActiveService:         DrupalServiceName,
+				ActiveService:         DrupalServiceName(rh.env.Name),
 				AutoPromotionEnabled:  &rolloutAutoPromote,
 				AutoPromotionSeconds:  &rolloutAutoPromoteDelay,
 				ScaleDownDelaySeconds: &scaleDownDelay,
@@ -228,7 +242,7 @@ func (rh *requestHandler) drupalRolloutSpec() rolloutsv1alpha1.RolloutSpec {
 
 func (rh *requestHandler) drupalPodTemplate() v1.PodTemplateSpec {
 	podLabels := labelsForRollout(rh.env)
-	annotations := drupalPodAnnotations(rh.env)
+	annotations := rh.drupalPodAnnotations()
 	rootUser := int64(0)
 	defaultMode := int32(0644)
 	filesVolumeMount := customercontainer.FilesVolumeMount(rh.env)
@@ -244,7 +258,7 @@ func (rh *requestHandler) drupalPodTemplate() v1.PodTemplateSpec {
 	drupal := rh.env.Spec.Drupal
 
 	phpfpmConfigMap := v1.ConfigMapVolumeSource{
-		LocalObjectReference: v1.LocalObjectReference{Name: "phpfpm-config"},
+		LocalObjectReference: v1.LocalObjectReference{Name: rh.env.ChildName(phpfpmConfigMapName)},
 		DefaultMode:          &defaultMode, // to prevent recurring Update()s
 	}
 
@@ -308,6 +322,11 @@ func (rh *requestHandler) drupalPodTemplate() v1.PodTemplateSpec {
 	// PhpFpm
 	phpFpmContainer := rh.phpFpmContainer()
 
+	containers := []v1.Container{
+		phpFpmContainer,
+		apacheContainer,
+	}
+
 	return v1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      podLabels,
@@ -318,10 +337,7 @@ func (rh *requestHandler) drupalPodTemplate() v1.PodTemplateSpec {
 				codeCopyContainer,
 				sharedSetupContainer,
 			},
-			Containers: []v1.Container{
-				phpFpmContainer,
-				apacheContainer,
-			},
+			Containers: containers,
 			NodeSelector: map[string]string{
 				common.WorkerNodeLabel: "true",
 			},
@@ -335,9 +351,9 @@ func (rh *requestHandler) drupalPodTemplate() v1.PodTemplateSpec {
 					Name:         "php-fpm-config",
 					VolumeSource: v1.VolumeSource{ConfigMap: &phpfpmConfigMap},
 				},
-				PhpConfigVolume(),
-				EnvConfigSecretVolume(),
-				ApacheConfEnabled(),
+				PhpConfigVolume(rh.env),
+				EnvConfigSecretVolume(rh.env),
+				ApacheConfEnabled(rh.env),
 			},
 		},
 	}
@@ -352,13 +368,10 @@ func labelsForRollout(drupalEnv *fnv1alpha1.DrupalEnvironment) map[string]string
 }
 
 // drupalPodAnnotations return the annotations for "drupal" Pods
-func drupalPodAnnotations(env *fnv1alpha1.DrupalEnvironment) map[string]string {
+func (rh *requestHandler) drupalPodAnnotations() map[string]string {
 	return map[string]string{
-		// Hash all fields that affect configuration files, which would necessitate a forced Pod rotation to reload
-		fnv1alpha1.ConfigHashAnnotation: common.HashValueOf(
-			env.Spec.Apache.WebRoot,
-			env.Spec.Phpfpm,
-		),
+		// Changes to configuration files necessitate a forced Pod rotation to reload
+		fnv1alpha1.ConfigHashAnnotation: rh.configHash,
 	}
 }
 
@@ -458,92 +471,67 @@ func (rh *requestHandler) pvc(name string) *v1.PersistentVolumeClaim {
 
 // reconcilePhpFpmConfigMap reconciles the "phpfpm-config" ConfigMap for the requested
 // DrupalEnvironment. This ConfigMap contains ".conf" files that will be enabled on the php-fpm container.
-func (rh *requestHandler) reconcilePhpFpmConfigMap() (result reconcile.Result, err error) {
+func (rh *requestHandler) reconcilePhpFpmConfigMap() (changed bool, err error) {
 	var conf strings.Builder
 	fmt.Fprintln(&conf, "[www]")
-	fmt.Fprintln(&conf, "pm.max_children =", rh.env.Spec.Phpfpm.Procs)
+	fmt.Fprintln(&conf, "pm.max_children =", int32Value(rh.env.Spec.Phpfpm.Procs))
 
 	if common.MeetsVersionConstraint(">= 7.3", rh.env.Spec.Phpfpm.Tag) {
 		fmt.Fprintln(&conf, "[global]")
 		fmt.Fprintln(&conf, "log_limit = 8192")
 	}
 
-	requeue, err := rh.reconcileConfigMap("phpfpm-config", map[string]string{
+	return rh.reconcileConfigMap(phpfpmConfigMapName, map[string]string{
 		"drupalenvironment.conf": conf.String(),
 	})
-
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	return
 }
 
-func (rh *requestHandler) reconcileDrupalRollout() (requeue bool, err error) {
+func (rh *requestHandler) reconcileDrupalRollout() (changed bool, err error) {
 	r := rh.reconciler
 
 	rollout := &rolloutsv1alpha1.Rollout{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      drupalRolloutName,
+			Name:      rh.env.ChildName(drupalRolloutName),
 			Namespace: rh.namespace,
+			Labels:    labelsForRollout(rh.env),
 		},
+		Spec: rh.drupalRolloutSpec(),
 	}
+	rh.associateResourceWithController(rollout)
 
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, rollout, func() error {
-		desired := rh.drupalRolloutSpec()
-
-		if rollout.ObjectMeta.CreationTimestamp.IsZero() {
-			// Create
-			rh.associateResourceWithController(rollout)
-		}
-
-		if diff := deep.Equal(rollout.Spec, desired); diff != nil {
-			rh.logger.Info("Rollout Spec needs update", "current != desired", diff)
-			rollout.Spec = desired
-		}
-
-		rollout.ObjectMeta.Labels = common.MergeLabels(rollout.ObjectMeta.Labels, labelsForRollout(rh.env))
-
-		return nil
-	})
+	// Replicas are controlled by the HPA once the Rollout exists
+	op, err := rh.apply(rollout, "/spec/replicas")
 	if err != nil {
 		return false, err
 	}
 	if op != controllerutil.OperationResultNone {
 		rh.logger.Info("Reconciled Drupal Rollout", "operation", op)
+		if op == controllerutil.OperationResultCreated {
+			r.recorder.Event(rh.env, v1.EventTypeNormal, common.ReasonRolloutCreated, "Created Drupal Rollout")
+		} else {
+			r.recorder.Event(rh.env, v1.EventTypeNormal, common.ReasonRolloutUpdated, "Updated Drupal Rollout")
+		}
 		return true, nil
 	}
 	return false, nil
 }
 
-func (rh *requestHandler) reconcileDrupalService() (requeue bool, err error) {
-	r := rh.reconciler
-	name := "drupal"
-
-	svc := rh.drupalService(name)
+func (rh *requestHandler) reconcileDrupalService() (changed bool, err error) {
+	svc := rh.drupalService(DrupalServiceName(rh.env.Name))
 
-	found := &v1.Service{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: rh.namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		rh.logger.Info("Creating Service", "Namespace", svc.Namespace, "Name", svc.Name)
-		err = r.client.Create(context.TODO(), svc)
-		if err != nil {
-			rh.logger.Error(err, "Failed to create Service", "Namespace", svc.Namespace, "Name", svc.Name)
-			return false, err
-		}
-		return true, nil
-	}
+	op, err := rh.apply(svc)
 	if err != nil {
-		rh.logger.Error(err, "Failed to reconcile Service", "Namespace", rh.namespace, "Name", name)
+		rh.logger.Error(err, "Failed to reconcile Service", "Namespace", svc.Namespace, "Name", svc.Name)
 		return false, err
 	}
-
-	// TODO: update selector if child labels change
-
+	if op != controllerutil.OperationResultNone {
+		rh.logger.Info("Reconciled Service", "Namespace", svc.Namespace, "Name", svc.Name, "operation", op)
+		return true, nil
+	}
 	return false, nil
 }
 
-func (rh *requestHandler) reconcilePV() (requeue bool, err error) {
+func (rh *requestHandler) reconcilePV() (changed bool, err error) {
 	r := rh.reconciler
 	name := string(rh.env.Id()) + "-files"
 
@@ -559,8 +547,10 @@ func (rh *requestHandler) reconcilePV() (requeue bool, err error) {
 		err = r.client.Create(context.TODO(), pv)
 		if err != nil {
 			rh.logger.Error(err, "Failed to create PV", "Namespace", pv.Namespace, "Name", pv.Name)
+			r.recorder.Eventf(rh.env, v1.EventTypeWarning, common.ReasonPersistentVolumeFailed, "Failed to create PersistentVolume %v: %v", pv.Name, err)
 			return false, err
 		}
+		r.recorder.Eventf(rh.env, v1.EventTypeNormal, common.ReasonPersistentVolumeCreated, "Created PersistentVolume %v", pv.Name)
 		return true, nil
 	}
 	if err != nil {
@@ -577,6 +567,7 @@ func (rh *requestHandler) reconcilePV() (requeue bool, err error) {
 		err = r.client.Update(context.TODO(), found)
 		if err != nil {
 			rh.logger.Error(err, "Failed to update PV", "Namespace", found.Namespace, "Name", found.Name)
+			r.recorder.Eventf(rh.env, v1.EventTypeWarning, common.ReasonPersistentVolumeFailed, "Failed to update PersistentVolume %v: %v", found.Name, err)
 			return false, err
 		}
 		return true, nil
@@ -585,7 +576,7 @@ func (rh *requestHandler) reconcilePV() (requeue bool, err error) {
 	return false, nil
 }
 
-func (rh *requestHandler) finalizePV() (requeue bool, err error) {
+func (rh *requestHandler) finalizePV() (changed bool, err error) {
 	r := rh.reconciler
 	name := string(rh.env.Id()) + "-files"
 
@@ -604,7 +595,7 @@ func (rh *requestHandler) finalizePV() (requeue bool, err error) {
 	return false, nil
 }
 
-func (rh *requestHandler) reconcilePVC() (requeue bool, err error) {
+func (rh *requestHandler) reconcilePVC() (changed bool, err error) {
 	r := rh.reconciler
 	name := string(rh.env.Id()) + "-files"
 
@@ -626,9 +617,11 @@ func (rh *requestHandler) reconcilePVC() (requeue bool, err error) {
 		return false, err
 	}
 
-	// PVCs can't be Updated
-
-	return false, nil
+	// PVCs can't be Updated, but changes made to them are reported
+	if err = rh.drift.Check(pvc, found); err != nil {
+		rh.logger.Error(err, "Failed to check PVC for drift", "Namespace", rh.namespace, "Name", name)
+	}
+	return false, err
 }
 
 func pvNeedsUpdate(found, pv *v1.PersistentVolume) bool {
@@ -639,3 +632,16 @@ func pvNeedsUpdate(found, pv *v1.PersistentVolume) bool {
 
 	return false
 }
+
+// int32Value returns the value of an optional number of the spec, or 0 if it's unset
+func int32Value(p *int32) int32 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// boolValue returns the value of an optional boolean of the spec, or false if it's unset
+func boolValue(p *bool) bool {
+	return p != nil && *p
+}
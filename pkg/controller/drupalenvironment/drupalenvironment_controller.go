@@ -12,10 +12,14 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -26,10 +30,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/apm"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/metrics"
 )
 
 const (
+	controllerName        = "drupalenvironment-controller"
 	drenvCleanupFinalizer = "drupalenvironments.fnresources.acquia.io"
 	istioInjectionLabel   = "istio-injection"
 )
@@ -40,19 +47,37 @@ var log = logf.Log.WithName("controller_drupalenvironment")
 
 // Add creates a new DrupalEnvironment Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
+// Also registers webhooks for this type.
 func Add(mgr manager.Manager) error {
+	err := builder.
+		WebhookManagedBy(mgr).
+		For(&fnv1alpha1.DrupalEnvironment{}).
+		Complete()
+	if err != nil {
+		log.Error(err, "could not create drupalenvironment webhook")
+		return err
+	}
 	return add(mgr, newReconciler(mgr))
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileDrupalEnvironment{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return NewReconciler(mgr.GetClient(), mgr.GetScheme(), mgr.GetEventRecorderFor(controllerName))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileDrupalEnvironment{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("drupalenvironment-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: 30})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: 30})
 	if err != nil {
 		return err
 	}
@@ -70,12 +95,56 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		&v1.Secret{},
 		&v1.Service{},
 		&v1.ServiceAccount{},
+		&v1.ResourceQuota{},
+		&v1.LimitRange{},
+		&rbacv1.Role{},
+		&rbacv1.RoleBinding{},
 		&appsv1.Deployment{},
 		&appsv1.StatefulSet{},
 		&autoscalingv1.HorizontalPodAutoscaler{},
+		&networkingv1.NetworkPolicy{},
 		&rolloutsv1alpha1.Rollout{},
+		&fnv1alpha1.Site{}, // For NetworkPolicy egress to Site Databases
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Secrets referenced by (but not owned by) DrupalEnvironments, to roll them out to Drupal Pods
+	err = c.Watch(&source.Kind{Type: &v1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencingEnvironments(mgr.GetClient()),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to DrupalApplications, whose environment templates and quota profiles apply to their
+	// DrupalEnvironments
+	return c.Watch(&source.Kind{Type: &fnv1alpha1.DrupalApplication{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: applicationEnvironments(mgr.GetClient()),
 	})
-	return err
+}
+
+// applicationEnvironments maps a DrupalApplication to reconcile requests for its DrupalEnvironments
+func applicationEnvironments(c client.Client) handler.ToRequestsFunc {
+	return func(o handler.MapObject) (requests []reconcile.Request) {
+		app, ok := o.Object.(*fnv1alpha1.DrupalApplication)
+		if !ok || app.Id() == "" {
+			return nil
+		}
+
+		envs := &fnv1alpha1.DrupalEnvironmentList{}
+		if err := c.List(context.TODO(), envs, client.MatchingLabels{fnv1alpha1.ApplicationIdLabel: string(app.Id())}); err != nil {
+			log.Error(err, "Failed to list DrupalEnvironments", "Application", app.Name)
+			return nil
+		}
+		for _, env := range envs.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: env.Namespace, Name: env.Name},
+			})
+		}
+		return
+	}
 }
 
 var _ reconcile.Reconciler = &ReconcileDrupalEnvironment{}
@@ -84,8 +153,9 @@ var _ reconcile.Reconciler = &ReconcileDrupalEnvironment{}
 type ReconcileDrupalEnvironment struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for a DrupalEnvironment object and makes changes based on the state read
@@ -112,9 +182,9 @@ func (r *ReconcileDrupalEnvironment) Reconcile(request reconcile.Request) (recon
 
 	// migrate to new Spec FIRST before anything else so we know for the rest
 	// of reconciliation that the type we have is safe
-	currentVersion := fnv1alpha1.ObjectVersion(env)
-	if fnv1alpha1.Migrate(env) {
-		logger.Info("MIGRATING", "current version", currentVersion, "target version", env.SpecVersion())
+	if report := fnv1alpha1.Migrate(env); report != nil {
+		logger.Info("MIGRATING", "current version", report.From, "target version", report.To, "steps", report.Steps)
+		common.RecordMigration(r.recorder, env, report)
 		return reconcile.Result{Requeue: true}, r.client.Update(context.TODO(), env)
 	}
 
@@ -133,9 +203,14 @@ func (r *ReconcileDrupalEnvironment) Reconcile(request reconcile.Request) (recon
 		env:        env,
 		app:        &fnv1alpha1.DrupalApplication{},
 		logger:     logger,
+		drift:      common.NewDriftDetector(r.client, r.scheme, controllerName, env.Status.AppliedResources),
 	}
 
 	result, err := rh.doReconcile()
+	if err != nil {
+		r.recorder.Event(env, v1.EventTypeWarning, common.ReasonReconcileFailed, err.Error())
+	}
+	rh.drift.Report(r.recorder, env, &env.Status.Conditions)
 
 	// Updating the Environment Status
 	statusError := rh.updateEnvironmentStatus(result, err)
@@ -144,6 +219,10 @@ func (r *ReconcileDrupalEnvironment) Reconcile(request reconcile.Request) (recon
 		rh.logger.Error(statusError, "Failed to update environment status")
 	}
 
+	// A periodic requeue doesn't make the environment any less synced, so it's only added after its status
+	if err == nil && !result.Requeue && result.RequeueAfter == 0 {
+		result.RequeueAfter = rh.requeueAfter
+	}
 	return result, err
 }
 
@@ -156,90 +235,212 @@ func (rh *requestHandler) doReconcile() (result reconcile.Result, err error) {
 
 	// Check if this resource is being deleted
 	if rh.isMarkedForDeletion() {
-		// Clean up non-owned Resources
-		if !common.UseDynamicProvisioning() {
-			result.Requeue, err = rh.finalizePV()
-			if common.ShouldReturn(result, err) {
-				return
-			}
-		}
+		return reconcile.Result{}, rh.finalize()
+	}
 
-		result.Requeue, err = rh.finalizeSSHDAccessControls()
-		if common.ShouldReturn(result, err) {
-			return
+	// Fetch the parent DrupalApplication instance
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: rh.env.Spec.Application}, rh.app)
+	if err != nil && !errors.IsNotFound(err) {
+		rh.logger.Error(err, "Failed to get Application", "Application Name", rh.env.Spec.Application)
+		return reconcile.Result{}, err
+	}
+	app := rh.app
+	if errors.IsNotFound(err) {
+		app = nil
+	}
+
+	// Changes to the DrupalEnvironment itself are the only ones that requeue, so that the next pass starts from the
+	// updated object
+	var changed bool
+	if changed, err = rh.reconcileMetadata(app); err != nil || changed {
+		return reconcile.Result{Requeue: changed}, err
+	}
+
+	if app == nil {
+		rh.logger.Info("Parent Application doesn't exist", "Application Name", rh.env.Spec.Application)
+		r.recorder.Eventf(rh.env, v1.EventTypeWarning, common.ReasonParentApplicationMissing, "DrupalApplication %q not found", rh.env.Spec.Application)
+		// Delay the requeue rather than returning an error, to avoid exponential error backoff
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	// Resolve the settings the environment leaves to its template, and default the ones neither of them sets. The
+	// resolved spec is only held in memory (and recorded in the status), so that later changes to the template are
+	// picked up.
+	spec, err := rh.env.ResolveSpec(app)
+	if err != nil {
+		rh.logger.Info("Environment template doesn't exist", "Template", rh.env.Spec.Template)
+		r.recorder.Event(rh.env, v1.EventTypeWarning, common.ReasonTemplateMissing, err.Error())
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	spec.SetDefaults()
+	// Settings taken from a template were never validated along with the environment's own
+	if err = spec.Validate(); err != nil {
+		rh.logger.Info("Resolved spec is invalid", "Error", err.Error())
+		r.recorder.Eventf(rh.env, v1.EventTypeWarning, common.ReasonSpecInvalid, "Resolved spec is invalid: %v", err)
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	rh.env.Spec = spec
+	rh.effectiveSpec = spec.DeepCopy()
+
+	// Apply all child resources in a single pass. Changes to them trigger another pass through the watches on owned
+	// resources, so there's no need to requeue.
+	steps, err := rh.childSteps()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	for _, s := range steps {
+		changed, err = metrics.Step(controllerName, s.name, s.reconcile)
+		if err != nil {
+			return reconcile.Result{}, err
 		}
+		rh.changed = rh.changed || changed
+	}
+	rh.drift.Complete()
 
-		// Remove our finalizer
-		if common.HasFinalizer(rh.env, drenvCleanupFinalizer) {
-			rh.logger.Info("Removing finalizer")
-			controllerutil.RemoveFinalizer(rh.env, drenvCleanupFinalizer)
+	return reconcile.Result{}, nil
+}
+
+// finalize cleans up the resources that aren't garbage collected along with the DrupalEnvironment, then removes its
+// finalizer
+func (rh *requestHandler) finalize() (err error) {
+	r := rh.reconciler
 
-			err = r.client.Update(context.TODO(), rh.env)
-			result.Requeue = true
+	// Clean up non-owned Resources
+	if !common.UseDynamicProvisioning() {
+		if _, err = rh.finalizePV(); err != nil {
+			r.recorder.Eventf(rh.env, v1.EventTypeWarning, common.ReasonFinalizerBlocked, "Failed to delete PersistentVolume: %v", err)
 			return
 		}
+	}
+
+	// The namespace's quota no longer counts the environment
+	if _, _, err = rh.reconcileNamespaceQuota(); err != nil {
+		return
+	}
 
+	// SSHD Role and RoleBinding are owned, but environments that were never migrated may still have a
+	// ClusterRoleBinding
+	if _, err = rh.removeLegacySSHDClusterRoleBinding(); err != nil {
 		return
 	}
 
+	// Remove our finalizer, along with the environment's metrics
+	if common.HasFinalizer(rh.env, drenvCleanupFinalizer) {
+		metrics.ForgetEnvironment(rh.env)
+		rh.logger.Info("Removing finalizer")
+		controllerutil.RemoveFinalizer(rh.env, drenvCleanupFinalizer)
+		err = r.client.Update(context.TODO(), rh.env)
+	}
+	return
+}
+
+// reconcileMetadata ensures the DrupalEnvironment's finalizer, its git ref label, and its owner reference and labels
+// from the DrupalApplication (when app isn't nil), saving any changes in a single Update
+func (rh *requestHandler) reconcileMetadata(app *fnv1alpha1.DrupalApplication) (changed bool, err error) {
+	r := rh.reconciler
+
 	// Ensure our DrupalEnvironment has a finalizer, for cleaning up the PV
 	if !common.HasFinalizer(rh.env, drenvCleanupFinalizer) {
 		rh.logger.Info("Adding finalizer")
 		controllerutil.AddFinalizer(rh.env, drenvCleanupFinalizer)
-		if err = r.client.Update(context.TODO(), rh.env); err != nil {
-			rh.logger.Error(err, "Failed to update controller reference")
-			return
-		}
-		result.Requeue = true
-		return
+		changed = true
 	}
 
 	// Label the DrupalEnvironment with the SHA1 hash of its "gitRef" field
 	hashedGitRef := common.HashValueForLabel(rh.env.Spec.GitRef)
-
 	if rh.env.Labels[fnv1alpha1.GitRefLabel] != hashedGitRef {
-		// Update the labels
+		rh.logger.Info("Updating git ref label")
 		rh.env.Labels[fnv1alpha1.GitRefLabel] = hashedGitRef
-		err := r.client.Update(context.TODO(), rh.env)
-		if err != nil {
-			rh.logger.Error(err, "Failed to set git ref label", "Name", rh.env.Name)
-			return reconcile.Result{}, err
-		}
-		rh.logger.Info("Git ref label updated")
-		return reconcile.Result{Requeue: true}, nil
+		changed = true
 	}
 
-	if requeue, err := rh.labelNamespaceForIstio(); requeue || err != nil {
-		return reconcile.Result{Requeue: requeue}, err
+	// Reconcile owner reference and sync labels from owner
+	if app != nil {
+		var linked bool
+		if linked, err = common.LinkToOwner(app, rh.env, r.scheme); err != nil {
+			return false, err
+		}
+		changed = changed || linked
 	}
 
-	// Fetch the parent DrupalApplication instance
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: rh.env.Spec.Application}, rh.app)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			rh.logger.Info("Parent Application doesn't exist", "Application Name", rh.app.Name)
-			// Delay the requeue rather than returning an error, to avoid exponential error backoff
-			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
-		} else {
-			rh.logger.Error(err, "Failed to get Application", "Application Name", rh.app.Name)
-			return reconcile.Result{}, err
+	if changed {
+		if err = r.client.Update(context.TODO(), rh.env); err != nil {
+			rh.logger.Error(err, "Failed to update DrupalEnvironment metadata")
+			return false, err
 		}
 	}
+	return
+}
+
+// reconcileStep is a named step of reconciling the DrupalEnvironment's child resources, reporting whether it changed
+// anything
+type reconcileStep struct {
+	name      string
+	reconcile func() (changed bool, err error)
+}
+
+// childSteps returns the steps applying all of the DrupalEnvironment's child resources, in order
+func (rh *requestHandler) childSteps() ([]reconcileStep, error) {
+	phpConfig := rh.phpConfig()
+
+	steps := []reconcileStep{
+		{"istio-namespace-label", rh.labelNamespaceForIstio},
+		{"php-config", func() (bool, error) { return rh.reconcileConfigMap(phpConfigMapName, phpConfig) }},
+		{"phpfpm-config", rh.reconcilePhpFpmConfigMap},
+		{"apache-conf-enabled", rh.reconcileApacheConfEnabledConfigMap},
+	}
 
-	// Reconcile owner reference and sync labels from owner
-	update, err := common.LinkToOwner(rh.app, rh.env, r.scheme)
-	if err != nil {
-		return reconcile.Result{}, err
+	// Check if the PV and PVC already exist, if not create them
+	if !common.UseDynamicProvisioning() {
+		steps = append(steps, reconcileStep{"pv", rh.reconcilePV})
 	}
-	if update {
-		if err := r.client.Update(context.TODO(), rh.env); err != nil {
-			rh.logger.Error(err, "Failed to update controller reference")
-			return reconcile.Result{}, err
-		} else {
-			return reconcile.Result{Requeue: true}, nil
+
+	steps = append(steps,
+		reconcileStep{"pvc", rh.reconcilePVC},
+		reconcileStep{"service", rh.reconcileDrupalService},
+		reconcileStep{"env-config", rh.reconcileEnvConfigSecret},
+		// Hash the configuration reconciled above, so that Drupal Pods get rotated when it changes
+		reconcileStep{"config-hash", func() (changed bool, err error) {
+			if rh.configHash, err = rh.computeConfigHash(); err != nil {
+				rh.logger.Error(err, "Failed to hash configuration")
+			}
+			return
+		}},
+		reconcileStep{"rollout", rh.reconcileDrupalRollout},
+		reconcileStep{"hpa", rh.reconcileHPA},
+		reconcileStep{"quota", rh.reconcileQuota},
+		reconcileStep{"network-policies", rh.reconcileNetworkPolicies},
+		// Migrate away from the cluster-scoped SSHD RBAC used by older versions of the operator
+		reconcileStep{"remove-legacy-sshd-rbac", rh.removeLegacySSHDClusterRoleBinding},
+		// Migrate away from the fixed child resource names used by older versions of the operator
+		reconcileStep{"remove-legacy-children", rh.removeLegacyChildren},
+	)
+
+	// Reconcile SSHD resources
+	sshUsername, err := rh.getSSHUsername()
+	if err != nil {
+		// If an API error occurred, return it
+		if err, ok := err.(*errors.StatusError); ok {
+			rh.logger.Error(err, "Failed to get SSH username")
+			return nil, err
 		}
+
+		// Otherwise, a ConfigMap misconfiguration is in place, so just log the error
+		rh.logger.Info("Couldn't configure SSH Endpoint", "reason", err)
+		return steps, nil
 	}
 
+	return append(steps,
+		reconcileStep{"sshd-access-controls", rh.reconcileSSHDAccessControls},
+		reconcileStep{"sshd-service", func() (bool, error) { return rh.reconcileSSHDService(sshUsername) }},
+		reconcileStep{"sshd-deployment", func() (bool, error) { return rh.reconcileSSHDDeployment(sshUsername) }},
+	), nil
+}
+
+// phpConfig returns the contents of the "php-config" ConfigMap, with PHP settings for php-fpm and the CLI
+func (rh *requestHandler) phpConfig() map[string]string {
+	r := rh.reconciler
+
 	// PHP settings ConfigMap
 	phpConfig := make(map[string]string)
 	phpConfig["zzz_drupalenvironment.ini"] = fmt.Sprintf(`
@@ -252,13 +453,13 @@ opcache.memory_consumption = %v
 opcache.interned_strings_buffer = %v
 session.save_path = "/shared/php_sessions"
 `,
-		rh.env.Spec.Phpfpm.MaxInputVars,
-		rh.env.Spec.Phpfpm.MaxExecutionTime,
-		rh.env.Spec.Phpfpm.ProcMemoryLimitMiB,
-		rh.env.Spec.Phpfpm.PostMaxSizeMiB,
-		rh.env.Spec.Phpfpm.ApcMemoryLimitMiB,
-		rh.env.Spec.Phpfpm.OpcacheMemoryLimitMiB,
-		rh.env.Spec.Phpfpm.OpcacheInternedStringsBufferMiB)
+		int32Value(rh.env.Spec.Phpfpm.MaxInputVars),
+		int32Value(rh.env.Spec.Phpfpm.MaxExecutionTime),
+		int32Value(rh.env.Spec.Phpfpm.ProcMemoryLimitMiB),
+		int32Value(rh.env.Spec.Phpfpm.PostMaxSizeMiB),
+		int32Value(rh.env.Spec.Phpfpm.ApcMemoryLimitMiB),
+		int32Value(rh.env.Spec.Phpfpm.OpcacheMemoryLimitMiB),
+		int32Value(rh.env.Spec.Phpfpm.OpcacheInternedStringsBufferMiB))
 
 	phpConfig["zzz_drupalenvironment_cli.ini"] = fmt.Sprintf(`
 max_input_vars = %v
@@ -268,103 +469,27 @@ opcache.memory_consumption = %v
 opcache.interned_strings_buffer = %v
 session.save_path = "/shared/php_sessions"
 `,
-		rh.env.Spec.Phpfpm.MaxInputVars,
-		rh.env.Spec.Phpfpm.PostMaxSizeMiB,
-		rh.env.Spec.Phpfpm.ApcMemoryLimitMiB,
-		rh.env.Spec.Phpfpm.OpcacheMemoryLimitMiB,
-		rh.env.Spec.Phpfpm.OpcacheInternedStringsBufferMiB)
-
-	// Configure New Relic if a license key was given
-	if rh.env.Spec.Phpfpm.NewRelicSecret != "" {
-		conf, err := rh.newRelicConf()
+		int32Value(rh.env.Spec.Phpfpm.MaxInputVars),
+		int32Value(rh.env.Spec.Phpfpm.PostMaxSizeMiB),
+		int32Value(rh.env.Spec.Phpfpm.ApcMemoryLimitMiB),
+		int32Value(rh.env.Spec.Phpfpm.OpcacheMemoryLimitMiB),
+		int32Value(rh.env.Spec.Phpfpm.OpcacheInternedStringsBufferMiB))
+
+	// Configure APM if a provider was given
+	provider, err := apm.ForEnvironment(rh.app, rh.env)
+	if err == nil && provider != nil {
+		var conf string
+		conf, err = provider.PhpIni(r.client)
 		if err == nil {
-			phpConfig["newrelic.ini"] = conf
-		} else {
-			rh.logger.Error(err, "couldn't generate New Relic config file")
-		}
-	}
-
-	var requeue bool
-	requeue, err = rh.reconcileConfigMap("php-config", phpConfig)
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	// Create/Update phpfpm ConfigMap
-	result, err = rh.reconcilePhpFpmConfigMap()
-	if common.ShouldReturn(result, err) {
-		return
-	}
-
-	// Create/Update apache-conf-enabled ConfigMap
-	result, err = rh.reconcileApacheConfEnabledConfigMap()
-	if common.ShouldReturn(result, err) {
-		return
-	}
-
-	// Check if the PV and PVC already exist, if not create them
-	if !common.UseDynamicProvisioning() {
-		requeue, err = rh.reconcilePV()
-		if err != nil || requeue {
-			return reconcile.Result{Requeue: requeue}, err
+			phpConfig[apm.PhpIniFile] = conf
 		}
 	}
-
-	requeue, err = rh.reconcilePVC()
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	requeue, err = rh.reconcileDrupalService()
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	// Create/Update Environment Config Secret
-	result, err = rh.reconcileEnvConfigSecret()
-	if common.ShouldReturn(result, err) {
-		return
-	}
-
-	requeue, err = rh.reconcileDrupalRollout()
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	requeue, err = rh.reconcileHPA()
-	if err != nil || requeue {
-		return reconcile.Result{Requeue: requeue}, err
-	}
-
-	// Reconcile SSHD resources
-	sshUsername, err := rh.getSSHUsername()
-	if err == nil {
-		result, err := rh.reconcileSSHDAccessControls()
-		if err != nil || result.Requeue || result.RequeueAfter != 0 {
-			return result, err
-		}
-
-		result, err = rh.reconcileSSHDService(sshUsername)
-		if err != nil || result.Requeue || result.RequeueAfter != 0 {
-			return result, err
-		}
-
-		result, err = rh.reconcileSSHDDeployment(sshUsername)
-		if err != nil || result.Requeue || result.RequeueAfter != 0 {
-			return result, err
-		}
-	} else {
-		// If an API error occurred, return it
-		if err, ok := err.(*errors.StatusError); ok {
-			rh.logger.Error(err, "Failed to get SSH username")
-			return reconcile.Result{}, err
-		}
-
-		// Otherwise, a ConfigMap misconfiguration is in place, so just log the error
-		rh.logger.Info("Couldn't configure SSH Endpoint", "reason", err)
+	if err != nil {
+		rh.logger.Error(err, "couldn't generate APM config file")
+		r.recorder.Eventf(rh.env, v1.EventTypeWarning, common.ReasonAPMConfigInvalid, "Couldn't configure APM: %v", err)
 	}
 
-	return reconcile.Result{}, nil
+	return phpConfig
 }
 
 type requestHandler struct {
@@ -374,6 +499,19 @@ type requestHandler struct {
 	app       *fnv1alpha1.DrupalApplication
 	namespace string
 	logger    logr.Logger
+
+	// configHash is a hash of the environment's rendered configuration, set on Drupal Pods
+	configHash string
+	// appliedConfigMaps holds the data of the ConfigMaps applied in this pass, by component
+	appliedConfigMaps map[string]map[string]string
+	// changed is set when any child resource was created, updated or deleted in this pass
+	changed bool
+	// drift detects changes made to child resources outside of the operator as they are applied
+	drift *common.DriftDetector
+	// effectiveSpec is the environment's spec resolved from its template, which rh.env holds in this pass
+	effectiveSpec *fnv1alpha1.DrupalEnvironmentSpec
+	// requeueAfter is set to reconcile the environment again periodically, once it's otherwise done
+	requeueAfter time.Duration
 }
 
 func (rh *requestHandler) associateResourceWithController(o metav1.Object) {
@@ -383,9 +521,16 @@ func (rh *requestHandler) associateResourceWithController(o metav1.Object) {
 	}
 }
 
+// apply creates or updates a child resource with a server-side apply patch, detecting its drift. obj must be fully
+// specified, including its labels and owner reference. The ignored fields are controlled by others once obj exists
+// (see common.DriftDetector.Apply).
+func (rh *requestHandler) apply(obj runtime.Object, ignored ...string) (controllerutil.OperationResult, error) {
+	return rh.drift.Apply(obj, ignored...)
+}
+
 // Add label to namespace if istio is enabled, to trigger auto-injection of Envoy
 // Remove the label if istio is disabled
-func (rh *requestHandler) labelNamespaceForIstio() (requeue bool, err error) {
+func (rh *requestHandler) labelNamespaceForIstio() (changed bool, err error) {
 	r := rh.reconciler
 	ns := &v1.Namespace{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: rh.namespace}, ns)
@@ -400,12 +545,12 @@ func (rh *requestHandler) labelNamespaceForIstio() (requeue bool, err error) {
 		}
 		ns.Labels[istioInjectionLabel] = "enabled"
 		rh.logger.Info("Adding istio label to namespace.")
-		requeue = true
+		changed = true
 		err = r.client.Update(context.TODO(), ns)
 	} else if !common.IsIstioEnabled() && nsLabeled {
 		delete(ns.Labels, istioInjectionLabel)
 		rh.logger.Info("Removing istio label from namespace.")
-		requeue = true
+		changed = true
 		err = r.client.Update(context.TODO(), ns)
 	}
 
@@ -433,13 +578,13 @@ func (rh *requestHandler) getEnvironmentStatus(result reconcile.Result, recError
 		return fnv1alpha1.DrupalEnvironmentStatusDeleting
 	}
 
-	if result.Requeue || result.RequeueAfter > 0 {
+	if result.Requeue || result.RequeueAfter > 0 || rh.changed {
 		return fnv1alpha1.DrupalEnvironmentStatusSyncing
 	}
 
 	r := rh.reconciler
 	rollout := &rolloutsv1alpha1.Rollout{}
-	err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalRolloutName, Namespace: rh.namespace}, rollout)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: rh.env.ChildName(drupalRolloutName), Namespace: rh.namespace}, rollout)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -470,14 +615,29 @@ func (rh *requestHandler) updateEnvironmentStatus(result reconcile.Result, recEr
 
 	status := rh.getEnvironmentStatus(result, recError)
 
+	effectiveSpec := rh.env.Status.EffectiveSpec
+	if rh.effectiveSpec != nil {
+		effectiveSpec = rh.effectiveSpec
+	}
+
 	nextStatus := fnv1alpha1.DrupalEnvironmentStatus{
 		NumDrupal: drupalCount,
 		Status:    status,
+		// Conditions are updated on rh.env during reconciliation. Copy them, since rh.env is re-fetched below.
+		Conditions:       rh.env.DeepCopy().Status.Conditions,
+		AppliedResources: rh.drift.AppliedResources(),
+		EffectiveSpec:    effectiveSpec,
 	}
 
+	// Once finalized, the environment's metrics were forgotten, and it may already be gone
+	finalized := rh.isMarkedForDeletion() && !common.HasFinalizer(rh.env, drenvCleanupFinalizer)
+
 	// Retrieving the actual DrupalEnvironment's runtime object for the status comparison & whether there is a need for update.
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: rh.env.Name, Namespace: rh.namespace}, rh.env)
 	if err != nil {
+		if finalized && errors.IsNotFound(err) {
+			return nil
+		}
 		return err
 	}
 
@@ -489,30 +649,35 @@ func (rh *requestHandler) updateEnvironmentStatus(result reconcile.Result, recEr
 		}
 	}
 
+	if !finalized {
+		metrics.SetEnvironmentStatus(rh.env, status)
+	}
+
 	return nil
 }
 
-func (rh *requestHandler) reconcileConfigMap(name string, data map[string]string) (requeue bool, err error) {
+// reconcileConfigMap applies the environment's ConfigMap for the given component
+func (rh *requestHandler) reconcileConfigMap(component string, data map[string]string) (changed bool, err error) {
 	cm := &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
+			Name:      rh.env.ChildName(component),
 			Namespace: rh.namespace,
+			Labels:    rh.env.ChildLabels(),
 		},
+		Data: data,
 	}
+	rh.associateResourceWithController(cm)
 	logger := rh.logger.WithValues("Namespace", cm.Namespace, "Name", cm.Name)
 
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), rh.reconciler.client, cm, func() error {
-		if cm.CreationTimestamp.IsZero() {
-			cm.Labels = common.MergeLabels(cm.Labels, rh.env.ChildLabels())
-			rh.associateResourceWithController(cm)
-		}
-		cm.Data = data
-		return nil
-	})
+	op, err := rh.apply(cm)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile ConfigMap")
 		return false, err
 	}
+	if rh.appliedConfigMaps == nil {
+		rh.appliedConfigMaps = map[string]map[string]string{}
+	}
+	rh.appliedConfigMaps[component] = cm.Data
 	if op != controllerutil.OperationResultNone {
 		logger.Info("Reconciled ConfigMap", "operation", op)
 		return true, nil
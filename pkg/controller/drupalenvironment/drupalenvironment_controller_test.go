@@ -13,17 +13,21 @@ import (
 	"github.com/argoproj/argo-rollouts/utils/conditions"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	v1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 )
 
@@ -59,159 +63,90 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		},
 	}
 
-	t.Run("should add DrupalCleanupFinalizer and Requeue", func(t *testing.T) {
+	t.Run("should add finalizer, GitRef label and owner reference in one update and Requeue", func(t *testing.T) {
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
 		require.True(t, res.Requeue)
 
-		// Verifying Finalizers has been set correctly
 		drupalEnvironment := &fnv1alpha1.DrupalEnvironment{}
 		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
 		require.NoError(t, err)
-		require.True(t, common.HasFinalizer(drupalEnvironment, drenvCleanupFinalizer))
-	})
 
-	t.Run("should have status as Syncing", func(t *testing.T) {
-		drupalEnvironment := &fnv1alpha1.DrupalEnvironment{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
-		require.NoError(t, err)
-		require.Equal(t, fnv1alpha1.DrupalEnvironmentStatusSyncing, drupalEnvironment.Status.Status)
-	})
-
-	t.Run("should setup GitRef and Requeue", func(t *testing.T) {
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		// Verifying Finalizers has been set correctly
+		require.True(t, common.HasFinalizer(drupalEnvironment, drenvCleanupFinalizer))
 
-		// Expecting a DrupalApplication Status should be set correctly and will have 0 NumEnvironments
-		drupalEnvironment := &fnv1alpha1.DrupalEnvironment{}
-		r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
 		labels := drupalEnvironment.GetLabels()
-
 		sha := sha1.New()
 		sha.Write([]byte(drupalEnvironment.Spec.GitRef))
 		hashedGitRef := fmt.Sprintf("%x", sha.Sum(nil))
 		require.Equal(t, hashedGitRef, labels[fnv1alpha1.GitRefLabel])
-	})
 
-	t.Run("should label namespace for istio", func(t *testing.T) {
-		common.SetIsIstioEnabled_ForTestsOnly(true)
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		ns := &v1.Namespace{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Namespace}, ns)
-		require.NoError(t, err)
+		// Verifying the owners has been updated correctly
+		require.Equal(t, testAppID, labels[fnv1alpha1.ApplicationIdLabel])
 
-		val, ok := ns.Labels[istioInjectionLabel]
-		require.True(t, ok)
-		require.Equal(t, "enabled", val)
+		// No child resources are created until the next pass
+		phpConfigMap := &v1.ConfigMap{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(phpConfigMapName), Namespace: testNamespace}, phpConfigMap)
+		require.True(t, errors.IsNotFound(err))
 	})
 
-	t.Run("should remove istio label from namespace", func(t *testing.T) {
-		common.SetIsIstioEnabled_ForTestsOnly(false)
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		ns := &v1.Namespace{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Namespace}, ns)
+	t.Run("should have status as Syncing", func(t *testing.T) {
+		drupalEnvironment := &fnv1alpha1.DrupalEnvironment{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
 		require.NoError(t, err)
-
-		_, ok := ns.Labels[istioInjectionLabel]
-		require.False(t, ok)
+		require.Equal(t, fnv1alpha1.DrupalEnvironmentStatusSyncing, drupalEnvironment.Status.Status)
 	})
 
-	t.Run("should find parent DrupalApplication and Link to Owner with Requeue", func(t *testing.T) {
+	t.Run("should create all child resources in a single pass", func(t *testing.T) {
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		require.False(t, res.Requeue)
+		require.Zero(t, res.RequeueAfter)
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeNormal, common.ReasonRolloutCreated)
 
-		// Verifying the owners has been updated correctly
+		// Still Syncing, since child resources changed
 		drupalEnvironment := &fnv1alpha1.DrupalEnvironment{}
-		r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
-		labels := drupalEnvironment.GetLabels()
-		require.Equal(t, testAppID, labels[fnv1alpha1.ApplicationIdLabel])
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
+		require.NoError(t, err)
+		require.Equal(t, fnv1alpha1.DrupalEnvironmentStatusSyncing, drupalEnvironment.Status.Status)
 	})
 
-	t.Run("should create php-config ConfigMap and Requeue", func(t *testing.T) {
-		// Verifying the php-config ConfigMap has not yet been created
+	t.Run("should create php-config ConfigMap", func(t *testing.T) {
 		phpConfigMap := &v1.ConfigMap{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "php-config", Namespace: testNamespace}, phpConfigMap)
-		require.True(t, errors.IsNotFound(err))
-
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		// Verifying the php-config ConfigMap has been updated correctly
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "php-config", Namespace: testNamespace}, phpConfigMap)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(phpConfigMapName), Namespace: testNamespace}, phpConfigMap)
 		require.NoError(t, err)
-
 		require.True(t, goldenHelper.GoldenSpec(t, "ConfigMap", phpConfigMap))
 	})
 
-	t.Run("should create phpfpm-config ConfigMap and Requeue", func(t *testing.T) {
-		// Verifying the phpfpm-config ConfigMap has not yet been created
+	t.Run("should create phpfpm-config ConfigMap", func(t *testing.T) {
 		phpfpmConfigMap := &v1.ConfigMap{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "phpfpm-config", Namespace: testNamespace}, phpfpmConfigMap)
-		require.True(t, errors.IsNotFound(err))
-
-		res, err := r.Reconcile(req)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(phpfpmConfigMapName), Namespace: testNamespace}, phpfpmConfigMap)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		// Verifying the phpfpm-config ConfigMap has been updated correctly
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "phpfpm-config", Namespace: testNamespace}, phpfpmConfigMap)
-		require.NoError(t, err)
-
 		require.True(t, goldenHelper.GoldenSpec(t, "ConfigMap", phpfpmConfigMap))
 	})
 
-	t.Run("should create apache-conf-enabled ConfigMap and Requeue", func(t *testing.T) {
-		// Verifying the apache-conf-enabled ConfigMap has not yet been created
+	t.Run("should create apache-conf-enabled ConfigMap", func(t *testing.T) {
 		apacheConfEnabledConfigMap := &v1.ConfigMap{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "apache-conf-enabled", Namespace: testNamespace}, apacheConfEnabledConfigMap)
-		require.True(t, errors.IsNotFound(err))
-
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		// Verifying the apache-conf-enabled ConfigMap has been updated correctly
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "apache-conf-enabled", Namespace: testNamespace}, apacheConfEnabledConfigMap)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(apacheConfEnabledConfigMapName), Namespace: testNamespace}, apacheConfEnabledConfigMap)
 		require.NoError(t, err)
-
 		require.True(t, goldenHelper.GoldenSpec(t, "ConfigMap", apacheConfEnabledConfigMap))
 	})
 
-	t.Run("should reconcile PV and Requeue", func(t *testing.T) {
-		res, err := r.Reconcile(req)
-		// Expecting PV to be created successfully and requeue
+	t.Run("should create PV and PVC", func(t *testing.T) {
+		name := string(drupalEnvironmentWithID.Id()) + "-files"
+
+		pv := &v1.PersistentVolume{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, pv)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
-	})
 
-	t.Run("should reconcile PVC and Requeue", func(t *testing.T) {
-		res, err := r.Reconcile(req)
-		// Expecting PVC to be created successfully and requeue
+		pvc := &v1.PersistentVolumeClaim{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, pvc)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
 	})
 
-	t.Run("should reconcile Drupal Service and Requeue", func(t *testing.T) {
-		// Verifying Drupal Service has not yet been created
+	t.Run("should create Drupal Service", func(t *testing.T) {
 		drupalService := &v1.Service{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "drupal", Namespace: testNamespace}, drupalService)
-		require.True(t, errors.IsNotFound(err))
-
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		// Verifying Drupal Service has been created
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "drupal", Namespace: testNamespace}, drupalService)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalServiceName), Namespace: testNamespace}, drupalService)
 		require.NoError(t, err)
 
 		// Verifying selectors has been successfully added
@@ -219,35 +154,17 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		require.Equal(t, "drupal", selectors["app"])
 	})
 
-	t.Run("should create env-config Secret and Requeue", func(t *testing.T) {
-		// Verifying the env-config Secret does not yet exist
+	t.Run("should create env-config Secret", func(t *testing.T) {
 		secret := &v1.Secret{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "env-config", Namespace: testNamespace}, secret)
-		require.True(t, errors.IsNotFound(err))
-
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		// Verifying the site-settings ConfigMap has been created
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "env-config", Namespace: testNamespace}, secret)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(envconfig.SecretComponent), Namespace: testNamespace}, secret)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.Golden(t, "Decoded_sites.inc", secret.Data["sites.inc"]))
 		require.True(t, goldenHelper.GoldenSpec(t, "Secret", secret))
 	})
 
-	t.Run("should reconcile Drupal Rollout and Requeue", func(t *testing.T) {
-		// Verifying Drupal Rollout does not yet exist
+	t.Run("should create Drupal Rollout", func(t *testing.T) {
 		drupalRollout := &rolloutsv1alpha1.Rollout{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "drupal", Namespace: testNamespace}, drupalRollout)
-		require.True(t, errors.IsNotFound(err))
-
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.Equal(t, res.Requeue, true)
-
-		// Verifying Drupal Rollout
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "drupal", Namespace: testNamespace}, drupalRollout)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: testNamespace}, drupalRollout)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "Rollout", drupalRollout))
 
@@ -256,16 +173,47 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		_ = r.client.Update(context.TODO(), drupalRollout)
 	})
 
-	t.Run("should reconcile HPA", func(t *testing.T) {
-		res, err := r.Reconcile(req)
+	t.Run("should create HPA", func(t *testing.T) {
+		hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalHPAName), Namespace: testNamespace}, hpa)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		require.Equal(t, drupalEnvironmentWithID.ChildName(drupalRolloutName), hpa.Spec.ScaleTargetRef.Name)
 	})
 
 	t.Run("should be fully reconciled without SSHD", func(t *testing.T) {
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
 		require.False(t, res.Requeue)
+		require.Zero(t, res.RequeueAfter)
+	})
+
+	t.Run("should label namespace for istio", func(t *testing.T) {
+		common.SetIsIstioEnabled_ForTestsOnly(true)
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.False(t, res.Requeue)
+
+		ns := &v1.Namespace{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Namespace}, ns)
+		require.NoError(t, err)
+
+		val, ok := ns.Labels[istioInjectionLabel]
+		require.True(t, ok)
+		require.Equal(t, "enabled", val)
+	})
+
+	t.Run("should remove istio label from namespace", func(t *testing.T) {
+		common.SetIsIstioEnabled_ForTestsOnly(false)
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.False(t, res.Requeue)
+
+		ns := &v1.Namespace{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.Namespace}, ns)
+		require.NoError(t, err)
+
+		_, ok := ns.Labels[istioInjectionLabel]
+		require.False(t, ok)
 	})
 
 	t.Run("should reconcile SSHD RBAC", func(t *testing.T) {
@@ -273,46 +221,44 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		err := r.client.Create(context.TODO(), testSshAuthorizedKeysConfigMap)
 		require.NoError(t, err)
 
-		// Should then reconcile SSHD RBAC
+		// Should then reconcile all SSHD resources in one pass
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		res, err = r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		require.False(t, res.Requeue)
 
 		sa := &v1.ServiceAccount{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: sshdDeploymentName}, sa)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: drupalEnvironmentWithID.ChildName(sshdDeploymentName)}, sa)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "ServiceAccount", sa))
 
+		role := &rbacv1.Role{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: drupalEnvironmentWithID.ChildName(sshdRoleName)}, role)
+		require.NoError(t, err)
+		require.True(t, goldenHelper.GoldenSpec(t, "Role", role))
+
+		rb := &rbacv1.RoleBinding{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: drupalEnvironmentWithID.ChildName(sshdRoleName)}, rb)
+		require.NoError(t, err)
+		require.True(t, goldenHelper.GoldenSpec(t, "RoleBinding", rb))
+
+		// No cluster-scoped RBAC should have been created
 		crb := &rbacv1.ClusterRoleBinding{}
 		err = r.client.Get(context.TODO(), types.NamespacedName{Name: sshdDeploymentName + "-" + testNamespace}, crb)
-		require.NoError(t, err)
-		require.True(t, goldenHelper.GoldenSpec(t, "ClusterRoleBinding", crb))
+		require.True(t, errors.IsNotFound(err))
 	})
 
 	t.Run("should reconcile SSHD Service", func(t *testing.T) {
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
 		svc := &v1.Service{}
-		key := types.NamespacedName{Namespace: testNamespace, Name: sshdServiceName}
-		err = r.client.Get(context.TODO(), key, svc)
+		key := types.NamespacedName{Namespace: testNamespace, Name: drupalEnvironmentWithID.ChildName(sshdServiceName)}
+		err := r.client.Get(context.TODO(), key, svc)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "Service", svc))
 	})
 
 	t.Run("should reconcile SSHD Deployment and still have status as Syncing", func(t *testing.T) {
-		res, err := r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
 		dep := &appsv1.Deployment{}
-		key := types.NamespacedName{Namespace: testNamespace, Name: sshdDeploymentName}
-		err = r.client.Get(context.TODO(), key, dep)
+		key := types.NamespacedName{Namespace: testNamespace, Name: drupalEnvironmentWithID.ChildName(sshdDeploymentName)}
+		err := r.client.Get(context.TODO(), key, dep)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "Deployment", dep))
 
@@ -334,7 +280,7 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		require.NotEqual(t, drupalEnvironment.Status.Status, fnv1alpha1.DrupalEnvironmentStatusDeploying)
 
 		rollout := &rolloutsv1alpha1.Rollout{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalRolloutName, Namespace: req.NamespacedName.Name}, rollout)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: req.NamespacedName.Name}, rollout)
 		require.NoError(t, err)
 
 		condition := rolloutsv1alpha1.RolloutCondition{
@@ -371,7 +317,7 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		require.NotEqual(t, drupalEnvironment.Status.Status, fnv1alpha1.DrupalEnvironmentStatusSynced)
 
 		rollout := &rolloutsv1alpha1.Rollout{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalRolloutName, Namespace: req.NamespacedName.Name}, rollout)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: req.NamespacedName.Name}, rollout)
 		require.NoError(t, err)
 
 		progressingCondition := rolloutsv1alpha1.RolloutCondition{
@@ -411,38 +357,34 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	t.Run("should update the php-config ConfigMap and Requeue", func(t *testing.T) {
+	t.Run("should update the php-config ConfigMap and Rollout in one pass", func(t *testing.T) {
+		before := &rolloutsv1alpha1.Rollout{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: req.NamespacedName.Name}, before)
+		require.NoError(t, err)
+
 		// Fetch Environment
 		drupalEnvironment := &fnv1alpha1.DrupalEnvironment{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
 		require.NoError(t, err)
 
 		// Updating Specs
-		drupalEnvironment.Spec.Phpfpm.OpcacheMemoryLimitMiB = 100
+		drupalEnvironment.Spec.Phpfpm.OpcacheMemoryLimitMiB = pointer.Int32Ptr(100)
 		err = r.client.Update(context.TODO(), drupalEnvironment)
 		require.NoError(t, err)
 
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		require.False(t, res.Requeue)
 
 		// Verify the php-config ConfigMap was updated
 		phpConfigMap := &v1.ConfigMap{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "php-config", Namespace: testNamespace}, phpConfigMap)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(phpConfigMapName), Namespace: testNamespace}, phpConfigMap)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "ConfigMap", phpConfigMap))
 
 		// Verify the hash value is updated to relaunch drupal Pods
-		before := &rolloutsv1alpha1.Rollout{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalRolloutName, Namespace: req.NamespacedName.Name}, before)
-		require.NoError(t, err)
-
-		res, err = r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
 		after := &rolloutsv1alpha1.Rollout{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalRolloutName, Namespace: req.NamespacedName.Name}, after)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: req.NamespacedName.Name}, after)
 		require.NoError(t, err)
 
 		annoBefore := before.Spec.Template.ObjectMeta.Annotations[fnv1alpha1.ConfigHashAnnotation]
@@ -450,6 +392,7 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 
 		require.NotEmpty(t, annoAfter)
 		require.NotEqual(t, annoBefore, annoAfter)
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeNormal, common.ReasonRolloutUpdated)
 	})
 
 	t.Run("php-fpm configuration for pre-7.3", func(t *testing.T) {
@@ -463,41 +406,31 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		err = r.client.Update(context.TODO(), drupalEnvironment)
 		require.NoError(t, err)
 
-		// Reconcile to update the phpfpm-config ConfigMap
+		// Reconcile to update the phpfpm-config ConfigMap, Rollout and SSH Deployment
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		require.False(t, res.Requeue)
 
 		// Verifying the phpfpm-config ConfigMap was updated
 		phpfpmConfigMap := &v1.ConfigMap{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "phpfpm-config", Namespace: testNamespace}, phpfpmConfigMap)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(phpfpmConfigMapName), Namespace: testNamespace}, phpfpmConfigMap)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "PhpfpmConfigMapWithPHPLessThan73", phpfpmConfigMap))
 
 		// Making sure Rollout gets updated
-		res, err = r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
 		drupalRollout := &rolloutsv1alpha1.Rollout{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "drupal", Namespace: testNamespace}, drupalRollout)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: testNamespace}, drupalRollout)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "Rollout", drupalRollout))
 
 		// Making sure SSH Deployment gets updated
-		res, err = r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
 		sshDeployment := &appsv1.Deployment{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: sshdDeploymentName, Namespace: testNamespace}, sshDeployment)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(sshdDeploymentName), Namespace: testNamespace}, sshDeployment)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "SSHDeployment", sshDeployment))
 
 		// Fully reconciled
-		res, err = r.Reconcile(req)
-		require.NoError(t, err)
-		require.False(t, res.Requeue)
+		require.Equal(t, 1, reconcileUntilDone(t, r, req))
 	})
 
 	t.Run("should delete DrupalEnvironment", func(t *testing.T) {
@@ -510,25 +443,24 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 		err = r.client.Update(context.TODO(), drupalEnvironment)
 		require.NoError(t, err)
 
-		// Removing of PV
+		// Removing of PV, SSH RBAC and the finalizer, in one pass
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
-		require.True(t, res.Requeue)
-
-		// Removing of SSH RBAC
-		res, err = r.Reconcile(req)
-		require.NoError(t, err)
-		require.True(t, res.Requeue)
+		require.False(t, res.Requeue)
 
 		ctx := context.TODO()
+		pv := &v1.PersistentVolume{}
+		err = r.client.Get(ctx, types.NamespacedName{Name: string(drupalEnvironmentWithID.Id()) + "-files"}, pv)
+		require.True(t, errors.IsNotFound(err))
+
 		crb := &rbacv1.ClusterRoleBinding{}
 		err = r.client.Get(ctx, types.NamespacedName{Name: "sshd-" + req.Namespace}, crb)
 		require.True(t, errors.IsNotFound(err))
 
-		// Reconcile complete
-		res, err = r.Reconcile(req)
+		drupalEnvironment = &fnv1alpha1.DrupalEnvironment{}
+		err = r.client.Get(ctx, types.NamespacedName{Name: req.NamespacedName.Name}, drupalEnvironment)
 		require.NoError(t, err)
-		require.False(t, res.Requeue)
+		require.False(t, common.HasFinalizer(drupalEnvironment, drenvCleanupFinalizer))
 	})
 
 	t.Run("should have status as deleting", func(t *testing.T) {
@@ -539,10 +471,167 @@ func TestReconcileDrupalEnvironment_Reconcile(t *testing.T) {
 	})
 }
 
+func TestReconcileDrupalEnvironment_ReconcileIterations(t *testing.T) {
+	common.SetRealm_ForTestsOnly("TestRealm")
+	common.SetAwsRegion_ForTestsOnly("TestRegion")
+
+	// objects to track in the fake client
+	objects := []runtime.Object{
+		testNamespaceResource,
+		drupalEnvironmentWithID,
+		drupalApplicationWithID,
+		siteWithID,
+		testDefaultClusterCredsSecret,
+		testProdNewRelicSecret,
+		testSshAuthorizedKeysConfigMap,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      drupalEnvironmentWithID.Name,
+			Namespace: drupalEnvironmentWithID.Namespace,
+		},
+	}
+
+	getEnv := func() *fnv1alpha1.DrupalEnvironment {
+		env := &fnv1alpha1.DrupalEnvironment{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, env))
+		return env
+	}
+
+	t.Run("new environment should converge in two passes", func(t *testing.T) {
+		// One pass to update the DrupalEnvironment itself, and one to apply all child resources
+		require.Equal(t, 2, reconcileUntilDone(t, r, req))
+
+		rollout := &rolloutsv1alpha1.Rollout{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalRolloutName), Namespace: testNamespace}, rollout)
+		require.NoError(t, err)
+
+		dep := &appsv1.Deployment{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(sshdDeploymentName), Namespace: testNamespace}, dep)
+		require.NoError(t, err)
+	})
+
+	t.Run("converged environment should not change or be Syncing", func(t *testing.T) {
+		require.Equal(t, 1, reconcileUntilDone(t, r, req))
+		require.NotEqual(t, fnv1alpha1.DrupalEnvironmentStatusSyncing, getEnv().Status.Status)
+	})
+
+	t.Run("spec change should converge in one pass", func(t *testing.T) {
+		env := getEnv()
+		*env.Spec.Drupal.MaxReplicas++
+		*env.Spec.Phpfpm.Procs++
+		require.NoError(t, r.client.Update(context.TODO(), env))
+
+		require.Equal(t, 1, reconcileUntilDone(t, r, req))
+
+		hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithID.ChildName(drupalHPAName), Namespace: testNamespace}, hpa)
+		require.NoError(t, err)
+		require.Equal(t, *env.Spec.Drupal.MaxReplicas, hpa.Spec.MaxReplicas)
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeNormal, common.ReasonRolloutUpdated)
+	})
+
+	t.Run("git ref change should converge in two passes", func(t *testing.T) {
+		env := getEnv()
+		env.Spec.GitRef = "tags/v2.0.0"
+		require.NoError(t, r.client.Update(context.TODO(), env))
+
+		// The git ref label is updated first
+		require.Equal(t, 2, reconcileUntilDone(t, r, req))
+		require.Equal(t, common.HashValueForLabel("tags/v2.0.0"), getEnv().Labels[fnv1alpha1.GitRefLabel])
+	})
+}
+
+// environmentSeries returns the stage labels of the exported status and rollout series of an environment
+func environmentSeries(t *testing.T, envID string) (stages []string) {
+	families, err := crmetrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "fn_drupal_operator_environment_status" && family.GetName() != "fn_drupal_operator_rollout_time_to_synced_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["environment_id"] == envID {
+				stages = append(stages, labels["stage"])
+			}
+		}
+	}
+	return stages
+}
+
+func TestReconcileDrupalEnvironment_Reconcile_ForgetsMetrics(t *testing.T) {
+	common.SetRealm_ForTestsOnly("TestRealm")
+	common.SetAwsRegion_ForTestsOnly("TestRegion")
+
+	// An environment of its own, since the metrics are global
+	const envID = "0b9c5f0e-6f4e-4a5c-9d59-4b1fbb1f6a27"
+	drupalEnvironment := drupalEnvironmentWithID.DeepCopy()
+	drupalEnvironment.UID = "metrics-env-uid"
+	drupalEnvironment.Labels[fnv1alpha1.EnvironmentIdLabel] = envID
+
+	objects := []runtime.Object{
+		testNamespaceResource,
+		drupalEnvironment,
+		drupalApplicationWithID,
+		siteWithID,
+		testDefaultClusterCredsSecret,
+		testProdNewRelicSecret,
+		testSshAuthorizedKeysConfigMap,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      drupalEnvironment.Name,
+			Namespace: drupalEnvironment.Namespace,
+		},
+	}
+
+	getEnv := func() *fnv1alpha1.DrupalEnvironment {
+		env := &fnv1alpha1.DrupalEnvironment{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, env))
+		return env
+	}
+
+	reconcileUntilDone(t, r, req)
+	require.NotEmpty(t, environmentSeries(t, envID))
+
+	t.Run("stage change should remove the series of the previous stage", func(t *testing.T) {
+		env := getEnv()
+		env.Spec.Stage = "preprod"
+		require.NoError(t, r.client.Update(context.TODO(), env))
+
+		reconcileUntilDone(t, r, req)
+		stages := environmentSeries(t, envID)
+		require.NotEmpty(t, stages)
+		require.NotContains(t, stages, "prod")
+	})
+
+	t.Run("deletion should remove all series", func(t *testing.T) {
+		env := getEnv()
+		env.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+		require.NoError(t, r.client.Update(context.TODO(), env))
+
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.False(t, common.HasFinalizer(getEnv(), drenvCleanupFinalizer))
+		require.Empty(t, environmentSeries(t, envID))
+	})
+}
+
 func TestReconcileDrupalEnvironment_Reconcile_UnknownNamespace(t *testing.T) {
 	// objects to track in the fake client
 	objects := []runtime.Object{
 		drupalEnvironmentWithoutID,
+		drupalApplicationWithID,
 	}
 
 	r := buildFakeReconcile(objects)
@@ -557,8 +646,7 @@ func TestReconcileDrupalEnvironment_Reconcile_UnknownNamespace(t *testing.T) {
 
 	_, _ = r.Reconcile(req)      // migrate
 	_, _ = r.Reconcile(req)      // set id
-	_, _ = r.Reconcile(req)      // add finalizer
-	_, _ = r.Reconcile(req)      // label env
+	_, _ = r.Reconcile(req)      // add finalizer, labels and owner reference
 	res, err := r.Reconcile(req) // try to label namespace
 	require.Error(t, err)
 	require.False(t, res.Requeue)
@@ -601,7 +689,7 @@ func TestReconcileDrupalEnvironment_Reconcile_NonProdValues(t *testing.T) {
 		require.True(t, fullyReconciled)
 
 		drupalRollout := &rolloutsv1alpha1.Rollout{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "drupal", Namespace: req.Namespace}, drupalRollout)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithNonProdValues.ChildName(drupalRolloutName), Namespace: req.Namespace}, drupalRollout)
 		require.NoError(t, err)
 
 		require.True(t, goldenHelper.GoldenSpec(t, "Rollout", drupalRollout))
@@ -610,24 +698,82 @@ func TestReconcileDrupalEnvironment_Reconcile_NonProdValues(t *testing.T) {
 	t.Run("config file ConfigMaps should be correct", func(t *testing.T) {
 		// Verify the Apache ConfigMap
 		configMap := &v1.ConfigMap{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "apache-conf-enabled", Namespace: testNonProdNamespace}, configMap)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithNonProdValues.ChildName(apacheConfEnabledConfigMapName), Namespace: testNonProdNamespace}, configMap)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "apache-conf-enabled", configMap))
 
 		// Verify the php-config ConfigMap
 		configMap = &v1.ConfigMap{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "php-config", Namespace: testNonProdNamespace}, configMap)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithNonProdValues.ChildName(phpConfigMapName), Namespace: testNonProdNamespace}, configMap)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "php-config", configMap))
 
 		// Verify the phpfpm-config ConfigMap
 		configMap = &v1.ConfigMap{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "phpfpm-config", Namespace: testNonProdNamespace}, configMap)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: drupalEnvironmentWithNonProdValues.ChildName(phpfpmConfigMapName), Namespace: testNonProdNamespace}, configMap)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.GoldenSpec(t, "phpfpm-config", configMap))
 	})
 }
 
+func TestReconcileDrupalEnvironment_Reconcile_RemovesLegacySSHDClusterRoleBinding(t *testing.T) {
+	nonProdSshConfigMap := testSshAuthorizedKeysConfigMap.DeepCopy()
+	nonProdSshConfigMap.Namespace = testNonProdNamespace
+
+	legacyClusterRoleBinding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: sshdDeploymentName + "-" + testNonProdNamespace},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      sshdDeploymentName,
+			Namespace: testNonProdNamespace,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     "sshd",
+		},
+	}
+
+	// objects to track in the fake client
+	objects := []runtime.Object{
+		drupalEnvironmentWithNonProdValues,
+		testNonProdNamespaceResource,
+		drupalApplicationWithID,
+		testNonProdNewRelicSecret,
+		nonProdSshConfigMap,
+		legacyClusterRoleBinding,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      drupalEnvironmentWithNonProdValues.Name,
+			Namespace: drupalEnvironmentWithNonProdValues.Namespace,
+		},
+	}
+
+	fullyReconciled := false
+	for i := 0; i < 20; i++ {
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		if !res.Requeue && res.RequeueAfter == 0 {
+			fullyReconciled = true
+			break
+		}
+	}
+	require.True(t, fullyReconciled)
+
+	crb := &rbacv1.ClusterRoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: legacyClusterRoleBinding.Name}, crb)
+	require.True(t, errors.IsNotFound(err))
+
+	rb := &rbacv1.RoleBinding{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(sshdRoleName)}, rb)
+	require.NoError(t, err)
+	require.Equal(t, "Role", rb.RoleRef.Kind)
+}
+
 func TestReconcileDrupalEnvironment_ReconcileWithoutEnvID(t *testing.T) {
 	// Have to set it because - GenerateName doesn't work with fake client.
 	// drupalEnvironment.SetTargetNamespace("generated-namespace")
@@ -678,14 +824,8 @@ func TestReconcileDrupalEnvironment_ReconcileWithoutDrupalApplication(t *testing
 	}
 
 	res, err := r.Reconcile(req)
-	// expecting finalizer to be added, and must requeue
-	// there is separate test for finalizers
-	require.NoError(t, err)
-	require.True(t, res.Requeue)
-
-	// expecting gitRef to set, and must requeue
-	// there is a separate check for GitRef
-	res, err = r.Reconcile(req)
+	// expecting finalizer and gitRef label to be added, and must requeue
+	// there are separate checks for them
 	require.NoError(t, err)
 	require.True(t, res.Requeue)
 
@@ -693,6 +833,7 @@ func TestReconcileDrupalEnvironment_ReconcileWithoutDrupalApplication(t *testing
 		res, err := r.Reconcile(req)
 		require.NoError(t, err)
 		require.Equal(t, 10*time.Second, res.RequeueAfter)
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeWarning, common.ReasonParentApplicationMissing)
 	})
 }
 
@@ -777,6 +918,46 @@ func TestStageMigration(t *testing.T) {
 			require.NoError(t, err)
 			require.Equal(t, found.SpecVersion(), found.Labels[fnv1alpha1.VersionLabel])
 			require.Equal(t, test.expectedStage, found.Spec.Stage)
+			testhelpers.RequireEvent(t, r.recorder, v1.EventTypeNormal, common.ReasonMigrated)
+			if test.drenvStage == "" {
+				testhelpers.RequireEvent(t, r.recorder, v1.EventTypeWarning, common.ReasonMigrationWarning)
+			}
 		})
 	}
 }
+
+func TestNewRelicMigration(t *testing.T) {
+	env := drupalEnvironmentWithID.DeepCopy()
+	env.Labels[fnv1alpha1.VersionLabel] = "2"
+	env.Spec.Phpfpm.Apm = fnv1alpha1.SpecAPM{}
+	env.Spec.Phpfpm.NewRelicSecret = testNewRelicSecretName
+	env.Spec.Phpfpm.NewRelicAppName = "Test App"
+
+	objects := []runtime.Object{
+		testNamespaceResource,
+		drupalApplicationWithID,
+		env,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      env.Name,
+			Namespace: env.Namespace,
+		},
+	}
+
+	res, err := r.Reconcile(req)
+	require.NoError(t, err)
+	require.True(t, res.Requeue)
+
+	found := &fnv1alpha1.DrupalEnvironment{}
+	err = r.client.Get(context.TODO(), req.NamespacedName, found)
+	require.NoError(t, err)
+	require.Equal(t, found.SpecVersion(), found.Labels[fnv1alpha1.VersionLabel])
+	require.Equal(t, drupalEnvironmentWithID.Spec.Phpfpm.Apm, found.Spec.Phpfpm.Apm)
+	require.Empty(t, found.Spec.Phpfpm.NewRelicSecret)
+	require.Empty(t, found.Spec.Phpfpm.NewRelicAppName)
+	require.Equal(t, "prod", found.Spec.Stage)
+}
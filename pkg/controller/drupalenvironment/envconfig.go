@@ -31,7 +31,7 @@ type DomainMap map[Domain]SiteName
 // reconcileEnvConfigSecret reconciles the Environment-wide settings in the "env-config" Secret for the requested
 // DrupalEnvironment. The "env-config" Secret contains Drupal configuration files that sre needed by "sites.php" and
 // "settings.php" to properly configure the environment to match Polaris resource state.
-func (rh *requestHandler) reconcileEnvConfigSecret() (result reconcile.Result, err error) {
+func (rh *requestHandler) reconcileEnvConfigSecret() (changed bool, err error) {
 	ctx := context.TODO()
 
 	sites := &fnv1alpha1.SiteList{}
@@ -60,10 +60,11 @@ func (rh *requestHandler) reconcileEnvConfigSecret() (result reconcile.Result, e
 	}
 
 	r := rh.reconciler
-	if result, err = envconfig.UpdateDrupalSitesConfig(r.client, r.scheme, rh.env, sitesInc); err != nil {
+	var result reconcile.Result
+	if result, err = envconfig.UpdateDrupalSitesConfig(r.client, r.scheme, rh.env, sitesInc, rh.drift); err != nil {
 		rh.logger.Error(err, "Failed to update sites.php config")
 	}
-	return
+	return result.Requeue, err
 }
 
 // func sortedDomainMap() // TODO
@@ -1,56 +1,42 @@
 package drupalenvironment
 
 import (
-	"context"
-
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// drupalHPAName is the component of the Drupal HPA's name (see DrupalEnvironment.ChildName)
 const drupalHPAName = "drupal"
 
 func (rh *requestHandler) hpa() *autoscalingv1.HorizontalPodAutoscaler {
 	drupalSpec := rh.env.Spec.Drupal
-	targetmetric := drupalSpec.TargetCPUUtilizationPercentage
-	// FIXME: default values for CRDs
-	if targetmetric == nil {
-		tmp := int32(50)
-		targetmetric = &tmp
-	}
 
 	hpa := &autoscalingv1.HorizontalPodAutoscaler{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      drupalHPAName,
+			Name:      rh.env.ChildName(drupalHPAName),
 			Namespace: rh.namespace,
 			Labels:    rh.env.ChildLabels(),
 		},
 		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
-			MinReplicas: &drupalSpec.MinReplicas,
-			MaxReplicas: drupalSpec.MaxReplicas,
+			MinReplicas: drupalSpec.MinReplicas,
+			MaxReplicas: int32Value(drupalSpec.MaxReplicas),
 			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
 				APIVersion: "argoproj.io/v1alpha1",
 				Kind:       "Rollout",
-				Name:       drupalRolloutName,
+				Name:       rh.env.ChildName(drupalRolloutName),
 			},
-			TargetCPUUtilizationPercentage: targetmetric,
+			TargetCPUUtilizationPercentage: drupalSpec.TargetCPUUtilizationPercentage,
 		},
 	}
 	return hpa
 }
 
 func (rh *requestHandler) reconcileHPA() (bool, error) {
-	r := rh.reconciler
-
 	hpa := rh.hpa()
+	rh.associateResourceWithController(hpa)
 
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, hpa, func() error {
-		hpa.Spec = rh.hpa().Spec
-		if hpa.CreationTimestamp.IsZero() {
-			rh.associateResourceWithController(hpa)
-		}
-		return nil
-	})
+	op, err := rh.apply(hpa)
 	if err != nil {
 		return false, err
 	}
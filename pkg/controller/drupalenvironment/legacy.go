@@ -0,0 +1,76 @@
+package drupalenvironment
+
+import (
+	"context"
+
+	rolloutsv1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
+)
+
+// legacyChild is a child resource as named by older versions of the operator, with its component alone
+type legacyChild struct {
+	obj  runtime.Object
+	name string
+}
+
+// legacyChildren returns the child resources that older versions of the operator named with their component alone, in
+// the order they're removed
+func legacyChildren() []legacyChild {
+	return []legacyChild{
+		{&rolloutsv1alpha1.Rollout{}, drupalRolloutName},
+		{&autoscalingv1.HorizontalPodAutoscaler{}, drupalHPAName},
+		{&v1.Service{}, drupalServiceName},
+		{&v1.ConfigMap{}, phpConfigMapName},
+		{&v1.ConfigMap{}, phpfpmConfigMapName},
+		{&v1.ConfigMap{}, apacheConfEnabledConfigMapName},
+		{&v1.Secret{}, envconfig.SecretComponent},
+		{&appsv1.Deployment{}, sshdDeploymentName},
+		{&v1.Service{}, sshdServiceName},
+		{&rbacv1.RoleBinding{}, sshdRoleName},
+		{&rbacv1.Role{}, sshdRoleName},
+		{&v1.ServiceAccount{}, sshdDeploymentName},
+		{&networkingv1.NetworkPolicy{}, drupalNetworkPolicyName},
+		{&networkingv1.NetworkPolicy{}, sshdNetworkPolicyName},
+		{&networkingv1.NetworkPolicy{}, egressNetworkPolicyName},
+		{&v1.ResourceQuota{}, legacyQuotaName},
+		{&v1.LimitRange{}, legacyQuotaName},
+	}
+}
+
+// removeLegacyChildren migrates a namespace from older versions of the operator, which only allowed a single
+// environment per namespace, by deleting the child resources they named with their component alone. They're only
+// deleted once the Drupal Rollout is available under its new name, so that the environment keeps serving in the
+// meantime. Only children controlled by this DrupalEnvironment are deleted.
+func (rh *requestHandler) removeLegacyChildren() (changed bool, err error) {
+	rollout := &rolloutsv1alpha1.Rollout{}
+	key := types.NamespacedName{Namespace: rh.namespace, Name: rh.env.ChildName(drupalRolloutName)}
+	if err = rh.reconciler.client.Get(context.TODO(), key, rollout); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return
+	}
+	if !isAvailable(rollout) {
+		rh.logger.V(1).Info("Waiting for the Drupal Rollout to be available before removing legacy child resources")
+		return false, nil
+	}
+
+	for _, child := range legacyChildren() {
+		var removed bool
+		if removed, err = rh.removeOwnedObject(child.obj, child.name); err != nil {
+			rh.logger.Error(err, "Failed to remove legacy child resource", "name", child.name)
+			return
+		}
+		changed = changed || removed
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package drupalenvironment
+
+import (
+	"context"
+	"testing"
+
+	rolloutsv1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/argoproj/argo-rollouts/utils/conditions"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+func TestReconcileDrupalEnvironment_RemovesLegacyChildren(t *testing.T) {
+	env := drupalEnvironmentWithNonProdValues
+	controllerRef := metav1.NewControllerRef(env, fnv1alpha1.SchemeGroupVersion.WithKind("DrupalEnvironment"))
+	otherRef := metav1.NewControllerRef(env, fnv1alpha1.SchemeGroupVersion.WithKind("DrupalEnvironment"))
+	otherRef.Name = "other"
+	otherRef.UID = "other"
+
+	legacyService := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       testNonProdNamespace,
+			Name:            drupalServiceName,
+			OwnerReferences: []metav1.OwnerReference{*controllerRef},
+		},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	// A ConfigMap with a legacy name, but controlled by another environment
+	otherConfigMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       testNonProdNamespace,
+			Name:            phpConfigMapName,
+			OwnerReferences: []metav1.OwnerReference{*otherRef},
+		},
+	}
+
+	objects := []runtime.Object{
+		env,
+		testNonProdNamespaceResource,
+		drupalApplicationWithID,
+		testNonProdNewRelicSecret,
+		legacyService,
+		otherConfigMap,
+	}
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: env.Name, Namespace: env.Namespace},
+	}
+	exists := func(obj runtime.Object, name string) bool {
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: name}, obj)
+		if errors.IsNotFound(err) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	t.Run("should keep legacy children until the Rollout is available", func(t *testing.T) {
+		reconcileUntilDone(t, r, req)
+
+		require.True(t, exists(&v1.Service{}, env.ChildName(drupalServiceName)))
+		require.True(t, exists(&v1.Service{}, drupalServiceName))
+	})
+
+	t.Run("should remove the legacy children it controls", func(t *testing.T) {
+		rollout := &rolloutsv1alpha1.Rollout{}
+		require.True(t, exists(rollout, env.ChildName(drupalRolloutName)))
+		conditions.SetRolloutCondition(&rollout.Status, rolloutsv1alpha1.RolloutCondition{
+			LastTransitionTime: metav1.Now(),
+			LastUpdateTime:     metav1.Now(),
+			Reason:             conditions.AvailableReason,
+			Status:             v1.ConditionTrue,
+			Type:               rolloutsv1alpha1.RolloutAvailable,
+		})
+		require.NoError(t, r.client.Update(context.TODO(), rollout))
+
+		reconcileUntilDone(t, r, req)
+
+		require.False(t, exists(&v1.Service{}, drupalServiceName))
+		require.True(t, exists(&v1.ConfigMap{}, phpConfigMapName))
+		require.True(t, exists(&v1.ConfigMap{}, env.ChildName(phpConfigMapName)))
+	})
+}
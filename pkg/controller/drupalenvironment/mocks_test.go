@@ -8,8 +8,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/apm"
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 )
 
@@ -87,7 +89,7 @@ var (
 			Namespace: testNamespace,
 			Labels: map[string]string{
 				fnv1alpha1.EnvironmentIdLabel: testEnvID,
-				fnv1alpha1.VersionLabel:       "2",
+				fnv1alpha1.VersionLabel:       "3",
 			},
 		},
 		Spec: fnv1alpha1.DrupalEnvironmentSpec{
@@ -106,39 +108,42 @@ var (
 			Production: true,
 			Phpfpm: fnv1alpha1.SpecPhpFpm{
 				Tag:                             "7.3",
-				Procs:                           4,
-				ProcMemoryLimitMiB:              128,
-				PostMaxSizeMiB:                  8,
-				OpcacheMemoryLimitMiB:           96,
-				OpcacheInternedStringsBufferMiB: 8,
-				ApcMemoryLimitMiB:               32,
-				MaxInputVars:                    1000,
-				MaxExecutionTime:                30,
-				NewRelicAppName:                 "Test App",
-				NewRelicSecret:                  testNewRelicSecretName,
+				Procs:                           pointer.Int32Ptr(4),
+				ProcMemoryLimitMiB:              pointer.Int32Ptr(128),
+				PostMaxSizeMiB:                  pointer.Int32Ptr(8),
+				OpcacheMemoryLimitMiB:           pointer.Int32Ptr(96),
+				OpcacheInternedStringsBufferMiB: pointer.Int32Ptr(8),
+				ApcMemoryLimitMiB:               pointer.Int32Ptr(32),
+				MaxInputVars:                    pointer.Int32Ptr(1000),
+				MaxExecutionTime:                pointer.Int32Ptr(30),
+				Apm: fnv1alpha1.SpecAPM{
+					Provider: fnv1alpha1.APMProviderNewRelic,
+					Secret:   testNewRelicSecretName,
+					AppName:  "Test App",
+				},
 			},
 			Drupal: fnv1alpha1.SpecDrupal{
-				MinReplicas:                    2,
-				MaxReplicas:                    2,
+				MinReplicas:                    pointer.Int32Ptr(2),
+				MaxReplicas:                    pointer.Int32Ptr(2),
 				Tag:                            "1.0.0",
 				PullPolicy:                     "Always",
 				TargetCPUUtilizationPercentage: &testCPUUtilization,
 
 				Liveness: fnv1alpha1.HTTPProbe{
-					Enabled:          true,
+					Enabled:          pointer.BoolPtr(true),
 					HTTPPath:         "/user/login",
-					TimeoutSeconds:   5,
-					FailureThreshold: 5,
-					SuccessThreshold: 1,
-					PeriodSeconds:    10,
+					TimeoutSeconds:   pointer.Int32Ptr(5),
+					FailureThreshold: pointer.Int32Ptr(5),
+					SuccessThreshold: pointer.Int32Ptr(1),
+					PeriodSeconds:    pointer.Int32Ptr(10),
 				},
 				Readiness: fnv1alpha1.HTTPProbe{
-					Enabled:          true,
+					Enabled:          pointer.BoolPtr(true),
 					HTTPPath:         "/user/login",
-					TimeoutSeconds:   5,
-					FailureThreshold: 5,
-					SuccessThreshold: 1,
-					PeriodSeconds:    10,
+					TimeoutSeconds:   pointer.Int32Ptr(5),
+					FailureThreshold: pointer.Int32Ptr(5),
+					SuccessThreshold: pointer.Int32Ptr(1),
+					PeriodSeconds:    pointer.Int32Ptr(10),
 				},
 			},
 			Apache: fnv1alpha1.SpecApache{
@@ -154,7 +159,7 @@ var (
 			Namespace: testNonProdNamespace,
 			Labels: map[string]string{
 				fnv1alpha1.EnvironmentIdLabel: testSecondEnvID,
-				fnv1alpha1.VersionLabel:       "2",
+				fnv1alpha1.VersionLabel:       "3",
 			},
 		},
 		Spec: fnv1alpha1.DrupalEnvironmentSpec{
@@ -173,38 +178,41 @@ var (
 			Production: false,
 			Phpfpm: fnv1alpha1.SpecPhpFpm{
 				Tag:                             "7.3",
-				Procs:                           4,
-				ProcMemoryLimitMiB:              128,
-				PostMaxSizeMiB:                  8,
-				OpcacheMemoryLimitMiB:           96,
-				OpcacheInternedStringsBufferMiB: 8,
-				ApcMemoryLimitMiB:               32,
-				MaxInputVars:                    1000,
-				MaxExecutionTime:                30,
-				NewRelicSecret:                  testNewRelicSecretName,
+				Procs:                           pointer.Int32Ptr(4),
+				ProcMemoryLimitMiB:              pointer.Int32Ptr(128),
+				PostMaxSizeMiB:                  pointer.Int32Ptr(8),
+				OpcacheMemoryLimitMiB:           pointer.Int32Ptr(96),
+				OpcacheInternedStringsBufferMiB: pointer.Int32Ptr(8),
+				ApcMemoryLimitMiB:               pointer.Int32Ptr(32),
+				MaxInputVars:                    pointer.Int32Ptr(1000),
+				MaxExecutionTime:                pointer.Int32Ptr(30),
+				Apm: fnv1alpha1.SpecAPM{
+					Provider: fnv1alpha1.APMProviderNewRelic,
+					Secret:   testNewRelicSecretName,
+				},
 			},
 			Drupal: fnv1alpha1.SpecDrupal{
-				MinReplicas:                    2,
-				MaxReplicas:                    2,
+				MinReplicas:                    pointer.Int32Ptr(2),
+				MaxReplicas:                    pointer.Int32Ptr(2),
 				Tag:                            "1.0.0",
 				PullPolicy:                     "Always",
 				TargetCPUUtilizationPercentage: &testCPUUtilization,
 
 				Liveness: fnv1alpha1.HTTPProbe{
-					Enabled:          true,
+					Enabled:          pointer.BoolPtr(true),
 					HTTPPath:         "/user/login",
-					TimeoutSeconds:   5,
-					FailureThreshold: 5,
-					SuccessThreshold: 1,
-					PeriodSeconds:    10,
+					TimeoutSeconds:   pointer.Int32Ptr(5),
+					FailureThreshold: pointer.Int32Ptr(5),
+					SuccessThreshold: pointer.Int32Ptr(1),
+					PeriodSeconds:    pointer.Int32Ptr(10),
 				},
 				Readiness: fnv1alpha1.HTTPProbe{
-					Enabled:          true,
+					Enabled:          pointer.BoolPtr(true),
 					HTTPPath:         "/user/login",
-					TimeoutSeconds:   5,
-					FailureThreshold: 5,
-					SuccessThreshold: 1,
-					PeriodSeconds:    10,
+					TimeoutSeconds:   pointer.Int32Ptr(5),
+					FailureThreshold: pointer.Int32Ptr(5),
+					SuccessThreshold: pointer.Int32Ptr(1),
+					PeriodSeconds:    pointer.Int32Ptr(10),
 				},
 			},
 			Apache: fnv1alpha1.SpecApache{
@@ -281,7 +289,7 @@ var (
 			Namespace: testNamespace,
 		},
 		Data: map[string][]byte{
-			newRelicLicenseSecretKey: []byte("1234567890abcdef"),
+			apm.NewRelicLicenseSecretKey: []byte("1234567890abcdef"),
 		},
 	}
 
@@ -291,7 +299,7 @@ var (
 			Namespace: testNonProdNamespace,
 		},
 		Data: map[string][]byte{
-			newRelicLicenseSecretKey: []byte("3333333333333333"),
+			apm.NewRelicLicenseSecretKey: []byte("3333333333333333"),
 		},
 	}
 
@@ -315,7 +323,8 @@ func buildFakeReconcile(objects []runtime.Object) *ReconcileDrupalEnvironment {
 
 	// create a ReconcileDrupalEnvironment object with the scheme and fake client
 	return &ReconcileDrupalEnvironment{
-		client: client,
-		scheme: scheme.Scheme,
+		client:   client,
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
 	}
 }
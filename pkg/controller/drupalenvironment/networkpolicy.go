@@ -0,0 +1,402 @@
+package drupalenvironment
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/apm"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+// The components of the NetworkPolicies' names (see DrupalEnvironment.ChildName)
+const (
+	drupalNetworkPolicyName = "drupal"
+	sshdNetworkPolicyName   = "sshd"
+	egressNetworkPolicyName = "egress"
+
+	defaultDatabasePort = 3306
+
+	// databaseHostResolvePeriod is how often the environment is reconciled again when its egress NetworkPolicy allows
+	// Database or APM hosts by their resolved IPs, so that the policy follows changes to them
+	databaseHostResolvePeriod = 5 * time.Minute
+)
+
+// lookupIP resolves Database and APM hostnames to IPs. Declared as a var so that it can be mocked in tests.
+var lookupIP = net.LookupIP
+
+var networkPolicyNames = []string{drupalNetworkPolicyName, sshdNetworkPolicyName, egressNetworkPolicyName}
+
+// reconcileNetworkPolicies restricts traffic to and from the DrupalEnvironment's Pods. Ingress to Drupal is only
+// allowed from the ingress controller (or Istio gateway), ingress to SSHD only from the SSH proxy, and egress only to
+// DNS, the Databases of the environment's Sites, its APM provider, and a configured allowlist.
+func (rh *requestHandler) reconcileNetworkPolicies() (changed bool, err error) {
+	if !common.NetworkPoliciesEnabled() {
+		return rh.removeNetworkPolicies()
+	}
+
+	specs := make(map[string]networkingv1.NetworkPolicySpec, len(networkPolicyNames))
+	if specs[drupalNetworkPolicyName], err = rh.drupalNetworkPolicySpec(); err != nil {
+		return
+	}
+	if specs[sshdNetworkPolicyName], err = rh.sshdNetworkPolicySpec(); err != nil {
+		return
+	}
+	if specs[egressNetworkPolicyName], err = rh.egressNetworkPolicySpec(); err != nil {
+		return
+	}
+
+	for _, name := range networkPolicyNames {
+		npChanged, err := rh.reconcileNetworkPolicy(name, specs[name])
+		if err != nil {
+			return false, err
+		}
+		changed = changed || npChanged
+	}
+	return
+}
+
+func (rh *requestHandler) reconcileNetworkPolicy(name string, desired networkingv1.NetworkPolicySpec) (changed bool, err error) {
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: rh.env.ChildName(name), Labels: rh.env.ChildLabels()},
+		Spec:       desired,
+	}
+	rh.associateResourceWithController(np)
+
+	op, err := rh.apply(np)
+	if err != nil {
+		rh.logger.Error(err, "Failed to reconcile NetworkPolicy", "name", name)
+		return
+	}
+	if op != controllerutil.OperationResultNone {
+		rh.logger.Info("Reconciled NetworkPolicy", "name", name, "op", op)
+		changed = true
+	}
+	return
+}
+
+// removeNetworkPolicies deletes any NetworkPolicies previously created for this DrupalEnvironment, in case they were
+// disabled after being enabled.
+func (rh *requestHandler) removeNetworkPolicies() (changed bool, err error) {
+	ctx := context.TODO()
+	for _, name := range networkPolicyNames {
+		np := &networkingv1.NetworkPolicy{}
+		if err = rh.reconciler.client.Get(ctx, types.NamespacedName{Namespace: rh.namespace, Name: rh.env.ChildName(name)}, np); err != nil {
+			if errors.IsNotFound(err) {
+				err = nil
+				continue
+			}
+			return
+		}
+		if !common.IsControlledBy(rh.env, np) {
+			continue
+		}
+
+		rh.logger.Info("Removing NetworkPolicy, since NetworkPolicies are disabled", "name", name)
+		if err = rh.reconciler.client.Delete(ctx, np); err != nil && !errors.IsNotFound(err) {
+			return
+		}
+		err = nil
+		changed = true
+	}
+	return
+}
+
+func (rh *requestHandler) drupalNetworkPolicySpec() (spec networkingv1.NetworkPolicySpec, err error) {
+	selectorString := common.IngressNamespaceSelector()
+	if common.IsIstioEnabled() {
+		selectorString = common.IstioGatewayNamespaceSelector()
+	}
+	ingressNamespaces, err := metav1.ParseToLabelSelector(selectorString)
+	if err != nil {
+		return spec, fmt.Errorf("invalid ingress namespace selector %q: %v", selectorString, err)
+	}
+
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: labelsForRollout(rh.env)},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromString("http"))},
+			From:  []networkingv1.NetworkPolicyPeer{{NamespaceSelector: ingressNamespaces}},
+		}},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}, nil
+}
+
+func (rh *requestHandler) sshdNetworkPolicySpec() (spec networkingv1.NetworkPolicySpec, err error) {
+	selectorString := common.SSHProxyNamespaceSelector()
+	sshProxyNamespaces, err := metav1.ParseToLabelSelector(selectorString)
+	if err != nil {
+		return spec, fmt.Errorf("invalid SSH proxy namespace selector %q: %v", selectorString, err)
+	}
+
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: common.MergeLabels(rh.env.ChildLabels(), map[string]string{"app": "sshd"}),
+		},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(intstr.FromString("ssh"))},
+			From:  []networkingv1.NetworkPolicyPeer{{NamespaceSelector: sshProxyNamespaces}},
+		}},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}, nil
+}
+
+func (rh *requestHandler) egressNetworkPolicySpec() (spec networkingv1.NetworkPolicySpec, err error) {
+	udp := v1.ProtocolUDP
+	dnsPort := intstr.FromInt(53)
+
+	dnsNamespaces, err := metav1.ParseToLabelSelector(common.DNSNamespaceSelector())
+	if err != nil {
+		return spec, fmt.Errorf("invalid DNS namespace selector %q: %v", common.DNSNamespaceSelector(), err)
+	}
+	dnsPods, err := metav1.ParseToLabelSelector(common.DNSPodSelector())
+	if err != nil {
+		return spec, fmt.Errorf("invalid DNS pod selector %q: %v", common.DNSPodSelector(), err)
+	}
+
+	rules := []networkingv1.NetworkPolicyEgressRule{
+		// DNS
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &dnsPort},
+				tcpPort(dnsPort),
+			},
+			To: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: dnsNamespaces, PodSelector: dnsPods}},
+		},
+		// Other Pods of this environment
+		{
+			To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: rh.env.ChildLabels()}}},
+		},
+	}
+
+	dbRules, err := rh.databaseEgressRules()
+	if err != nil {
+		return
+	}
+	rules = append(rules, dbRules...)
+
+	apmRules, err := rh.apmEgressRules()
+	if err != nil {
+		return
+	}
+	rules = append(rules, apmRules...)
+
+	// Sidecars need to reach the Istio control plane
+	if common.IsIstioEnabled() {
+		var istioNamespaces *metav1.LabelSelector
+		if istioNamespaces, err = metav1.ParseToLabelSelector(common.IstioGatewayNamespaceSelector()); err != nil {
+			return spec, fmt.Errorf("invalid Istio namespace selector %q: %v", common.IstioGatewayNamespaceSelector(), err)
+		}
+		rules = append(rules, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: istioNamespaces}},
+		})
+	}
+
+	// Configured allowlist
+	if s := common.EgressAllowedNamespaceSelector(); s != "" {
+		var allowedNamespaces *metav1.LabelSelector
+		if allowedNamespaces, err = metav1.ParseToLabelSelector(s); err != nil {
+			return spec, fmt.Errorf("invalid egress namespace selector %q: %v", s, err)
+		}
+		rules = append(rules, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: allowedNamespaces}},
+		})
+	}
+	if cidrs := common.EgressAllowedCIDRs(); len(cidrs) > 0 {
+		rule := networkingv1.NetworkPolicyEgressRule{}
+		for _, cidr := range cidrs {
+			rule.To = append(rule.To, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+		}
+		rules = append(rules, rule)
+	}
+
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: rh.env.ChildLabels()},
+		Egress:      rules,
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+	}, nil
+}
+
+// databaseEgressRules returns an egress rule for each distinct Database host and port used by the environment's Sites.
+// Sites whose Database doesn't exist yet are skipped; the policy will be updated once it's created. Hostnames are
+// resolved again every databaseHostResolvePeriod.
+func (rh *requestHandler) databaseEgressRules() (rules []networkingv1.NetworkPolicyEgressRule, err error) {
+	ctx := context.TODO()
+
+	sites := &fnv1alpha1.SiteList{}
+	err = rh.reconciler.client.List(ctx, sites, client.InNamespace(rh.namespace), client.MatchingLabels(rh.env.ChildLabels()))
+	if err != nil {
+		rh.logger.Error(err, "Failed to list Sites")
+		return
+	}
+
+	// Sort sites by name to avoid spurious updates due to indefinite ordering
+	sort.Slice(sites.Items, func(i, j int) bool {
+		return sites.Items[i].Name < sites.Items[j].Name
+	})
+
+	seen := make(map[string]bool)
+	for _, site := range sites.Items {
+		db := &fnv1alpha1.Database{}
+		if err = rh.reconciler.client.Get(ctx, types.NamespacedName{Namespace: rh.namespace, Name: site.Spec.Database}, db); err != nil {
+			if errors.IsNotFound(err) {
+				rh.logger.Info("Database for Site not found, not allowing egress to it yet", "site", site.Name, "database", site.Spec.Database)
+				err = nil
+				continue
+			}
+			return
+		}
+
+		port := db.Spec.Port
+		if port == 0 {
+			port = defaultDatabasePort
+		}
+
+		key := fmt.Sprintf("%v:%v", db.Spec.Host, port)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		npPort := tcpPort(intstr.FromInt(port))
+		var peers []networkingv1.NetworkPolicyPeer
+		if peers, err = rh.hostPeers(db.Spec.Host, npPort); err != nil {
+			return
+		}
+		if len(peers) == 0 {
+			continue
+		}
+		rules = append(rules, networkingv1.NetworkPolicyEgressRule{Ports: []networkingv1.NetworkPolicyPort{npPort}, To: peers})
+	}
+	return
+}
+
+// apmEgressRules returns an egress rule for each destination of the environment's APM provider. Agents on the Pod's
+// node are allowed on their port alone, since the node's IP differs between Pods. In-cluster Service names
+// ("<service>.<namespace>.svc...") are allowed by their namespace, since NetworkPolicies don't apply to Service IPs.
+func (rh *requestHandler) apmEgressRules() (rules []networkingv1.NetworkPolicyEgressRule, err error) {
+	// An invalid APM configuration is reported when rendering the "php-config" ConfigMap
+	provider, providerErr := apm.ForEnvironment(rh.app, rh.env)
+	if providerErr != nil || provider == nil {
+		return nil, nil
+	}
+
+	for _, d := range provider.Destinations() {
+		protocol := d.Protocol
+		port := intstr.FromInt(d.Port)
+		npPort := networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port}
+		rule := networkingv1.NetworkPolicyEgressRule{Ports: []networkingv1.NetworkPolicyPort{npPort}}
+
+		if d.Host != "" {
+			if namespace := serviceNamespace(d.Host); namespace != "" {
+				rule.To = []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": namespace}},
+				}}
+			} else {
+				if rule.To, err = rh.hostPeers(d.Host, npPort); err != nil {
+					return
+				}
+				if len(rule.To) == 0 {
+					continue
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// serviceNamespace returns the namespace of an in-cluster Service hostname ("<service>.<namespace>.svc", optionally
+// followed by the cluster domain), or "" for other hosts
+func serviceNamespace(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 3 && parts[2] == "svc" {
+		return parts[1]
+	}
+	return ""
+}
+
+// hostPeers returns a peer for each IP of the given host, which may itself be an IP. Hostnames are resolved again every
+// databaseHostResolvePeriod. If a hostname can't be resolved, the IPs that the applied egress NetworkPolicy allows on
+// the same port are kept, rather than failing the reconcile or cutting off the host.
+func (rh *requestHandler) hostPeers(host string, port networkingv1.NetworkPolicyPort) (peers []networkingv1.NetworkPolicyPeer, err error) {
+	if net.ParseIP(host) == nil {
+		rh.requeueAfter = databaseHostResolvePeriod
+	}
+
+	cidrs, lookupErr := resolveHostCIDRs(host)
+	if lookupErr != nil {
+		rh.logger.Error(lookupErr, "Failed to resolve host, keeping the IPs previously allowed on its port", "host", host)
+		return rh.previousEgressPeers(port)
+	}
+
+	for _, cidr := range cidrs {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	return
+}
+
+// previousEgressPeers returns the IP peers of the applied egress NetworkPolicy's rules for the given port
+func (rh *requestHandler) previousEgressPeers(port networkingv1.NetworkPolicyPort) (peers []networkingv1.NetworkPolicyPeer, err error) {
+	np := &networkingv1.NetworkPolicy{}
+	key := types.NamespacedName{Namespace: rh.namespace, Name: rh.env.ChildName(egressNetworkPolicyName)}
+	if err = rh.reconciler.client.Get(context.TODO(), key, np); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, rule := range np.Spec.Egress {
+		if len(rule.Ports) != 1 || !equality.Semantic.DeepEqual(rule.Ports[0], port) {
+			continue
+		}
+		for _, peer := range rule.To {
+			if peer.IPBlock != nil && !seen[peer.IPBlock.CIDR] {
+				seen[peer.IPBlock.CIDR] = true
+				peers = append(peers, peer)
+			}
+		}
+	}
+	return
+}
+
+// resolveHostCIDRs returns single-address CIDRs for all IPs of the given host, which may itself be an IP
+func resolveHostCIDRs(host string) (cidrs []string, err error) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = lookupIP(host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			cidrs = append(cidrs, ip.String()+"/32")
+		} else {
+			cidrs = append(cidrs, ip.String()+"/128")
+		}
+	}
+	sort.Strings(cidrs)
+	return
+}
+
+func tcpPort(port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	tcp := v1.ProtocolTCP
+	return networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &port}
+}
@@ -0,0 +1,279 @@
+package drupalenvironment
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+const testDatabaseHost = "db.example.com"
+
+var (
+	testNonProdSite = &fnv1alpha1.Site{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testSiteName,
+			Namespace: testNonProdNamespace,
+			Labels: map[string]string{
+				fnv1alpha1.ApplicationIdLabel: testAppID,
+				fnv1alpha1.EnvironmentIdLabel: testSecondEnvID,
+				fnv1alpha1.SiteIdLabel:        testSiteID,
+			},
+		},
+		Spec: fnv1alpha1.SiteSpec{
+			Environment: testNonProdEnvironmentName,
+			Domains:     []string{testDomain1},
+			Database:    testDatabaseResourceName,
+		},
+	}
+
+	testNonProdDatabase = &fnv1alpha1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testDatabaseResourceName,
+			Namespace: testNonProdNamespace,
+		},
+		Spec: fnv1alpha1.DatabaseSpec{
+			Host:       testDatabaseHost,
+			SchemaName: "wlgore",
+			User:       "wlgore",
+			UserSecret: "wlgore-db",
+		},
+	}
+)
+
+// reconcileUntilDone reconciles the DrupalEnvironment until it no longer requeues, other than to resolve its Database
+// hosts again, and returns the number of passes
+func reconcileUntilDone(t *testing.T, r *ReconcileDrupalEnvironment, req reconcile.Request) int {
+	for i := 1; i <= 30; i++ {
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		if !res.Requeue && (res.RequeueAfter == 0 || res.RequeueAfter == databaseHostResolvePeriod) {
+			return i
+		}
+	}
+	require.Fail(t, "DrupalEnvironment did not finish reconciling")
+	return 0
+}
+
+func TestReconcileDrupalEnvironment_NetworkPolicies(t *testing.T) {
+	nonProdSshConfigMap := testSshAuthorizedKeysConfigMap.DeepCopy()
+	nonProdSshConfigMap.Namespace = testNonProdNamespace
+
+	objects := []runtime.Object{
+		drupalEnvironmentWithNonProdValues,
+		testNonProdNamespaceResource,
+		drupalApplicationWithID,
+		testNonProdNewRelicSecret,
+		nonProdSshConfigMap,
+		testNonProdSite,
+		testNonProdDatabase,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      drupalEnvironmentWithNonProdValues.Name,
+			Namespace: drupalEnvironmentWithNonProdValues.Namespace,
+		},
+	}
+
+	lookupIP = func(host string) ([]net.IP, error) {
+		require.Equal(t, testDatabaseHost, host)
+		return []net.IP{net.ParseIP("10.0.2.20"), net.ParseIP("10.0.1.10")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	_ = os.Setenv("NEWRELIC_DAEMON_ADDR", "newrelic.newrelic.svc.cluster.local:9999")
+	common.SetNetworkPoliciesEnabled_ForTestsOnly(true)
+	common.SetEgressAllowedCIDRs_ForTestsOnly([]string{"192.168.0.0/16"})
+	defer func() {
+		common.SetNetworkPoliciesEnabled_ForTestsOnly(false)
+		common.SetEgressAllowedCIDRs_ForTestsOnly(nil)
+	}()
+
+	t.Run("should create NetworkPolicies", func(t *testing.T) {
+		reconcileUntilDone(t, r, req)
+
+		np := &networkingv1.NetworkPolicy{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(drupalNetworkPolicyName)}, np)
+		require.NoError(t, err)
+		require.Equal(t, "drupal", np.Spec.PodSelector.MatchLabels["app"])
+		require.Equal(t, testSecondEnvID, np.Spec.PodSelector.MatchLabels[fnv1alpha1.EnvironmentIdLabel])
+		require.Len(t, np.Spec.Ingress, 1)
+		require.Equal(t, "ingress-nginx", np.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels["name"])
+		require.Equal(t, "http", np.Spec.Ingress[0].Ports[0].Port.String())
+
+		np = &networkingv1.NetworkPolicy{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(sshdNetworkPolicyName)}, np)
+		require.NoError(t, err)
+		require.Equal(t, "sshd", np.Spec.PodSelector.MatchLabels["app"])
+		require.Equal(t, "acquia-polaris-system", np.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels["name"])
+		require.Equal(t, "ssh", np.Spec.Ingress[0].Ports[0].Port.String())
+
+		np = &networkingv1.NetworkPolicy{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(egressNetworkPolicyName)}, np)
+		require.NoError(t, err)
+		require.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}, np.Spec.PolicyTypes)
+		require.Equal(t, drupalEnvironmentWithNonProdValues.ChildLabels(), np.Spec.PodSelector.MatchLabels)
+
+		// DNS, same environment, Database, New Relic daemon, allowlist
+		require.Len(t, np.Spec.Egress, 5)
+		require.Equal(t, "53", np.Spec.Egress[0].Ports[0].Port.String())
+		require.Len(t, np.Spec.Egress[0].To, 1)
+		require.Equal(t, "kube-system", np.Spec.Egress[0].To[0].NamespaceSelector.MatchLabels["name"])
+		require.Equal(t, "kube-dns", np.Spec.Egress[0].To[0].PodSelector.MatchLabels["k8s-app"])
+		require.Equal(t, drupalEnvironmentWithNonProdValues.ChildLabels(), np.Spec.Egress[1].To[0].PodSelector.MatchLabels)
+
+		dbRule := np.Spec.Egress[2]
+		require.Equal(t, "3306", dbRule.Ports[0].Port.String())
+		require.Len(t, dbRule.To, 2)
+		require.Equal(t, "10.0.1.10/32", dbRule.To[0].IPBlock.CIDR)
+		require.Equal(t, "10.0.2.20/32", dbRule.To[1].IPBlock.CIDR)
+
+		apmRule := np.Spec.Egress[3]
+		require.Equal(t, "9999", apmRule.Ports[0].Port.String())
+		require.Equal(t, "newrelic", apmRule.To[0].NamespaceSelector.MatchLabels["name"])
+
+		require.Equal(t, "192.168.0.0/16", np.Spec.Egress[4].To[0].IPBlock.CIDR)
+	})
+
+	t.Run("should resolve Database hosts again periodically", func(t *testing.T) {
+		lookupIP = func(host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP("10.0.3.30")}, nil
+		}
+
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.Equal(t, databaseHostResolvePeriod, res.RequeueAfter)
+
+		np := &networkingv1.NetworkPolicy{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(egressNetworkPolicyName)}, np)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.3.30/32", np.Spec.Egress[2].To[0].IPBlock.CIDR)
+	})
+
+	t.Run("should keep the previous IPs of a Database host that can't be resolved", func(t *testing.T) {
+		lookupIP = func(host string) ([]net.IP, error) {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		res, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.Equal(t, databaseHostResolvePeriod, res.RequeueAfter)
+
+		np := &networkingv1.NetworkPolicy{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(egressNetworkPolicyName)}, np)
+		require.NoError(t, err)
+		require.Len(t, np.Spec.Egress, 5)
+		require.Equal(t, "3306", np.Spec.Egress[2].Ports[0].Port.String())
+		require.Len(t, np.Spec.Egress[2].To, 1)
+		require.Equal(t, "10.0.3.30/32", np.Spec.Egress[2].To[0].IPBlock.CIDR)
+	})
+
+	t.Run("should follow Istio gateway namespace", func(t *testing.T) {
+		common.SetIsIstioEnabled_ForTestsOnly(true)
+		defer common.SetIsIstioEnabled_ForTestsOnly(false)
+
+		reconcileUntilDone(t, r, req)
+
+		np := &networkingv1.NetworkPolicy{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(drupalNetworkPolicyName)}, np)
+		require.NoError(t, err)
+		require.Equal(t, "istio-system", np.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels["name"])
+	})
+
+	t.Run("should remove NetworkPolicies when disabled", func(t *testing.T) {
+		common.SetNetworkPoliciesEnabled_ForTestsOnly(false)
+
+		reconcileUntilDone(t, r, req)
+
+		for _, name := range networkPolicyNames {
+			np := &networkingv1.NetworkPolicy{}
+			err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: drupalEnvironmentWithNonProdValues.ChildName(name)}, np)
+			require.True(t, errors.IsNotFound(err), name)
+		}
+	})
+}
+
+func TestReconcileDrupalEnvironment_APMEgress(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		require.Equal(t, "otlp.example.com", host)
+		return []net.IP{net.ParseIP("10.0.4.40")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	common.SetNetworkPoliciesEnabled_ForTestsOnly(true)
+	defer common.SetNetworkPoliciesEnabled_ForTestsOnly(false)
+
+	tests := []struct {
+		name     string
+		apm      fnv1alpha1.SpecAPM
+		port     string
+		protocol v1.Protocol
+		to       []networkingv1.NetworkPolicyPeer
+	}{
+		{
+			name:     "New Relic daemon Service",
+			apm:      fnv1alpha1.SpecAPM{Provider: fnv1alpha1.APMProviderNewRelic, Secret: testNewRelicSecretName, Settings: map[string]string{"daemonAddress": "newrelic-daemon.monitoring.svc.cluster.local:31339"}},
+			port:     "31339",
+			protocol: v1.ProtocolTCP,
+			to:       []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "monitoring"}}}},
+		},
+		{
+			name:     "Datadog agent on the node",
+			apm:      fnv1alpha1.SpecAPM{Provider: fnv1alpha1.APMProviderDatadog},
+			port:     "8126",
+			protocol: v1.ProtocolTCP,
+		},
+		{
+			name:     "Datadog agent at an IP",
+			apm:      fnv1alpha1.SpecAPM{Provider: fnv1alpha1.APMProviderDatadog, Settings: map[string]string{"agentHost": "10.0.5.50", "agentPort": "9126"}},
+			port:     "9126",
+			protocol: v1.ProtocolTCP,
+			to:       []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.5.50/32"}}},
+		},
+		{
+			name:     "OpenTelemetry endpoint",
+			apm:      fnv1alpha1.SpecAPM{Provider: fnv1alpha1.APMProviderOpenTelemetry, Settings: map[string]string{"endpoint": "https://otlp.example.com"}},
+			port:     "443",
+			protocol: v1.ProtocolTCP,
+			to:       []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.4.40/32"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := drupalEnvironmentWithNonProdValues.DeepCopy()
+			env.Spec.Phpfpm.Apm = tt.apm
+
+			r := buildFakeReconcile([]runtime.Object{env, testNonProdNamespaceResource, drupalApplicationWithID, testNonProdNewRelicSecret})
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: env.Name, Namespace: env.Namespace}}
+			reconcileUntilDone(t, r, req)
+
+			np := &networkingv1.NetworkPolicy{}
+			err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: env.ChildName(egressNetworkPolicyName)}, np)
+			require.NoError(t, err)
+
+			// DNS, same environment, APM
+			require.Len(t, np.Spec.Egress, 3)
+			rule := np.Spec.Egress[2]
+			require.Len(t, rule.Ports, 1)
+			require.Equal(t, tt.port, rule.Ports[0].Port.String())
+			require.Equal(t, tt.protocol, *rule.Ports[0].Protocol)
+			require.Equal(t, tt.to, rule.To)
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package drupalenvironment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+const (
+	// namespaceQuotaName is the name of the ResourceQuota and LimitRange shared by the environments of a namespace
+	namespaceQuotaName = "drupal-environments"
+
+	// The components of the names of the ResourceQuota and LimitRange that previous versions of the operator applied
+	// for each environment (see DrupalEnvironment.ChildName)
+	resourceQuotaName = "quota"
+	limitRangeName    = "limits"
+
+	// legacyQuotaName is the name of the ResourceQuota and LimitRange of older versions of the operator, which applied
+	// a single one of each to the namespace
+	legacyQuotaName = "drupal-environment"
+)
+
+// quotaProfile returns the QuotaProfile for a stage, preferring the DrupalApplication's (if app isn't nil) over the
+// operator's default. Returns nil if there is none.
+func quotaProfile(app *fnv1alpha1.DrupalApplication, stage string) *fnv1alpha1.QuotaProfile {
+	if app != nil {
+		if profile, ok := app.Spec.QuotaProfiles[stage]; ok {
+			return &profile
+		}
+	}
+	if profile, ok := common.DefaultQuotaProfile(stage); ok {
+		return &profile
+	}
+	return nil
+}
+
+// namespaceQuota returns the QuotaProfile applied to the namespace, combined from the profiles of its
+// DrupalEnvironments that aren't being deleted, along with those environments. Its hard limits are the sum of the
+// environments' for the resources all of them limit, so that none is capped by another's quota; an environment without
+// hard limits leaves the namespace without any. Its LimitRange is the environments' if they all agree, since the
+// defaults of several LimitRanges would conflict.
+func (rh *requestHandler) namespaceQuota() (profile *fnv1alpha1.QuotaProfile, envs []fnv1alpha1.DrupalEnvironment, err error) {
+	r := rh.reconciler
+	list := &fnv1alpha1.DrupalEnvironmentList{}
+	if err = r.client.List(context.TODO(), list, client.InNamespace(rh.namespace)); err != nil {
+		return
+	}
+
+	profile = &fnv1alpha1.QuotaProfile{}
+	apps := map[string]*fnv1alpha1.DrupalApplication{}
+	for i, env := range list.Items {
+		if env.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		app, ok := apps[env.Spec.Application]
+		if !ok {
+			app = &fnv1alpha1.DrupalApplication{}
+			if err = r.client.Get(context.TODO(), types.NamespacedName{Name: env.Spec.Application}, app); err != nil {
+				if !errors.IsNotFound(err) {
+					return
+				}
+				app = nil
+			}
+			apps[env.Spec.Application] = app
+		}
+		envProfile := quotaProfile(app, env.Spec.Stage)
+		if envProfile == nil {
+			envProfile = &fnv1alpha1.QuotaProfile{}
+		}
+
+		if len(envs) == 0 {
+			profile = envProfile.DeepCopy()
+		} else {
+			profile.Hard = sumHardLimits(profile.Hard, envProfile.Hard)
+			if !equality.Semantic.DeepEqual(profile.Limits, envProfile.Limits) && profile.Limits != nil {
+				rh.logger.Info("DrupalEnvironments of the namespace have different LimitRanges; not applying any", "DrupalEnvironment", env.Name)
+				profile.Limits = nil
+			}
+		}
+		envs = append(envs, list.Items[i])
+	}
+	return profile, envs, nil
+}
+
+// sumHardLimits returns the sum of two sets of hard limits, for the resources limited by both
+func sumHardLimits(a, b v1.ResourceList) v1.ResourceList {
+	sum := v1.ResourceList{}
+	for name, q := range a {
+		if other, ok := b[name]; ok {
+			q = q.DeepCopy()
+			q.Add(other)
+			sum[name] = q
+		}
+	}
+	if len(sum) == 0 {
+		return nil
+	}
+	return sum
+}
+
+// reconcileQuota applies the namespace's combined QuotaProfile as a ResourceQuota and LimitRange shared by its
+// environments, removes those that previous versions applied for the environment alone, and sets the QuotaExceeded
+// condition if the Drupal HPA's maximum size won't fit.
+func (rh *requestHandler) reconcileQuota() (changed bool, err error) {
+	profile, changed, err := rh.reconcileNamespaceQuota()
+	if err != nil {
+		return
+	}
+
+	for _, child := range []legacyChild{
+		{&v1.ResourceQuota{}, rh.env.ChildName(resourceQuotaName)},
+		{&v1.LimitRange{}, rh.env.ChildName(limitRangeName)},
+	} {
+		var removed bool
+		if removed, err = rh.removeOwnedObject(child.obj, child.name); err != nil {
+			return
+		}
+		changed = changed || removed
+	}
+
+	err = rh.updateQuotaCondition(profile)
+	return
+}
+
+// reconcileNamespaceQuota applies the namespace's combined QuotaProfile, or removes its ResourceQuota and LimitRange
+// if it has none. They're owned by all of the namespace's environments, and resized when one of them is deleted.
+func (rh *requestHandler) reconcileNamespaceQuota() (profile *fnv1alpha1.QuotaProfile, changed bool, err error) {
+	profile, envs, err := rh.namespaceQuota()
+	if err != nil {
+		rh.logger.Error(err, "Failed to combine the quota profiles of the namespace")
+		return
+	}
+
+	owners := make([]metav1.OwnerReference, len(envs))
+	for i, env := range envs {
+		owners[i] = metav1.OwnerReference{
+			APIVersion: fnv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "DrupalEnvironment",
+			Name:       env.Name,
+			UID:        env.UID,
+		}
+	}
+	meta := metav1.ObjectMeta{Namespace: rh.namespace, Name: namespaceQuotaName, OwnerReferences: owners}
+
+	var rqChanged, lrChanged bool
+	if len(profile.Hard) > 0 {
+		rqChanged, err = rh.applyNamespaceObject(&v1.ResourceQuota{ObjectMeta: meta, Spec: v1.ResourceQuotaSpec{Hard: profile.Hard}})
+	} else {
+		rqChanged, err = rh.removeNamespaceObject(&v1.ResourceQuota{})
+	}
+	if err != nil {
+		return
+	}
+
+	if len(profile.Limits) > 0 {
+		lrChanged, err = rh.applyNamespaceObject(&v1.LimitRange{ObjectMeta: meta, Spec: v1.LimitRangeSpec{Limits: profile.Limits}})
+	} else {
+		lrChanged, err = rh.removeNamespaceObject(&v1.LimitRange{})
+	}
+	return profile, rqChanged || lrChanged, err
+}
+
+// applyNamespaceObject applies an object shared by the namespace's environments. Its drift isn't detected, since
+// every environment applies it.
+func (rh *requestHandler) applyNamespaceObject(obj runtime.Object) (changed bool, err error) {
+	logger := rh.logger.WithValues("kind", fmt.Sprintf("%T", obj), "name", namespaceQuotaName)
+	op, err := common.Apply(rh.reconciler.client, rh.reconciler.scheme, obj)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile namespace object")
+		return
+	}
+	if op != controllerutil.OperationResultNone {
+		logger.Info("Reconciled namespace object", "op", op)
+		changed = true
+	}
+	return
+}
+
+// removeNamespaceObject deletes the object shared by the namespace's environments, if it exists and is owned by
+// DrupalEnvironments
+func (rh *requestHandler) removeNamespaceObject(obj runtime.Object) (changed bool, err error) {
+	ctx := context.TODO()
+	if err = rh.reconciler.client.Get(ctx, types.NamespacedName{Namespace: rh.namespace, Name: namespaceQuotaName}, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return
+	}
+
+	metaObj, ok := obj.(metav1.Object)
+	if !ok || !ownedByEnvironments(metaObj) {
+		return
+	}
+
+	rh.logger.Info("Removing namespace object which is no longer needed", "kind", fmt.Sprintf("%T", obj), "name", namespaceQuotaName)
+	if err = rh.reconciler.client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return
+	}
+	return true, nil
+}
+
+// ownedByEnvironments returns true if the object has a DrupalEnvironment among its owners
+func ownedByEnvironments(o metav1.Object) bool {
+	for _, ref := range o.GetOwnerReferences() {
+		if ref.Kind == "DrupalEnvironment" && strings.HasPrefix(ref.APIVersion, fnv1alpha1.SchemeGroupVersion.Group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOwnedObject deletes the named object from the environment's namespace, if it exists and is controlled by the
+// DrupalEnvironment
+func (rh *requestHandler) removeOwnedObject(obj runtime.Object, name string) (changed bool, err error) {
+	ctx := context.TODO()
+	if err = rh.reconciler.client.Get(ctx, types.NamespacedName{Namespace: rh.namespace, Name: name}, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return
+	}
+
+	metaObj, ok := obj.(metav1.Object)
+	if !ok || !common.IsControlledBy(rh.env, metaObj) {
+		return
+	}
+
+	rh.logger.Info("Removing object which is no longer needed", "kind", fmt.Sprintf("%T", obj), "name", name)
+	if err = rh.reconciler.client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return
+	}
+	return true, nil
+}
+
+// updateQuotaCondition checks that MaxReplicas Drupal Pods fit within the namespace's quota, along with the other Pods
+// of the namespace, and reports the result in the QuotaExceeded condition
+func (rh *requestHandler) updateQuotaCondition(profile *fnv1alpha1.QuotaProfile) error {
+	if len(profile.Hard) == 0 {
+		fnv1alpha1.RemoveCondition(&rh.env.Status.Conditions, fnv1alpha1.QuotaExceededCondition)
+		return nil
+	}
+
+	used, err := rh.otherPodsUsage()
+	if err != nil {
+		rh.logger.Error(err, "Failed to list the Pods of the namespace")
+		return err
+	}
+
+	problems := quotaProblems(rh.drupalPodTemplate(), int32Value(rh.env.Spec.Drupal.MaxReplicas), used, profile)
+	if len(problems) > 0 {
+		rh.logger.Info("Environment may not be able to scale to its maximum size", "problems", problems)
+		if !fnv1alpha1.IsConditionTrue(rh.env.Status.Conditions, fnv1alpha1.QuotaExceededCondition) {
+			rh.reconciler.recorder.Event(rh.env, v1.EventTypeWarning, common.ReasonQuotaExceeded, strings.Join(problems, "; "))
+		}
+		fnv1alpha1.SetCondition(&rh.env.Status.Conditions, fnv1alpha1.Condition{
+			Type:    fnv1alpha1.QuotaExceededCondition,
+			Status:  v1.ConditionTrue,
+			Reason:  "MaxReplicasExceedQuota",
+			Message: strings.Join(problems, "; "),
+		})
+	} else {
+		fnv1alpha1.SetCondition(&rh.env.Status.Conditions, fnv1alpha1.Condition{
+			Type:   fnv1alpha1.QuotaExceededCondition,
+			Status: v1.ConditionFalse,
+			Reason: "WithinQuota",
+		})
+	}
+	return nil
+}
+
+// otherPodsUsage returns the quota usage of the namespace's Pods, other than the environment's Drupal Pods and those
+// that terminated
+func (rh *requestHandler) otherPodsUsage() (v1.ResourceList, error) {
+	pods := &v1.PodList{}
+	if err := rh.reconciler.client.List(context.TODO(), pods, client.InNamespace(rh.namespace)); err != nil {
+		return nil, err
+	}
+
+	drupal := labels.SelectorFromSet(labelsForRollout(rh.env))
+	var count int64
+	requests, limits := v1.ResourceList{}, v1.ResourceList{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed || drupal.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		count++
+		// The LimitRange defaults were already applied to existing Pods
+		podRequests, podLimits := podResources(v1.PodTemplateSpec{Spec: pod.Spec}, nil)
+		for name, q := range podRequests {
+			addQuantity(requests, name, q)
+		}
+		for name, q := range podLimits {
+			addQuantity(limits, name, q)
+		}
+	}
+	return quotaUsage(count, requests, limits), nil
+}
+
+// quotaUsage returns the usage of "pods" Pods with the given total requests and limits, by quota resource name
+func quotaUsage(pods int64, requests, limits v1.ResourceList) v1.ResourceList {
+	usage := v1.ResourceList{
+		v1.ResourcePods: *resource.NewQuantity(pods, resource.DecimalSI),
+	}
+	for name, q := range requests {
+		usage[v1.ResourceName("requests."+string(name))] = q
+		usage[name] = q
+	}
+	for name, q := range limits {
+		usage[v1.ResourceName("limits."+string(name))] = q
+	}
+	return usage
+}
+
+// quotaProblems returns a description of each quota which "replicas" copies of the given Pod would exceed, on top of
+// the used resources
+func quotaProblems(template v1.PodTemplateSpec, replicas int32, used v1.ResourceList, profile *fnv1alpha1.QuotaProfile) (problems []string) {
+	requests, limits := podResources(template, profile.Limits)
+	for _, list := range []v1.ResourceList{requests, limits} {
+		for name, q := range list {
+			list[name] = *resource.NewMilliQuantity(q.MilliValue()*int64(replicas), q.Format)
+		}
+	}
+	needed := quotaUsage(int64(replicas), requests, limits)
+
+	for name, hard := range profile.Hard {
+		total, ok := needed[name]
+		if !ok {
+			continue
+		}
+
+		other := used[name]
+		withOther := total.DeepCopy()
+		withOther.Add(other)
+		if withOther.Cmp(hard) <= 0 {
+			continue
+		}
+
+		if other.IsZero() {
+			problems = append(problems, fmt.Sprintf("%v: %v replicas need %v, quota is %v", name, replicas, total.String(), hard.String()))
+		} else {
+			problems = append(problems, fmt.Sprintf("%v: %v replicas need %v and other Pods use %v, quota is %v", name, replicas, total.String(), other.String(), hard.String()))
+		}
+	}
+
+	sort.Strings(problems)
+	return
+}
+
+// podResources sums the requests and limits of the Pod's containers, using the LimitRange defaults for containers that
+// don't specify them
+func podResources(template v1.PodTemplateSpec, limitRange []v1.LimitRangeItem) (requests, limits v1.ResourceList) {
+	var defaultRequests, defaultLimits v1.ResourceList
+	for _, item := range limitRange {
+		if item.Type == v1.LimitTypeContainer {
+			defaultRequests = item.DefaultRequest
+			defaultLimits = item.Default
+		}
+	}
+
+	requests = v1.ResourceList{}
+	limits = v1.ResourceList{}
+	for _, c := range template.Spec.Containers {
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			request := firstNonZero(c.Resources.Requests[name], defaultRequests[name], c.Resources.Limits[name], defaultLimits[name])
+			limit := firstNonZero(c.Resources.Limits[name], defaultLimits[name])
+			addQuantity(requests, name, request)
+			addQuantity(limits, name, limit)
+		}
+	}
+	return
+}
+
+func firstNonZero(quantities ...resource.Quantity) resource.Quantity {
+	for _, q := range quantities {
+		if !q.IsZero() {
+			return q
+		}
+	}
+	return resource.Quantity{}
+}
+
+func addQuantity(list v1.ResourceList, name v1.ResourceName, q resource.Quantity) {
+	if q.IsZero() {
+		return
+	}
+	sum := list[name]
+	sum.Add(q)
+	list[name] = sum
+}
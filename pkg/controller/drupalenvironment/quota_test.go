@@ -0,0 +1,323 @@
+package drupalenvironment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+func TestReconcileDrupalEnvironment_Quota(t *testing.T) {
+	app := drupalApplicationWithID.DeepCopy()
+	app.Spec.QuotaProfiles = map[string]fnv1alpha1.QuotaProfile{
+		"dev": {
+			Hard: v1.ResourceList{
+				v1.ResourcePods:        resource.MustParse("1"),
+				v1.ResourceRequestsCPU: resource.MustParse("4"),
+			},
+			Limits: []v1.LimitRangeItem{{
+				Type:           v1.LimitTypeContainer,
+				DefaultRequest: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")},
+			}},
+		},
+	}
+
+	objects := []runtime.Object{
+		drupalEnvironmentWithNonProdValues,
+		testNonProdNamespaceResource,
+		app,
+		testNonProdNewRelicSecret,
+	}
+
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      drupalEnvironmentWithNonProdValues.Name,
+			Namespace: drupalEnvironmentWithNonProdValues.Namespace,
+		},
+	}
+
+	t.Run("should apply the application's quota profile for the stage", func(t *testing.T) {
+		reconcileUntilDone(t, r, req)
+
+		rq := &v1.ResourceQuota{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, rq)
+		require.NoError(t, err)
+		require.Equal(t, "1", rq.Spec.Hard.Pods().String())
+		require.Len(t, rq.OwnerReferences, 1)
+		require.Equal(t, drupalEnvironmentWithNonProdValues.Name, rq.OwnerReferences[0].Name)
+
+		lr := &v1.LimitRange{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, lr)
+		require.NoError(t, err)
+		require.Len(t, lr.Spec.Limits, 1)
+	})
+
+	t.Run("should report that MaxReplicas exceed the quota", func(t *testing.T) {
+		env := &fnv1alpha1.DrupalEnvironment{}
+		err := r.client.Get(context.TODO(), req.NamespacedName, env)
+		require.NoError(t, err)
+
+		cond := fnv1alpha1.FindCondition(env.Status.Conditions, fnv1alpha1.QuotaExceededCondition)
+		require.NotNil(t, cond)
+		require.Equal(t, v1.ConditionTrue, cond.Status)
+		require.Equal(t, "pods: 2 replicas need 2, quota is 1", cond.Message)
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeWarning, common.ReasonQuotaExceeded)
+	})
+
+	t.Run("should clear the condition and remove the quota when the profile is removed", func(t *testing.T) {
+		app := &fnv1alpha1.DrupalApplication{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: testApplicationName}, app)
+		require.NoError(t, err)
+		app.Spec.QuotaProfiles = nil
+		err = r.client.Update(context.TODO(), app)
+		require.NoError(t, err)
+
+		reconcileUntilDone(t, r, req)
+
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, &v1.ResourceQuota{})
+		require.True(t, errors.IsNotFound(err))
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, &v1.LimitRange{})
+		require.True(t, errors.IsNotFound(err))
+
+		env := &fnv1alpha1.DrupalEnvironment{}
+		err = r.client.Get(context.TODO(), req.NamespacedName, env)
+		require.NoError(t, err)
+		require.Nil(t, fnv1alpha1.FindCondition(env.Status.Conditions, fnv1alpha1.QuotaExceededCondition))
+	})
+
+	t.Run("should fall back to the operator's default quota profile", func(t *testing.T) {
+		common.SetQuotaProfiles_ForTestsOnly(map[string]fnv1alpha1.QuotaProfile{
+			"dev": {Hard: v1.ResourceList{v1.ResourcePods: resource.MustParse("10")}},
+		})
+		defer common.SetQuotaProfiles_ForTestsOnly(nil)
+
+		reconcileUntilDone(t, r, req)
+
+		rq := &v1.ResourceQuota{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, rq)
+		require.NoError(t, err)
+		require.Equal(t, "10", rq.Spec.Hard.Pods().String())
+
+		env := &fnv1alpha1.DrupalEnvironment{}
+		err = r.client.Get(context.TODO(), req.NamespacedName, env)
+		require.NoError(t, err)
+		require.False(t, fnv1alpha1.IsConditionTrue(env.Status.Conditions, fnv1alpha1.QuotaExceededCondition))
+	})
+}
+
+func TestReconcileDrupalEnvironment_QuotaSharedNamespace(t *testing.T) {
+	app := drupalApplicationWithID.DeepCopy()
+	app.Spec.QuotaProfiles = map[string]fnv1alpha1.QuotaProfile{
+		"dev": {
+			Hard:   v1.ResourceList{v1.ResourcePods: resource.MustParse("2")},
+			Limits: []v1.LimitRangeItem{{Type: v1.LimitTypeContainer}},
+		},
+	}
+
+	env := drupalEnvironmentWithNonProdValues.DeepCopy()
+	env.UID = "first"
+	otherEnv := drupalEnvironmentWithNonProdValues.DeepCopy()
+	otherEnv.Name = "wlgore-other"
+	otherEnv.UID = "other"
+	otherEnv.Labels[fnv1alpha1.EnvironmentIdLabel] = "other-env-id"
+
+	// The ResourceQuota applied by a previous version for the environment alone
+	envQuota := &v1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Namespace: testNonProdNamespace, Name: env.ChildName(resourceQuotaName)}}
+	require.NoError(t, controllerutil.SetControllerReference(env, envQuota, scheme.Scheme))
+
+	pod := func(name string, labels map[string]string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNonProdNamespace, Name: name, Labels: labels},
+			Status:     v1.PodStatus{Phase: phase},
+		}
+	}
+
+	r := buildFakeReconcile([]runtime.Object{
+		env, otherEnv, envQuota, testNonProdNamespaceResource, app, testNonProdNewRelicSecret,
+		pod("drupal-1", labelsForRollout(env), v1.PodRunning),
+		pod("other-drupal-1", labelsForRollout(otherEnv), v1.PodRunning),
+		pod("other-drupal-2", labelsForRollout(otherEnv), v1.PodPending),
+		pod("other-job", nil, v1.PodSucceeded),
+	})
+	envReq := reconcile.Request{NamespacedName: types.NamespacedName{Name: env.Name, Namespace: env.Namespace}}
+	otherReq := reconcile.Request{NamespacedName: types.NamespacedName{Name: otherEnv.Name, Namespace: otherEnv.Namespace}}
+
+	getEnv := func(req reconcile.Request) *fnv1alpha1.DrupalEnvironment {
+		e := &fnv1alpha1.DrupalEnvironment{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, e))
+		return e
+	}
+
+	t.Run("should apply a single quota sized for all environments", func(t *testing.T) {
+		reconcileUntilDone(t, r, otherReq)
+		reconcileUntilDone(t, r, envReq)
+
+		rq := &v1.ResourceQuota{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, rq)
+		require.NoError(t, err)
+		require.Equal(t, "4", rq.Spec.Hard.Pods().String())
+		require.Len(t, rq.OwnerReferences, 2)
+
+		lr := &v1.LimitRange{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, lr)
+		require.NoError(t, err)
+		require.Len(t, lr.OwnerReferences, 2)
+
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: env.ChildName(resourceQuotaName)}, &v1.ResourceQuota{})
+		require.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("should count the other Pods of the namespace against the quota", func(t *testing.T) {
+		// 2 replicas, and the other environment's 2 unfinished Pods
+		cond := fnv1alpha1.FindCondition(getEnv(envReq).Status.Conditions, fnv1alpha1.QuotaExceededCondition)
+		require.NotNil(t, cond)
+		require.Equal(t, v1.ConditionFalse, cond.Status)
+
+		require.NoError(t, r.client.Create(context.TODO(), pod("other-drupal-3", labelsForRollout(otherEnv), v1.PodRunning)))
+		reconcileUntilDone(t, r, envReq)
+
+		cond = fnv1alpha1.FindCondition(getEnv(envReq).Status.Conditions, fnv1alpha1.QuotaExceededCondition)
+		require.NotNil(t, cond)
+		require.Equal(t, v1.ConditionTrue, cond.Status)
+		require.Equal(t, "pods: 2 replicas need 2 and other Pods use 3, quota is 4", cond.Message)
+	})
+
+	t.Run("should shrink the quota when an environment is deleted", func(t *testing.T) {
+		e := getEnv(otherReq)
+		e.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+		require.NoError(t, r.client.Update(context.TODO(), e))
+		_, err := r.Reconcile(otherReq)
+		require.NoError(t, err)
+
+		rq := &v1.ResourceQuota{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: namespaceQuotaName}, rq)
+		require.NoError(t, err)
+		require.Equal(t, "2", rq.Spec.Hard.Pods().String())
+		require.Len(t, rq.OwnerReferences, 1)
+		require.Equal(t, env.Name, rq.OwnerReferences[0].Name)
+	})
+}
+
+func Test_namespaceQuota_LimitsConflict(t *testing.T) {
+	app := drupalApplicationWithID.DeepCopy()
+	app.Spec.QuotaProfiles = map[string]fnv1alpha1.QuotaProfile{
+		"dev": {
+			Hard:   v1.ResourceList{v1.ResourcePods: resource.MustParse("2"), v1.ResourceRequestsCPU: resource.MustParse("1")},
+			Limits: []v1.LimitRangeItem{{Type: v1.LimitTypeContainer}},
+		},
+		"test": {
+			Hard: v1.ResourceList{v1.ResourcePods: resource.MustParse("3")},
+		},
+	}
+
+	env := drupalEnvironmentWithNonProdValues.DeepCopy()
+	otherEnv := drupalEnvironmentWithNonProdValues.DeepCopy()
+	otherEnv.Name = "wlgore-test"
+	otherEnv.Spec.Stage = "test"
+
+	r := buildFakeReconcile([]runtime.Object{env, otherEnv, app})
+	rh := &requestHandler{reconciler: r, namespace: testNonProdNamespace, env: env, logger: log}
+
+	profile, envs, err := rh.namespaceQuota()
+	require.NoError(t, err)
+	require.Len(t, envs, 2)
+	// Only the resources both environments limit are limited
+	require.Len(t, profile.Hard, 1)
+	require.Equal(t, "5", profile.Hard.Pods().String())
+	require.Nil(t, profile.Limits)
+}
+
+func Test_quotaProblems(t *testing.T) {
+	template := v1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name: "a",
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+						Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+					},
+				},
+				{
+					Name: "b", // Gets LimitRange defaults
+				},
+			},
+		},
+	}
+	limitRange := []v1.LimitRangeItem{{
+		Type:           v1.LimitTypeContainer,
+		Default:        v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+		DefaultRequest: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")},
+	}}
+
+	tests := []struct {
+		name     string
+		hard     v1.ResourceList
+		used     v1.ResourceList
+		expected []string
+	}{
+		{
+			name: "fits",
+			hard: v1.ResourceList{
+				v1.ResourceRequestsCPU:  resource.MustParse("3"),
+				v1.ResourceLimitsMemory: resource.MustParse("6Gi"),
+			},
+		},
+		{
+			name: "cpu requests exceeded",
+			hard: v1.ResourceList{
+				v1.ResourceRequestsCPU: resource.MustParse("2"),
+			},
+			expected: []string{"requests.cpu: 4 replicas need 3, quota is 2"},
+		},
+		{
+			name: "memory limits exceeded",
+			hard: v1.ResourceList{
+				v1.ResourceLimitsMemory: resource.MustParse("5Gi"),
+			},
+			expected: []string{"limits.memory: 4 replicas need 6Gi, quota is 5Gi"},
+		},
+		{
+			name: "requests default to limits",
+			hard: v1.ResourceList{
+				v1.ResourceRequestsMemory: resource.MustParse("4Gi"),
+			},
+			expected: []string{"requests.memory: 4 replicas need 6Gi, quota is 4Gi"},
+		},
+		{
+			name: "used by other Pods",
+			hard: v1.ResourceList{
+				v1.ResourcePods:        resource.MustParse("5"),
+				v1.ResourceRequestsCPU: resource.MustParse("4"),
+			},
+			used: v1.ResourceList{
+				v1.ResourcePods:        resource.MustParse("2"),
+				v1.ResourceRequestsCPU: resource.MustParse("500m"),
+			},
+			expected: []string{"pods: 4 replicas need 4 and other Pods use 2, quota is 5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := quotaProblems(template, 4, tt.used, &fnv1alpha1.QuotaProfile{Hard: tt.hard, Limits: limitRange})
+			require.Equal(t, tt.expected, problems)
+		})
+	}
+}
@@ -6,153 +6,135 @@ import (
 
 	"github.com/acquia/fn-ssh-proxy/pkg/sshtunnel"
 	"github.com/argoproj/argo-rollouts/utils/defaults"
-	"github.com/go-test/deep"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/customercontainer"
 )
 
+// Components of the names of the SSHD resources (see DrupalEnvironment.ChildName)
 const (
 	sshdServiceName    = "sshd"
 	sshdDeploymentName = "sshd"
+	sshdRoleName       = "sshd"
+
+	sshProxyPubkeyConfigMapName = "ssh-proxy-pubkey"
 )
 
-func (rh *requestHandler) reconcileSSHDService(username string) (result reconcile.Result, err error) {
+func (rh *requestHandler) reconcileSSHDService(username string) (changed bool, err error) {
 	svc := &v1.Service{
-		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: sshdServiceName},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: rh.namespace,
+			Name:      rh.env.ChildName(sshdServiceName),
+			Labels:    rh.sshdLabels(username),
+		},
+		Spec: rh.sshdServiceSpec(username),
 	}
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), rh.reconciler.client, svc, func() error {
-		desired := rh.sshdServiceSpec(username)
+	rh.associateResourceWithController(svc)
 
-		if svc.CreationTimestamp.IsZero() {
-			// Create
-			desired.DeepCopyInto(&svc.Spec)
-			rh.associateResourceWithController(svc)
-		} else {
-			// Update
-			svc.Spec.Ports = desired.Ports
-		}
-		// Both Create and Update
-		svc.Labels = common.MergeLabels(svc.Labels, rh.env.ChildLabels())
-		svc.Labels = common.MergeLabels(svc.Labels, sshdAppLabels(username))
-		return nil
-	})
+	op, err := rh.apply(svc)
 	if err != nil {
 		rh.logger.Error(err, "Failed to reconcile SSH Service")
 		return
 	}
 	if op != controllerutil.OperationResultNone {
 		rh.logger.Info("Reconciled SSH Service", "op", op)
-		result.Requeue = true
+		changed = true
 	}
 
 	return
 }
 
-func (rh *requestHandler) reconcileSSHDDeployment(username string) (result reconcile.Result, err error) {
+func (rh *requestHandler) reconcileSSHDDeployment(username string) (changed bool, err error) {
 	dep := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: sshdDeploymentName},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: rh.namespace,
+			Name:      rh.env.ChildName(sshdDeploymentName),
+			Labels:    rh.sshdLabels(username),
+		},
+		Spec: rh.sshdDeploymentSpec(username),
 	}
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), rh.reconciler.client, dep, func() error {
-		desired := rh.sshdDeploymentSpec(username)
-
-		if dep.CreationTimestamp.IsZero() {
-			// Create
-			rh.associateResourceWithController(dep)
-			dep.Labels = rh.env.ChildLabels()
-		}
+	rh.associateResourceWithController(dep)
 
-		if diff := deep.Equal(dep.Spec, desired); diff != nil {
-			rh.logger.Info("SSHD Deployment Spec needs update", "current != desired", diff)
-			dep.Spec = desired
-		}
-
-		dep.Labels = common.MergeLabels(dep.Labels, sshdAppLabels(username))
-		return nil
-	})
+	op, err := rh.apply(dep)
 	if err != nil {
 		rh.logger.Error(err, "Failed to reconcile SSH Deployment")
 		return
 	}
 	if op != controllerutil.OperationResultNone {
 		rh.logger.Info("Reconciled SSH Deployment", "op", op)
-		result.Requeue = true
+		changed = true
 	}
 
 	return
 }
 
-func (rh *requestHandler) reconcileSSHDAccessControls() (result reconcile.Result, err error) {
-	ctx := context.TODO()
-
-	// Create/Update ServiceAccount
+func (rh *requestHandler) reconcileSSHDAccessControls() (changed bool, err error) {
 	sa := &v1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: sshdDeploymentName},
+		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: rh.env.ChildName(sshdDeploymentName), Labels: rh.env.ChildLabels()},
 	}
 
-	var op controllerutil.OperationResult
-	op, err = controllerutil.CreateOrUpdate(ctx, rh.reconciler.client, sa, func() error {
-		if sa.CreationTimestamp.IsZero() {
-			rh.associateResourceWithController(sa)
-		}
-		sa.Labels = common.MergeLabels(sa.Labels, rh.env.ChildLabels())
-		return nil
-	})
-	if err != nil {
-		rh.logger.Error(err, "Failed to reconcile SSHD ServiceAccount")
-		return
-	}
-	if op != controllerutil.OperationResultNone {
-		rh.logger.Info("Reconciled SSH ServiceAccount", "op", op)
-		result.Requeue = true
-		return
-	}
-
-	// Create/Update ClusterRoleBinding
-	crb := &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: rh.clusterRoleBindingName()},
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: rh.env.ChildName(sshdRoleName), Labels: rh.env.ChildLabels()},
+		Rules: []rbacv1.PolicyRule{{
+			Verbs:         []string{"get"},
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{sshProxyPubkeyConfigMapName},
+		}},
 	}
 
-	op, err = controllerutil.CreateOrUpdate(ctx, rh.reconciler.client, crb, func() error {
-		crb.Labels = common.MergeLabels(crb.Labels, rh.env.ChildLabels())
-		crb.Subjects = []rbacv1.Subject{{
+	// RoleRef is immutable, but applying it unchanged is allowed
+	rb := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: rh.namespace, Name: rh.env.ChildName(sshdRoleName), Labels: rh.env.ChildLabels()},
+		Subjects: []rbacv1.Subject{{
 			Kind:      "ServiceAccount",
-			Name:      sshdDeploymentName,
+			Name:      rh.env.ChildName(sshdDeploymentName),
 			Namespace: rh.namespace,
-		}}
-		crb.RoleRef = rbacv1.RoleRef{
+		}},
+		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
-			Kind:     "ClusterRole",
-			Name:     "sshd",
-		}
-		return nil
-	})
-	if err != nil {
-		rh.logger.Error(err, "Failed to reconcile SSHD ClusterRoleBinding")
-		return
+			Kind:     "Role",
+			Name:     rh.env.ChildName(sshdRoleName),
+		},
 	}
-	if op != controllerutil.OperationResultNone {
-		rh.logger.Info("Reconciled SSH ClusterRoleBinding", "op", op)
-		result.Requeue = true
+
+	for _, obj := range []interface {
+		metav1.Object
+		runtime.Object
+	}{sa, role, rb} {
+		rh.associateResourceWithController(obj)
+
+		var op controllerutil.OperationResult
+		if op, err = rh.apply(obj); err != nil {
+			rh.logger.Error(err, "Failed to reconcile SSHD access controls", "kind", fmt.Sprintf("%T", obj))
+			return false, err
+		}
+		if op != controllerutil.OperationResultNone {
+			rh.logger.Info("Reconciled SSHD access controls", "kind", fmt.Sprintf("%T", obj), "op", op)
+			changed = true
+		}
 	}
 	return
 }
 
-func (rh *requestHandler) finalizeSSHDAccessControls() (requeue bool, err error) {
+// removeLegacySSHDClusterRoleBinding deletes the per-namespace ClusterRoleBinding that older versions of the operator
+// created for SSHD. It is now replaced by a namespaced Role and RoleBinding, which are garbage collected along with the
+// DrupalEnvironment.
+func (rh *requestHandler) removeLegacySSHDClusterRoleBinding() (changed bool, err error) {
 	ctx := context.TODO()
 	crb := &rbacv1.ClusterRoleBinding{}
-	if err = rh.reconciler.client.Get(ctx, types.NamespacedName{Name: rh.clusterRoleBindingName()}, crb); err != nil {
+	if err = rh.reconciler.client.Get(ctx, types.NamespacedName{Name: rh.legacyClusterRoleBindingName()}, crb); err != nil {
 		if errors.IsNotFound(err) {
 			// Already deleted
 			return false, nil
@@ -161,13 +143,14 @@ func (rh *requestHandler) finalizeSSHDAccessControls() (requeue bool, err error)
 		}
 	}
 
-	if err = rh.reconciler.client.Delete(ctx, crb); err != nil {
-		requeue = true
+	rh.logger.Info("Removing legacy SSHD ClusterRoleBinding", "name", crb.Name)
+	if err = rh.reconciler.client.Delete(ctx, crb); err != nil && !errors.IsNotFound(err) {
+		return false, err
 	}
-	return
+	return true, nil
 }
 
-func (rh *requestHandler) clusterRoleBindingName() string {
+func (rh *requestHandler) legacyClusterRoleBindingName() string {
 	return fmt.Sprintf("%v-%v", sshdDeploymentName, rh.namespace)
 }
 
@@ -201,12 +184,12 @@ func (rh *requestHandler) sshdServiceSpec(username string) v1.ServiceSpec {
 			TargetPort: intstr.FromString("ssh"),
 			Protocol:   "TCP",
 		}},
-		Selector: sshdAppLabels(username),
+		Selector: rh.sshdLabels(username),
 	}
 }
 
 func (rh *requestHandler) sshdDeploymentSpec(username string) appsv1.DeploymentSpec {
-	appLabels := sshdAppLabels(username)
+	labels := rh.sshdLabels(username)
 	template := rh.drupalPodTemplate()
 	replicas := int32(1)
 	terminationGracePeriod := int64(v1.DefaultTerminationGracePeriodSeconds)
@@ -254,9 +237,9 @@ func (rh *requestHandler) sshdDeploymentSpec(username string) appsv1.DeploymentS
 		},
 	}
 
-	template.Labels = common.MergeLabels(rh.env.ChildLabels(), appLabels)
-	template.Spec.ServiceAccountName = sshdDeploymentName
-	template.Spec.DeprecatedServiceAccount = sshdDeploymentName // Need to set to avoid update loops
+	template.Labels = labels
+	template.Spec.ServiceAccountName = rh.env.ChildName(sshdDeploymentName)
+	template.Spec.DeprecatedServiceAccount = rh.env.ChildName(sshdDeploymentName) // Need to set to avoid update loops
 	template.Spec.Containers = []v1.Container{*container}
 	template.Spec.RestartPolicy = v1.RestartPolicyAlways
 	template.Spec.DNSPolicy = v1.DNSClusterFirst
@@ -267,7 +250,7 @@ func (rh *requestHandler) sshdDeploymentSpec(username string) appsv1.DeploymentS
 	return appsv1.DeploymentSpec{
 		Replicas: &replicas,
 		Selector: &metav1.LabelSelector{
-			MatchLabels: appLabels,
+			MatchLabels: labels,
 		},
 		Template:                template,
 		Strategy:                common.DefaultDeploymentStrategy(),
@@ -276,9 +259,10 @@ func (rh *requestHandler) sshdDeploymentSpec(username string) appsv1.DeploymentS
 	}
 }
 
-func sshdAppLabels(username string) map[string]string {
-	return map[string]string{
+// sshdLabels returns the labels of the environment's SSHD resources, which also select its SSHD Pods
+func (rh *requestHandler) sshdLabels(username string) map[string]string {
+	return common.MergeLabels(rh.env.ChildLabels(), map[string]string{
 		"app":                  "sshd",
 		sshtunnel.LabelSshUser: username,
-	}
+	})
 }
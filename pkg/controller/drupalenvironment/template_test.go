@@ -0,0 +1,105 @@
+package drupalenvironment
+
+import (
+	"context"
+	"testing"
+
+	rolloutsv1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/stretchr/testify/require"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+func TestReconcileDrupalEnvironment_Template(t *testing.T) {
+	app := drupalApplicationWithID.DeepCopy()
+	app.Spec.EnvironmentTemplates = map[string]fnv1alpha1.EnvironmentTemplate{
+		"dev": {Drupal: fnv1alpha1.SpecDrupal{MaxReplicas: pointer.Int32Ptr(4)}},
+	}
+	env := drupalEnvironmentWithNonProdValues.DeepCopy()
+	env.Spec.Drupal.MaxReplicas = nil
+	env.Spec.Drupal.TargetCPUUtilizationPercentage = nil
+
+	objects := []runtime.Object{
+		env,
+		testNonProdNamespaceResource,
+		app,
+		testNonProdNewRelicSecret,
+	}
+	r := buildFakeReconcile(objects)
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: env.Name, Namespace: env.Namespace},
+	}
+
+	t.Run("should apply the settings of the stage's template and the defaults", func(t *testing.T) {
+		reconcileUntilDone(t, r, req)
+
+		hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: env.ChildName(drupalHPAName)}, hpa)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), *hpa.Spec.MinReplicas)
+		require.Equal(t, int32(4), hpa.Spec.MaxReplicas)
+		require.Equal(t, fnv1alpha1.DefaultTargetCPUUtilizationPercentage, *hpa.Spec.TargetCPUUtilizationPercentage)
+
+		drupalEnv := &fnv1alpha1.DrupalEnvironment{}
+		require.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, drupalEnv))
+		require.Nil(t, drupalEnv.Spec.Drupal.MaxReplicas)
+		require.NotNil(t, drupalEnv.Status.EffectiveSpec)
+		require.Equal(t, int32(4), *drupalEnv.Status.EffectiveSpec.Drupal.MaxReplicas)
+	})
+
+	t.Run("should report a resolved spec that is invalid", func(t *testing.T) {
+		drupalApp := &fnv1alpha1.DrupalApplication{}
+		require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: app.Name}, drupalApp))
+		drupalApp.Spec.EnvironmentTemplates["dev"] = fnv1alpha1.EnvironmentTemplate{Drupal: fnv1alpha1.SpecDrupal{MaxReplicas: pointer.Int32Ptr(1)}}
+		require.NoError(t, r.client.Update(context.TODO(), drupalApp))
+
+		result, err := r.Reconcile(req)
+		require.NoError(t, err)
+		require.NotZero(t, result.RequeueAfter)
+		testhelpers.RequireEvent(t, r.recorder, v1.EventTypeWarning, common.ReasonSpecInvalid)
+	})
+}
+
+func TestReconcileDrupalEnvironment_TemplateOverriddenWithZeroValues(t *testing.T) {
+	app := drupalApplicationWithID.DeepCopy()
+	app.Spec.EnvironmentTemplates = map[string]fnv1alpha1.EnvironmentTemplate{
+		"dev": {
+			Drupal: fnv1alpha1.SpecDrupal{Liveness: fnv1alpha1.HTTPProbe{Enabled: pointer.BoolPtr(true)}},
+			Phpfpm: fnv1alpha1.SpecPhpFpm{MaxExecutionTime: pointer.Int32Ptr(300)},
+		},
+	}
+	env := drupalEnvironmentWithNonProdValues.DeepCopy()
+	env.Spec.Drupal.Liveness.Enabled = pointer.BoolPtr(false)
+	env.Spec.Phpfpm.MaxExecutionTime = pointer.Int32Ptr(0)
+
+	r := buildFakeReconcile([]runtime.Object{env, testNonProdNamespaceResource, app, testNonProdNewRelicSecret})
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: env.Name, Namespace: env.Namespace},
+	}
+	reconcileUntilDone(t, r, req)
+
+	t.Run("should disable the liveness probe the template enables", func(t *testing.T) {
+		rollout := &rolloutsv1alpha1.Rollout{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: env.ChildName(drupalRolloutName)}, rollout)
+		require.NoError(t, err)
+		for _, c := range rollout.Spec.Template.Spec.Containers {
+			require.Nil(t, c.LivenessProbe, "container %q", c.Name)
+		}
+	})
+
+	t.Run("should not limit the execution time the template limits", func(t *testing.T) {
+		configMap := &v1.ConfigMap{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: testNonProdNamespace, Name: env.ChildName(phpConfigMapName)}, configMap)
+		require.NoError(t, err)
+		require.Contains(t, configMap.Data["zzz_drupalenvironment.ini"], "\nmax_execution_time = 0\n")
+	})
+}
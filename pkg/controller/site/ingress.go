@@ -1,11 +1,9 @@
 package site
 
 import (
-	"context"
-	"reflect"
-
 	net "istio.io/api/networking/v1alpha3"
 	netv1a3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
 	extv1b1 "k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -26,84 +24,40 @@ func (rh *requestHandler) reconcileIngress() (bool, error) {
 func (rh *requestHandler) reconcileIstioIngress() (bool, error) {
 	r := rh.reconciler
 
-	vs := &netv1a3.VirtualService{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      rh.site.Name,
-			Namespace: rh.site.Namespace,
-		},
+	vs := rh.virtualService()
+	if _, err := common.LinkToOwner(rh.site, vs, r.scheme); err != nil {
+		return false, err
 	}
 
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, vs, func() error {
-		desired := rh.virtualService()
-
-		if vs.CreationTimestamp.IsZero() {
-			// Create
-			_, _ = common.LinkToOwner(rh.site, vs, rh.reconciler.scheme)
-		}
-
-		// Create or Update
-		vs.Labels = desired.Labels
-		desired.Spec.DeepCopyInto(&vs.Spec)
-
-		return nil
-	})
+	op, err := rh.drift.Apply(vs)
 	if err != nil || op == controllerutil.OperationResultNone {
 		return false, err
 	}
 	rh.logger.Info("Reconciled VirtualService", "operation", op)
+	r.recorder.Eventf(rh.site, corev1.EventTypeNormal, common.ReasonIngressUpdated, "VirtualService %v", op)
 	return true, nil
 }
 
 func (rh *requestHandler) reconcileIngressResource() (bool, error) {
 	r := rh.reconciler
 
-	ing := &extv1b1.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      rh.site.Name,
-			Namespace: rh.site.Namespace,
-		},
+	ing := rh.ingress()
+	if _, err := common.LinkToOwner(rh.site, ing, r.scheme); err != nil {
+		return false, err
 	}
 
-	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, ing, func() error {
-		desired := rh.ingress()
-
-		if ing.CreationTimestamp.IsZero() {
-			// Create
-			desired.Spec.DeepCopyInto(&ing.Spec)
-			ing.Annotations = desired.Annotations
-			ing.Labels = common.MergeLabels(ing.Labels, desired.Labels)
-			_, _ = common.LinkToOwner(rh.site, ing, rh.reconciler.scheme)
-			return nil
-		}
-
-		// Update
-		rules, tls, ingAnnotations := ing.Spec.Rules, ing.Spec.TLS, ing.ObjectMeta.Annotations
-		desiredRules, desiredTLS := rh.site.IngressRules(), rh.site.IngressTLS()
-		if !reflect.DeepEqual(rules, desiredRules) {
-			rh.logger.V(1).Info("Ingress rules out of date. Updating...")
-			ing.Spec.Rules = desiredRules
-		}
-		if !reflect.DeepEqual(tls, desiredTLS) {
-			rh.logger.V(1).Info("Ingress tls out of date. Updating...")
-			ing.Spec.TLS = desiredTLS
-		}
-
-		for anno := range desired.Annotations {
-			if ingAnnotations[anno] != desired.Annotations[anno] {
-				rh.logger.V(1).Info("Ingress annotation out of date. Updating...")
-				ing.ObjectMeta.Annotations[anno] = desired.Annotations[anno]
-			}
-		}
-
-		return nil
-	})
+	op, err := rh.drift.Apply(ing)
 	if err != nil || op == controllerutil.OperationResultNone {
 		return false, err
 	}
 	rh.logger.Info("Reconciled Ingress", "operation", op)
+	r.recorder.Eventf(rh.site, corev1.EventTypeNormal, common.ReasonIngressUpdated, "Ingress %v", op)
 	return true, nil
 }
 
+// maintenanceSnippet is the nginx configuration that makes the Ingress of a Site in maintenance respond with 503
+const maintenanceSnippet = "return 503;"
+
 func (rh *requestHandler) virtualService() *netv1a3.VirtualService {
 	vs := &netv1a3.VirtualService{
 		ObjectMeta: metav1.ObjectMeta{
@@ -117,7 +71,7 @@ func (rh *requestHandler) virtualService() *netv1a3.VirtualService {
 			Http: []*net.HTTPRoute{{
 				Route: []*net.HTTPRouteDestination{{
 					Destination: &net.Destination{
-						Host: drupalenvironment.DrupalServiceName,
+						Host: drupalenvironment.DrupalServiceName(rh.site.Spec.Environment),
 						Port: &net.PortSelector{
 							Number: 80,
 						},
@@ -126,6 +80,14 @@ func (rh *requestHandler) virtualService() *netv1a3.VirtualService {
 			}},
 		},
 	}
+	if rh.site.InMaintenance() {
+		vs.Spec.Http[0].Fault = &net.HTTPFaultInjection{
+			Abort: &net.HTTPFaultInjection_Abort{
+				ErrorType:  &net.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: 503},
+				Percentage: &net.Percent{Value: 100},
+			},
+		}
+	}
 	return vs
 }
 
@@ -140,7 +102,7 @@ func (rh *requestHandler) ingress() *extv1b1.Ingress {
 			Annotations: rh.desiredIngAnnotations(),
 		},
 		Spec: extv1b1.IngressSpec{
-			Rules: rh.site.IngressRules(),
+			Rules: rh.site.IngressRules(drupalenvironment.DrupalServiceName(rh.site.Spec.Environment)),
 			TLS:   rh.site.IngressTLS(),
 		},
 	}
@@ -148,8 +110,12 @@ func (rh *requestHandler) ingress() *extv1b1.Ingress {
 }
 
 func (rh *requestHandler) desiredIngAnnotations() map[string]string {
-	return map[string]string{
+	annotations := map[string]string{
 		"certmanager.k8s.io/cluster-issuer": rh.site.IngressCertIssuer(),
 		"kubernetes.io/ingress.class":       rh.site.IngressClass(),
 	}
+	if rh.site.InMaintenance() {
+		annotations["nginx.ingress.kubernetes.io/configuration-snippet"] = maintenanceSnippet
+	}
+	return annotations
 }
@@ -14,6 +14,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 	goldenHelper "github.com/acquia/fn-go-utils/pkg/testhelpers"
@@ -97,6 +98,59 @@ func Test_ReconcileIstio(t *testing.T) {
 	common.SetIsIstioEnabled_ForTestsOnly(istioWasEnabled)
 }
 
+func Test_ReconcileMaintenance(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	istioWasEnabled := common.IsIstioEnabled()
+	defer common.SetIsIstioEnabled_ForTestsOnly(istioWasEnabled)
+
+	site := testSite.DeepCopy()
+	site.Annotations = map[string]string{fnv1alpha1.MaintenanceAnnotation: "databaserestore/wlgore-restore"}
+	objects := []runtime.Object{
+		drupalApplication,
+		drupalEnvironment,
+		site,
+		testDatabase,
+		testDBUserSecret,
+		dbAdminSecret,
+	}
+	siteKey := types.NamespacedName{Name: site.Name, Namespace: site.Namespace}
+	request := reconcile.Request{NamespacedName: siteKey}
+
+	reconcileSite := func(t *testing.T) *ReconcileSite {
+		r := BuildFakeReconcile(objects)
+		r.recorder = testhelpers.NewFakeRecorder()
+		for i, res := 0, (reconcile.Result{Requeue: true}); res.Requeue || res.RequeueAfter > 0; i++ {
+			require.True(t, i <= maxReconcileIters, "Maximum Reconcile() iterations reached")
+			var err error
+			res, err = r.Reconcile(request)
+			require.NoError(t, err)
+		}
+		return r
+	}
+
+	t.Run("nonIstio", func(t *testing.T) {
+		common.SetIsIstioEnabled_ForTestsOnly(false)
+		r := reconcileSite(t)
+
+		ing := &extv1b1.Ingress{}
+		require.NoError(t, r.client.Get(context.TODO(), siteKey, ing))
+		require.Equal(t, "return 503;", ing.Annotations["nginx.ingress.kubernetes.io/configuration-snippet"])
+	})
+
+	t.Run("istio", func(t *testing.T) {
+		common.SetIsIstioEnabled_ForTestsOnly(true)
+		r := reconcileSite(t)
+
+		virtualService := &netv1a3.VirtualService{}
+		require.NoError(t, r.client.Get(context.TODO(), siteKey, virtualService))
+		fault := virtualService.Spec.Http[0].Fault
+		require.NotNil(t, fault)
+		require.Equal(t, int32(503), fault.Abort.GetHttpStatus())
+		require.Equal(t, float64(100), fault.Abort.Percentage.Value)
+	})
+}
+
 // BuildFakeReconcile return reconcile with fake client, schemes and runtime objects
 func BuildFakeReconcile(objects []runtime.Object) *ReconcileSite {
 	c := testhelpers.NewFakeClient(objects)
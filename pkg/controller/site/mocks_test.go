@@ -211,7 +211,8 @@ func buildFakeReconcile(objects []runtime.Object) *ReconcileSite {
 
 	// create a ReconcileDrupalApplication object with the scheme and fake client
 	return &ReconcileSite{
-		client: c,
-		scheme: scheme.Scheme,
+		client:   c,
+		scheme:   scheme.Scheme,
+		recorder: testhelpers.NewFakeRecorder(),
 	}
 }
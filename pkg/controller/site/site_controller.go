@@ -2,6 +2,7 @@ package site
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -10,8 +11,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	extv1b1 "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -23,8 +26,12 @@ import (
 
 	fn "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/metrics"
 )
 
+// controllerName is the name of this controller, used for its Events and metrics
+const controllerName = "site-controller"
+
 // siteCleanupFinalizer defines the site finalizer.
 const siteCleanupFinalizer = "sites.fnresources.acquia.io"
 
@@ -37,19 +44,33 @@ var log = logf.Log.WithName("controller_site")
 
 // Add creates a new Site Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
+// Also registers webhooks for this type.
 func Add(mgr manager.Manager) error {
+	if err := addWebhook(mgr); err != nil {
+		log.Error(err, "could not create site webhook")
+		return err
+	}
 	return add(mgr, newReconciler(mgr))
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileSite{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return NewReconciler(mgr.GetClient(), mgr.GetScheme(), mgr.GetEventRecorderFor(controllerName))
+}
+
+// NewReconciler returns a new reconcile.Reconciler using the given client, which need not be a manager's client
+func NewReconciler(c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) reconcile.Reconciler {
+	return &ReconcileSite{
+		client:   c,
+		scheme:   scheme,
+		recorder: recorder,
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("site-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: 30})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: 30})
 	if err != nil {
 		return err
 	}
@@ -66,7 +87,55 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		&extv1b1.Ingress{},
 		&batchv1b1.CronJob{}, // FIXME?
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the user and TLS Secrets of Databases, to render rotated credentials and certificates into the
+	// settings of their Sites
+	return c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: databaseSites(mgr.GetClient()),
+	})
+}
+
+// databaseSites maps a Secret owned by a Database, or used by the TLS settings of Databases, to reconcile requests for
+// the Sites using the Databases
+func databaseSites(c client.Client) handler.ToRequestsFunc {
+	return func(o handler.MapObject) (requests []reconcile.Request) {
+		databases := map[string]bool{}
+		owner := metav1.GetControllerOf(o.Meta)
+		if owner != nil && owner.Kind == "Database" && strings.HasPrefix(owner.APIVersion, fn.SchemeGroupVersion.Group+"/") {
+			databases[owner.Name] = true
+		}
+
+		dbs := &fn.DatabaseList{}
+		if err := c.List(context.TODO(), dbs, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list Databases", "Namespace", o.Meta.GetNamespace())
+			return nil
+		}
+		for _, db := range dbs.Items {
+			if tls := db.Spec.TLS; tls != nil && (tls.CASecret == o.Meta.GetName() || tls.ClientCertSecret == o.Meta.GetName()) {
+				databases[db.Name] = true
+			}
+		}
+		if len(databases) == 0 {
+			return nil
+		}
+
+		sites := &fn.SiteList{}
+		if err := c.List(context.TODO(), sites, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list Sites", "Namespace", o.Meta.GetNamespace())
+			return nil
+		}
+		for _, site := range sites.Items {
+			if databases[site.Spec.Database] {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: site.Namespace, Name: site.Name},
+				})
+			}
+		}
+		return
+	}
 }
 
 // blank assignment to verify that ReconcileSite implements reconcile.Reconciler
@@ -76,8 +145,9 @@ var _ reconcile.Reconciler = &ReconcileSite{}
 type ReconcileSite struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
 }
 
 // requestHandler gets initialized per request to have thread-safe code.
@@ -89,6 +159,8 @@ type requestHandler struct {
 	site     *fn.Site
 	database *fn.Database
 	logger   logr.Logger
+	// drift detects changes made to child resources outside of the operator as they are applied
+	drift *common.DriftDetector
 }
 
 // Reconcile reads that state of the cluster for a Site object and makes changes based on the state read
@@ -127,11 +199,15 @@ func (r *ReconcileSite) Reconcile(request reconcile.Request) (reconcile.Result,
 		return reconcile.Result{Requeue: true}, nil
 	}
 
-	if reqResult, err := rh.doReconcile(); reqResult.Requeue || reqResult.RequeueAfter > 0 || err != nil {
+	rh.drift = common.NewDriftDetector(r.client, r.scheme, controllerName, rh.site.Status.AppliedResources)
+	reqResult, err := rh.doReconcile()
+	rh.drift.Report(r.recorder, rh.site, &rh.site.Status.Conditions)
+	if reqResult.Requeue || reqResult.RequeueAfter > 0 || err != nil {
 		return reqResult, err
 	}
 
 	// Note: the status of the site gets updated during the reconcile process, at this point the status needs to be updated.
+	rh.site.Status.AppliedResources = rh.drift.AppliedResources()
 	err = rh.reconciler.client.Status().Update(context.TODO(), rh.site)
 	if err != nil {
 		log.Error(err, "Unable to update site status")
@@ -151,6 +227,9 @@ func (rh *requestHandler) doReconcile() (result reconcile.Result, err error) {
 
 		// Remove this site's entry from the env-config Secret
 		result, err = rh.cleanupSiteSettings()
+		if err != nil {
+			rh.reconciler.recorder.Eventf(rh.site, corev1.EventTypeWarning, common.ReasonFinalizerBlocked, "Failed to remove site settings: %v", err)
+		}
 		if common.ShouldReturn(result, err) {
 			return
 		}
@@ -170,6 +249,7 @@ func (rh *requestHandler) doReconcile() (result reconcile.Result, err error) {
 		if errors.IsNotFound(err) {
 			// Delay the requeue rather than returning an error, to avoid exponential error backoff
 			rh.logger.Info("Failed to get parent environment", "Environment", rh.site.Spec.Environment)
+			rh.reconciler.recorder.Eventf(rh.site, corev1.EventTypeWarning, common.ReasonParentEnvironmentMissing, "DrupalEnvironment %q not found", rh.site.Spec.Environment)
 			result.RequeueAfter = time.Second * 10
 			return result, nil
 		}
@@ -181,6 +261,7 @@ func (rh *requestHandler) doReconcile() (result reconcile.Result, err error) {
 	if err != nil {
 		if errors.IsNotFound(err) {
 			rh.logger.Info("Failed to get parent application", "Application", rh.env.Spec.Application)
+			rh.reconciler.recorder.Eventf(rh.site, corev1.EventTypeWarning, common.ReasonParentApplicationMissing, "DrupalApplication %q not found", rh.env.Spec.Application)
 			result.RequeueAfter = time.Second * 10
 			return result, nil
 		}
@@ -192,13 +273,14 @@ func (rh *requestHandler) doReconcile() (result reconcile.Result, err error) {
 	if err != nil {
 		if errors.IsNotFound(err) {
 			rh.logger.Info("Failed to get database", "Database", rh.site.Spec.Database)
+			rh.reconciler.recorder.Eventf(rh.site, corev1.EventTypeWarning, common.ReasonDatabaseMissing, "Database %q not found", rh.site.Spec.Database)
 			result.RequeueAfter = time.Second * 10
 			return result, nil
 		}
 		return
 	}
 
-	result.Requeue, err = rh.linkToEnvironment()
+	result.Requeue, err = metrics.Step(controllerName, "link-to-environment", rh.linkToEnvironment)
 	if err != nil {
 		rh.logger.Error(err, "Failed to link to parent Environment")
 	}
@@ -206,12 +288,21 @@ func (rh *requestHandler) doReconcile() (result reconcile.Result, err error) {
 		return
 	}
 
+	result.Requeue, err = metrics.Step(controllerName, "protect-database", rh.protectDatabase)
+	if err != nil {
+		rh.logger.Error(err, "Failed to protect Database from deletion")
+	}
+	if common.ShouldReturn(result, err) {
+		return
+	}
+
 	// Reconcile Ingress and Site Settings
 	result, err = rh.reconcileDomains()
 	if common.ShouldReturn(result, err) {
 		return
 	}
 
+	rh.drift.Complete()
 	rh.site.SetStatus(fn.SiteSyncedStatus)
 	return
 }
@@ -249,16 +340,29 @@ func (rh *requestHandler) linkToEnvironment() (requeue bool, err error) {
 	return update, nil
 }
 
+// protectDatabase labels the Database of a Site in a production environment, so that it's protected from deletion by
+// default, like the environment itself. The label is never removed, since that would disable protection in one step;
+// the deletion protection annotation still overrides it.
+func (rh *requestHandler) protectDatabase() (requeue bool, err error) {
+	if !rh.env.Spec.Production || rh.database.Labels[fn.ProductionLabel] == "true" {
+		return false, nil
+	}
+
+	rh.logger.Info("Labelling Database of production environment", "Database", rh.database.Name)
+	rh.database.Labels = common.MergeLabels(rh.database.Labels, map[string]string{fn.ProductionLabel: "true"})
+	return false, rh.reconciler.client.Update(context.TODO(), rh.database)
+}
+
 // reconcileDomains creates the domains config maps and ingress objects.
 func (rh *requestHandler) reconcileDomains() (result reconcile.Result, err error) {
 	rh.site.SetDomainStatus(fn.DomainsUpdatingStatus)
 
-	result, err = rh.updateSiteSettings()
+	result, err = metrics.StepResult(controllerName, "site-settings", rh.updateSiteSettings)
 	if common.ShouldReturn(result, err) {
 		return
 	}
 
-	result.Requeue, err = rh.reconcileIngress()
+	result.Requeue, err = metrics.Step(controllerName, "ingress", rh.reconcileIngress)
 	if common.ShouldReturn(result, err) {
 		return
 	}
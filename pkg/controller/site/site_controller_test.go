@@ -13,11 +13,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
 	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
 )
 
@@ -50,6 +52,7 @@ func TestSiteController_ReconcileDrupalEnvironmentNotFound(t *testing.T) {
 	res, err = r.Reconcile(req)
 	require.Nil(t, err)
 	require.Equal(t, time.Second*10, res.RequeueAfter)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonParentEnvironmentMissing)
 }
 
 func TestSiteController_ReconcileDrupalApplicationNotFound(t *testing.T) {
@@ -82,6 +85,7 @@ func TestSiteController_ReconcileDrupalApplicationNotFound(t *testing.T) {
 	res, err = r.Reconcile(req)
 	require.Nil(t, err)
 	require.Equal(t, time.Second*10, res.RequeueAfter)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonParentApplicationMissing)
 }
 
 func TestSiteController_ReconcileDatabaseNotFound(t *testing.T) {
@@ -111,6 +115,7 @@ func TestSiteController_ReconcileDatabaseNotFound(t *testing.T) {
 	res, err = r.Reconcile(req)
 	require.Nil(t, err)
 	require.Equal(t, time.Second*10, res.RequeueAfter)
+	testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeWarning, common.ReasonDatabaseMissing)
 }
 
 func TestSiteController_ReconcileSiteWithoutID(t *testing.T) {
@@ -201,7 +206,7 @@ func TestSiteController_Reconcile(t *testing.T) {
 	t.Run("should reconcile env-config Secret", func(t *testing.T) {
 		// Verifying the env-config Secret does not yet exist
 		secret := &corev1.Secret{}
-		err := r.client.Get(context.TODO(), types.NamespacedName{Name: "env-config", Namespace: testNamespace}, secret)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: envconfig.SecretName(testEnvironmentName), Namespace: testNamespace}, secret)
 		require.True(t, errors.IsNotFound(err))
 
 		res, err := r.Reconcile(req)
@@ -209,10 +214,11 @@ func TestSiteController_Reconcile(t *testing.T) {
 		require.True(t, res.Requeue)
 
 		// Verifying the env-config Secret has been created
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "env-config", Namespace: testNamespace}, secret)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: envconfig.SecretName(testEnvironmentName), Namespace: testNamespace}, secret)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.Golden(t, "first_site_settings.inc", secret.Data[testSiteName+".settings.inc"]))
 		require.True(t, goldenHelper.GoldenSpec(t, "Secret", secret))
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonSiteSettingsUpdated)
 	})
 
 	t.Run("should reconcile ingress", func(t *testing.T) {
@@ -226,6 +232,7 @@ func TestSiteController_Reconcile(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, ingress.Spec.Rules[1].Host, testDomain2)
 		require.Nil(t, ingress.Spec.TLS)
+		testhelpers.RequireEvent(t, r.recorder, corev1.EventTypeNormal, common.ReasonIngressUpdated)
 	})
 
 	t.Run("should finish reconcile loop", func(t *testing.T) {
@@ -330,7 +337,7 @@ func TestSiteController_Reconcile(t *testing.T) {
 
 		// Verifying the env-config Secret has been updated
 		secret := &corev1.Secret{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "env-config", Namespace: testNamespace}, secret)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: envconfig.SecretName(testEnvironmentName), Namespace: testNamespace}, secret)
 		require.NoError(t, err)
 		require.True(t, goldenHelper.Golden(t, "second_site_settings.inc", secret.Data[testSecondSiteName+".settings.inc"]))
 		require.True(t, goldenHelper.GoldenSpec(t, "Secret", secret))
@@ -352,7 +359,7 @@ func TestSiteController_Reconcile(t *testing.T) {
 		require.True(t, res.Requeue)
 
 		secret := &corev1.Secret{}
-		err = r.client.Get(context.TODO(), types.NamespacedName{Name: "env-config", Namespace: testNamespace}, secret)
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: envconfig.SecretName(testEnvironmentName), Namespace: testNamespace}, secret)
 		require.NoError(t, err)
 		require.Zero(t, string(secret.Data[siteWithID.Name+".settings.inc"]))
 		require.True(t, goldenHelper.Golden(t, "second_site_settings.inc", secret.Data[testSecondSiteName+".settings.inc"]))
@@ -364,3 +371,132 @@ func TestSiteController_Reconcile(t *testing.T) {
 		require.True(t, res.Requeue)
 	})
 }
+
+func TestSiteController_ProtectDatabase(t *testing.T) {
+	env := drupalEnvironment.DeepCopy()
+	env.Spec.Production = true
+	unprotectedDB := test2ndDatabase.DeepCopy()
+	unprotectedDB.Annotations = map[string]string{fnv1alpha1.DeletionProtectionAnnotation: string(fnv1alpha1.DeletionProtectionDisabled)}
+
+	r := buildFakeReconcile([]runtime.Object{
+		siteWithID,
+		testSecondSite,
+		env,
+		drupalApplication,
+		testDatabase,
+		unprotectedDB,
+		testDBUserSecret,
+		test2ndDBUserSecret,
+		dbAdminSecret,
+	})
+
+	for _, site := range []*fnv1alpha1.Site{siteWithID, testSecondSite} {
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: site.Name, Namespace: site.Namespace}}
+		for i := 0; i < 3; i++ {
+			_, err := r.Reconcile(req)
+			require.NoError(t, err)
+		}
+	}
+
+	db := &fnv1alpha1.Database{}
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: testDatabase.Name, Namespace: testDatabase.Namespace}, db))
+	require.Equal(t, "true", db.Labels[fnv1alpha1.ProductionLabel])
+	require.Equal(t, fnv1alpha1.DeletionProtectionEnabled, fnv1alpha1.GetDeletionProtection(db))
+
+	// A Database whose protection was disabled stays unprotected
+	require.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: unprotectedDB.Name, Namespace: unprotectedDB.Namespace}, db))
+	require.Equal(t, "true", db.Labels[fnv1alpha1.ProductionLabel])
+	require.Equal(t, fnv1alpha1.DeletionProtectionDisabled, fnv1alpha1.GetDeletionProtection(db))
+}
+
+func TestSiteController_RotatedCredentials(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	r := buildFakeReconcile([]runtime.Object{
+		siteWithID,
+		testSecondSite,
+		drupalEnvironment,
+		drupalApplication,
+		testDatabase,
+		testDBUserSecret,
+		dbAdminSecret,
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: siteWithID.Name, Namespace: siteWithID.Namespace}}
+	reconcileSite := func(t *testing.T) string {
+		for i := 0; i < 5; i++ {
+			_, err := r.Reconcile(req)
+			require.NoError(t, err)
+		}
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: envconfig.SecretName(testEnvironmentName), Namespace: testNamespace}, secret)
+		require.NoError(t, err)
+		return string(secret.Data[testSiteName+".settings.inc"])
+	}
+	require.Contains(t, reconcileSite(t), "'password' => 'testpassword'")
+
+	// The Database controller rotates credentials in its user Secret
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: testDatabaseUserSecretName, Namespace: testNamespace}, secret)
+	require.NoError(t, err)
+	controller := true
+	secret.OwnerReferences = []metav1.OwnerReference{{APIVersion: "fnresources.acquia.io/v1alpha1", Kind: "Database", Name: testDatabase.Name, Controller: &controller}}
+	secret.Data = map[string][]byte{"username": []byte(testDatabase.Spec.User + fnv1alpha1.AlternateUserSuffix), "password": []byte("rotatedpassword")}
+	err = r.client.Update(context.TODO(), secret)
+	require.NoError(t, err)
+
+	requests := databaseSites(r.client)(handler.MapObject{Meta: secret, Object: secret})
+	require.Equal(t, []reconcile.Request{req}, requests, "only the Sites of the Database are reconciled")
+
+	settings := reconcileSite(t)
+	require.Contains(t, settings, "'username' => '"+testDatabase.Spec.User+fnv1alpha1.AlternateUserSuffix+"'")
+	require.Contains(t, settings, "'password' => 'rotatedpassword'")
+}
+
+func TestSiteController_DatabaseTLS(t *testing.T) {
+	logf.SetLogger(logf.ZapLogger(true))
+
+	database := testDatabase.DeepCopy()
+	database.Spec.TLS = &fnv1alpha1.DatabaseTLS{CASecret: "mysql-ca", ClientCertSecret: "mysql-client"}
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-ca", Namespace: testNamespace},
+		Data:       map[string][]byte{fnv1alpha1.TLSCAKey: []byte("ca")},
+	}
+	clientSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-client", Namespace: testNamespace},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+	}
+
+	r := buildFakeReconcile([]runtime.Object{
+		siteWithID,
+		drupalEnvironment,
+		drupalApplication,
+		database,
+		testDBUserSecret,
+		dbAdminSecret,
+		caSecret,
+		clientSecret,
+	})
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: siteWithID.Name, Namespace: siteWithID.Namespace}}
+	for i := 0; i < 5; i++ {
+		_, err := r.Reconcile(req)
+		require.NoError(t, err)
+	}
+
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: envconfig.SecretName(testEnvironmentName), Namespace: testNamespace}, secret)
+	require.NoError(t, err)
+	require.Equal(t, "ca", string(secret.Data[testSiteName+".mysql-ca.pem"]))
+	require.Equal(t, "cert", string(secret.Data[testSiteName+".mysql-cert.pem"]))
+	require.Equal(t, "key", string(secret.Data[testSiteName+".mysql-key.pem"]))
+
+	settings := string(secret.Data[testSiteName+".settings.inc"])
+	require.Contains(t, settings, "PDO::MYSQL_ATTR_SSL_CA => '/mnt/env-config/"+testSiteName+".mysql-ca.pem',")
+	require.Contains(t, settings, "PDO::MYSQL_ATTR_SSL_CERT => '/mnt/env-config/"+testSiteName+".mysql-cert.pem',")
+	require.Contains(t, settings, "PDO::MYSQL_ATTR_SSL_KEY => '/mnt/env-config/"+testSiteName+".mysql-key.pem',")
+	require.Contains(t, settings, "PDO::MYSQL_ATTR_SSL_VERIFY_SERVER_CERT => TRUE,")
+
+	// A new CA bundle is rendered for the Sites of the Databases using it
+	requests := databaseSites(r.client)(handler.MapObject{Meta: caSecret, Object: caSecret})
+	require.Equal(t, []reconcile.Request{req}, requests)
+}
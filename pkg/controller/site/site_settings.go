@@ -8,11 +8,13 @@ import (
 	"text/template"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
 	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
 )
 
@@ -34,6 +36,16 @@ $databases['{{ .Key }}']['default'] = [
   'port' => '{{ .Port }}',
   'driver' => '{{ .Driver }}',
   'prefix' => '{{ .Prefix }}',
+{{- with .TLS }}
+  'pdo' => [
+    PDO::MYSQL_ATTR_SSL_CA => '{{ .CA }}',
+{{- if .Cert }}
+    PDO::MYSQL_ATTR_SSL_CERT => '{{ .Cert }}',
+    PDO::MYSQL_ATTR_SSL_KEY => '{{ .Key }}',
+{{- end }}
+    PDO::MYSQL_ATTR_SSL_VERIFY_SERVER_CERT => {{ if .VerifyServerCert }}TRUE{{ else }}FALSE{{ end }},
+  ],
+{{- end }}
 ];
 {{- end }}
 
@@ -56,6 +68,9 @@ type DrupalSiteConfig struct {
 	Domains   []string
 	Databases []DrupalDBConfig
 	HashSalt  string
+
+	// DatabaseTLSFiles are written to the "env-config" Secret next to the settings include, which refers to them
+	DatabaseTLSFiles *v1alpha1.DatabaseTLSFiles
 }
 
 type DrupalDBConfig struct {
@@ -70,6 +85,18 @@ type DrupalDBConfig struct {
 	Driver   string
 	Prefix   string
 	// Collation string
+
+	// TLS has the PDO options of TLS connections, which are unencrypted if it's nil
+	TLS *DrupalDBTLSConfig
+}
+
+// DrupalDBTLSConfig contains the paths of the files of TLS connections to the database in the Drupal containers
+type DrupalDBTLSConfig struct {
+	CA   string
+	Cert string
+	Key  string
+	// VerifyServerCert verifies the server's certificate, including its host, since PHP can't verify it without the host
+	VerifyServerCert bool
 }
 
 // updateSiteSettings reconciles the site's settings include file held in the "env-config" Secret.
@@ -90,9 +117,19 @@ func (rh *requestHandler) updateSiteSettings() (result reconcile.Result, err err
 		return
 	}
 
-	// Create/Update the Secret resource
+	// Create/Update the Secret resource, with the TLS files first so that the settings don't refer to missing files
 	r := rh.reconciler
-	return envconfig.UpdateDrupalSettingsConfig(r.client, r.scheme, rh.env, rh.site, settingsInc)
+	var tlsResult reconcile.Result
+	if tlsResult, err = envconfig.UpdateDrupalDatabaseTLSFiles(r.client, r.scheme, rh.env, rh.site, siteConfig.DatabaseTLSFiles); err != nil {
+		rh.logger.Error(err, "Failed to update Drupal database TLS files")
+		return
+	}
+	result, err = envconfig.UpdateDrupalSettingsConfig(r.client, r.scheme, rh.env, rh.site, settingsInc, rh.drift)
+	result.Requeue = result.Requeue || tlsResult.Requeue
+	if err == nil && result.Requeue {
+		r.recorder.Event(rh.site, corev1.EventTypeNormal, common.ReasonSiteSettingsUpdated, "Updated Drupal settings in env-config")
+	}
+	return
 }
 
 // cleanupSiteSettings removed the site's settings include file held in the "env-config" Secret.
@@ -112,7 +149,13 @@ func (rh *requestHandler) cleanupSiteSettings() (result reconcile.Result, err er
 	}
 
 	rh.logger.Info("Removing Drupal settings from env-config")
-	return envconfig.UpdateDrupalSettingsConfig(r.client, r.scheme, rh.env, rh.site, nil)
+	if result, err = envconfig.UpdateDrupalSettingsConfig(r.client, r.scheme, rh.env, rh.site, nil, nil); err != nil {
+		return
+	}
+	var tlsResult reconcile.Result
+	tlsResult, err = envconfig.UpdateDrupalDatabaseTLSFiles(r.client, r.scheme, rh.env, rh.site, nil)
+	result.Requeue = result.Requeue || tlsResult.Requeue
+	return
 }
 
 func (rh *requestHandler) newSiteConfig() (config *DrupalSiteConfig, err error) {
@@ -136,23 +179,49 @@ func (rh *requestHandler) newSiteConfig() (config *DrupalSiteConfig, err error)
 		return
 	}
 
+	var tlsFiles *v1alpha1.DatabaseTLSFiles
+	if tlsFiles, err = db.GetTLSFiles(rh.reconciler.client); err != nil {
+		rh.logger.Error(err, "Failed to get DB TLS files")
+		return
+	}
+
+	dbConfig := DrupalDBConfig{
+		Key:      "default",
+		Database: conn.Name,
+		Username: conn.User,
+		Password: conn.Password,
+		Host:     conn.Host,
+		Port:     strconv.Itoa(conn.Port),
+		Driver:   "mysql",
+		Prefix:   "",
+	}
+	if tlsFiles != nil {
+		dbConfig.TLS = rh.newDBTLSConfig(tlsFiles)
+	}
+
 	return &DrupalSiteConfig{
 		Domains:  rh.site.Spec.Domains,
 		HashSalt: "fake garbage", // TODO: https://backlog.acquia.com/browse/NW-130
 
-		Databases: []DrupalDBConfig{{
-			Key:      "default",
-			Database: conn.Name,
-			Username: conn.User,
-			Password: conn.Password,
-			Host:     conn.Host,
-			Port:     strconv.Itoa(conn.Port),
-			Driver:   "mysql",
-			Prefix:   "",
-		}},
+		Databases:        []DrupalDBConfig{dbConfig},
+		DatabaseTLSFiles: tlsFiles,
 	}, nil
 }
 
+// newDBTLSConfig returns the PDO options of the site's TLS connections with the given files. PHP can't verify the
+// server's certificate without its host, so the certificate isn't verified by Drupal with the VerifyCA mode.
+func (rh *requestHandler) newDBTLSConfig(files *v1alpha1.DatabaseTLSFiles) *DrupalDBTLSConfig {
+	config := &DrupalDBTLSConfig{
+		CA:               envconfig.DatabaseTLSFilePath(rh.site, envconfig.DatabaseCAFile),
+		VerifyServerCert: files.VerifyMode == v1alpha1.DatabaseTLSVerifyIdentity,
+	}
+	if files.Cert != nil {
+		config.Cert = envconfig.DatabaseTLSFilePath(rh.site, envconfig.DatabaseCertFile)
+		config.Key = envconfig.DatabaseTLSFilePath(rh.site, envconfig.DatabaseKeyFile)
+	}
+	return config
+}
+
 func (rh *requestHandler) generateSettingsInclude(siteConfig *DrupalSiteConfig) (settingsInc []byte, err error) {
 	var buf bytes.Buffer
 	if err = tmplDrupalSettings.Execute(&buf, siteConfig); err == nil {
@@ -0,0 +1,230 @@
+package site
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	fn "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+const (
+	// domainWildcardsField is the field index of Sites by the wildcards covering their domains (see domainWildcard)
+	domainWildcardsField = "spec.domains.wildcard"
+
+	// validatingWebhookPath is the path the Site validating webhook is served on
+	validatingWebhookPath = "/validate-fnresources-acquia-io-v1alpha1-site"
+)
+
+// addWebhook registers the Site conversion webhook, indexes Sites by the wildcards of their domains, and registers the
+// Site validating webhook, which looks them up
+func addWebhook(mgr manager.Manager) error {
+	// Site implements neither webhook.Validator nor webhook.Defaulter, so this only serves its conversion
+	if err := builder.WebhookManagedBy(mgr).For(&fn.Site{}).Complete(); err != nil {
+		return err
+	}
+
+	err := mgr.GetFieldIndexer().IndexField(&fn.Site{}, domainWildcardsField, func(o runtime.Object) []string {
+		domains := o.(*fn.Site).Spec.Domains
+		wildcards := make([]string, len(domains))
+		for i, domain := range domains {
+			wildcards[i] = domainWildcard(domain)
+		}
+		return wildcards
+	})
+	if err != nil {
+		return err
+	}
+
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mgr.GetWebhookServer().Register(validatingWebhookPath, &webhook.Admission{
+		Handler: &siteValidator{client: mgr.GetClient(), decoder: decoder, recorder: mgr.GetEventRecorderFor(controllerName)},
+	})
+	return nil
+}
+
+// siteValidator validates Sites. Unlike webhook.Validator, it has a client, to check a Site against other resources.
+type siteValidator struct {
+	client   client.Client
+	decoder  *admission.Decoder
+	recorder record.EventRecorder
+}
+
+var _ admission.Handler = &siteValidator{}
+
+// Handle denies Sites with invalid domains, or domains that overlap those another Site already claims, and the deletion
+// of protected Sites. Sites referring to a DrupalEnvironment or Database that doesn't exist (yet) are allowed, with a
+// Warning Event.
+func (v *siteValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.WithName("validator").WithValues("operation", req.Operation, "Request.Namespace", req.Namespace, "Request.Name", req.Name)
+	if req.Operation == admissionv1beta1.Delete {
+		// The OldObject of a delete request is the Site being deleted
+		site := &fn.Site{}
+		if err := v.decoder.DecodeRaw(req.OldObject, site); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := fn.ValidateDeletion(site); err != nil {
+			logger.Info(err.Error())
+			return admission.Denied(err.Error())
+		}
+		return admission.Allowed("")
+	}
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	site := &fn.Site{}
+	if err := v.decoder.Decode(req, site); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// The namespace of the request, rather than the object's, which may be left out
+	site.Namespace = req.Namespace
+
+	var err error
+	if req.Operation == admissionv1beta1.Update {
+		old := &fn.Site{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err = fn.ValidateDeletionProtection(site, old)
+	} else {
+		err = fn.ValidateDeletionProtection(site, nil)
+	}
+	if err != nil {
+		logger.Info(err.Error())
+		return admission.Denied(err.Error())
+	}
+
+	for _, domain := range site.Spec.Domains {
+		if err := validateDomain(domain); err != nil {
+			logger.Info(err.Error())
+			return admission.Denied(err.Error())
+		}
+	}
+
+	claimant, err := v.domainClaimant(ctx, site)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if claimant != "" {
+		logger.Info(claimant)
+		return admission.Denied(claimant)
+	}
+
+	// Admission responses can't carry warnings that clients show, so they're recorded as Events instead
+	if err := v.warnMissingReferences(ctx, logger, site); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.Allowed("")
+}
+
+// validateDomain checks that the domain is a valid hostname. Wildcards may only replace the first label, and must be
+// followed by at least two labels (e.g. "*.example.com", but not "*.com").
+func validateDomain(domain string) error {
+	var problems []string
+	if strings.HasPrefix(domain, "*.") {
+		problems = validation.IsWildcardDNS1123Subdomain(domain)
+		if len(problems) == 0 && !strings.Contains(strings.TrimPrefix(domain, "*."), ".") {
+			problems = append(problems, "a wildcard must be followed by at least two labels")
+		}
+	} else {
+		problems = validation.IsDNS1123Subdomain(domain)
+		if strings.Contains(domain, "*") {
+			problems = append(problems, "a wildcard may only be the first label")
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid domain %q: %s", domain, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// domainWildcard returns the wildcard covering the domain, i.e. the domain itself if it's a wildcard, or else the
+// wildcard of its first label (e.g. "*.example.com" for "www.example.com"). Domains that overlap have the same wildcard.
+func domainWildcard(domain string) string {
+	if strings.HasPrefix(domain, "*.") {
+		return domain
+	}
+	if i := strings.Index(domain, "."); i >= 0 {
+		return "*" + domain[i:]
+	}
+	return domain
+}
+
+// domainsOverlap returns whether the domains serve a host in common: if they're the same, or one is a wildcard covering
+// the other. A wildcard only covers a single label, as in Ingress rules.
+func domainsOverlap(a, b string) bool {
+	return a == b || (domainWildcard(a) == domainWildcard(b) && (strings.HasPrefix(a, "*.") || strings.HasPrefix(b, "*.")))
+}
+
+// domainClaimant returns a message naming a domain of the Site that overlaps one another Site, in any namespace,
+// already claims
+func (v *siteValidator) domainClaimant(ctx context.Context, site *fn.Site) (string, error) {
+	for _, domain := range site.Spec.Domains {
+		sites := &fn.SiteList{}
+		if err := v.client.List(ctx, sites, client.MatchingFields{domainWildcardsField: domainWildcard(domain)}); err != nil {
+			return "", err
+		}
+		for _, other := range sites.Items {
+			if other.Namespace == site.Namespace && other.Name == site.Name {
+				continue
+			}
+			// Double-check the domains, since the index only narrows them down, and not every client (e.g. the fake
+			// one) filters by field
+			for _, otherDomain := range other.Spec.Domains {
+				switch {
+				case otherDomain == domain:
+					return fmt.Sprintf("domain %q is already claimed by Site %s/%s", domain, other.Namespace, other.Name), nil
+				case domainsOverlap(domain, otherDomain):
+					return fmt.Sprintf("domain %q overlaps %q, which is already claimed by Site %s/%s", domain, otherDomain, other.Namespace, other.Name), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// warnMissingReferences records a Warning Event on the Site for the DrupalEnvironment and Database it refers to, if
+// they don't exist
+func (v *siteValidator) warnMissingReferences(ctx context.Context, logger logr.Logger, site *fn.Site) error {
+	references := []struct {
+		kind   string
+		reason string
+		name   string
+		obj    runtime.Object
+	}{
+		{"DrupalEnvironment", common.ReasonParentEnvironmentMissing, site.Spec.Environment, &fn.DrupalEnvironment{}},
+		{"Database", common.ReasonDatabaseMissing, site.Spec.Database, &fn.Database{}},
+	}
+	for _, ref := range references {
+		err := v.client.Get(ctx, types.NamespacedName{Namespace: site.Namespace, Name: ref.name}, ref.obj)
+		if errors.IsNotFound(err) {
+			logger.Info("Allowing Site with a missing reference", "Kind", ref.kind, "Name", ref.name)
+			v.recorder.Eventf(site, corev1.EventTypeWarning, ref.reason, "%s %q not found in namespace %q", ref.kind, ref.name, site.Namespace)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package site
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+// admissionRequest returns a request to admit the Site with the given operation. The old Site of updates is the Site
+// itself, unless another one is given.
+func admissionRequest(t *testing.T, operation admissionv1beta1.Operation, site, old *fnv1alpha1.Site) admission.Request {
+	rawSite := func(site *fnv1alpha1.Site) runtime.RawExtension {
+		site = site.DeepCopy()
+		site.TypeMeta = metav1.TypeMeta{APIVersion: fnv1alpha1.SchemeGroupVersion.String(), Kind: "Site"}
+		raw, err := json.Marshal(site)
+		require.NoError(t, err)
+		return runtime.RawExtension{Raw: raw}
+	}
+
+	req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		Operation: operation,
+		Namespace: site.Namespace,
+		Name:      site.Name,
+	}}
+	switch operation {
+	case admissionv1beta1.Create:
+		req.Object = rawSite(site)
+	case admissionv1beta1.Update:
+		if old == nil {
+			old = site
+		}
+		req.Object = rawSite(site)
+		req.OldObject = rawSite(old)
+	case admissionv1beta1.Delete:
+		// The OldObject of a delete request is the object being deleted
+		req.OldObject = rawSite(site)
+	}
+	return req
+}
+
+func TestSiteValidator(t *testing.T) {
+	wildcardSite := &fnv1alpha1.Site{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "wildcards"},
+		Spec:       fnv1alpha1.SiteSpec{Domains: []string{"www.wlgore.net", "*.wlgore.org"}},
+	}
+	c := testhelpers.NewFakeClient([]runtime.Object{siteWithID, testSecondSite, wildcardSite, drupalEnvironment, testDatabase})
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	require.NoError(t, err)
+	recorder := testhelpers.NewFakeRecorder()
+	v := &siteValidator{client: c, decoder: decoder, recorder: recorder}
+
+	newSite := func(namespace string, domains ...string) *fnv1alpha1.Site {
+		return &fnv1alpha1.Site{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "third"},
+			Spec: fnv1alpha1.SiteSpec{
+				Environment: testEnvironmentName,
+				Database:    testDatabaseResourceName,
+				Domains:     domains,
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		operation admissionv1beta1.Operation
+		site      *fnv1alpha1.Site
+		old       *fnv1alpha1.Site
+		allowed   bool
+		reason    string
+		events    []string
+	}{
+		{
+			name:      "valid Site",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "wlgore-prod-site4.com", "*.wlgore.com"),
+			allowed:   true,
+		},
+		{
+			name:      "update keeping its own domains",
+			operation: admissionv1beta1.Update,
+			site:      siteWithID,
+			allowed:   true,
+		},
+		{
+			name:      "domain claimed by another Site",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, testDomain3, testDomain2),
+			reason:    `domain "wlgore-prod-site2.com" is already claimed by Site wlgore-prod/default`,
+		},
+		{
+			name:      "domain claimed by a Site in another namespace",
+			operation: admissionv1beta1.Create,
+			site:      newSite("other", testSecondSiteDomain1),
+			reason:    `domain "second-site1.com" is already claimed by Site wlgore-prod/second`,
+		},
+		{
+			name:      "references that don't exist yet",
+			operation: admissionv1beta1.Create,
+			site:      newSite("other", "wlgore-other-site1.com"),
+			allowed:   true,
+			events:    []string{common.ReasonParentEnvironmentMissing, common.ReasonDatabaseMissing},
+		},
+		{
+			name:      "wildcard covering a domain claimed by another Site",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "*.wlgore.net"),
+			reason:    `domain "*.wlgore.net" overlaps "www.wlgore.net", which is already claimed by Site wlgore-prod/wildcards`,
+		},
+		{
+			name:      "domain covered by a wildcard claimed by another Site",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "shop.wlgore.org"),
+			reason:    `domain "shop.wlgore.org" overlaps "*.wlgore.org", which is already claimed by Site wlgore-prod/wildcards`,
+		},
+		{
+			name:      "domains sharing a wildcard, but no host",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "shop.wlgore.net", "shop.eu.wlgore.org"),
+			allowed:   true,
+		},
+		{
+			name:      "invalid hostname",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "WLGore_site.com"),
+			reason:    `invalid domain "WLGore_site.com": a DNS-1123 subdomain must consist of lower case alphanumeric characters`,
+		},
+		{
+			name:      "wildcard of a top-level domain",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "*.com"),
+			reason:    `invalid domain "*.com": a wildcard must be followed by at least two labels`,
+		},
+		{
+			name:      "wildcard in another label than the first",
+			operation: admissionv1beta1.Create,
+			site:      newSite(testNamespace, "site.*.wlgore.com"),
+			reason:    "a wildcard may only be the first label",
+		},
+		{
+			name:      "deletion",
+			operation: admissionv1beta1.Delete,
+			site:      newSite(testNamespace, "WLGore_site.com"),
+			allowed:   true,
+		},
+		{
+			name:      "deletion of a protected Site",
+			operation: admissionv1beta1.Delete,
+			site:      protectedSite(newSite(testNamespace, "wlgore.com"), fnv1alpha1.DeletionProtectionEnabled),
+			reason:    "third is protected from deletion",
+		},
+		{
+			name:      "invalid deletion protection",
+			operation: admissionv1beta1.Create,
+			site:      protectedSite(newSite(testNamespace, "wlgore-prod-site4.com"), "true"),
+			reason:    fnv1alpha1.DeletionProtectionAnnotation + " must be one of",
+		},
+		{
+			name:      "deletion protection disabled in one step",
+			operation: admissionv1beta1.Update,
+			site:      protectedSite(siteWithID, fnv1alpha1.DeletionProtectionDisabled),
+			old:       protectedSite(siteWithID, fnv1alpha1.DeletionProtectionEnabled),
+			reason:    "deletion protection can't be disabled in one step",
+		},
+		{
+			name:      "deletion protection disabled after an unlock request",
+			operation: admissionv1beta1.Update,
+			site:      protectedSite(siteWithID, fnv1alpha1.DeletionProtectionDisabled),
+			old:       protectedSite(siteWithID, fnv1alpha1.DeletionProtectionUnlockRequested),
+			allowed:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := v.Handle(context.TODO(), admissionRequest(t, test.operation, test.site, test.old))
+			require.Equal(t, test.allowed, resp.Allowed, resp.Result.Reason)
+			if test.reason == "" {
+				require.Empty(t, resp.Result.Reason)
+			} else {
+				require.Contains(t, string(resp.Result.Reason), test.reason)
+			}
+			for _, reason := range test.events {
+				testhelpers.RequireEvent(t, recorder, corev1.EventTypeWarning, reason)
+			}
+		})
+	}
+}
+
+// protectedSite returns a copy of the Site annotated with the deletion protection
+func protectedSite(site *fnv1alpha1.Site, protection fnv1alpha1.DeletionProtection) *fnv1alpha1.Site {
+	site = site.DeepCopy()
+	if site.Annotations == nil {
+		site.Annotations = map[string]string{}
+	}
+	site.Annotations[fnv1alpha1.DeletionProtectionAnnotation] = string(protection)
+	return site
+}
@@ -10,7 +10,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/apm"
 	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
 )
 
 const (
@@ -105,6 +107,16 @@ func SharedVolumeMount(e *fnv1alpha1.DrupalEnvironment) v1.VolumeMount {
 	}
 }
 
+// apmEnvironmentVariables returns the environment variables of the environment's APM provider, if any. Invalid APM
+// configuration is reported by the DrupalEnvironment controller, so errors are ignored here.
+func apmEnvironmentVariables(a *fnv1alpha1.DrupalApplication, e *fnv1alpha1.DrupalEnvironment) []v1.EnvVar {
+	provider, err := apm.ForEnvironment(a, e)
+	if err != nil || provider == nil {
+		return nil
+	}
+	return provider.EnvVars()
+}
+
 func Template(a *fnv1alpha1.DrupalApplication, e *fnv1alpha1.DrupalEnvironment) v1.Container {
 	return v1.Container{
 		Image:           ImageName(a, e),
@@ -119,7 +131,7 @@ func Template(a *fnv1alpha1.DrupalApplication, e *fnv1alpha1.DrupalEnvironment)
 				v1.ResourceMemory: resource.MustParse("512Mi"),
 			},
 		},
-		Env: EnvironmentVariables(e),
+		Env: append(EnvironmentVariables(e), apmEnvironmentVariables(a, e)...),
 		VolumeMounts: []v1.VolumeMount{
 			FilesVolumeMount(e),
 			SharedVolumeMount(e),
@@ -137,13 +149,13 @@ func Template(a *fnv1alpha1.DrupalApplication, e *fnv1alpha1.DrupalEnvironment)
 			},
 			{
 				Name:      "php-config",
-				MountPath: "/usr/local/php/etc/conf.d/newrelic.ini",
-				SubPath:   "newrelic.ini",
+				MountPath: apm.PhpIniMountPath,
+				SubPath:   apm.PhpIniFile,
 				ReadOnly:  true,
 			},
 			{
 				Name:      "env-config",
-				MountPath: "/mnt/env-config/",
+				MountPath: envconfig.MountPath,
 				ReadOnly:  true,
 			},
 		},
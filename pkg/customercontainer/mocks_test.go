@@ -3,6 +3,7 @@ package customercontainer
 import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 
 	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
 )
@@ -46,37 +47,37 @@ var (
 			Production: true,
 			Phpfpm: fnv1alpha1.SpecPhpFpm{
 				Tag:                             "7.3",
-				Procs:                           4,
-				ProcMemoryLimitMiB:              128,
-				PostMaxSizeMiB:                  8,
-				OpcacheMemoryLimitMiB:           96,
-				OpcacheInternedStringsBufferMiB: 8,
-				ApcMemoryLimitMiB:               32,
-				MaxInputVars:                    1000,
-				MaxExecutionTime:                30,
+				Procs:                           pointer.Int32Ptr(4),
+				ProcMemoryLimitMiB:              pointer.Int32Ptr(128),
+				PostMaxSizeMiB:                  pointer.Int32Ptr(8),
+				OpcacheMemoryLimitMiB:           pointer.Int32Ptr(96),
+				OpcacheInternedStringsBufferMiB: pointer.Int32Ptr(8),
+				ApcMemoryLimitMiB:               pointer.Int32Ptr(32),
+				MaxInputVars:                    pointer.Int32Ptr(1000),
+				MaxExecutionTime:                pointer.Int32Ptr(30),
 			},
 			Drupal: fnv1alpha1.SpecDrupal{
-				MinReplicas:                    2,
-				MaxReplicas:                    2,
+				MinReplicas:                    pointer.Int32Ptr(2),
+				MaxReplicas:                    pointer.Int32Ptr(2),
 				Tag:                            "1.0.0",
 				PullPolicy:                     "Always",
 				TargetCPUUtilizationPercentage: &testCPUUtilization,
 
 				Liveness: fnv1alpha1.HTTPProbe{
-					Enabled:          true,
+					Enabled:          pointer.BoolPtr(true),
 					HTTPPath:         "/user/login",
-					TimeoutSeconds:   5,
-					FailureThreshold: 5,
-					SuccessThreshold: 1,
-					PeriodSeconds:    10,
+					TimeoutSeconds:   pointer.Int32Ptr(5),
+					FailureThreshold: pointer.Int32Ptr(5),
+					SuccessThreshold: pointer.Int32Ptr(1),
+					PeriodSeconds:    pointer.Int32Ptr(10),
 				},
 				Readiness: fnv1alpha1.HTTPProbe{
-					Enabled:          true,
+					Enabled:          pointer.BoolPtr(true),
 					HTTPPath:         "/user/login",
-					TimeoutSeconds:   5,
-					FailureThreshold: 5,
-					SuccessThreshold: 1,
-					PeriodSeconds:    10,
+					TimeoutSeconds:   pointer.Int32Ptr(5),
+					FailureThreshold: pointer.Int32Ptr(5),
+					SuccessThreshold: pointer.Int32Ptr(1),
+					PeriodSeconds:    pointer.Int32Ptr(10),
 				},
 			},
 			Apache: fnv1alpha1.SpecApache{
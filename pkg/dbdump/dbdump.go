@@ -0,0 +1,320 @@
+// Package dbdump builds the Jobs that dump the schema of a Database to a DatabaseDumpTarget with mysqldump, and restore
+// it from one with mysql. Dumps are compressed with gzip, and copied to and from S3 with the AWS CLI.
+package dbdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+const (
+	// DumpContainerName is the name of the container that dumps the schema, and reports its Result
+	DumpContainerName = "mysqldump"
+	// RestoreContainerName is the name of the container that restores the schema
+	RestoreContainerName = "mysql"
+	// S3ContainerName is the name of the container that uploads the dump to S3, or downloads it from S3
+	S3ContainerName = "s3"
+
+	// mountPath is where the target, or the scratch volume of S3 targets, is mounted
+	mountPath = "/dumps"
+	// tlsCAPath and tlsClientCertPath are where the Secrets with the CA bundle, and the client certificate and key, of
+	// the TLS connections to the Database's server are mounted
+	tlsCAPath         = "/etc/mysql-tls/ca"
+	tlsClientCertPath = "/etc/mysql-tls/client"
+	// backoffLimit is the number of times a failed Job is retried
+	backoffLimit = 2
+)
+
+// dumpScript dumps a schema with mysqldump, and compresses it. mysqldump connects with TLS if MYSQL_SSL_MODE is set,
+// and with a client certificate if MYSQL_SSL_CERT is set too. The dump is written to a temporary file first, so that a
+// failed dump doesn't leave a file that looks complete. The size and checksum of the dump are reported as the
+// container's termination message.
+const dumpScript = `set -o errexit -o pipefail
+mkdir -p "$(dirname "$DUMP_FILE")"
+mysqldump --single-transaction --routines --triggers ${MYSQL_SSL_MODE:+--ssl-mode="$MYSQL_SSL_MODE" --ssl-ca="$MYSQL_SSL_CA"} ${MYSQL_SSL_CERT:+--ssl-cert="$MYSQL_SSL_CERT" --ssl-key="$MYSQL_SSL_KEY"} \
+  --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" "$MYSQL_DATABASE" | gzip > "$DUMP_FILE.tmp"
+mv "$DUMP_FILE.tmp" "$DUMP_FILE"
+printf '{"sizeBytes":%s,"checksum":"sha256:%s"}' "$(stat -c %s "$DUMP_FILE")" "$(sha256sum "$DUMP_FILE" | cut -d ' ' -f 1)" > /dev/termination-log
+`
+
+// restoreScript checks the dump against its checksum, if it's known, and loads it with mysql. Like mysqldump, mysql
+// connects with TLS if MYSQL_SSL_MODE is set.
+const restoreScript = `set -o errexit -o pipefail
+if [ -n "$DUMP_CHECKSUM" ]; then
+  echo "${DUMP_CHECKSUM#sha256:}  $DUMP_FILE" | sha256sum --check --status || {
+    echo "$DUMP_FILE doesn't match checksum $DUMP_CHECKSUM" | tee /dev/termination-log >&2
+    exit 1
+  }
+fi
+gunzip -c "$DUMP_FILE" | mysql ${MYSQL_SSL_MODE:+--ssl-mode="$MYSQL_SSL_MODE" --ssl-ca="$MYSQL_SSL_CA"} ${MYSQL_SSL_CERT:+--ssl-cert="$MYSQL_SSL_CERT" --ssl-key="$MYSQL_SSL_KEY"} \
+  --host="$MYSQL_HOST" --port="$MYSQL_PORT" --user="$MYSQL_USER" "$MYSQL_DATABASE"
+`
+
+// uploadScript and downloadScript copy the dump to and from S3. The endpoint is only passed for S3-compatible services.
+const (
+	uploadScript   = `aws s3 cp --only-show-errors ${S3_ENDPOINT:+--endpoint-url "$S3_ENDPOINT"} "$DUMP_FILE" "s3://$S3_BUCKET/$S3_KEY"`
+	downloadScript = `aws s3 cp --only-show-errors ${S3_ENDPOINT:+--endpoint-url "$S3_ENDPOINT"} "s3://$S3_BUCKET/$S3_KEY" "$DUMP_FILE"`
+)
+
+// Credentials are the MySQL user a Job connects as. The password is read from a Secret, and so is the user name if
+// UserKey is set.
+type Credentials struct {
+	User        string
+	Secret      string
+	UserKey     string
+	PasswordKey string
+}
+
+// UserCredentials returns the credentials of the user of a Database. The user is read from its user Secret, since it
+// changes when the credentials are rotated.
+func UserCredentials(db *fnv1alpha1.Database) Credentials {
+	return Credentials{Secret: db.Spec.UserSecret, UserKey: "username", PasswordKey: "password"}
+}
+
+// AdminCredentials returns the credentials of the admin Secret of a Database
+func AdminCredentials(db *fnv1alpha1.Database) Credentials {
+	return Credentials{Secret: db.Spec.AdminSecret, UserKey: "username", PasswordKey: "password"}
+}
+
+// Options configure a dump or restore Job
+type Options struct {
+	// Name, Namespace and Labels are those of the Job
+	Name      string
+	Namespace string
+	Labels    map[string]string
+
+	Database    *fnv1alpha1.Database
+	Credentials Credentials
+	Target      fnv1alpha1.DatabaseDumpTarget
+	// File is the path of the dump within the target's Path
+	File string
+	// Checksum is the expected checksum of a restored dump, if it's known
+	Checksum string
+}
+
+// Key returns the path of the dump within the target's volume or bucket
+func (o Options) Key() string {
+	return path.Join(o.Target.Path, o.File)
+}
+
+// Result is the termination message of the DumpContainerName container
+type Result struct {
+	SizeBytes int64  `json:"sizeBytes"`
+	Checksum  string `json:"checksum"`
+}
+
+// DumpJob returns the Job that dumps the schema of a Database to a target. Dumps to S3 are written to a scratch volume by
+// an init container, and then uploaded.
+func DumpJob(o Options) *batchv1.Job {
+	dump := o.mysqlContainer(DumpContainerName, dumpScript)
+	if o.Target.S3 == nil {
+		return o.job(nil, []corev1.Container{dump})
+	}
+	return o.job([]corev1.Container{dump}, []corev1.Container{o.s3Container(uploadScript)})
+}
+
+// RestoreJob returns the Job that restores the schema of a Database from a dump in a target. Dumps in S3 are downloaded
+// to a scratch volume by an init container first.
+func RestoreJob(o Options) *batchv1.Job {
+	restore := o.mysqlContainer(RestoreContainerName, restoreScript)
+	restore.Env = append(restore.Env, corev1.EnvVar{Name: "DUMP_CHECKSUM", Value: o.Checksum})
+	if o.Target.S3 == nil {
+		return o.job(nil, []corev1.Container{restore})
+	}
+	return o.job([]corev1.Container{o.s3Container(downloadScript)}, []corev1.Container{restore})
+}
+
+// ParseResult returns the Result reported by the dump container of a Pod of a DumpJob, or nil if the container didn't
+// terminate successfully
+func ParseResult(pod *corev1.Pod) (*Result, error) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name != DumpContainerName {
+			continue
+		}
+		terminated := status.State.Terminated
+		if terminated == nil || terminated.ExitCode != 0 {
+			return nil, nil
+		}
+		result := &Result{}
+		if err := json.Unmarshal([]byte(terminated.Message), result); err != nil {
+			return nil, fmt.Errorf("invalid result %q of Pod %s: %v", terminated.Message, pod.Name, err)
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+// JobPhase returns DatabaseJobSucceeded or DatabaseJobFailed once a Job finished, with the message and time of the
+// condition that finished it, or else DatabaseJobRunning
+func JobPhase(job *batchv1.Job) (phase fnv1alpha1.DatabaseJobPhase, message string, at metav1.Time) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return fnv1alpha1.DatabaseJobSucceeded, c.Message, c.LastTransitionTime
+		case batchv1.JobFailed:
+			return fnv1alpha1.DatabaseJobFailed, c.Message, c.LastTransitionTime
+		}
+	}
+	return fnv1alpha1.DatabaseJobRunning, "", metav1.Time{}
+}
+
+func (o Options) job(initContainers, containers []corev1.Container) *batchv1.Job {
+	limit := int32(backoffLimit)
+	volume := corev1.Volume{Name: "dumps"}
+	if o.Target.S3 == nil {
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: o.Target.PersistentVolumeClaim}
+	} else {
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      o.Name,
+			Namespace: o.Namespace,
+			Labels:    o.Labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &limit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: o.Labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:  corev1.RestartPolicyNever,
+					InitContainers: initContainers,
+					Containers:     containers,
+					Volumes:        append([]corev1.Volume{volume}, o.tlsVolumes()...),
+				},
+			},
+		},
+	}
+}
+
+func (o Options) mysqlContainer(name, script string) corev1.Container {
+	db := o.Database
+	user := corev1.EnvVar{Name: "MYSQL_USER", Value: o.Credentials.User}
+	if o.Credentials.UserKey != "" {
+		user = corev1.EnvVar{Name: "MYSQL_USER", ValueFrom: secretKey(o.Credentials.Secret, o.Credentials.UserKey)}
+	}
+
+	container := corev1.Container{
+		Name:    name,
+		Image:   common.MysqlClientImage(),
+		Command: []string{"bash", "-c", script},
+		Env: []corev1.EnvVar{
+			{Name: "MYSQL_HOST", Value: db.Spec.Host},
+			{Name: "MYSQL_PORT", Value: strconv.Itoa(db.Spec.Port)},
+			{Name: "MYSQL_DATABASE", Value: db.DatabaseName()},
+			user,
+			// mysqldump and mysql read the password from MYSQL_PWD, which keeps it off the command line
+			{Name: "MYSQL_PWD", ValueFrom: secretKey(o.Credentials.Secret, o.Credentials.PasswordKey)},
+			{Name: "DUMP_FILE", Value: o.localFile()},
+		},
+		VolumeMounts:             []corev1.VolumeMount{{Name: "dumps", MountPath: mountPath}},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+
+	if tls := db.Spec.TLS; tls != nil {
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "MYSQL_SSL_MODE", Value: sslMode(tls.GetVerifyMode())},
+			corev1.EnvVar{Name: "MYSQL_SSL_CA", Value: path.Join(tlsCAPath, fnv1alpha1.TLSCAKey)},
+		)
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "mysql-ca", MountPath: tlsCAPath, ReadOnly: true})
+		if tls.ClientCertSecret != "" {
+			container.Env = append(container.Env,
+				corev1.EnvVar{Name: "MYSQL_SSL_CERT", Value: path.Join(tlsClientCertPath, corev1.TLSCertKey)},
+				corev1.EnvVar{Name: "MYSQL_SSL_KEY", Value: path.Join(tlsClientCertPath, corev1.TLSPrivateKeyKey)},
+			)
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "mysql-client-cert", MountPath: tlsClientCertPath, ReadOnly: true})
+		}
+	}
+	return container
+}
+
+// tlsVolumes returns the volumes of the Secrets of the TLS connections to the Database's server, if it has any
+func (o Options) tlsVolumes() []corev1.Volume {
+	tls := o.Database.Spec.TLS
+	if tls == nil {
+		return nil
+	}
+	volumes := []corev1.Volume{{
+		Name:         "mysql-ca",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: tls.CASecret}},
+	}}
+	if tls.ClientCertSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name:         "mysql-client-cert",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: tls.ClientCertSecret}},
+		})
+	}
+	return volumes
+}
+
+// sslMode returns the --ssl-mode of mysql and mysqldump that matches a verify mode
+func sslMode(mode fnv1alpha1.DatabaseTLSVerifyMode) string {
+	switch mode {
+	case fnv1alpha1.DatabaseTLSRequired:
+		return "REQUIRED"
+	case fnv1alpha1.DatabaseTLSVerifyCA:
+		return "VERIFY_CA"
+	default:
+		return "VERIFY_IDENTITY"
+	}
+}
+
+func (o Options) s3Container(script string) corev1.Container {
+	s3 := o.Target.S3
+	region := s3.Region
+	if region == "" {
+		region = common.AwsRegion()
+	}
+	env := []corev1.EnvVar{
+		{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+		{Name: "S3_BUCKET", Value: s3.Bucket},
+		{Name: "S3_KEY", Value: o.Key()},
+		{Name: "AWS_DEFAULT_REGION", Value: region},
+		{Name: "DUMP_FILE", Value: o.localFile()},
+	}
+	if s3.CredentialsSecret != "" {
+		env = append(env,
+			corev1.EnvVar{Name: "AWS_ACCESS_KEY_ID", ValueFrom: secretKey(s3.CredentialsSecret, "accessKeyId")},
+			corev1.EnvVar{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: secretKey(s3.CredentialsSecret, "secretAccessKey")},
+		)
+	}
+
+	return corev1.Container{
+		Name:                     S3ContainerName,
+		Image:                    common.S3ClientImage(),
+		Command:                  []string{"sh", "-c", script},
+		Env:                      env,
+		VolumeMounts:             []corev1.VolumeMount{{Name: "dumps", MountPath: mountPath}},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+}
+
+// localFile returns the path of the dump in the containers. A PVC is mounted as a whole, while S3 dumps are copied to the
+// root of the scratch volume.
+func (o Options) localFile() string {
+	if o.Target.S3 != nil {
+		return path.Join(mountPath, path.Base(o.File))
+	}
+	return path.Join(mountPath, o.Key())
+}
+
+func secretKey(name, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: name},
+		Key:                  key,
+	}}
+}
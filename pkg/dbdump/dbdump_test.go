@@ -0,0 +1,201 @@
+package dbdump
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+var testDatabase = &fnv1alpha1.Database{
+	ObjectMeta: metav1.ObjectMeta{Name: "wlgoredatabase", Namespace: "wlgore"},
+	Spec: fnv1alpha1.DatabaseSpec{
+		Host:       "mysql.default.svc.cluster.local",
+		Port:       3306,
+		SchemaName: "wlgoredatabase",
+		User:       "wlgore",
+		UserSecret: "wlgore-user-secret",
+	},
+}
+
+func testOptions(target fnv1alpha1.DatabaseDumpTarget) Options {
+	return Options{
+		Name:        "wlgoredatabase-backup",
+		Namespace:   "wlgore",
+		Database:    testDatabase,
+		Credentials: UserCredentials(testDatabase),
+		Target:      target,
+		File:        "wlgoredatabase-backup.sql.gz",
+	}
+}
+
+func TestDumpJob(t *testing.T) {
+	t.Run("to a PVC", func(t *testing.T) {
+		job := DumpJob(testOptions(fnv1alpha1.DatabaseDumpTarget{PersistentVolumeClaim: "wlgore-backups", Path: "databases"}))
+		pod := job.Spec.Template.Spec
+
+		require.Empty(t, pod.InitContainers)
+		require.Len(t, pod.Containers, 1)
+		require.Equal(t, DumpContainerName, pod.Containers[0].Name)
+		require.Equal(t, []string{"bash", "-c", dumpScript}, pod.Containers[0].Command)
+		require.Equal(t, "wlgore-backups", pod.Volumes[0].PersistentVolumeClaim.ClaimName)
+		env := pod.Containers[0].Env
+		require.Contains(t, env, corev1.EnvVar{Name: "DUMP_FILE", Value: "/dumps/databases/wlgoredatabase-backup.sql.gz"})
+		require.Contains(t, env, corev1.EnvVar{Name: "MYSQL_USER", ValueFrom: secretKey("wlgore-user-secret", "username")})
+		require.Contains(t, env, corev1.EnvVar{Name: "MYSQL_PWD", ValueFrom: secretKey("wlgore-user-secret", "password")})
+	})
+
+	t.Run("to S3", func(t *testing.T) {
+		job := DumpJob(testOptions(fnv1alpha1.DatabaseDumpTarget{
+			S3:   &fnv1alpha1.S3Target{Bucket: "wlgore-backups", Endpoint: "http://minio:9000", Region: "us-east-1", CredentialsSecret: "minio"},
+			Path: "databases",
+		}))
+		pod := job.Spec.Template.Spec
+
+		require.Len(t, pod.InitContainers, 1)
+		require.Equal(t, DumpContainerName, pod.InitContainers[0].Name)
+		require.Contains(t, pod.InitContainers[0].Env, corev1.EnvVar{Name: "DUMP_FILE", Value: "/dumps/wlgoredatabase-backup.sql.gz"})
+		require.NotNil(t, pod.Volumes[0].EmptyDir)
+
+		require.Len(t, pod.Containers, 1)
+		upload := pod.Containers[0]
+		require.Equal(t, S3ContainerName, upload.Name)
+		require.Contains(t, upload.Env, corev1.EnvVar{Name: "S3_KEY", Value: "databases/wlgoredatabase-backup.sql.gz"})
+		require.Contains(t, upload.Env, corev1.EnvVar{Name: "S3_ENDPOINT", Value: "http://minio:9000"})
+		require.Contains(t, upload.Env, corev1.EnvVar{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: secretKey("minio", "secretAccessKey")})
+	})
+
+	t.Run("with admin credentials", func(t *testing.T) {
+		db := testDatabase.DeepCopy()
+		db.Spec.AdminSecret = "wlgore-admin-secret"
+		options := testOptions(fnv1alpha1.DatabaseDumpTarget{PersistentVolumeClaim: "wlgore-backups"})
+		options.Credentials = AdminCredentials(db)
+		env := DumpJob(options).Spec.Template.Spec.Containers[0].Env
+
+		require.Contains(t, env, corev1.EnvVar{Name: "MYSQL_USER", ValueFrom: secretKey("wlgore-admin-secret", "username")})
+		require.Contains(t, env, corev1.EnvVar{Name: "MYSQL_PWD", ValueFrom: secretKey("wlgore-admin-secret", "password")})
+	})
+}
+
+func TestDumpJob_TLS(t *testing.T) {
+	db := testDatabase.DeepCopy()
+	db.Spec.TLS = &fnv1alpha1.DatabaseTLS{CASecret: "mysql-ca", VerifyMode: fnv1alpha1.DatabaseTLSVerifyCA, ClientCertSecret: "mysql-client"}
+	options := testOptions(fnv1alpha1.DatabaseDumpTarget{PersistentVolumeClaim: "wlgore-backups"})
+	options.Database = db
+	pod := DumpJob(options).Spec.Template.Spec
+	dump := pod.Containers[0]
+
+	require.Contains(t, dump.Env, corev1.EnvVar{Name: "MYSQL_SSL_MODE", Value: "VERIFY_CA"})
+	require.Contains(t, dump.Env, corev1.EnvVar{Name: "MYSQL_SSL_CA", Value: "/etc/mysql-tls/ca/ca.crt"})
+	require.Contains(t, dump.Env, corev1.EnvVar{Name: "MYSQL_SSL_CERT", Value: "/etc/mysql-tls/client/tls.crt"})
+	require.Contains(t, dump.Env, corev1.EnvVar{Name: "MYSQL_SSL_KEY", Value: "/etc/mysql-tls/client/tls.key"})
+	require.Contains(t, dump.VolumeMounts, corev1.VolumeMount{Name: "mysql-ca", MountPath: "/etc/mysql-tls/ca", ReadOnly: true})
+	require.Contains(t, dump.VolumeMounts, corev1.VolumeMount{Name: "mysql-client-cert", MountPath: "/etc/mysql-tls/client", ReadOnly: true})
+	require.Len(t, pod.Volumes, 3)
+	require.Equal(t, "mysql-ca", pod.Volumes[1].Secret.SecretName)
+	require.Equal(t, "mysql-client", pod.Volumes[2].Secret.SecretName)
+
+	t.Run("without a client certificate", func(t *testing.T) {
+		db.Spec.TLS = &fnv1alpha1.DatabaseTLS{CASecret: "mysql-ca"}
+		pod := RestoreJob(options).Spec.Template.Spec
+		restore := pod.Containers[0]
+
+		require.Contains(t, restore.Env, corev1.EnvVar{Name: "MYSQL_SSL_MODE", Value: "VERIFY_IDENTITY"})
+		for _, env := range restore.Env {
+			require.NotEqual(t, "MYSQL_SSL_CERT", env.Name)
+		}
+		require.Len(t, pod.Volumes, 2)
+	})
+
+	t.Run("without TLS", func(t *testing.T) {
+		pod := DumpJob(testOptions(fnv1alpha1.DatabaseDumpTarget{PersistentVolumeClaim: "wlgore-backups"})).Spec.Template.Spec
+		for _, env := range pod.Containers[0].Env {
+			require.NotEqual(t, "MYSQL_SSL_MODE", env.Name)
+		}
+		require.Len(t, pod.Volumes, 1)
+	})
+}
+
+func TestDumpScript(t *testing.T) {
+	// Stored procedures, functions and triggers are part of the schema, and a dump that isn't a consistent snapshot of
+	// the InnoDB tables can't be restored reliably
+	var command string
+	for _, line := range strings.Split(dumpScript, "\n") {
+		if strings.HasPrefix(line, "mysqldump ") {
+			command = line
+		}
+	}
+	for _, flag := range []string{"--single-transaction", "--routines", "--triggers"} {
+		require.Contains(t, strings.Fields(command), flag)
+	}
+}
+
+func TestRestoreJob(t *testing.T) {
+	options := testOptions(fnv1alpha1.DatabaseDumpTarget{S3: &fnv1alpha1.S3Target{Bucket: "wlgore-backups"}})
+	options.Checksum = "sha256:abc"
+	pod := RestoreJob(options).Spec.Template.Spec
+
+	require.Len(t, pod.InitContainers, 1)
+	require.Equal(t, S3ContainerName, pod.InitContainers[0].Name)
+	require.Equal(t, downloadScript, pod.InitContainers[0].Command[2])
+	require.Len(t, pod.InitContainers[0].Env, 5, "credentials are only set from a Secret")
+
+	require.Len(t, pod.Containers, 1)
+	require.Equal(t, RestoreContainerName, pod.Containers[0].Name)
+	require.Contains(t, pod.Containers[0].Env, corev1.EnvVar{Name: "DUMP_CHECKSUM", Value: "sha256:abc"})
+}
+
+func TestParseResult(t *testing.T) {
+	terminated := func(exitCode int32, message string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:  DumpContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message}},
+		}
+	}
+
+	t.Run("from an init container", func(t *testing.T) {
+		pod := &corev1.Pod{Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{terminated(0, `{"sizeBytes":1024,"checksum":"sha256:abc"}`)},
+			ContainerStatuses:     []corev1.ContainerStatus{{Name: S3ContainerName}},
+		}}
+		result, err := ParseResult(pod)
+		require.NoError(t, err)
+		require.Equal(t, &Result{SizeBytes: 1024, Checksum: "sha256:abc"}, result)
+	})
+
+	t.Run("from a failed container", func(t *testing.T) {
+		pod := &corev1.Pod{Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{terminated(2, "mysqldump: Got error: 1045: Access denied")},
+		}}
+		result, err := ParseResult(pod)
+		require.NoError(t, err)
+		require.Nil(t, result)
+	})
+
+	t.Run("from an invalid message", func(t *testing.T) {
+		pod := &corev1.Pod{Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{terminated(0, "done")},
+		}}
+		_, err := ParseResult(pod)
+		require.Error(t, err)
+	})
+}
+
+func TestJobPhase(t *testing.T) {
+	job := &batchv1.Job{}
+	phase, _, _ := JobPhase(job)
+	require.Equal(t, fnv1alpha1.DatabaseJobRunning, phase)
+
+	job.Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobFailed, Status: corev1.ConditionFalse},
+		{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"},
+	}
+	phase, message, _ := JobPhase(job)
+	require.Equal(t, fnv1alpha1.DatabaseJobFailed, phase)
+	require.Equal(t, "Job has reached the specified backoff limit", message)
+}
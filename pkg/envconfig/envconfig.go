@@ -1,6 +1,7 @@
 package envconfig
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
@@ -16,30 +17,89 @@ import (
 	"github.com/acquia/fn-drupal-operator/pkg/common"
 )
 
-const envConfigSecretName = "env-config"
+// SecretComponent is the component of the name of the Secret holding the PHP include files that configure Drupal
+const SecretComponent = "env-config"
+
+// SecretName returns the name of the named DrupalEnvironment's Secret holding the PHP include files that configure
+// Drupal
+func SecretName(environment string) string {
+	return v1alpha1.EnvironmentChildName(environment, SecretComponent)
+}
+
+// MountPath is where the "env-config" Secret is mounted in the Drupal containers
+const MountPath = "/mnt/env-config/"
+
+// Files of the TLS connections of a site to its database, held in the "env-config" Secret
+const (
+	DatabaseCAFile   = "mysql-ca.pem"
+	DatabaseCertFile = "mysql-cert.pem"
+	DatabaseKeyFile  = "mysql-key.pem"
+)
 
 var log = logf.Log.WithName("envconfig")
 
+// DatabaseTLSFilePath returns the path of one of the files of the site's database TLS connections in the Drupal
+// containers
+func DatabaseTLSFilePath(site *v1alpha1.Site, file string) string {
+	return MountPath + databaseTLSFileName(site, file)
+}
+
+func databaseTLSFileName(site *v1alpha1.Site, file string) string {
+	return fmt.Sprintf("%s.%s", v1alpha1.DrupalSiteName(site), file)
+}
+
+// UpdateDrupalSettingsConfig sets the site's settings include file in the "env-config" Secret, or removes it if
+// settingsInc is nil. Drift of the entry is detected unless drift is nil.
 func UpdateDrupalSettingsConfig(c client.Client, scheme *runtime.Scheme, drenv *v1alpha1.DrupalEnvironment,
-	site *v1alpha1.Site, settingsInc []byte) (result reconcile.Result, err error) {
+	site *v1alpha1.Site, settingsInc []byte, drift *common.DriftDetector) (result reconcile.Result, err error) {
 
-	filename := fmt.Sprintf("%s.settings.inc", v1alpha1.DrupalSiteName(site))
-	return createOrUpdateEnvConfigEntry(c, scheme, drenv, filename, settingsInc)
+	return createOrUpdateEnvConfigEntry(c, scheme, drenv, SettingsFileName(site), settingsInc, drift)
 }
 
+// SettingsFileName returns the name of the site's settings include file in the "env-config" Secret
+func SettingsFileName(site *v1alpha1.Site) string {
+	return fmt.Sprintf("%s.settings.inc", v1alpha1.DrupalSiteName(site))
+}
+
+// UpdateDrupalDatabaseTLSFiles sets the files of the site's database TLS connections in the "env-config" Secret, or
+// removes them if files is nil. The client certificate and key are removed if the files don't have them.
+func UpdateDrupalDatabaseTLSFiles(c client.Client, scheme *runtime.Scheme, drenv *v1alpha1.DrupalEnvironment,
+	site *v1alpha1.Site, files *v1alpha1.DatabaseTLSFiles) (result reconcile.Result, err error) {
+
+	entries := map[string][]byte{DatabaseCAFile: nil, DatabaseCertFile: nil, DatabaseKeyFile: nil}
+	if files != nil {
+		entries[DatabaseCAFile] = files.CA
+		entries[DatabaseCertFile] = files.Cert
+		entries[DatabaseKeyFile] = files.Key
+	}
+
+	for _, file := range []string{DatabaseCAFile, DatabaseCertFile, DatabaseKeyFile} {
+		// Drift is only detected on the settings include file, which is the single entry recorded for the site
+		var entryResult reconcile.Result
+		if entryResult, err = createOrUpdateEnvConfigEntry(c, scheme, drenv, databaseTLSFileName(site, file), entries[file], nil); err != nil {
+			return
+		}
+		result.Requeue = result.Requeue || entryResult.Requeue
+	}
+	return
+}
+
+// UpdateDrupalSitesConfig sets the environment's sites.inc file in the "env-config" Secret. Drift of the entry is
+// detected unless drift is nil.
 func UpdateDrupalSitesConfig(c client.Client, scheme *runtime.Scheme, drenv *v1alpha1.DrupalEnvironment, sitesInc []byte,
-) (result reconcile.Result, err error) {
+	drift *common.DriftDetector) (result reconcile.Result, err error) {
 
-	return createOrUpdateEnvConfigEntry(c, scheme, drenv, "sites.inc", sitesInc)
+	return createOrUpdateEnvConfigEntry(c, scheme, drenv, "sites.inc", sitesInc, drift)
 }
 
 func createOrUpdateEnvConfigEntry(c client.Client, scheme *runtime.Scheme, drenv *v1alpha1.DrupalEnvironment, filename string, incFile []byte,
-) (result reconcile.Result, err error) {
+	drift *common.DriftDetector) (result reconcile.Result, err error) {
 
 	secret := &v1.Secret{
-		ObjectMeta: metav1.ObjectMeta{Namespace: drenv.Namespace, Name: envConfigSecretName},
+		ObjectMeta: metav1.ObjectMeta{Namespace: drenv.Namespace, Name: SecretName(drenv.Name)},
 	}
 	logger := log.WithValues("Namespace", secret.Namespace, "Name", secret.Name)
+	hash := common.HashValueOf(incFile)
 
 	var op controllerutil.OperationResult
 	op, err = controllerutil.CreateOrUpdate(context.TODO(), c, secret, func() error {
@@ -50,10 +110,13 @@ func createOrUpdateEnvConfigEntry(c client.Client, scheme *runtime.Scheme, drenv
 			secret.Data = make(map[string][]byte)
 		}
 
-		if incFile == nil {
+		switch {
+		case incFile == nil:
 			// Remove entry
 			delete(secret.Data, filename)
-		} else {
+		case drift != nil && !secret.CreationTimestamp.IsZero() && keepEntry(drift, secret, filename, incFile, hash):
+			// Keep the entry's live value, per the Secret's drift policy
+		default:
 			// Add/update entry
 			secret.Data[filename] = incFile
 		}
@@ -65,6 +128,10 @@ func createOrUpdateEnvConfigEntry(c client.Client, scheme *runtime.Scheme, drenv
 		logger.Error(err, "Failed to reconcile Environment Config Secret")
 		return
 	}
+	if drift != nil && incFile != nil {
+		// Each owner sets a single entry of the Secret, so the entry is recorded as the Secret
+		drift.Record("Secret", secret.Name, hash)
+	}
 	if op != controllerutil.OperationResultNone {
 		logger.Info("Reconciled Environment Config Secret", "op", op)
 		result.Requeue = true
@@ -72,3 +139,13 @@ func createOrUpdateEnvConfigEntry(c client.Client, scheme *runtime.Scheme, drenv
 
 	return
 }
+
+// keepEntry detects the drift of an entry of the live "env-config" Secret, and returns whether its live value should
+// be kept
+func keepEntry(drift *common.DriftDetector, secret *v1.Secret, filename string, incFile []byte, hash string) bool {
+	var fields []string
+	if live, ok := secret.Data[filename]; !ok || !bytes.Equal(live, incFile) {
+		fields = append(fields, common.JSONPointer("data", filename))
+	}
+	return len(drift.Detect("Secret", secret.Name, hash, fields, drift.Policy(secret))) > 0
+}
@@ -0,0 +1,301 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+const namespace = "fn_drupal_operator"
+
+// Outcomes of a reconcile step
+const (
+	ResultSuccess = "success"
+	ResultRequeue = "requeue"
+	ResultError   = "error"
+)
+
+// Results of a Command's Job
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Label names, derived from the fnresources.acquia.io/* labels of the reconciled resources
+var (
+	applicationIdLabel = labelName(fnv1alpha1.ApplicationIdLabel)
+	environmentIdLabel = labelName(fnv1alpha1.EnvironmentIdLabel)
+	databaseIdLabel    = labelName(fnv1alpha1.DatabaseIdLabel)
+	stageLabel         = labelName(fnv1alpha1.StageLabel)
+)
+
+var environmentStatuses = []fnv1alpha1.DrupalEnvironmentStatusType{
+	fnv1alpha1.DrupalEnvironmentStatusSyncing,
+	fnv1alpha1.DrupalEnvironmentStatusDeploying,
+	fnv1alpha1.DrupalEnvironmentStatusSynced,
+	fnv1alpha1.DrupalEnvironmentStatusUnstable,
+	fnv1alpha1.DrupalEnvironmentStatusDeployError,
+	fnv1alpha1.DrupalEnvironmentStatusDeleting,
+}
+
+var (
+	reconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_step_duration_seconds",
+		Help:      "Duration of reconcile steps, by controller, step and result (success, requeue or error)",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"controller", "step", "result"})
+
+	environmentStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "environment_status",
+		Help:      "Status of a DrupalEnvironment; 1 for its current status, 0 for all others",
+	}, []string{applicationIdLabel, environmentIdLabel, stageLabel, "status"})
+
+	rolloutTimeToSynced = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rollout_time_to_synced_seconds",
+		Help:      "Time for a DrupalEnvironment to become Synced again, after a change to it or its Rollout",
+		Buckets:   prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{applicationIdLabel, environmentIdLabel, stageLabel})
+
+	databaseProvisionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "database_provision_duration_seconds",
+		Help:      "Time from the creation of a Database until its database and user were provisioned",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{applicationIdLabel, environmentIdLabel})
+
+	databaseProvisionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_provision_failures_total",
+		Help:      "Number of failed attempts to provision a Database",
+	}, []string{applicationIdLabel, environmentIdLabel, databaseIdLabel})
+
+	commandJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_jobs_total",
+		Help:      "Number of finished Command Jobs, by result (succeeded or failed)",
+	}, []string{applicationIdLabel, environmentIdLabel, "result"})
+
+	driftDetected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_detected_total",
+		Help:      "Number of child resources found changed outside of the operator, by controller, kind and drift policy",
+	}, []string{"controller", "kind", "policy"})
+)
+
+// lastBackupAge exports the age of the latest successful backup of each Database. The age is computed when the metrics
+// are scraped, so that it keeps growing while no backup succeeds.
+var lastBackupAge = &backupAgeCollector{
+	desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "database_last_backup_age_seconds"),
+		"Time since the latest successful backup of a Database completed",
+		[]string{applicationIdLabel, environmentIdLabel, databaseIdLabel}, nil),
+	backups: map[types.UID]lastBackup{},
+}
+
+// notSyncedSince tracks when each DrupalEnvironment stopped being Synced, keyed by UID
+var notSyncedSince = struct {
+	sync.Mutex
+	times map[types.UID]time.Time
+}{times: map[types.UID]time.Time{}}
+
+// environmentSeries tracks the label values of each DrupalEnvironment's metrics, keyed by UID, so that the series of a
+// previous stage can be deleted when it changes
+var environmentSeries = struct {
+	sync.Mutex
+	labels map[types.UID][]string
+}{labels: map[types.UID][]string{}}
+
+func init() {
+	// Served by the Manager's metrics endpoint
+	metrics.Registry.MustRegister(
+		reconcileStepDuration,
+		environmentStatus,
+		rolloutTimeToSynced,
+		databaseProvisionDuration,
+		databaseProvisionFailures,
+		commandJobs,
+		driftDetected,
+		lastBackupAge,
+	)
+}
+
+// labelName converts a label such as "fnresources.acquia.io/application-id" to a Prometheus label name
+// ("application_id")
+func labelName(label string) string {
+	return strings.Replace(strings.TrimPrefix(label, fnv1alpha1.LabelPrefix), "-", "_", -1)
+}
+
+// labelValues returns the values of the given fnresources.acquia.io/* labels of an object
+func labelValues(o metav1.Object, labels ...string) []string {
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		values[i] = o.GetLabels()[label]
+	}
+	return values
+}
+
+// environmentLabelValues returns the values of the application ID, environment ID and stage labels of a
+// DrupalEnvironment's metrics. The stage is taken from its spec, since environments aren't labelled with it.
+func environmentLabelValues(env *fnv1alpha1.DrupalEnvironment) []string {
+	return append(labelValues(env, fnv1alpha1.ApplicationIdLabel, fnv1alpha1.EnvironmentIdLabel), env.Spec.Stage)
+}
+
+// Step runs a reconcile step of a controller, and records its duration and outcome
+func Step(controller, step string, f func() (requeue bool, err error)) (requeue bool, err error) {
+	start := time.Now()
+	requeue, err = f()
+	observeStep(controller, step, start, requeue, err)
+	return
+}
+
+// StepResult is Step, for reconcile steps returning a reconcile.Result
+func StepResult(controller, step string, f func() (reconcile.Result, error)) (result reconcile.Result, err error) {
+	start := time.Now()
+	result, err = f()
+	observeStep(controller, step, start, result.Requeue || result.RequeueAfter > 0, err)
+	return
+}
+
+func observeStep(controller, step string, start time.Time, requeue bool, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	} else if requeue {
+		result = ResultRequeue
+	}
+	reconcileStepDuration.WithLabelValues(controller, step, result).Observe(time.Since(start).Seconds())
+}
+
+// SetEnvironmentStatus records the current status of a DrupalEnvironment. When it becomes Synced again, the time it
+// took since it stopped being Synced is recorded.
+func SetEnvironmentStatus(env *fnv1alpha1.DrupalEnvironment, status fnv1alpha1.DrupalEnvironmentStatusType) {
+	ids := environmentLabelValues(env)
+
+	environmentSeries.Lock()
+	if previous, ok := environmentSeries.labels[env.UID]; ok && !reflect.DeepEqual(previous, ids) {
+		deleteEnvironmentSeries(previous)
+	}
+	environmentSeries.labels[env.UID] = ids
+	environmentSeries.Unlock()
+
+	for _, s := range environmentStatuses {
+		value := 0.0
+		if s == status {
+			value = 1
+		}
+		environmentStatus.WithLabelValues(append(ids, string(s))...).Set(value)
+	}
+
+	notSyncedSince.Lock()
+	defer notSyncedSince.Unlock()
+
+	since, tracked := notSyncedSince.times[env.UID]
+	switch {
+	case status != fnv1alpha1.DrupalEnvironmentStatusSynced && !tracked:
+		notSyncedSince.times[env.UID] = time.Now()
+	case status == fnv1alpha1.DrupalEnvironmentStatusSynced && tracked:
+		rolloutTimeToSynced.WithLabelValues(ids...).Observe(time.Since(since).Seconds())
+		delete(notSyncedSince.times, env.UID)
+	}
+}
+
+// ForgetEnvironment removes the metrics of a deleted DrupalEnvironment
+func ForgetEnvironment(env *fnv1alpha1.DrupalEnvironment) {
+	deleteEnvironmentSeries(environmentLabelValues(env))
+
+	environmentSeries.Lock()
+	if previous, ok := environmentSeries.labels[env.UID]; ok {
+		deleteEnvironmentSeries(previous)
+		delete(environmentSeries.labels, env.UID)
+	}
+	environmentSeries.Unlock()
+
+	notSyncedSince.Lock()
+	defer notSyncedSince.Unlock()
+	delete(notSyncedSince.times, env.UID)
+}
+
+// deleteEnvironmentSeries deletes the status and rollout series of a DrupalEnvironment with the given label values
+func deleteEnvironmentSeries(ids []string) {
+	for _, s := range environmentStatuses {
+		environmentStatus.DeleteLabelValues(append(ids[:len(ids):len(ids)], string(s))...)
+	}
+	rolloutTimeToSynced.DeleteLabelValues(ids...)
+}
+
+// DatabaseProvisioned records the time it took to provision a Database since it was created
+func DatabaseProvisioned(db *fnv1alpha1.Database) {
+	if db.CreationTimestamp.IsZero() {
+		return
+	}
+	ids := labelValues(db, fnv1alpha1.ApplicationIdLabel, fnv1alpha1.EnvironmentIdLabel)
+	databaseProvisionDuration.WithLabelValues(ids...).Observe(time.Since(db.CreationTimestamp.Time).Seconds())
+}
+
+// DatabaseProvisionFailed counts a failed attempt to provision a Database
+func DatabaseProvisionFailed(db *fnv1alpha1.Database) {
+	databaseProvisionFailures.WithLabelValues(labelValues(db, fnv1alpha1.ApplicationIdLabel, fnv1alpha1.EnvironmentIdLabel, fnv1alpha1.DatabaseIdLabel)...).Inc()
+}
+
+// CommandJobFinished counts a finished Job of a Command, with the given result (JobSucceeded or JobFailed)
+func CommandJobFinished(cmd *fnv1alpha1.Command, result string) {
+	commandJobs.WithLabelValues(append(labelValues(cmd, fnv1alpha1.ApplicationIdLabel, fnv1alpha1.EnvironmentIdLabel), result)...).Inc()
+}
+
+// DriftDetected counts a child resource of a controller found changed outside of the operator, with the drift policy
+// that was applied to it
+func DriftDetected(controller, kind, policy string) {
+	driftDetected.WithLabelValues(controller, kind, policy).Inc()
+}
+
+// DatabaseBackedUp records when the latest successful backup of a Database completed
+func DatabaseBackedUp(db *fnv1alpha1.Database, completed time.Time) {
+	lastBackupAge.Lock()
+	defer lastBackupAge.Unlock()
+	lastBackupAge.backups[db.UID] = lastBackup{
+		labels:    labelValues(db, fnv1alpha1.ApplicationIdLabel, fnv1alpha1.EnvironmentIdLabel, fnv1alpha1.DatabaseIdLabel),
+		completed: completed,
+	}
+}
+
+// ForgetDatabase removes the metrics of a deleted Database
+func ForgetDatabase(db *fnv1alpha1.Database) {
+	lastBackupAge.Lock()
+	defer lastBackupAge.Unlock()
+	delete(lastBackupAge.backups, db.UID)
+}
+
+// backupAgeCollector collects the age of the latest successful backups of Databases, keyed by UID
+type backupAgeCollector struct {
+	sync.Mutex
+	desc    *prometheus.Desc
+	backups map[types.UID]lastBackup
+}
+
+type lastBackup struct {
+	labels    []string
+	completed time.Time
+}
+
+func (c *backupAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *backupAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+	for _, b := range c.backups {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Since(b.completed).Seconds(), b.labels...)
+	}
+}
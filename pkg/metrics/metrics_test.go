@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+const (
+	testAppID = "d8de5846-fbec-4a35-b888-aed09bb1733b"
+	testEnvID = "e5462ba5-09d0-49fa-a5b3-8c82d85f4c9e"
+	testDbID  = "8e7e6c73-9d43-4e8a-8a43-2c3c9a7d2a11"
+)
+
+var testLabels = map[string]string{
+	fnv1alpha1.ApplicationIdLabel: testAppID,
+	fnv1alpha1.EnvironmentIdLabel: testEnvID,
+	fnv1alpha1.StageLabel:         "prod",
+}
+
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	require.NoError(t, o.(prometheus.Metric).Write(m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func Test_labelName(t *testing.T) {
+	require.Equal(t, "application_id", labelName(fnv1alpha1.ApplicationIdLabel))
+	require.Equal(t, "environment_id", labelName(fnv1alpha1.EnvironmentIdLabel))
+	require.Equal(t, "stage", labelName(fnv1alpha1.StageLabel))
+}
+
+func TestStep(t *testing.T) {
+	requeue, err := Step("test-controller", "step", func() (bool, error) { return true, nil })
+	require.True(t, requeue)
+	require.NoError(t, err)
+
+	_, err = Step("test-controller", "step", func() (bool, error) { return false, errors.New("failed") })
+	require.Error(t, err)
+
+	result, err := StepResult("test-controller", "step", func() (reconcile.Result, error) {
+		return reconcile.Result{}, nil
+	})
+	require.Equal(t, reconcile.Result{}, result)
+	require.NoError(t, err)
+
+	result, _ = StepResult("test-controller", "step", func() (reconcile.Result, error) {
+		return reconcile.Result{RequeueAfter: time.Second}, nil
+	})
+	require.Equal(t, time.Second, result.RequeueAfter)
+
+	require.Equal(t, uint64(2), sampleCount(t, reconcileStepDuration.WithLabelValues("test-controller", "step", ResultRequeue)))
+	require.Equal(t, uint64(1), sampleCount(t, reconcileStepDuration.WithLabelValues("test-controller", "step", ResultError)))
+	require.Equal(t, uint64(1), sampleCount(t, reconcileStepDuration.WithLabelValues("test-controller", "step", ResultSuccess)))
+}
+
+func TestSetEnvironmentStatus(t *testing.T) {
+	env := &fnv1alpha1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "wlgore-prod", UID: "env-uid", Labels: testLabels},
+		Spec:       fnv1alpha1.DrupalEnvironmentSpec{Stage: "prod"},
+	}
+	status := func(s fnv1alpha1.DrupalEnvironmentStatusType) float64 {
+		return testutil.ToFloat64(environmentStatus.WithLabelValues(testAppID, testEnvID, "prod", string(s)))
+	}
+	timeToSynced := func() uint64 {
+		return sampleCount(t, rolloutTimeToSynced.WithLabelValues(testAppID, testEnvID, "prod"))
+	}
+
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSyncing)
+	require.Equal(t, 1.0, status(fnv1alpha1.DrupalEnvironmentStatusSyncing))
+	require.Equal(t, 0.0, status(fnv1alpha1.DrupalEnvironmentStatusSynced))
+
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusDeploying)
+	require.Equal(t, 0.0, status(fnv1alpha1.DrupalEnvironmentStatusSyncing))
+	require.Equal(t, 1.0, status(fnv1alpha1.DrupalEnvironmentStatusDeploying))
+	require.Equal(t, uint64(0), timeToSynced())
+
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSynced)
+	require.Equal(t, 0.0, status(fnv1alpha1.DrupalEnvironmentStatusDeploying))
+	require.Equal(t, 1.0, status(fnv1alpha1.DrupalEnvironmentStatusSynced))
+	require.Equal(t, uint64(1), timeToSynced())
+
+	// Staying Synced doesn't count as another rollout
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSynced)
+	require.Equal(t, uint64(1), timeToSynced())
+
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusDeleting)
+	ForgetEnvironment(env)
+	require.False(t, environmentStatus.DeleteLabelValues(testAppID, testEnvID, "prod", string(fnv1alpha1.DrupalEnvironmentStatusDeleting)))
+	require.Empty(t, notSyncedSince.times)
+}
+
+func TestSetEnvironmentStatus_StageFromSpec(t *testing.T) {
+	// Environments aren't labelled with their stage
+	env := &fnv1alpha1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "wlgore-dev", UID: "unlabelled-env-uid"},
+		Spec:       fnv1alpha1.DrupalEnvironmentSpec{Stage: "dev"},
+	}
+
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSynced)
+	require.Equal(t, 1.0, testutil.ToFloat64(environmentStatus.WithLabelValues("", "", "dev", string(fnv1alpha1.DrupalEnvironmentStatusSynced))))
+
+	ForgetEnvironment(env)
+	require.False(t, environmentStatus.DeleteLabelValues("", "", "dev", string(fnv1alpha1.DrupalEnvironmentStatusSynced)))
+}
+
+func TestSetEnvironmentStatus_StageChange(t *testing.T) {
+	env := &fnv1alpha1.DrupalEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "wlgore-test", UID: "staged-env-uid", Labels: testLabels},
+		Spec:       fnv1alpha1.DrupalEnvironmentSpec{Stage: "test"},
+	}
+
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSyncing)
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSynced)
+
+	// The series of the previous stage are deleted
+	env.Spec.Stage = "preprod"
+	SetEnvironmentStatus(env, fnv1alpha1.DrupalEnvironmentStatusSyncing)
+	require.False(t, environmentStatus.DeleteLabelValues(testAppID, testEnvID, "test", string(fnv1alpha1.DrupalEnvironmentStatusSynced)))
+	require.False(t, rolloutTimeToSynced.DeleteLabelValues(testAppID, testEnvID, "test"))
+	require.Equal(t, 1.0, testutil.ToFloat64(environmentStatus.WithLabelValues(testAppID, testEnvID, "preprod", string(fnv1alpha1.DrupalEnvironmentStatusSyncing))))
+
+	ForgetEnvironment(env)
+	require.False(t, environmentStatus.DeleteLabelValues(testAppID, testEnvID, "preprod", string(fnv1alpha1.DrupalEnvironmentStatusSyncing)))
+	require.NotContains(t, environmentSeries.labels, env.UID)
+}
+
+func TestDatabaseMetrics(t *testing.T) {
+	db := &fnv1alpha1.Database{ObjectMeta: metav1.ObjectMeta{
+		UID:               "db-uid",
+		Labels:            map[string]string{fnv1alpha1.DatabaseIdLabel: testDbID},
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute)),
+	}}
+	for k, v := range testLabels {
+		db.Labels[k] = v
+	}
+
+	DatabaseProvisionFailed(db)
+	require.Equal(t, 1.0, testutil.ToFloat64(databaseProvisionFailures.WithLabelValues(testAppID, testEnvID, testDbID)))
+
+	DatabaseProvisioned(db)
+	require.Equal(t, uint64(1), sampleCount(t, databaseProvisionDuration.WithLabelValues(testAppID, testEnvID)))
+
+	DatabaseBackedUp(db, time.Now().Add(-time.Hour))
+	require.InDelta(t, 3600, testutil.ToFloat64(lastBackupAge), 60)
+
+	ForgetDatabase(db)
+	require.Empty(t, lastBackupAge.backups)
+}
+
+func TestCommandJobFinished(t *testing.T) {
+	cmd := &fnv1alpha1.Command{ObjectMeta: metav1.ObjectMeta{Labels: testLabels}}
+
+	CommandJobFinished(cmd, JobSucceeded)
+	CommandJobFinished(cmd, JobSucceeded)
+	CommandJobFinished(cmd, JobFailed)
+	require.Equal(t, 2.0, testutil.ToFloat64(commandJobs.WithLabelValues(testAppID, testEnvID, JobSucceeded)))
+	require.Equal(t, 1.0, testutil.ToFloat64(commandJobs.WithLabelValues(testAppID, testEnvID, JobFailed)))
+}
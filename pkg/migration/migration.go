@@ -0,0 +1,104 @@
+// Package migration migrates all the stored custom resources of a cluster to the latest version of their spec at once,
+// instead of waiting for the controllers to migrate them as they're reconciled.
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+)
+
+// Result is the migration of a single object
+type Result struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Report    *fnv1alpha1.MigrationReport
+	// Patch is the JSON merge patch (RFC 7386) of the migration
+	Patch []byte
+	// Err is set if the migrated object couldn't be diffed or updated
+	Err error
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%v %v/%v", r.Kind, r.Namespace, r.Name)
+}
+
+// MigrateAll migrates the objects of all namespaces that aren't up to date, and returns their migrations. Unless
+// dryRun is set, the migrated objects are updated and their migrations are recorded as Events, if a recorder is
+// given. Failures to update objects are reported in their results; MigrateAll only fails if it can't list them.
+func MigrateAll(ctx context.Context, c client.Client, recorder record.EventRecorder, dryRun bool) ([]Result, error) {
+	m := &migrator{ctx: ctx, client: c, recorder: recorder, dryRun: dryRun}
+
+	envs := &fnv1alpha1.DrupalEnvironmentList{}
+	if err := c.List(ctx, envs); err != nil {
+		return nil, err
+	}
+	for i := range envs.Items {
+		env := &envs.Items[i]
+		m.migrate("DrupalEnvironment", env, func() *fnv1alpha1.MigrationReport { return fnv1alpha1.Migrate(env) })
+	}
+
+	dbs := &fnv1alpha1.DatabaseList{}
+	if err := c.List(ctx, dbs); err != nil {
+		return m.results, err
+	}
+	for i := range dbs.Items {
+		db := &dbs.Items[i]
+		m.migrate("Database", db, func() *fnv1alpha1.MigrationReport { return fnv1alpha1.Migrate(db) })
+	}
+
+	return m.results, nil
+}
+
+type object interface {
+	runtime.Object
+	metav1.Object
+}
+
+type migrator struct {
+	ctx      context.Context
+	client   client.Client
+	recorder record.EventRecorder
+	dryRun   bool
+	results  []Result
+}
+
+// migrate migrates an object with the given function, which returns nil if the object is up to date. The results of
+// migrated objects are added to the migrator's.
+func (m *migrator) migrate(kind string, obj object, migrate func() *fnv1alpha1.MigrationReport) {
+	result := Result{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+
+	original, err := json.Marshal(obj)
+	if result.Report = migrate(); result.Report == nil {
+		return
+	}
+	if err == nil {
+		var migrated []byte
+		if migrated, err = json.Marshal(obj); err == nil {
+			result.Patch, err = jsonpatch.CreateMergePatch(original, migrated)
+		}
+	}
+	if err != nil {
+		result.Err = err
+		m.results = append(m.results, result)
+		return
+	}
+
+	if !m.dryRun {
+		result.Err = m.client.Update(m.ctx, obj)
+		if result.Err == nil && m.recorder != nil {
+			common.RecordMigration(m.recorder, obj, result.Report)
+		}
+	}
+	m.results = append(m.results, result)
+}
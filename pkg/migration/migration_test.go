@@ -0,0 +1,83 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/common"
+	"github.com/acquia/fn-drupal-operator/pkg/testhelpers"
+)
+
+func testObjects() []runtime.Object {
+	return []runtime.Object{
+		&fnv1alpha1.DrupalEnvironment{
+			ObjectMeta: metav1.ObjectMeta{Name: "wlgore-dev", Namespace: "wlgore"},
+			Spec: fnv1alpha1.DrupalEnvironmentSpec{
+				Phpfpm: fnv1alpha1.SpecPhpFpm{NewRelicSecret: "newrelic"},
+			},
+		},
+		&fnv1alpha1.DrupalEnvironment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wlgore-prod",
+				Namespace: "wlgore",
+				Labels:    map[string]string{fnv1alpha1.VersionLabel: "3"},
+			},
+			Spec: fnv1alpha1.DrupalEnvironmentSpec{Stage: "prod"},
+		},
+		&fnv1alpha1.Database{
+			ObjectMeta: metav1.ObjectMeta{Name: "wlgore-database", Namespace: "wlgore"},
+		},
+	}
+}
+
+func TestMigrateAll(t *testing.T) {
+	c := testhelpers.NewFakeClient(testObjects())
+	recorder := testhelpers.NewFakeRecorder()
+
+	results, err := MigrateAll(context.TODO(), c, recorder, false)
+	require.NoError(t, err)
+	require.Len(t, results, 2, "only the objects that aren't up to date should be migrated")
+
+	require.Equal(t, "DrupalEnvironment wlgore/wlgore-dev", results[0].String())
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "", results[0].Report.From)
+	require.Equal(t, "3", results[0].Report.To)
+	require.Len(t, results[0].Report.Warnings, 1)
+	require.Contains(t, string(results[0].Patch), `"stage":"dev"`)
+
+	require.Equal(t, "Database wlgore/wlgore-database", results[1].String())
+	require.NoError(t, results[1].Err)
+	require.Contains(t, string(results[1].Patch), `"adopt":true`)
+
+	env := &fnv1alpha1.DrupalEnvironment{}
+	require.NoError(t, c.Get(context.TODO(), types.NamespacedName{Namespace: "wlgore", Name: "wlgore-dev"}, env))
+	require.Equal(t, "3", env.Labels[fnv1alpha1.VersionLabel])
+	require.Equal(t, fnv1alpha1.APMProviderNewRelic, env.Spec.Phpfpm.Apm.Provider)
+	testhelpers.RequireEvent(t, recorder, corev1.EventTypeNormal, common.ReasonMigrated)
+	testhelpers.RequireEvent(t, recorder, corev1.EventTypeWarning, common.ReasonMigrationWarning)
+
+	results, err = MigrateAll(context.TODO(), c, recorder, false)
+	require.NoError(t, err)
+	require.Empty(t, results, "migrated objects should be up to date")
+}
+
+func TestMigrateAll_DryRun(t *testing.T) {
+	c := testhelpers.NewFakeClient(testObjects())
+
+	results, err := MigrateAll(context.TODO(), c, nil, true)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	dbs := &fnv1alpha1.DatabaseList{}
+	require.NoError(t, c.List(context.TODO(), dbs, client.InNamespace("wlgore")))
+	require.Len(t, dbs.Items, 1)
+	require.Empty(t, dbs.Items[0].Labels, "a dry run shouldn't update objects")
+}
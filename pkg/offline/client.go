@@ -0,0 +1,92 @@
+// Package offline provides a client for running the operator's controllers without an API server, as the unit tests and
+// the cmd/render tool do.
+package offline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// NewClient returns an in-memory client holding the given objects, which supports server-side apply patches.
+func NewClient(scheme *runtime.Scheme, objects ...runtime.Object) client.Client {
+	return applyClient{fake.NewFakeClientWithScheme(scheme, objects...)}
+}
+
+// applyClient emulates server-side apply patches, which the fake client doesn't support, with a Create of the applied
+// object or a JSON merge patch of it. Unlike the API server, it doesn't track field managers, so fields that are no
+// longer applied are kept. Like the API server, it ignores the status and creation timestamp of applied objects, and
+// doesn't update objects that the patch wouldn't change.
+type applyClient struct {
+	client.Client
+}
+
+func (c applyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	key, err := client.ObjectKeyFromObject(obj)
+	if err != nil {
+		return err
+	}
+	existing := obj.DeepCopyObject()
+	if err = c.Get(ctx, key, existing); err != nil {
+		if errors.IsNotFound(err) {
+			return c.Create(ctx, obj)
+		}
+		return err
+	}
+
+	applied, err := appliedFields(obj)
+	if err != nil {
+		return err
+	}
+	current, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+	merged, err := jsonpatch.MergePatch(current, applied)
+	if err != nil {
+		return err
+	}
+
+	// Compare through the typed object, since the merged JSON may differ in its null or omitted fields
+	mergedObj := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err = json.Unmarshal(merged, mergedObj); err != nil {
+		return err
+	}
+	if merged, err = json.Marshal(mergedObj); err != nil {
+		return err
+	}
+	if bytes.Equal(current, merged) {
+		return c.Get(ctx, key, obj)
+	}
+
+	return c.Client.Patch(ctx, obj, client.ConstantPatch(types.MergePatchType, applied))
+}
+
+// appliedFields returns the JSON of an applied object, without the fields server-side apply ignores
+func appliedFields(obj runtime.Object) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "status")
+	if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return json.Marshal(fields)
+}
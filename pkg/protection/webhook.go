@@ -0,0 +1,93 @@
+// Package protection records who disables the deletion protection of the operator's custom resources (see
+// fnv1alpha1.DeletionProtectionAnnotation), in a mutating webhook shared by all of their kinds. The protection itself is
+// enforced by the validating webhooks of the kinds.
+package protection
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+// mutatingWebhookPath is the path the webhook is served on
+const mutatingWebhookPath = "/mutate-fnresources-acquia-io-v1alpha1-deletion-protection"
+
+var log = logf.Log.WithName("deletion_protection")
+
+// unlockAnnotations are the annotations that record the disabling of deletion protection
+var unlockAnnotations = []string{fnv1alpha1.DeletionUnlockedByAnnotation, fnv1alpha1.DeletionUnlockedAtAnnotation}
+
+// AddToManager registers the mutating webhook
+func AddToManager(mgr manager.Manager) error {
+	mgr.GetWebhookServer().Register(mutatingWebhookPath, &webhook.Admission{
+		Handler: &unlockRecorder{now: time.Now},
+	})
+	return nil
+}
+
+// unlockRecorder annotates objects whose deletion protection is disabled with the user who disabled it, and when
+type unlockRecorder struct {
+	now func() time.Time
+}
+
+var _ admission.Handler = &unlockRecorder{}
+
+// Handle records the user of updates that disable the deletion protection of an object, after an unlock was requested.
+// The record is kept from the old object while protection stays disabled, and removed otherwise, so that clients can't
+// set it themselves.
+func (u *unlockRecorder) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	// The webhook serves every kind, and only changes annotations, so the objects aren't decoded to their types
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	old := &unstructured.Unstructured{}
+	if req.Operation == admissionv1beta1.Update {
+		if err := old.UnmarshalJSON(req.OldObject.Raw); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	oldAnnotations := old.GetAnnotations()
+	disabled := annotations[fnv1alpha1.DeletionProtectionAnnotation] == string(fnv1alpha1.DeletionProtectionDisabled)
+	for _, key := range unlockAnnotations {
+		if value, ok := oldAnnotations[key]; ok && disabled {
+			annotations[key] = value
+		} else {
+			delete(annotations, key)
+		}
+	}
+
+	if disabled && oldAnnotations[fnv1alpha1.DeletionProtectionAnnotation] == string(fnv1alpha1.DeletionProtectionUnlockRequested) {
+		log.Info("Deletion protection disabled", "Kind", req.Kind.Kind, "Request.Namespace", req.Namespace, "Request.Name", req.Name, "User", req.UserInfo.Username)
+		annotations[fnv1alpha1.DeletionUnlockedByAnnotation] = req.UserInfo.Username
+		annotations[fnv1alpha1.DeletionUnlockedAtAnnotation] = u.now().UTC().Format(time.RFC3339)
+	}
+
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+	marshaled, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,128 @@
+package protection
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/stretchr/testify/require"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+)
+
+var testTime = time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testDatabase(annotations map[string]string) runtime.RawExtension {
+	db := &fnv1alpha1.Database{
+		TypeMeta:   metav1.TypeMeta{APIVersion: fnv1alpha1.SchemeGroupVersion.String(), Kind: "Database"},
+		ObjectMeta: metav1.ObjectMeta{Name: "wlgore-database", Namespace: "wlgore", Annotations: annotations},
+	}
+	raw, err := json.Marshal(db)
+	if err != nil {
+		panic(err)
+	}
+	return runtime.RawExtension{Raw: raw}
+}
+
+// patchedAnnotations returns the annotations of the object after applying the response's patches
+func patchedAnnotations(t *testing.T, object runtime.RawExtension, resp admission.Response) map[string]string {
+	require.True(t, resp.Allowed, resp.Result.Reason)
+	patches, err := json.Marshal(resp.Patches)
+	require.NoError(t, err)
+	patch, err := jsonpatch.DecodePatch(patches)
+	require.NoError(t, err)
+	patched, err := patch.Apply(object.Raw)
+	require.NoError(t, err)
+
+	db := &fnv1alpha1.Database{}
+	require.NoError(t, json.Unmarshal(patched, db))
+	return db.Annotations
+}
+
+func TestUnlockRecorder(t *testing.T) {
+	const (
+		protection = fnv1alpha1.DeletionProtectionAnnotation
+		unlockedBy = fnv1alpha1.DeletionUnlockedByAnnotation
+		unlockedAt = fnv1alpha1.DeletionUnlockedAtAnnotation
+	)
+	unlockRecord := map[string]string{
+		protection: "disabled",
+		unlockedBy: "alice@example.com",
+		unlockedAt: "2020-02-01T00:00:00Z",
+	}
+
+	tests := []struct {
+		name     string
+		op       admissionv1beta1.Operation
+		old      map[string]string
+		new      map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "unlock",
+			op:       admissionv1beta1.Update,
+			old:      map[string]string{protection: "unlock-requested"},
+			new:      map[string]string{protection: "disabled"},
+			expected: map[string]string{protection: "disabled", unlockedBy: "bob@example.com", unlockedAt: "2020-03-01T12:00:00Z"},
+		},
+		{
+			name:     "keep the record of an unlock",
+			op:       admissionv1beta1.Update,
+			old:      unlockRecord,
+			new:      map[string]string{protection: "disabled"},
+			expected: unlockRecord,
+		},
+		{
+			name:     "forge the record of an unlock",
+			op:       admissionv1beta1.Update,
+			old:      unlockRecord,
+			new:      map[string]string{protection: "disabled", unlockedBy: "mallory@example.com"},
+			expected: unlockRecord,
+		},
+		{
+			name:     "protect again",
+			op:       admissionv1beta1.Update,
+			old:      unlockRecord,
+			new:      map[string]string{protection: "enabled", unlockedBy: "alice@example.com"},
+			expected: map[string]string{protection: "enabled"},
+		},
+		{
+			name: "create with a record",
+			op:   admissionv1beta1.Create,
+			new:  unlockRecord,
+			expected: map[string]string{
+				protection: "disabled",
+			},
+		},
+		{
+			name: "create without annotations",
+			op:   admissionv1beta1.Create,
+		},
+	}
+
+	u := &unlockRecorder{now: func() time.Time { return testTime }}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: test.op,
+				Namespace: "wlgore",
+				Name:      "wlgore-database",
+				UserInfo:  authenticationv1.UserInfo{Username: "bob@example.com"},
+				Object:    testDatabase(test.new),
+			}}
+			if test.op == admissionv1beta1.Update {
+				req.OldObject = testDatabase(test.old)
+			}
+
+			resp := u.Handle(context.TODO(), req)
+			require.Equal(t, test.expected, patchedAnnotations(t, req.Object, resp))
+		})
+	}
+}
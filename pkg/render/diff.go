@@ -0,0 +1,126 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Diff writes a unified diff from each object in a live cluster export to the same rendered object, and returns whether
+// any differ. Live objects are masked like the rendered ones, and only the fields that the rendered object sets are
+// compared, since the API server and other controllers set many more. Rendered objects missing from the export are
+// diffed against nothing.
+func Diff(w io.Writer, rendered, live []*unstructured.Unstructured) (differs bool, err error) {
+	liveObjs := map[objectKey]*unstructured.Unstructured{}
+	for _, u := range live {
+		u = u.DeepCopy()
+		clean(u)
+		liveObjs[unstructuredKey(u)] = u
+	}
+	var liveList []*unstructured.Unstructured
+	for _, u := range liveObjs {
+		liveList = append(liveList, u)
+	}
+	if err = Mask(liveList); err != nil {
+		return false, err
+	}
+
+	for _, u := range rendered {
+		var from []byte
+		if l, ok := liveObjs[unstructuredKey(u)]; ok {
+			if from, err = yaml.Marshal(prune(l.Object, u.Object)); err != nil {
+				return false, err
+			}
+		}
+		to, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return false, err
+		}
+
+		name := strings.TrimPrefix(fmt.Sprintf("%v/%v/%v", u.GetKind(), u.GetNamespace(), u.GetName()), "/")
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(from)),
+			B:        difflib.SplitLines(string(to)),
+			FromFile: "live/" + name,
+			ToFile:   "rendered/" + name,
+			Context:  3,
+		})
+		if err != nil {
+			return false, err
+		}
+		if diff != "" {
+			differs = true
+			if _, err = io.WriteString(w, diff); err != nil {
+				return false, err
+			}
+		}
+	}
+	return differs, nil
+}
+
+func unstructuredKey(u *unstructured.Unstructured) objectKey {
+	key := objectKey{GroupKind: u.GroupVersionKind().GroupKind()}
+	key.Namespace, key.Name = u.GetNamespace(), u.GetName()
+	return key
+}
+
+// clean removes the fields of an object that the API server sets, or that the operator never sets
+func clean(u *unstructured.Unstructured) {
+	for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink", "managedFields"} {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(u.Object, "status")
+
+	annotations := u.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	u.SetAnnotations(annotations)
+
+	// Owner UIDs differ between clusters, and aren't known offline
+	refs, _, _ := unstructured.NestedSlice(u.Object, "metadata", "ownerReferences")
+	for _, ref := range refs {
+		if ref, ok := ref.(map[string]interface{}); ok {
+			delete(ref, "uid")
+		}
+	}
+	if len(refs) > 0 {
+		_ = unstructured.SetNestedSlice(u.Object, refs, "metadata", "ownerReferences")
+	}
+}
+
+// prune returns the fields of live that are set in rendered. Lists of the same length are pruned item by item, other
+// lists are kept whole.
+func prune(live, rendered interface{}) interface{} {
+	switch r := rendered.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		pruned := map[string]interface{}{}
+		for k, rv := range r {
+			if lv, ok := l[k]; ok {
+				pruned[k] = prune(lv, rv)
+			}
+		}
+		return pruned
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(r) {
+			return live
+		}
+		pruned := make([]interface{}, len(l))
+		for i := range l {
+			pruned[i] = prune(l[i], r[i])
+		}
+		return pruned
+	default:
+		return live
+	}
+}
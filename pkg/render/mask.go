@@ -0,0 +1,105 @@
+package render
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/acquia/fn-drupal-operator/pkg/envconfig"
+)
+
+// masked replaces secret values
+const masked = "********"
+
+// passwordPattern matches the database passwords in the settings include files of the env-config Secret
+var passwordPattern = regexp.MustCompile(`('password' => ')[^']*(')`)
+
+// Mask replaces the data of each Secret with masked stringData. The include files in the env-config Secret are kept
+// readable, with database passwords and the values of every other Secret, including the extra ones given, masked out.
+func Mask(objs []*unstructured.Unstructured, extraSecrets ...*unstructured.Unstructured) error {
+	var values []string
+	for _, u := range append(objs, extraSecrets...) {
+		if u.GetKind() != "Secret" || isEnvConfig(u) {
+			continue
+		}
+		data, err := secretData(u)
+		if err != nil {
+			return err
+		}
+		for _, v := range data {
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	for _, u := range objs {
+		if u.GetKind() != "Secret" {
+			continue
+		}
+		data, err := secretData(u)
+		if err != nil {
+			return err
+		}
+
+		stringData := map[string]interface{}{}
+		for k, v := range data {
+			if !isEnvConfig(u) {
+				stringData[k] = masked
+				continue
+			}
+			for _, value := range values {
+				v = strings.ReplaceAll(v, value, masked)
+			}
+			stringData[k] = passwordPattern.ReplaceAllString(v, "${1}"+masked+"${2}")
+		}
+
+		unstructured.RemoveNestedField(u.Object, "data")
+		unstructured.RemoveNestedField(u.Object, "stringData")
+		if len(stringData) > 0 {
+			if err = unstructured.SetNestedField(u.Object, stringData, "stringData"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isEnvConfig returns whether the Secret is the env-config Secret of the DrupalEnvironment owning it
+func isEnvConfig(u *unstructured.Unstructured) bool {
+	for _, ref := range u.GetOwnerReferences() {
+		if ref.Kind == "DrupalEnvironment" && u.GetName() == envconfig.SecretName(ref.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretData returns the decoded data of a Secret, including its stringData
+func secretData(u *unstructured.Unstructured) (map[string]string, error) {
+	data, _, err := unstructured.NestedStringMap(u.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = string(decoded)
+	}
+
+	stringData, _, err := unstructured.NestedStringMap(u.Object, "stringData")
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+	for k, v := range stringData {
+		data[k] = v
+	}
+	return data, nil
+}
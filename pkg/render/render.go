@@ -0,0 +1,388 @@
+// Package render runs the operator's controllers against an in-memory client, to show the resources they would create
+// for a set of custom resources without deploying them.
+package render
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	rollouts "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	netv1a3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	extv1b1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	fnresources "github.com/acquia/fn-drupal-operator/pkg/apis"
+	fnv1alpha1 "github.com/acquia/fn-drupal-operator/pkg/apis/fnresources/v1alpha1"
+	"github.com/acquia/fn-drupal-operator/pkg/controller/command"
+	"github.com/acquia/fn-drupal-operator/pkg/controller/drupalapplication"
+	"github.com/acquia/fn-drupal-operator/pkg/controller/drupalenvironment"
+	"github.com/acquia/fn-drupal-operator/pkg/controller/site"
+	"github.com/acquia/fn-drupal-operator/pkg/offline"
+)
+
+// maxPasses bounds the reconcile passes over the custom resources, in case a controller never stops requeueing
+const maxPasses = 20
+
+// placeholderPassword is the password of Database user Secrets that aren't given, which the Database controller would
+// otherwise generate while provisioning the database
+const placeholderPassword = "rendered-placeholder-password"
+
+// childLists are the kinds of objects the operator creates or updates. Namespaces are included, since the operator
+// labels them, and DrupalEnvironments, since DrupalApplications may provision them.
+var childLists = []runtime.Object{
+	&corev1.NamespaceList{},
+	&fnv1alpha1.DrupalEnvironmentList{},
+	&corev1.ConfigMapList{},
+	&corev1.SecretList{},
+	&corev1.PersistentVolumeList{},
+	&corev1.PersistentVolumeClaimList{},
+	&corev1.ServiceList{},
+	&corev1.ServiceAccountList{},
+	&rbacv1.RoleList{},
+	&rbacv1.RoleBindingList{},
+	&rollouts.RolloutList{},
+	&appsv1.DeploymentList{},
+	&autoscalingv1.HorizontalPodAutoscalerList{},
+	&corev1.ResourceQuotaList{},
+	&corev1.LimitRangeList{},
+	&networkingv1.NetworkPolicyList{},
+	&extv1b1.IngressList{},
+	&netv1a3.VirtualServiceList{},
+	&batchv1beta1.CronJobList{},
+	&batchv1.JobList{},
+}
+
+// controllers are the controllers run for each pass, in order, with the kind of custom resource each reconciles. The
+// Database controller isn't run, since it needs a MySQL server.
+var controllers = []struct {
+	list          runtime.Object
+	newReconciler func(client.Client, *runtime.Scheme, record.EventRecorder) reconcile.Reconciler
+}{
+	{&fnv1alpha1.DrupalApplicationList{}, drupalapplication.NewReconciler},
+	{&fnv1alpha1.DrupalEnvironmentList{}, drupalenvironment.NewReconciler},
+	{&fnv1alpha1.SiteList{}, site.NewReconciler},
+	{&fnv1alpha1.CommandList{}, command.NewReconciler},
+}
+
+// Scheme returns the scheme of every type the operator reads or creates. The in-memory client decodes lists with the
+// client-go scheme, so the types are added to it.
+func Scheme() (*runtime.Scheme, error) {
+	for _, addToScheme := range []func(*runtime.Scheme) error{fnresources.AddToScheme, rollouts.AddToScheme, netv1a3.AddToScheme} {
+		if err := addToScheme(scheme.Scheme); err != nil {
+			return nil, err
+		}
+	}
+	return scheme.Scheme, nil
+}
+
+// Decode reads the objects in a stream of YAML or JSON documents. Lists, such as the output of `kubectl get -o yaml`,
+// are expanded into their items.
+func Decode(r io.Reader) (objs []*unstructured.Unstructured, err error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		ext := runtime.RawExtension{}
+		if err = decoder.Decode(&ext); err == io.EOF {
+			return objs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(string(ext.Raw))) == 0 || string(ext.Raw) == "null" {
+			// Empty document
+			continue
+		}
+
+		obj, _, err := unstructured.UnstructuredJSONScheme.Decode(ext.Raw, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		switch o := obj.(type) {
+		case *unstructured.Unstructured:
+			objs = append(objs, o)
+		case *unstructured.UnstructuredList:
+			for i := range o.Items {
+				objs = append(objs, &o.Items[i])
+			}
+		}
+	}
+}
+
+// clusterScoped are the kinds of cluster-scoped objects that may be rendered
+var clusterScoped = map[string]bool{
+	"DrupalApplication":  true,
+	"Namespace":          true,
+	"PersistentVolume":   true,
+	"ClusterRole":        true,
+	"ClusterRoleBinding": true,
+}
+
+// Default sets the namespace of namespaced objects that don't have one, and names objects that only have a
+// generateName after it, as the API server would.
+func Default(objs []*unstructured.Unstructured, namespace string) {
+	for _, u := range objs {
+		if u.GetNamespace() == "" && !clusterScoped[u.GetKind()] {
+			u.SetNamespace(namespace)
+		}
+		if u.GetName() == "" && u.GetGenerateName() != "" {
+			u.SetName(u.GetGenerateName() + "rendered")
+		}
+	}
+}
+
+// Typed converts decoded objects to the typed objects of the scheme.
+func Typed(s *runtime.Scheme, objs []*unstructured.Unstructured) ([]runtime.Object, error) {
+	typed := make([]runtime.Object, 0, len(objs))
+	for _, u := range objs {
+		obj, err := s.New(u.GroupVersionKind())
+		if err != nil {
+			return nil, fmt.Errorf("%v %q: %v", u.GetKind(), u.GetName(), err)
+		}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+			return nil, fmt.Errorf("%v %q: %v", u.GetKind(), u.GetName(), err)
+		}
+		typed = append(typed, obj)
+	}
+	return typed, nil
+}
+
+// Render runs the operator's controllers against an in-memory client holding the given objects, until they stop
+// requeueing, and returns every object the operator manages with Secrets masked (see Mask). Objects that were given are
+// left out, apart from Namespaces. The Namespaces of the given objects and the user Secrets of their Databases are
+// created if they aren't given, since the operator expects them to exist. Warning Events, such as for missing parent
+// resources, are returned as warnings.
+func Render(s *runtime.Scheme, objects []runtime.Object) (rendered []*unstructured.Unstructured, warnings []string, err error) {
+	given := map[objectKey]bool{}
+	for _, obj := range objects {
+		key, err := keyOf(s, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		given[key] = true
+	}
+
+	prerequisites, err := prerequisites(s, objects, given)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := offline.NewClient(s, append(objects, prerequisites...)...)
+
+	recorder := record.NewFakeRecorder(100)
+	for pass := 1; ; pass++ {
+		if pass > maxPasses {
+			return nil, warnings, fmt.Errorf("controllers still requeueing after %d passes", maxPasses)
+		}
+
+		requeued := false
+		warnings = nil
+		for _, ctrl := range controllers {
+			r := ctrl.newReconciler(c, s, recorder)
+
+			list := ctrl.list.DeepCopyObject()
+			if err = c.List(context.TODO(), list); err != nil {
+				return nil, nil, err
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, item := range items {
+				accessor, err := meta.Accessor(item)
+				if err != nil {
+					return nil, nil, err
+				}
+				request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}}
+				result, err := r.Reconcile(request)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to reconcile %T %v: %v", item, request, err)
+				}
+				requeued = requeued || result.Requeue
+				warnings = append(warnings, warningEvents(recorder)...)
+			}
+		}
+		if !requeued {
+			break
+		}
+	}
+
+	for _, list := range childLists {
+		list = list.DeepCopyObject()
+		if err = c.List(context.TODO(), list); err != nil {
+			return nil, nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var objs []*unstructured.Unstructured
+		for _, item := range items {
+			key, err := keyOf(s, item)
+			if err != nil {
+				return nil, nil, err
+			}
+			if given[key] && key.Kind != "Namespace" {
+				continue
+			}
+
+			u, err := toUnstructured(s, item)
+			if err != nil {
+				return nil, nil, err
+			}
+			objs = append(objs, u)
+		}
+		sort.Slice(objs, func(i, j int) bool {
+			if objs[i].GetNamespace() != objs[j].GetNamespace() {
+				return objs[i].GetNamespace() < objs[j].GetNamespace()
+			}
+			return objs[i].GetName() < objs[j].GetName()
+		})
+		rendered = append(rendered, objs...)
+	}
+
+	// Given Secrets are included, since their values may appear in the rendered env-config
+	var secrets []*unstructured.Unstructured
+	for _, obj := range objects {
+		if _, ok := obj.(*corev1.Secret); ok {
+			u, err := toUnstructured(s, obj)
+			if err != nil {
+				return nil, nil, err
+			}
+			secrets = append(secrets, u)
+		}
+	}
+	if err = Mask(rendered, secrets...); err != nil {
+		return nil, nil, err
+	}
+	return rendered, warnings, nil
+}
+
+// prerequisites returns the Namespaces and Database user Secrets that the given objects need and don't include
+func prerequisites(s *runtime.Scheme, objects []runtime.Object, given map[objectKey]bool) (objs []runtime.Object, err error) {
+	added := map[objectKey]bool{}
+	add := func(obj runtime.Object) error {
+		key, err := keyOf(s, obj)
+		if err != nil {
+			return err
+		}
+		if !given[key] && !added[key] {
+			added[key] = true
+			objs = append(objs, obj)
+		}
+		return nil
+	}
+
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		if ns := accessor.GetNamespace(); ns != "" {
+			if err = add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil {
+				return nil, err
+			}
+		}
+
+		if db, ok := obj.(*fnv1alpha1.Database); ok {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: db.Namespace, Name: db.Spec.UserSecret},
+				Data:       map[string][]byte{"username": []byte(db.Spec.User), "password": []byte(placeholderPassword)},
+				Type:       corev1.SecretTypeOpaque,
+			}
+			if err = controllerutil.SetControllerReference(db, secret, s); err != nil {
+				return nil, err
+			}
+			if err = add(secret); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return objs, nil
+}
+
+// warningEvents drains the recorder, returning its Warning Events
+func warningEvents(recorder *record.FakeRecorder) (warnings []string) {
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.HasPrefix(event, corev1.EventTypeWarning+" ") {
+				warnings = append(warnings, strings.TrimPrefix(event, corev1.EventTypeWarning+" "))
+			}
+		default:
+			return
+		}
+	}
+}
+
+// objectKey identifies an object, regardless of its API version
+type objectKey struct {
+	schema.GroupKind
+	types.NamespacedName
+}
+
+func keyOf(s *runtime.Scheme, obj runtime.Object) (objectKey, error) {
+	gvk, err := apiutil.GVKForObject(obj, s)
+	if err != nil {
+		return objectKey{}, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return objectKey{}, err
+	}
+	return objectKey{
+		GroupKind:      gvk.GroupKind(),
+		NamespacedName: types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()},
+	}, nil
+}
+
+// toUnstructured converts a typed object, without the fields that only the in-memory client sets
+func toUnstructured(s *runtime.Scheme, obj runtime.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, s)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	clean(u)
+	return u, nil
+}
+
+// ToYAML writes objects as a stream of YAML documents.
+func ToYAML(w io.Writer, objs []*unstructured.Unstructured) error {
+	for _, u := range objs {
+		data, err := sigsyaml.Marshal(u.Object)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testNamespace = "wlgore"
+
+func findObject(objs []*unstructured.Unstructured, kind, name string) *unstructured.Unstructured {
+	for _, u := range objs {
+		if u.GetKind() == kind && u.GetName() == name {
+			return u
+		}
+	}
+	return nil
+}
+
+func TestRender(t *testing.T) {
+	s, err := Scheme()
+	require.NoError(t, err)
+
+	// Render the example custom resources
+	files, err := filepath.Glob("../../deploy/crds/fnresources.acquia.io_v1alpha1_*_cr.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	var objs []*unstructured.Unstructured
+	for _, file := range files {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		decoded, err := Decode(f)
+		f.Close()
+		require.NoError(t, err, file)
+		objs = append(objs, decoded...)
+	}
+	Default(objs, testNamespace)
+	typed, err := Typed(s, objs)
+	require.NoError(t, err)
+
+	rendered, _, err := Render(s, typed)
+	require.NoError(t, err)
+
+	for _, expected := range []struct{ kind, name string }{
+		{"Namespace", testNamespace},
+		{"ConfigMap", "wlgore-wil-prod-php-config"},
+		{"Service", "wlgore-wil-prod-drupal"},
+		{"Rollout", "wlgore-wil-prod-drupal"},
+		{"HorizontalPodAutoscaler", "wlgore-wil-prod-drupal"},
+		{"Ingress", "wlgore-site"},
+		{"Secret", "wlgore-wil-prod-env-config"},
+		{"Secret", "wlgore-user-secret"},
+	} {
+		require.NotNil(t, findObject(rendered, expected.kind, expected.name), "%v %q not rendered", expected.kind, expected.name)
+	}
+
+	// Custom resources aren't rendered
+	require.Nil(t, findObject(rendered, "DrupalEnvironment", "wlgore-wil-prod"))
+
+	// Secrets are masked
+	var out bytes.Buffer
+	require.NoError(t, ToYAML(&out, rendered))
+	require.NotContains(t, out.String(), placeholderPassword)
+	require.Contains(t, out.String(), "'password' => '"+masked+"'")
+}
+
+func TestMask(t *testing.T) {
+	secret := func(name string, data map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"namespace": testNamespace, "name": name},
+			"data":       data,
+		}}
+	}
+	owned := func(u *unstructured.Unstructured, kind, name string) *unstructured.Unstructured {
+		u.SetOwnerReferences([]metav1.OwnerReference{{Kind: kind, Name: name}})
+		return u
+	}
+
+	// "c2VjcmV0" is "secret", and the include file is "<?php $api_key = 'secret'; $db = ['password' => 'other'];"
+	userSecret := secret("user", map[string]interface{}{"password": "c2VjcmV0"})
+	envConfig := owned(secret("test-env-config", map[string]interface{}{
+		"site.settings.inc": "PD9waHAgJGFwaV9rZXkgPSAnc2VjcmV0JzsgJGRiID0gWydwYXNzd29yZCcgPT4gJ290aGVyJ107",
+	}), "DrupalEnvironment", "test")
+
+	require.NoError(t, Mask([]*unstructured.Unstructured{envConfig}, userSecret))
+	require.Equal(t, map[string]interface{}{
+		"site.settings.inc": "<?php $api_key = '" + masked + "'; $db = ['password' => '" + masked + "'];",
+	}, envConfig.Object["stringData"])
+	require.NotContains(t, envConfig.Object, "data")
+
+	require.NoError(t, Mask([]*unstructured.Unstructured{userSecret}))
+	require.Equal(t, map[string]interface{}{"password": masked}, userSecret.Object["stringData"])
+}
+
+func TestDiff(t *testing.T) {
+	configMap := func(value string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"namespace": testNamespace, "name": "test"},
+			"data":       map[string]interface{}{"key": value},
+		}}
+	}
+	rendered := []*unstructured.Unstructured{configMap("a")}
+
+	// Fields set by the API server or others aren't compared
+	live := configMap("a")
+	live.SetUID("a5e1b0c2-4b6e-4f6b-9f0e-6a3b7c2d1e0f")
+	live.SetResourceVersion("42")
+	live.SetAnnotations(map[string]string{"other": "value"})
+	live.Object["data"].(map[string]interface{})["other"] = "value"
+
+	var out bytes.Buffer
+	differs, err := Diff(&out, rendered, []*unstructured.Unstructured{live})
+	require.NoError(t, err)
+	require.False(t, differs)
+	require.Empty(t, out.String())
+
+	// Changed fields are diffed
+	live.Object["data"].(map[string]interface{})["key"] = "b"
+	differs, err = Diff(&out, rendered, []*unstructured.Unstructured{live})
+	require.NoError(t, err)
+	require.True(t, differs)
+	require.Contains(t, out.String(), "--- live/ConfigMap/wlgore/test\n+++ rendered/ConfigMap/wlgore/test\n")
+	require.Contains(t, out.String(), "\n-  key: b\n+  key: a\n")
+
+	// Missing objects are diffed against nothing
+	out.Reset()
+	differs, err = Diff(&out, rendered, nil)
+	require.NoError(t, err)
+	require.True(t, differs)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[3:] {
+		require.True(t, strings.HasPrefix(line, "+"), line)
+	}
+}
@@ -0,0 +1,34 @@
+package testhelpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/record"
+)
+
+// NewFakeRecorder returns an EventRecorder for tests, with a buffer large enough that recording never blocks during
+// a test's reconcile loops.
+func NewFakeRecorder() *record.FakeRecorder {
+	return record.NewFakeRecorder(1024)
+}
+
+// RequireEvent asserts that an Event with the given type and reason was recorded by a recorder from
+// NewFakeRecorder(). Events recorded before it are discarded.
+func RequireEvent(t *testing.T, recorder record.EventRecorder, eventType, reason string) {
+	fake, ok := recorder.(*record.FakeRecorder)
+	require.True(t, ok, "recorder is not a FakeRecorder")
+
+	for {
+		select {
+		case event := <-fake.Events:
+			if strings.HasPrefix(event, eventType+" "+reason+" ") {
+				return
+			}
+		default:
+			require.Failf(t, "Event not recorded", "%v %v", eventType, reason)
+			return
+		}
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	fnresources "github.com/acquia/fn-drupal-operator/pkg/apis"
+	"github.com/acquia/fn-drupal-operator/pkg/offline"
 	"github.com/acquia/fn-go-utils/pkg/testhelpers"
 )
 
@@ -26,5 +26,5 @@ func NewFakeClient(objects []runtime.Object) client.Client {
 		panic(err)
 	}
 
-	return fake.NewFakeClientWithScheme(scheme.Scheme, objects...)
+	return offline.NewClient(scheme.Scheme, objects...)
 }